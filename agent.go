@@ -3,6 +3,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
@@ -10,8 +11,10 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -20,18 +23,28 @@ import (
 type GenericAgent struct {
 	provider       LLMProvider
 	getUserMessage func() (string, bool)
-	tools          []ToolDefinition
+	tools          *ToolRegistry
 	verbose        bool
 	database       *ProjectDatabase
+
+	tracker         *WorkingTreeTracker // nil when working tree tracking is off
+	externalChanges []checkpointChange  // external edits not yet reported to the model
+
+	repoMap      string // repository map sent with the system prompt
+	repoMapValid bool   // false once a new turn starts or a tool changes files
 }
 
 // Global database instance
 var globalDB *ProjectDatabase
 
+// approveAction asks the user whether a risky action may run. When it is
+// nil, for example without an interactive session, such actions are refused.
+var approveAction func(description string) bool
+
 func NewGenericAgent(
 	provider LLMProvider,
 	getUserMessage func() (string, bool),
-	tools []ToolDefinition,
+	tools *ToolRegistry,
 	verbose bool,
 ) *GenericAgent {
 	return &GenericAgent{
@@ -40,14 +53,16 @@ func NewGenericAgent(
 		tools:          tools,
 		verbose:        verbose,
 		database:       globalDB,
+		tracker:        NewWorkingTreeTracker("."),
 	}
 }
 
 type APICallInput struct {
-	URL     string            `json:"url" jsonschema_description:"The URL to make the HTTP request to"`
-	Method  string            `json:"method" jsonschema_description:"HTTP method (GET, POST, PUT, DELETE, etc.)"`
-	Headers map[string]string `json:"headers,omitempty" jsonschema_description:"Optional headers as key-value pairs"`
-	Body    string            `json:"body,omitempty" jsonschema_description:"Optional request body"`
+	URL            string            `json:"url" jsonschema_description:"The URL to make the HTTP request to"`
+	Method         string            `json:"method" jsonschema_description:"HTTP method (GET, POST, PUT, DELETE, etc.)"`
+	Headers        map[string]string `json:"headers,omitempty" jsonschema_description:"Optional headers as key-value pairs. Reference secrets as ${env:NAME} instead of including them literally, e.g. {\"Authorization\": \"Bearer ${env:GITHUB_TOKEN}\"}. Only variables the user declared for the request's host can be referenced."`
+	Body           string            `json:"body,omitempty" jsonschema_description:"Optional request body"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" jsonschema_description:"Optional timeout in seconds (default 30, max 300)"`
 }
 
 var APICallInputSchema = GenerateSchema[APICallInput]()
@@ -58,36 +73,62 @@ func APICall(input json.RawMessage) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	req, err := http.NewRequest(apiInput.Method, apiInput.URL, strings.NewReader(apiInput.Body))
+	method := strings.ToUpper(apiInput.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	cfg := globalHTTPConfig
+	timeout := cfg.requestTimeout(apiInput.TimeoutSeconds)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var body io.Reader
+	if apiInput.Body != "" {
+		body = strings.NewReader(apiInput.Body)
+	}
+	req, err := newPolicyRequest(ctx, cfg, method, apiInput.URL, body, nil)
 	if err != nil {
 		return "", err
 	}
-	for k, v := range apiInput.Headers {
-		req.Header.Set(k, v)
+	for name, value := range apiInput.Headers {
+		expanded, err := cfg.expandSecretRefs(value, req.URL.Hostname())
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set(name, expanded)
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	log.Printf("api_call %s %s\n%s", method, req.URL.Redacted(), formatHeaders(req.Header))
+
+	resp, err := cfg.Client(timeout).Do(req)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+
+	data, truncated, err := readLimited(resp.Body, cfg.MaxResponseBytes)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to read response: %w", err)
 	}
-	return fmt.Sprintf("Status: %s\nBody: %s", resp.Status, string(body)), nil
+
+	return formatHTTPResponse(resp, data, truncated, cfg.MaxResponseBytes), nil
 }
 
 var APICallDefinition = ToolDefinition{
 	Name:        "api_call",
-	Description: "Make an HTTP request to a given URL. Supports GET, POST, PUT, DELETE, etc.",
+	Description: "Make an HTTP request to a given URL. Supports GET, POST, PUT, DELETE, etc. Returns the status, response headers and body (JSON is pretty-printed). Requests are subject to the host allow/deny policy, a timeout and a response size cap. Put credentials in headers as ${env:NAME} references.",
 	InputSchema: APICallInputSchema,
 	Function:    APICall,
 }
 
 type WebScraperInput struct {
-	URL      string `json:"url" jsonschema_description:"The URL to scrape"`
-	Selector string `json:"selector" jsonschema_description:"CSS selector to extract text from"`
+	URL            string `json:"url" jsonschema_description:"The URL to scrape"`
+	Selector       string `json:"selector,omitempty" jsonschema_description:"Optional CSS selector to restrict extraction to matching elements"`
+	Mode           string `json:"mode,omitempty" jsonschema_description:"Optional output mode: 'markdown' (readable page content as Markdown; default without a selector), 'text' (plain text of each match; default with a selector) or 'links' (absolute links with their text)"`
+	Attribute      string `json:"attribute,omitempty" jsonschema_description:"Optional attribute to return for each element matched by selector, e.g. 'href' or 'src'"`
+	MaxChars       int    `json:"max_chars,omitempty" jsonschema_description:"Optional cap on returned characters (default 40000)"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" jsonschema_description:"Optional timeout in seconds (default 30, max 300)"`
+	NoCache        bool   `json:"no_cache,omitempty" jsonschema_description:"Optional. Fetch the page again instead of using a cached copy from the last 15 minutes"`
 }
 
 var WebScraperInputSchema = GenerateSchema[WebScraperInput]()
@@ -98,25 +139,105 @@ func WebScraper(input json.RawMessage) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	resp, err := http.Get(scraperInput.URL)
-	if err != nil {
-		return "", err
+	mode := scraperInput.Mode
+	if mode == "" {
+		mode = "markdown"
+		if scraperInput.Selector != "" {
+			mode = "text"
+		}
 	}
-	defer resp.Body.Close()
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if mode != "markdown" && mode != "text" && mode != "links" {
+		return "", fmt.Errorf("unknown mode %q; use markdown, text or links", mode)
+	}
+	if scraperInput.Attribute != "" && scraperInput.Selector == "" {
+		return "", fmt.Errorf("attribute requires a selector")
+	}
+
+	page, cached, err := fetchPage(scraperInput.URL, scraperInput.TimeoutSeconds, !scraperInput.NoCache)
 	if err != nil {
 		return "", err
 	}
-	var result strings.Builder
-	doc.Find(scraperInput.Selector).Each(func(i int, s *goquery.Selection) {
-		result.WriteString(s.Text() + "\n")
-	})
-	return result.String(), nil
+
+	var result string
+	if !page.isHTML() {
+		if scraperInput.Selector != "" || mode == "links" {
+			return "", fmt.Errorf("%s is %s, not HTML", scraperInput.URL, page.ContentType)
+		}
+		result = formatResponseBody(page.ContentType, page.Body)
+	} else {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page.Body))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse HTML: %w", err)
+		}
+		base, _ := url.Parse(page.FinalURL)
+		if href, ok := doc.Find("base[href]").Attr("href"); ok && base != nil {
+			if ref, err := url.Parse(href); err == nil {
+				base = base.ResolveReference(ref)
+			}
+		}
+
+		selection := doc.Selection
+		if scraperInput.Selector != "" {
+			selection = doc.Find(scraperInput.Selector)
+			if selection.Length() == 0 {
+				return fmt.Sprintf("No elements match selector %q", scraperInput.Selector), nil
+			}
+		}
+
+		switch {
+		case scraperInput.Attribute != "":
+			var sb strings.Builder
+			selection.Each(func(i int, s *goquery.Selection) {
+				if value, ok := s.Attr(scraperInput.Attribute); ok {
+					if scraperInput.Attribute == "href" || scraperInput.Attribute == "src" {
+						value = resolveLink(base, value)
+					}
+					sb.WriteString(value + "\n")
+				}
+			})
+			result = sb.String()
+		case mode == "links":
+			result = pageLinks(selection, base)
+		case mode == "text":
+			var sb strings.Builder
+			selection.Each(func(i int, s *goquery.Selection) {
+				sb.WriteString(collapseBlankLines(s.Text()) + "\n")
+			})
+			result = sb.String()
+		default:
+			if scraperInput.Selector == "" {
+				selection = readableContent(doc)
+			}
+			title := strings.TrimSpace(doc.Find("title").First().Text())
+			result = htmlToMarkdown(selection, base)
+			if title != "" {
+				result = "Title: " + title + "\n\n" + result
+			}
+		}
+	}
+
+	result = collapseBlankLines(result)
+	header := "URL: " + page.FinalURL
+	if cached {
+		header += fmt.Sprintf(" (cached %s ago)", time.Since(page.FetchedAt).Round(time.Second))
+	}
+	if page.Truncated {
+		header += fmt.Sprintf("\n[page truncated at %d bytes]", webMaxPageBytes)
+	}
+
+	maxChars := scraperInput.MaxChars
+	if maxChars <= 0 {
+		maxChars = webDefaultMaxChars
+	}
+	if len(result) > maxChars {
+		result = truncateUTF8(result, maxChars) + fmt.Sprintf("\n\n[output truncated at %d characters; use a selector or raise max_chars]", maxChars)
+	}
+	return header + "\n\n" + result, nil
 }
 
 var WebScraperDefinition = ToolDefinition{
 	Name:        "web_scraper",
-	Description: "Scrape text from a webpage using a CSS selector.",
+	Description: "Fetch a webpage and extract its content: readable Markdown of the main content (headings, links, code blocks, tables), plain text or attribute values of elements matching a CSS selector, or the page's links. Pages are size-limited and cached on disk for 15 minutes.",
 	InputSchema: WebScraperInputSchema,
 	Function:    WebScraper,
 }
@@ -153,89 +274,6 @@ var SaveToDatabaseDefinition = ToolDefinition{
 	Function:    SaveToDatabase,
 }
 
-type CreateCheckpointInput struct {
-	Name        string `json:"name" jsonschema_description:"Name of the checkpoint"`
-	Description string `json:"description" jsonschema_description:"Description of the checkpoint"`
-}
-
-var CreateCheckpointInputSchema = GenerateSchema[CreateCheckpointInput]()
-
-func CreateCheckpoint(input json.RawMessage) (string, error) {
-	var cpInput CreateCheckpointInput
-	if err := json.Unmarshal(input, &cpInput); err != nil {
-		return "", fmt.Errorf("failed to parse input: %w", err)
-	}
-
-	if globalDB != nil {
-		checkpoint, err := globalDB.CreateCheckpoint(cpInput.Name, cpInput.Description)
-		if err != nil {
-			return "", fmt.Errorf("failed to create checkpoint: %w", err)
-		}
-		return fmt.Sprintf("Successfully created checkpoint '%s' with ID %d", checkpoint.Name, checkpoint.ID), nil
-	}
-
-	return "", fmt.Errorf("database not initialized")
-}
-
-var CreateCheckpointDefinition = ToolDefinition{
-	Name:        "create_checkpoint",
-	Description: "Create a checkpoint (snapshot) of the current project state.",
-	InputSchema: CreateCheckpointInputSchema,
-	Function:    CreateCheckpoint,
-}
-
-type RestoreCheckpointInput struct {
-	CheckpointID int `json:"checkpoint_id" jsonschema_description:"ID of the checkpoint to restore"`
-}
-
-var RestoreCheckpointInputSchema = GenerateSchema[RestoreCheckpointInput]()
-
-func RestoreCheckpoint(input json.RawMessage) (string, error) {
-	var cpInput RestoreCheckpointInput
-	if err := json.Unmarshal(input, &cpInput); err != nil {
-		return "", fmt.Errorf("failed to parse input: %w", err)
-	}
-
-	// Checkpoint restoration not implemented for file-based storage
-	return "", fmt.Errorf("checkpoint restoration is not implemented for file-based storage")
-}
-
-var RestoreCheckpointDefinition = ToolDefinition{
-	Name:        "restore_checkpoint",
-	Description: "Restore project to a previous checkpoint state.",
-	InputSchema: RestoreCheckpointInputSchema,
-	Function:    RestoreCheckpoint,
-}
-
-type ListCheckpointsInput struct{}
-
-var ListCheckpointsInputSchema = GenerateSchema[ListCheckpointsInput]()
-
-func ListCheckpoints(input json.RawMessage) (string, error) {
-	if globalDB != nil {
-		checkpoints, err := globalDB.ListCheckpoints()
-		if err != nil {
-			return "", fmt.Errorf("failed to list checkpoints: %w", err)
-		}
-
-		result := "Available Checkpoints:\n"
-		for _, cp := range checkpoints {
-			result += fmt.Sprintf("- ID: %d, Name: %s, Description: %s, Files: %d, Time: %s\n",
-				cp.ID, cp.Name, cp.Description, cp.FileCount, cp.Timestamp.Format("2006-01-02 15:04:05"))
-		}
-		return result, nil
-	}
-
-	return "", fmt.Errorf("database not initialized")
-}
-
-var ListCheckpointsDefinition = ToolDefinition{
-	Name:        "list_checkpoints",
-	Description: "List all available project checkpoints.",
-	InputSchema: ListCheckpointsInputSchema,
-	Function:    ListCheckpoints,
-}
-
 type MCPIntegrationInput struct {
 	Name      string `json:"name" jsonschema_description:"Name of the MCP integration"`
 	Endpoint  string `json:"endpoint" jsonschema_description:"MCP server endpoint URL"`
@@ -317,40 +355,11 @@ var RecordMultiplayerActionDefinition = ToolDefinition{
 	Function:    RecordMultiplayerAction,
 }
 
-type BackupProjectInput struct {
-	Path string `json:"path" jsonschema_description:"Path where to save the backup file"`
-}
-
-var BackupProjectInputSchema = GenerateSchema[BackupProjectInput]()
-
-func BackupProject(input json.RawMessage) (string, error) {
-	var backupInput BackupProjectInput
-	if err := json.Unmarshal(input, &backupInput); err != nil {
-		return "", fmt.Errorf("failed to parse input: %w", err)
-	}
-
-	if globalDB != nil {
-		if err := globalDB.BackupProject(backupInput.Path); err != nil {
-			return "", fmt.Errorf("failed to backup project: %w", err)
-		}
-		return fmt.Sprintf("Successfully backed up project to '%s'", backupInput.Path), nil
-	}
-
-	return "", fmt.Errorf("database not initialized")
-}
-
-var BackupProjectDefinition = ToolDefinition{
-	Name:        "backup_project",
-	Description: "Create a full backup of the project including all files and checkpoints.",
-	InputSchema: BackupProjectInputSchema,
-	Function:    BackupProject,
-}
-
 func (a *GenericAgent) Run(ctx context.Context) error {
 	conversation := []Message{}
 
 	// Load conversation from file
-	if data, err := os.ReadFile("conversation.json"); err == nil {
+	if data, err := os.ReadFile(conversationFile); err == nil {
 		json.Unmarshal(data, &conversation)
 	}
 
@@ -371,6 +380,8 @@ func (a *GenericAgent) Run(ctx context.Context) error {
 	}
 	fmt.Printf("🤖 EVE with %s (use 'ctrl-c' to quit)\n", a.provider.Name())
 	fmt.Println("💡 Try: 'Read the riddle.txt file and solve the puzzle'")
+	a.startTracking()
+	a.maintainDatabase()
 	fmt.Println()
 
 	for {
@@ -395,10 +406,20 @@ func (a *GenericAgent) Run(ctx context.Context) error {
 			log.Printf("User input received: %q", userInput)
 		}
 
+		// Slash commands are handled locally and never reach the provider
+		if a.handleCommand(userInput) {
+			// Commands such as /undo change files too; keep them from being reported as external edits
+			a.syncWorkingTree(strings.Fields(userInput)[0])
+			continue
+		}
+
+		// Files may have changed outside EVE since the last turn
+		a.repoMapValid = false
+
 		// Add user message to conversation
 		userMessage := Message{
 			Role:    "user",
-			Content: userInput,
+			Content: a.withExternalChanges(userInput),
 		}
 		conversation = append(conversation, userMessage)
 
@@ -407,7 +428,7 @@ func (a *GenericAgent) Run(ctx context.Context) error {
 		}
 
 		// Get response from provider
-		response, err := a.provider.SendMessage(ctx, conversation, a.tools)
+		response, err := a.provider.SendMessage(ctx, a.withSystemPrompt(conversation), a.tools.Tools())
 		if err != nil {
 			if a.verbose {
 				log.Printf("Error during inference: %v", err)
@@ -438,31 +459,28 @@ func (a *GenericAgent) Run(ctx context.Context) error {
 				// Find and execute the tool
 				var toolResult string
 				var toolError error
-				var toolFound bool
-				for _, tool := range a.tools {
-					if tool.Name == toolUse.Name {
-						if a.verbose {
-							log.Printf("Executing tool: %s", tool.Name)
-						}
-						toolResult, toolError = tool.Function(toolUse.Input)
-						fmt.Printf("\u001b[92mresult\u001b[0m: %s\n", toolResult)
+				tool, toolFound := a.tools.Lookup(toolUse.Name)
+				if toolFound {
+					if a.verbose {
+						log.Printf("Executing tool: %s", tool.Name)
+					}
+					toolResult, toolError = tool.Function(toolUse.Input)
+					a.syncAfterTool(tool.Name)
+					fmt.Printf("\u001b[92mresult\u001b[0m: %s\n", toolResult)
+					if toolError != nil {
+						fmt.Printf("\u001b[91merror\u001b[0m: %s\n", toolError.Error())
+					}
+					if a.verbose {
 						if toolError != nil {
-							fmt.Printf("\u001b[91merror\u001b[0m: %s\n", toolError.Error())
-						}
-						if a.verbose {
-							if toolError != nil {
-								log.Printf("Tool execution failed: %v", toolError)
-							} else {
-								log.Printf("Tool execution successful, result length: %d chars", len(toolResult))
-							}
+							log.Printf("Tool execution failed: %v", toolError)
+						} else {
+							log.Printf("Tool execution successful, result length: %d chars", len(toolResult))
 						}
-						toolFound = true
-						break
 					}
 				}
 
 				if !toolFound {
-					toolError = fmt.Errorf("tool '%s' not found", toolUse.Name)
+					toolError = fmt.Errorf("tool '%s' not found or disabled", toolUse.Name)
 					fmt.Printf("\u001b[91merror\u001b[0m: %s\n", toolError.Error())
 				}
 
@@ -508,7 +526,7 @@ func (a *GenericAgent) Run(ctx context.Context) error {
 			conversation = append(conversation, toolResultMessage)
 
 			// Get the provider's response after tool execution
-			followupResponse, err := a.provider.SendMessage(ctx, conversation, a.tools)
+			followupResponse, err := a.provider.SendMessage(ctx, a.withSystemPrompt(conversation), a.tools.Tools())
 			if err != nil {
 				if a.verbose {
 					log.Printf("Error during followup inference: %v", err)
@@ -542,7 +560,7 @@ func (a *GenericAgent) Run(ctx context.Context) error {
 
 	// Save conversation to file
 	data, _ := json.Marshal(conversation)
-	os.WriteFile("conversation.json", data, 0644)
+	os.WriteFile(conversationFile, data, 0644)
 
 	return nil
 }
@@ -580,6 +598,18 @@ func main() {
 		defer db.Close()
 	}
 
+	// Subcommands such as `eve checkpoint list` work on the project without a provider
+	if flag.NArg() > 0 {
+		if err := runSubcommand(flag.Args()); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			if globalDB != nil {
+				globalDB.Close()
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Load configuration
 	config, err := NewConfigFromEnv()
 	if err != nil {
@@ -596,6 +626,8 @@ func main() {
 		os.Exit(1)
 	}
 
+	globalHTTPConfig = config.HTTP
+
 	// Create provider
 	provider, err := config.CreateProvider()
 	if err != nil {
@@ -617,30 +649,42 @@ func main() {
 		}
 		return scanner.Text(), true
 	}
+	approveAction = func(description string) bool {
+		fmt.Printf("\u001b[91m⚠️  %s\u001b[0m\nAllow? [y/N]: ", description)
+		if !scanner.Scan() {
+			return false
+		}
+		answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		return answer == "y" || answer == "yes"
+	}
+
+	// Register the built-in and project-specific tools
+	registry := NewToolRegistry()
+	if err := registerBuiltinTools(registry); err != nil {
+		fmt.Printf("Tool registration error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	customTools, err := LoadCustomTools(customToolsPath(), registry)
+	if err != nil {
+		fmt.Printf("Custom tools error: %s\n", err.Error())
+	} else if len(customTools) > 0 {
+		if err := registry.Register("custom", CategoryCustom, customTools...); err != nil {
+			fmt.Printf("Custom tools error: %s\n", err.Error())
+		} else if *verbose {
+			log.Printf("Loaded %d custom tools: %s", len(customTools), customToolNames(customTools))
+		}
+	}
 
-	// Define tools with database integration
-	tools := []ToolDefinition{
-		ReadFileDefinition,
-		ListFilesDefinition,
-		BashDefinition,
-		EditFileDefinition,
-		CodeSearchDefinition,
-		APICallDefinition,
-		WebScraperDefinition,
-		SaveToDatabaseDefinition,
-		CreateCheckpointDefinition,
-		RestoreCheckpointDefinition,
-		ListCheckpointsDefinition,
-		AddMCPIntegrationDefinition,
-		RecordMultiplayerActionDefinition,
-		BackupProjectDefinition,
+	if err := registry.Configure(config.Tools); err != nil {
+		fmt.Printf("Tool configuration error: %s\n", err.Error())
 	}
 
 	if *verbose {
-		log.Printf("Initialized %d tools", len(tools))
+		log.Printf("Initialized %d tools (%d enabled)", len(registry.Definitions()), len(registry.Tools()))
 	}
 
-	agent := NewGenericAgent(provider, getUserMessage, tools, *verbose)
+	agent := NewGenericAgent(provider, getUserMessage, registry, *verbose)
 	err = agent.Run(context.TODO())
 	if err != nil {
 		fmt.Printf("Error: %s\n", err.Error())
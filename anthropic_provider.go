@@ -51,9 +51,14 @@ func (p *AnthropicProvider) AvailableModels() []string {
 func (p *AnthropicProvider) SendMessage(ctx context.Context, conversation []Message, tools []ToolDefinition) (*LLMResponse, error) {
 	// Convert our generic messages to Anthropic format
 	var anthropicMessages []anthropic.MessageParam
+	var system []anthropic.TextBlockParam
 
 	for _, msg := range conversation {
 		switch msg.Role {
+		case "system":
+			if content, ok := msg.Content.(string); ok {
+				system = append(system, anthropic.TextBlockParam{Text: content})
+			}
 		case "user":
 			if content, ok := msg.Content.(string); ok {
 				anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(anthropic.NewTextBlock(content)))
@@ -115,6 +120,7 @@ func (p *AnthropicProvider) SendMessage(ctx context.Context, conversation []Mess
 	message, err := p.client.Messages.New(ctx, anthropic.MessageNewParams{
 		Model:     anthropic.Model(p.model),
 		MaxTokens: int64(1024),
+		System:    system,
 		Messages:  anthropicMessages,
 		Tools:     anthropicTools,
 	})
@@ -0,0 +1,450 @@
+// backup.go - Portable tar.gz backups of the project database with manifest and checksums
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupFormat       = 1
+	backupManifestName = "manifest.json"
+	backupProjectDir   = "project"
+	backupSessionDir   = "session"
+
+	// backupCheckpointBundle holds the commits of checkpoints stored in git
+	backupCheckpointBundle = "git/checkpoints.bundle"
+
+	// backupPreviousSuffix names the project data moved aside by a restore
+	backupPreviousSuffix = ".before-restore-"
+)
+
+// conversationFile is where the chat session is persisted between runs
+const conversationFile = "conversation.json"
+
+// backupSkippedDirs hold caches that are rebuilt on demand and are not worth archiving
+var backupSkippedDirs = map[string]bool{
+	"embeddings": true,
+	"web_cache":  true,
+}
+
+// BackupManifest lists every file in a backup with its checksum. It is the
+// last entry of the archive so checksums can be computed while writing.
+type BackupManifest struct {
+	Format    int           `json:"format"`
+	CreatedAt time.Time     `json:"created_at"`
+	Entries   []BackupEntry `json:"entries"`
+}
+
+// BackupEntry is one archived file
+type BackupEntry struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   os.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256"`
+}
+
+// BackupProject writes the project data (files, checkpoints, blobs, edit
+// history, MCP integrations, multiplayer sessions), the commits of
+// checkpoints stored in git and the saved conversation to a tar.gz archive
+// at backupPath.
+func (pdb *ProjectDatabase) BackupProject(backupPath string) error {
+	if backupPath == "" {
+		return fmt.Errorf("backup path is required")
+	}
+	absBackup, err := filepath.Abs(backupPath)
+	if err != nil {
+		return err
+	}
+	absProject, err := filepath.Abs(pdb.projectDir)
+	if err != nil {
+		return err
+	}
+	if absBackup == absProject || strings.HasPrefix(absBackup, absProject+string(filepath.Separator)) {
+		return fmt.Errorf("backup cannot be written inside the project data directory %s", pdb.projectDir)
+	}
+
+	if dir := filepath.Dir(backupPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create backup directory: %w", err)
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(backupPath), "."+filepath.Base(backupPath)+".eve-tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	success := false
+	defer func() {
+		if !success {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	manifest := &BackupManifest{Format: backupFormat, CreatedAt: time.Now()}
+
+	// The backend is held still while its files are archived, so writers in
+	// this or another process cannot leave a torn copy
+	pdb.mu.RLock()
+	err = pdb.store.Snapshot(func(replacements map[string]string) error {
+		return filepath.WalkDir(pdb.projectDir, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(pdb.projectDir, filePath)
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if backupSkippedDirs[rel] || strings.Contains(d.Name(), ".eve-tmp-") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || strings.Contains(d.Name(), ".eve-tmp-") || d.Name() == fileStoreLockName {
+				return nil
+			}
+			source := filePath
+			if replacement, ok := replacements[filepath.ToSlash(rel)]; ok {
+				if replacement == "" {
+					return nil
+				}
+				source = replacement
+			}
+			return addBackupFile(tw, manifest, path.Join(backupProjectDir, filepath.ToSlash(rel)), source)
+		})
+	})
+	pdb.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to archive project data: %w", err)
+	}
+
+	if err := addCheckpointBundle(tw, manifest); err != nil {
+		return fmt.Errorf("failed to archive git checkpoints: %w", err)
+	}
+
+	if _, err := os.Stat(conversationFile); err == nil {
+		if err := addBackupFile(tw, manifest, path.Join(backupSessionDir, conversationFile), conversationFile); err != nil {
+			return fmt.Errorf("failed to archive conversation: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: backupManifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish compression: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), backupPath); err != nil {
+		return fmt.Errorf("failed to write %s: %w", backupPath, err)
+	}
+
+	success = true
+	return nil
+}
+
+// addBackupFile copies one file into the archive and records its checksum
+func addBackupFile(tw *tar.Writer, manifest *BackupManifest, name, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, hash), file, info.Size()); err != nil {
+		return fmt.Errorf("failed to read %s (was it modified during the backup?): %w", filePath, err)
+	}
+	manifest.Entries = append(manifest.Entries, BackupEntry{
+		Path:   name,
+		Size:   info.Size(),
+		Mode:   info.Mode().Perm(),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+// addCheckpointBundle archives a git bundle of the checkpoint refs, if
+// there are any
+func addCheckpointBundle(tw *tar.Writer, manifest *BackupManifest) error {
+	tmp, err := os.MkdirTemp("", "eve-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	bundlePath := filepath.Join(tmp, path.Base(backupCheckpointBundle))
+	found, err := bundleGitCheckpoints(bundlePath)
+	if err != nil || !found {
+		return err
+	}
+	return addBackupFile(tw, manifest, backupCheckpointBundle, bundlePath)
+}
+
+// validBackupPath reports whether an archive entry name is safe to extract
+func validBackupPath(name string) bool {
+	if name == backupManifestName {
+		return true
+	}
+	if path.IsAbs(name) || path.Clean(name) != name || strings.HasPrefix(name, "../") || strings.Contains(name, "\\") {
+		return false
+	}
+	return strings.HasPrefix(name, backupProjectDir+"/") || name == path.Join(backupSessionDir, conversationFile) || name == backupCheckpointBundle
+}
+
+// readBackup reads and verifies an archive. Every entry is checked against
+// the manifest; files missing from either side, size or checksum mismatches
+// and unsafe paths are errors. Files are extracted into destDir when it is set.
+func readBackup(backupPath, destDir string) (*BackupManifest, error) {
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a gzip archive: %w", backupPath, err)
+	}
+	defer gz.Close()
+
+	var manifest *BackupManifest
+	found := map[string]BackupEntry{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("backup is truncated or corrupt: %w", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg || !validBackupPath(header.Name) {
+			return nil, fmt.Errorf("backup contains an unexpected entry %q", header.Name)
+		}
+		if _, ok := found[header.Name]; ok {
+			return nil, fmt.Errorf("backup contains %q twice", header.Name)
+		}
+
+		if header.Name == backupManifestName {
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("backup manifest is corrupt: %w", err)
+			}
+			found[header.Name] = BackupEntry{}
+			continue
+		}
+
+		var out io.Writer = io.Discard
+		if destDir != "" {
+			target := filepath.Join(destDir, filepath.FromSlash(header.Name))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return nil, err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, os.FileMode(header.Mode).Perm()|0600)
+			if err != nil {
+				return nil, err
+			}
+			out = f
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(out, hash), tr)
+		if f, ok := out.(*os.File); ok {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("backup is truncated or corrupt at %s: %w", header.Name, err)
+		}
+		found[header.Name] = BackupEntry{Path: header.Name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("backup has no manifest")
+	}
+	if manifest.Format != backupFormat {
+		return nil, fmt.Errorf("unsupported backup format %d", manifest.Format)
+	}
+
+	var problems []string
+	listed := map[string]bool{backupManifestName: true}
+	for _, entry := range manifest.Entries {
+		listed[entry.Path] = true
+		got, ok := found[entry.Path]
+		switch {
+		case !ok:
+			problems = append(problems, "missing "+entry.Path)
+		case got.Size != entry.Size || got.SHA256 != entry.SHA256:
+			problems = append(problems, "checksum mismatch for "+entry.Path)
+		}
+	}
+	for name := range found {
+		if !listed[name] {
+			problems = append(problems, "unlisted "+name)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("backup failed verification: %s", strings.Join(problems, ", "))
+	}
+	return manifest, nil
+}
+
+// VerifyBackup checks an archive without extracting it
+func VerifyBackup(backupPath string) (*BackupManifest, error) {
+	return readBackup(backupPath, "")
+}
+
+// RestoreProject replaces the project data and saved conversation with the
+// contents of a backup, and fetches the commits of git checkpoints back into
+// the repository. The archive is fully extracted and verified before
+// anything is replaced, so a damaged backup never leaves a partial restore.
+// The previous project data is kept next to it as <dir>.before-restore-<time>.
+func (pdb *ProjectDatabase) RestoreProject(backupPath string) error {
+	parent := filepath.Dir(filepath.Clean(pdb.projectDir))
+	staging, err := os.MkdirTemp(parent, ".eve-restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if _, err := readBackup(backupPath, staging); err != nil {
+		return err
+	}
+
+	stagedProject := filepath.Join(staging, backupProjectDir)
+	if err := os.MkdirAll(stagedProject, 0755); err != nil {
+		return err
+	}
+
+	// Git checkpoints are restored last, so check up front that they can be
+	stagedBundle := filepath.Join(staging, filepath.FromSlash(backupCheckpointBundle))
+	_, err = os.Stat(stagedBundle)
+	hasBundle := err == nil
+	if hasBundle {
+		if err := verifyGitCheckpointBundle(stagedBundle); err != nil {
+			return err
+		}
+	}
+
+	// The storage backend is closed while its directory is swapped and then
+	// reopened on whichever directory ends up in place
+	previous := filepath.Clean(pdb.projectDir) + backupPreviousSuffix + time.Now().Format("20060102-150405")
+	err = pdb.swapStore(func() error {
+		err := os.Rename(pdb.projectDir, previous)
+		if err == nil || os.IsNotExist(err) {
+			if err = os.Rename(stagedProject, pdb.projectDir); err != nil {
+				os.Rename(previous, pdb.projectDir)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move restored project data into place: %w", err)
+	}
+
+	stagedConversation := filepath.Join(staging, backupSessionDir, conversationFile)
+	if data, err := os.ReadFile(stagedConversation); err == nil {
+		if current, err := os.ReadFile(conversationFile); err == nil {
+			if err := os.WriteFile(filepath.Join(previous, conversationFile), current, 0644); err != nil {
+				return fmt.Errorf("project data restored but the current conversation could not be kept: %w", err)
+			}
+		}
+		if err := writeFileAtomic(conversationFile, data, 0644); err != nil {
+			return fmt.Errorf("project data restored but the conversation could not be: %w", err)
+		}
+	}
+
+	if hasBundle {
+		if err := unbundleGitCheckpoints(stagedBundle); err != nil {
+			return fmt.Errorf("project data restored but the git checkpoints could not be: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type BackupProjectInput struct {
+	Path string `json:"path" jsonschema_description:"Path where to save the backup file (.tar.gz)"`
+}
+
+var BackupProjectInputSchema = GenerateSchema[BackupProjectInput]()
+
+func BackupProject(input json.RawMessage) (string, error) {
+	var backupInput BackupProjectInput
+	if err := json.Unmarshal(input, &backupInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	if globalDB != nil {
+		if err := globalDB.BackupProject(backupInput.Path); err != nil {
+			return "", fmt.Errorf("failed to backup project: %w", err)
+		}
+		manifest, err := VerifyBackup(backupInput.Path)
+		if err != nil {
+			return "", fmt.Errorf("backup written but failed verification: %w", err)
+		}
+		return fmt.Sprintf("Successfully backed up project to '%s' (%d files)", backupInput.Path, len(manifest.Entries)), nil
+	}
+
+	return "", fmt.Errorf("database not initialized")
+}
+
+var BackupProjectDefinition = ToolDefinition{
+	Name:        "backup_project",
+	Description: "Create a full backup of the project data (tracked files, checkpoints including those stored in git, edit history, MCP integrations and sessions) as a verified tar.gz archive.",
+	InputSchema: BackupProjectInputSchema,
+	Function:    BackupProject,
+}
@@ -0,0 +1,295 @@
+// backup_test.go - Backup archive verification and restore tests
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBackupEntry is one entry of a hand-built archive
+type testBackupEntry struct {
+	name     string
+	body     string
+	typeflag byte   // tar.TypeReg if zero
+	link     string // target of symlink entries
+	unlisted bool   // left out of the manifest
+	checksum string // manifest checksum, if it should not match body
+}
+
+// writeTestBackup writes an archive of entries followed by their manifest
+func writeTestBackup(t *testing.T, backupPath string, entries []testBackupEntry) {
+	t.Helper()
+	file, err := os.Create(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	manifest := &BackupManifest{Format: backupFormat, CreatedAt: time.Now()}
+	for _, entry := range entries {
+		typeflag := entry.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.body)), Typeflag: typeflag, Linkname: entry.link}
+		if typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if entry.unlisted {
+			continue
+		}
+		sum := sha256.Sum256([]byte(entry.body))
+		checksum := hex.EncodeToString(sum[:])
+		if entry.checksum != "" {
+			checksum = entry.checksum
+		}
+		manifest.Entries = append(manifest.Entries, BackupEntry{Path: entry.name, Size: int64(len(entry.body)), Mode: 0644, SHA256: checksum})
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: backupManifestName, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidBackupPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{backupManifestName, true},
+		{"project/files/1.json", true},
+		{"session/conversation.json", true},
+		{backupCheckpointBundle, true},
+		{"git/other.bundle", false},
+		{"../project/x", false},
+		{"project/../../x", false},
+		{"project/./x", false},
+		{"/project/x", false},
+		{`project\..\x`, false},
+		{"session/other.json", false},
+		{"elsewhere/x", false},
+	}
+	for _, tt := range tests {
+		if got := validBackupPath(tt.name); got != tt.want {
+			t.Errorf("validBackupPath(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadBackupRejectsUnsafeArchives(t *testing.T) {
+	valid := testBackupEntry{name: "project/state/redo.json", body: "[]"}
+	tests := []struct {
+		name    string
+		entries []testBackupEntry
+		want    string
+	}{
+		{"parent path", []testBackupEntry{valid, {name: "../evil", body: "x"}}, "unexpected entry"},
+		{"nested parent path", []testBackupEntry{{name: "project/../../evil", body: "x"}}, "unexpected entry"},
+		{"absolute path", []testBackupEntry{{name: "/tmp/evil", body: "x"}}, "unexpected entry"},
+		{"symlink", []testBackupEntry{valid, {name: "project/link", typeflag: tar.TypeSymlink, link: "/etc/passwd"}}, "unexpected entry"},
+		{"hard link", []testBackupEntry{{name: "project/link", typeflag: tar.TypeLink, link: "project/state/redo.json"}}, "unexpected entry"},
+		{"unlisted entry", []testBackupEntry{valid, {name: "project/extra.json", body: "{}", unlisted: true}}, "unlisted project/extra.json"},
+		{"checksum mismatch", []testBackupEntry{{name: "project/state/redo.json", body: "[]", checksum: strings.Repeat("0", 64)}}, "checksum mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			backupPath := filepath.Join(dir, "backup.tar.gz")
+			writeTestBackup(t, backupPath, tt.entries)
+
+			dest := filepath.Join(dir, "dest")
+			_, err := readBackup(backupPath, dest)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("readBackup error = %v, want %q", err, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil")); err == nil {
+				t.Fatal("entry was extracted outside the destination")
+			}
+		})
+	}
+}
+
+func TestRestoreProjectFailureKeepsProjectData(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	pdb := openTestDatabase(t, StorageFile, filepath.Join(dir, "data"))
+	defer pdb.Close()
+	if err := pdb.RecordEdit(&EditHistory{Path: "a.txt", Operation: "create", Tool: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	backupPath := filepath.Join(dir, "bad.tar.gz")
+	writeTestBackup(t, backupPath, []testBackupEntry{
+		{name: "project/edits/1.json", body: "{}"},
+		{name: "project/edits/2.json", body: "{}", checksum: strings.Repeat("0", 64)},
+	})
+	if err := pdb.RestoreProject(backupPath); err == nil {
+		t.Fatal("restore of a corrupt backup succeeded")
+	}
+
+	checkEdits(t, pdb, 1)
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+backupPreviousSuffix+"*"))
+	if len(matches) > 0 {
+		t.Fatalf("project data was moved aside: %v", matches)
+	}
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			pdb := openTestDatabase(t, backend, filepath.Join(dir, "data"))
+			defer pdb.Close()
+			if err := os.WriteFile(conversationFile, []byte(`["before"]`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := pdb.RecordEdit(&EditHistory{Path: "a.txt", Operation: "create", Tool: "test"}); err != nil {
+				t.Fatal(err)
+			}
+
+			backupPath := filepath.Join(dir, "backup.tar.gz")
+			if err := pdb.BackupProject(backupPath); err != nil {
+				t.Fatalf("BackupProject: %v", err)
+			}
+			if _, err := VerifyBackup(backupPath); err != nil {
+				t.Fatalf("VerifyBackup: %v", err)
+			}
+
+			if err := pdb.RecordEdit(&EditHistory{Path: "b.txt", Operation: "create", Tool: "test"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(conversationFile, []byte(`["after"]`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := pdb.RestoreProject(backupPath); err != nil {
+				t.Fatalf("RestoreProject: %v", err)
+			}
+
+			checkEdits(t, pdb, 1)
+			checkTestFile(t, conversationFile, `["before"]`)
+		})
+	}
+}
+
+func TestBackupRestoreGitCheckpoints(t *testing.T) {
+	source := t.TempDir()
+	t.Chdir(source)
+	if _, err := runGit("init", "-q"); err != nil {
+		t.Skipf("git is not available: %v", err)
+	}
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	useTestDatabase(t, pdb)
+	writeTestFile(t, "a.txt", "checkpointed\n")
+	checkpoint, err := createGitCheckpoint("before", "test checkpoint")
+	if err != nil {
+		t.Fatalf("createGitCheckpoint: %v", err)
+	}
+
+	backupPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := pdb.BackupProject(backupPath); err != nil {
+		t.Fatalf("BackupProject: %v", err)
+	}
+	manifest, err := VerifyBackup(backupPath)
+	if err != nil {
+		t.Fatalf("VerifyBackup: %v", err)
+	}
+	bundled := false
+	for _, entry := range manifest.Entries {
+		bundled = bundled || entry.Path == backupCheckpointBundle
+	}
+	if !bundled {
+		t.Fatal("backup has no git checkpoint bundle")
+	}
+
+	// Restore into a fresh repository that has never seen the commits
+	t.Chdir(t.TempDir())
+	if _, err := runGit("init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+	restored := openTestDatabase(t, StorageFile, t.TempDir())
+	defer restored.Close()
+	useTestDatabase(t, restored)
+	if err := restored.RestoreProject(backupPath); err != nil {
+		t.Fatalf("RestoreProject: %v", err)
+	}
+
+	got, err := restored.GetCheckpoint(checkpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveGitCheckpoint(got); err != nil {
+		t.Fatalf("resolveGitCheckpoint: %v", err)
+	}
+	content, err := checkpointBlob(got.Files["a.txt"])
+	if err != nil || string(content) != "checkpointed\n" {
+		t.Fatalf("checkpoint content = %q, %v", content, err)
+	}
+}
+
+func TestRestoreGitCheckpointsOutsideRepository(t *testing.T) {
+	source := t.TempDir()
+	t.Chdir(source)
+	if _, err := runGit("init", "-q"); err != nil {
+		t.Skipf("git is not available: %v", err)
+	}
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	useTestDatabase(t, pdb)
+	writeTestFile(t, "a.txt", "checkpointed\n")
+	if _, err := createGitCheckpoint("before", "test checkpoint"); err != nil {
+		t.Fatalf("createGitCheckpoint: %v", err)
+	}
+	backupPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := pdb.BackupProject(backupPath); err != nil {
+		t.Fatalf("BackupProject: %v", err)
+	}
+
+	// Without a repository to fetch into nothing is replaced
+	t.Chdir(t.TempDir())
+	target := openTestDatabase(t, StorageFile, t.TempDir())
+	defer target.Close()
+	if _, err := target.CreateCheckpoint("current", "", nil, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.RestoreProject(backupPath); err == nil || !strings.Contains(err.Error(), "not the top level") {
+		t.Fatalf("RestoreProject outside a repository = %v", err)
+	}
+	checkpoints, err := target.ListCheckpoints()
+	if err != nil || len(checkpoints) != 1 || checkpoints[0].Name != "current" {
+		t.Fatalf("checkpoints after the failed restore = %v, %v", checkpoints, err)
+	}
+}
@@ -0,0 +1,273 @@
+// chains.go - Tool chains that run existing tools in sequence as a single tool
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// chainStepID restricts step ids so they can be referenced from templates
+var chainStepID = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// chainPlaceholderPattern matches {{input.name}}, {{steps.id.output}} and
+// {{prev.output}} references in chain templates
+var chainPlaceholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_-]*(?:\.[a-zA-Z0-9_-]+)*)\s*\}\}`)
+
+// ToolChainSpec declares a chain: a named tool with its own input schema that
+// runs other tools in order. Step inputs are JSON templates that can refer to
+// the chain's arguments as {{input.name}} and to earlier results as
+// {{steps.<id>.output}}, {{steps.<id>.error}}, {{steps.<id>.ok}} or
+// {{prev.output}}. A string that is exactly one reference keeps the
+// referenced value's type.
+type ToolChainSpec struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	InputSchema CustomToolSchema `json:"input_schema"`
+	Steps       []ToolChainStep  `json:"steps"`
+	Output      string           `json:"output,omitempty"` // optional template for the result
+}
+
+// ToolChainStep is one tool call in a chain
+type ToolChainStep struct {
+	ID      string          `json:"id,omitempty"` // defaults to step1, step2, ...
+	Tool    string          `json:"tool"`
+	Input   json.RawMessage `json:"input,omitempty"`
+	OnError string          `json:"on_error,omitempty"` // "stop" (default) or "continue"
+	input   interface{}
+}
+
+// chainStepResult is the outcome of a step, available to later templates
+type chainStepResult struct {
+	Output string
+	Error  string
+	OK     bool
+}
+
+// validate checks a chain against the tools it may call
+func (chain *ToolChainSpec) validate(taken map[string]bool, available map[string]ToolDefinition) error {
+	if !customToolName.MatchString(chain.Name) {
+		return fmt.Errorf("name must start with a letter and contain only letters, digits, '_' or '-' (max 64)")
+	}
+	if taken[chain.Name] {
+		return fmt.Errorf("name %q is already used by another tool", chain.Name)
+	}
+	if strings.TrimSpace(chain.Description) == "" {
+		return fmt.Errorf("description is required")
+	}
+	if len(chain.Steps) == 0 {
+		return fmt.Errorf("at least one step is required")
+	}
+	if err := chain.InputSchema.validate(); err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for i := range chain.Steps {
+		step := &chain.Steps[i]
+		if step.ID == "" {
+			step.ID = fmt.Sprintf("step%d", i+1)
+		}
+		if !chainStepID.MatchString(step.ID) || seen[step.ID] {
+			return fmt.Errorf("step %d: id %q must be unique and start with a letter", i+1, step.ID)
+		}
+		if _, ok := available[step.Tool]; !ok {
+			return fmt.Errorf("step %s: unknown tool %q", step.ID, step.Tool)
+		}
+		if step.OnError != "" && step.OnError != "stop" && step.OnError != "continue" {
+			return fmt.Errorf("step %s: on_error must be stop or continue", step.ID)
+		}
+
+		step.input = map[string]interface{}{}
+		if len(step.Input) > 0 {
+			decoder := json.NewDecoder(strings.NewReader(string(step.Input)))
+			decoder.UseNumber()
+			if err := decoder.Decode(&step.input); err != nil {
+				return fmt.Errorf("step %s: input must be a JSON object: %w", step.ID, err)
+			}
+			if _, ok := step.input.(map[string]interface{}); !ok {
+				return fmt.Errorf("step %s: input must be a JSON object", step.ID)
+			}
+		}
+		for _, ref := range chainReferences(step.input) {
+			if err := chain.checkReference(ref, seen, i == 0); err != nil {
+				return fmt.Errorf("step %s: %w", step.ID, err)
+			}
+		}
+		seen[step.ID] = true
+	}
+
+	for _, ref := range chainReferences(chain.Output) {
+		if err := chain.checkReference(ref, seen, false); err != nil {
+			return fmt.Errorf("output: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkReference verifies that a template reference can be resolved
+func (chain *ToolChainSpec) checkReference(ref string, earlier map[string]bool, first bool) error {
+	parts := strings.Split(ref, ".")
+	field := parts[len(parts)-1]
+	resultField := field == "output" || field == "error" || field == "ok"
+	switch {
+	case parts[0] == "input" && len(parts) == 2:
+		if chain.InputSchema.Properties[parts[1]] == nil {
+			return fmt.Errorf("{{%s}} refers to an undeclared input", ref)
+		}
+	case parts[0] == "steps" && len(parts) == 3 && resultField:
+		if !earlier[parts[1]] {
+			return fmt.Errorf("{{%s}} refers to a step that has not run yet", ref)
+		}
+	case parts[0] == "prev" && len(parts) == 2 && resultField:
+		if first {
+			return fmt.Errorf("{{%s}} is not available in the first step", ref)
+		}
+	default:
+		return fmt.Errorf("unknown reference {{%s}}", ref)
+	}
+	return nil
+}
+
+// chainReferences lists the references used in a template value
+func chainReferences(value interface{}) []string {
+	var refs []string
+	switch v := value.(type) {
+	case string:
+		for _, match := range chainPlaceholderPattern.FindAllStringSubmatch(v, -1) {
+			refs = append(refs, match[1])
+		}
+	case []interface{}:
+		for _, item := range v {
+			refs = append(refs, chainReferences(item)...)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			refs = append(refs, chainReferences(item)...)
+		}
+	}
+	return refs
+}
+
+// definition exposes the chain as a single tool. Each step's tool is looked
+// up when the step runs, so a chain cannot reach a tool that was disabled or
+// left out of the active profile.
+func (chain *ToolChainSpec) definition(lookup func(name string) (ToolDefinition, bool)) ToolDefinition {
+	return ToolDefinition{
+		Name:        chain.Name,
+		Description: chain.Description,
+		InputSchema: chain.InputSchema.param(),
+		Function: func(input json.RawMessage) (string, error) {
+			return chain.run(input, lookup)
+		},
+	}
+}
+
+// chainScope resolves references while a chain runs
+type chainScope struct {
+	args    map[string]interface{}
+	results map[string]*chainStepResult
+	prev    *chainStepResult
+}
+
+// lookup returns the value of a reference
+func (scope *chainScope) lookup(ref string) interface{} {
+	parts := strings.Split(ref, ".")
+	var result *chainStepResult
+	switch parts[0] {
+	case "input":
+		return scope.args[parts[1]]
+	case "steps":
+		result = scope.results[parts[1]]
+	case "prev":
+		result = scope.prev
+	}
+	if result == nil {
+		return nil
+	}
+	switch parts[len(parts)-1] {
+	case "output":
+		return result.Output
+	case "error":
+		return result.Error
+	default:
+		return result.OK
+	}
+}
+
+// render fills in the references of a template value
+func (scope *chainScope) render(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if match := chainPlaceholderPattern.FindStringSubmatch(v); match != nil && match[0] == strings.TrimSpace(v) {
+			return scope.lookup(match[1])
+		}
+		return chainPlaceholderPattern.ReplaceAllStringFunc(v, func(placeholder string) string {
+			return argumentString(scope.lookup(chainPlaceholderPattern.FindStringSubmatch(placeholder)[1]))
+		})
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered[i] = scope.render(item)
+		}
+		return rendered
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered[key] = scope.render(item)
+		}
+		return rendered
+	}
+	return value
+}
+
+// run executes the steps in order, stopping at the first failing step unless
+// it is marked on_error: continue
+func (chain *ToolChainSpec) run(input json.RawMessage, lookup func(name string) (ToolDefinition, bool)) (string, error) {
+	args, err := chain.InputSchema.arguments(input)
+	if err != nil {
+		return "", err
+	}
+
+	scope := &chainScope{args: args, results: map[string]*chainStepResult{}}
+	var report strings.Builder
+	for i, step := range chain.Steps {
+		stepInput, err := json.Marshal(scope.render(step.input))
+		if err != nil {
+			return "", fmt.Errorf("step %s: failed to build input: %w", step.ID, err)
+		}
+
+		tool, ok := lookup(step.Tool)
+		if !ok {
+			return "", fmt.Errorf("chain %s stopped at step %s: tool %s is not enabled\n%s", chain.Name, step.ID, step.Tool, report.String())
+		}
+		log.Printf("Chain %s step %d/%d: %s(%s)", chain.Name, i+1, len(chain.Steps), step.Tool, stepInput)
+		output, err := tool.Function(stepInput)
+		result := &chainStepResult{Output: output, OK: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		scope.results[step.ID] = result
+		scope.prev = result
+
+		status := "ok"
+		if err != nil {
+			status = "failed: " + err.Error()
+		}
+		fmt.Fprintf(&report, "## [%d/%d] %s (%s): %s\n", i+1, len(chain.Steps), step.ID, step.Tool, status)
+		if output != "" {
+			report.WriteString(strings.TrimRight(output, "\n") + "\n")
+		}
+
+		if err != nil && step.OnError != "continue" {
+			return "", fmt.Errorf("chain %s stopped at step %s:\n%s", chain.Name, step.ID, report.String())
+		}
+	}
+
+	if chain.Output != "" {
+		return argumentString(scope.render(chain.Output)), nil
+	}
+	return report.String(), nil
+}
@@ -0,0 +1,140 @@
+// chains_test.go - Tool chains and the registry state of their steps
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRegistryTool returns a tool that records its calls and echoes its input
+func testRegistryTool(name string, calls *[]string) ToolDefinition {
+	return ToolDefinition{
+		Name:        name,
+		Description: "test tool " + name,
+		Function: func(input json.RawMessage) (string, error) {
+			*calls = append(*calls, name)
+			return name + ":" + string(input), nil
+		},
+	}
+}
+
+// loadTestChains registers a reader and a shell tool and loads the chains
+// declared in tools
+func loadTestChains(t *testing.T, tools string) (*ToolRegistry, *[]string) {
+	t.Helper()
+	var calls []string
+	registry := NewToolRegistry()
+	if err := registry.Register("files", CategoryRead, testRegistryTool("peek", &calls)); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("shell", CategoryExec, testRegistryTool("shell", &calls)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "tools.json")
+	writeTestFile(t, path, tools)
+	custom, err := LoadCustomTools(path, registry)
+	if err != nil {
+		t.Fatalf("LoadCustomTools: %v", err)
+	}
+	if err := registry.Register("custom", CategoryCustom, custom...); err != nil {
+		t.Fatal(err)
+	}
+	return registry, &calls
+}
+
+const testChainTools = `{
+	"tools": [],
+	"chains": [{
+		"name": "inspect",
+		"description": "peek, then run a command",
+		"input_schema": {"properties": {"path": {"type": "string"}}, "required": ["path"]},
+		"steps": [
+			{"id": "look", "tool": "peek", "input": {"path": "{{input.path}}"}},
+			{"tool": "shell", "input": {"command": "cat {{steps.look.output}}"}}
+		]
+	}]
+}`
+
+// runTestChain calls the chain's function directly, as a tool call would
+func runTestChain(t *testing.T, registry *ToolRegistry) (string, error) {
+	t.Helper()
+	for _, tool := range registry.Definitions() {
+		if tool.Name == "inspect" {
+			return tool.Function(json.RawMessage(`{"path": "a.txt"}`))
+		}
+	}
+	t.Fatal("chain inspect is not registered")
+	return "", nil
+}
+
+func TestToolChainRunsSteps(t *testing.T) {
+	registry, calls := loadTestChains(t, testChainTools)
+	output, err := runTestChain(t, registry)
+	if err != nil {
+		t.Fatalf("chain failed: %v", err)
+	}
+	if strings.Join(*calls, ",") != "peek,shell" {
+		t.Fatalf("calls = %v", *calls)
+	}
+	if !strings.Contains(output, `shell:{"command":"cat peek:{\"path\":\"a.txt\"}"}`) {
+		t.Fatalf("output does not show the second step's input:\n%s", output)
+	}
+}
+
+func TestToolChainRefusesDisabledSteps(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*ToolRegistry) error
+	}{
+		{"disabled tool", func(r *ToolRegistry) error {
+			_, err := r.SetEnabled(false, "shell")
+			return err
+		}},
+		{"outside the profile", func(r *ToolRegistry) error {
+			if err := r.ApplyProfile("read-only"); err != nil {
+				return err
+			}
+			// Even with the chain itself enabled again
+			_, err := r.SetEnabled(true, "inspect")
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, calls := loadTestChains(t, testChainTools)
+			if err := tt.configure(registry); err != nil {
+				t.Fatal(err)
+			}
+			_, err := runTestChain(t, registry)
+			if err == nil || !strings.Contains(err.Error(), "tool shell is not enabled") {
+				t.Fatalf("chain error = %v", err)
+			}
+			for _, call := range *calls {
+				if call == "shell" {
+					t.Fatal("disabled tool ran as a chain step")
+				}
+			}
+
+			// Enabling the tool again makes the chain usable
+			if _, err := registry.SetEnabled(true, "shell"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := runTestChain(t, registry); err != nil {
+				t.Fatalf("chain after enabling the tool: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadCustomToolsRejectsUnknownStep(t *testing.T) {
+	registry := NewToolRegistry()
+	path := filepath.Join(t.TempDir(), "tools.json")
+	writeTestFile(t, path, strings.Replace(testChainTools, `"tool": "shell"`, `"tool": "missing"`, 1))
+	if _, err := LoadCustomTools(path, registry); err == nil || !strings.Contains(err.Error(), "unknown tool") {
+		t.Fatalf("LoadCustomTools error = %v", err)
+	}
+}
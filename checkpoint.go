@@ -0,0 +1,456 @@
+// checkpoint.go - Working tree checkpoints: snapshot, restore with preview, and diff
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	checkpointMaxFileSize = 10 * 1024 * 1024 // larger files are listed as skipped
+	checkpointMaxDiffSize = 100000           // characters of diff output returned
+)
+
+// checkpointExcluded are EVE's own state files, which a restore must never rewind
+var checkpointExcluded = map[string]bool{
+	conversationFile: true,
+}
+
+// checkpointChange is one difference between two snapshots
+type checkpointChange struct {
+	Path      string
+	Operation string // "create", "modify" or "delete"
+	Old       CheckpointFile
+	New       CheckpointFile
+}
+
+// snapshotWorkingTree hashes every non-ignored file under root with hash.
+// Passing globalDB.SaveBlob saves the contents so the snapshot can be
+// restored later.
+func snapshotWorkingTree(root string, hash func([]byte) (string, error)) (map[string]CheckpointFile, []string, error) {
+	files := map[string]CheckpointFile{}
+	var skipped []string
+	err := walkIgnoring(root, false, func(relPath string, d fs.DirEntry) error {
+		if d.IsDir() || checkpointExcluded[relPath] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if info.Size() > checkpointMaxFileSize {
+			skipped = append(skipped, relPath)
+			return nil
+		}
+
+		content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(relPath)))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", relPath, err)
+		}
+		sum, err := hash(content)
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", relPath, err)
+		}
+		files[relPath] = CheckpointFile{Hash: sum, Mode: info.Mode().Perm(), Size: info.Size()}
+		return nil
+	})
+	return files, skipped, err
+}
+
+// hashBlob hashes content like SaveBlob without storing it
+func hashBlob(content []byte) (string, error) {
+	return blobHash(content), nil
+}
+
+// snapshotHasher returns the hash function that files were hashed with, so
+// the working tree can be compared with checkpoints taken before blobs were
+// keyed on SHA-256
+func snapshotHasher(files map[string]CheckpointFile) func([]byte) (string, error) {
+	for _, file := range files {
+		if legacyBlobHash(file.Hash) {
+			return func(content []byte) (string, error) { return contentHash(string(content)), nil }
+		}
+		break
+	}
+	return hashBlob
+}
+
+// withoutSkipped removes the files a checkpoint skipped as too large from a
+// snapshot, since the checkpoint does not know their content
+func withoutSkipped(files map[string]CheckpointFile, skipped []string) map[string]CheckpointFile {
+	for _, path := range skipped {
+		delete(files, path)
+	}
+	return files
+}
+
+// compareSnapshots lists the changes that turn from into to, sorted by path
+func compareSnapshots(from, to map[string]CheckpointFile) []checkpointChange {
+	var changes []checkpointChange
+	for path, newFile := range to {
+		oldFile, ok := from[path]
+		switch {
+		case !ok:
+			changes = append(changes, checkpointChange{Path: path, Operation: "create", New: newFile})
+		case oldFile.Hash != newFile.Hash || oldFile.Mode != newFile.Mode:
+			changes = append(changes, checkpointChange{Path: path, Operation: "modify", Old: oldFile, New: newFile})
+		}
+	}
+	for path, oldFile := range from {
+		if _, ok := to[path]; !ok {
+			changes = append(changes, checkpointChange{Path: path, Operation: "delete", Old: oldFile})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// formatChangeList renders changes as git-style status lines
+func formatChangeList(changes []checkpointChange) string {
+	var sb strings.Builder
+	for _, change := range changes {
+		marker := map[string]string{"create": "A", "modify": "M", "delete": "D"}[change.Operation]
+		fmt.Fprintf(&sb, "%s %s\n", marker, change.Path)
+	}
+	return sb.String()
+}
+
+// CreateProjectCheckpoint snapshots the working tree into a new checkpoint
+func CreateProjectCheckpoint(name, description string) (*Checkpoint, error) {
+	if globalDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("checkpoint name is required")
+	}
+
+	// In a git repository the snapshot becomes a commit on a hidden ref
+	if gitCheckpointsEnabled() {
+		checkpoint, err := createGitCheckpoint(name, description)
+		if err == nil {
+			return checkpoint, nil
+		}
+		log.Printf("Storing checkpoint in git failed, using the project database: %v", err)
+	}
+
+	files, skipped, err := snapshotWorkingTree(".", globalDB.SaveBlob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot working tree: %w", err)
+	}
+	return globalDB.CreateCheckpoint(name, description, files, skipped, "")
+}
+
+// loadCheckpoint returns a checkpoint that holds a restorable snapshot
+func loadCheckpoint(id int) (*Checkpoint, error) {
+	if globalDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	checkpoint, err := globalDB.GetCheckpoint(id)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.Files == nil && checkpoint.FileCount > 0 {
+		return nil, fmt.Errorf("checkpoint %d was created before snapshots were stored and cannot be restored", id)
+	}
+	if checkpoint.GitCommit != "" {
+		if err := resolveGitCheckpoint(checkpoint); err != nil {
+			return nil, err
+		}
+	}
+	return checkpoint, nil
+}
+
+// RestoreProjectCheckpoint makes the working tree match a checkpoint. With
+// preview set it only reports what would change. Before writing anything the
+// current state is saved as a new checkpoint so the restore can be reverted.
+func RestoreProjectCheckpoint(id int, preview bool) (string, error) {
+	checkpoint, err := loadCheckpoint(id)
+	if err != nil {
+		return "", err
+	}
+
+	current, _, err := snapshotWorkingTree(".", snapshotHasher(checkpoint.Files))
+	if err != nil {
+		return "", fmt.Errorf("failed to scan working tree: %w", err)
+	}
+	changes := compareSnapshots(withoutSkipped(current, checkpoint.Skipped), checkpoint.Files)
+	if len(changes) == 0 {
+		return fmt.Sprintf("Working tree already matches checkpoint %d (%s)", checkpoint.ID, checkpoint.Name), nil
+	}
+
+	if preview {
+		return fmt.Sprintf("Restoring checkpoint %d (%s) would change %d files:\n%s",
+			checkpoint.ID, checkpoint.Name, len(changes), formatChangeList(changes)), nil
+	}
+
+	// Make sure every blob is available before touching the working tree
+	for _, change := range changes {
+		if change.Operation != "delete" {
+			if _, err := checkpointBlob(change.New); err != nil {
+				return "", fmt.Errorf("cannot restore %s: %w", change.Path, err)
+			}
+		}
+	}
+
+	safety, err := CreateProjectCheckpoint(fmt.Sprintf("before-restore-%d", checkpoint.ID),
+		fmt.Sprintf("Automatic checkpoint taken before restoring checkpoint %d", checkpoint.ID))
+	if err != nil {
+		return "", fmt.Errorf("failed to save current state before restoring: %w", err)
+	}
+
+	// The restore is one change group, so /undo reverts it as a whole
+	group := newChangeGroup()
+	for _, change := range changes {
+		if err := applyCheckpointChange(change, group); err != nil {
+			return "", fmt.Errorf("failed to restore %s (current state saved as checkpoint %d): %w", change.Path, safety.ID, err)
+		}
+	}
+
+	return fmt.Sprintf("Restored checkpoint %d (%s), %d files changed:\n%sPrevious state saved as checkpoint %d",
+		checkpoint.ID, checkpoint.Name, len(changes), formatChangeList(changes), safety.ID), nil
+}
+
+// applyCheckpointChange writes or removes one file of a restore and records
+// it in the edit history under group
+func applyCheckpointChange(change checkpointChange, group string) error {
+	path := filepath.FromSlash(change.Path)
+	oldContent, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if change.Operation == "delete" {
+		if oldContent == nil {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		recordFileChange("restore_checkpoint", group, change.Path, change.Old.Mode, oldContent, nil)
+		return nil
+	}
+
+	content, err := checkpointBlob(change.New)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(path, content, change.New.Mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, change.New.Mode); err != nil {
+		return err
+	}
+	recordFileChange("restore_checkpoint", group, change.Path, 0, oldContent, content)
+	return nil
+}
+
+// DiffCheckpoints returns a unified diff from one checkpoint to another. A
+// toID of 0 compares against the current working tree. pathPrefix limits the
+// diff to files under that path.
+func DiffCheckpoints(fromID, toID int, pathPrefix string) (string, error) {
+	from, err := loadCheckpoint(fromID)
+	if err != nil {
+		return "", err
+	}
+
+	toLabel := "working tree"
+	toFiles := map[string]CheckpointFile{}
+	if toID == 0 {
+		if toFiles, _, err = snapshotWorkingTree(".", snapshotHasher(from.Files)); err != nil {
+			return "", fmt.Errorf("failed to scan working tree: %w", err)
+		}
+	} else {
+		to, err := loadCheckpoint(toID)
+		if err != nil {
+			return "", err
+		}
+		toFiles = to.Files
+		toLabel = fmt.Sprintf("checkpoint %d (%s)", to.ID, to.Name)
+	}
+
+	var changes []checkpointChange
+	prefix := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(pathPrefix)), "./")
+	for _, change := range compareSnapshots(from.Files, withoutSkipped(toFiles, from.Skipped)) {
+		if pathPrefix == "" || prefix == "." || change.Path == prefix || strings.HasPrefix(change.Path, prefix+"/") {
+			changes = append(changes, change)
+		}
+	}
+
+	header := fmt.Sprintf("Changes from checkpoint %d (%s) to %s", from.ID, from.Name, toLabel)
+	if len(changes) == 0 {
+		return header + ": none", nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s, %d files:\n%s\n", header, len(changes), formatChangeList(changes))
+	for _, change := range changes {
+		oldContent, newContent := "", ""
+		oldPath, newPath := "a/"+change.Path, "b/"+change.Path
+		if change.Operation == "create" {
+			oldPath = "/dev/null"
+		} else if oldContent, err = checkpointContent(change.Old, "", false); err != nil {
+			return "", err
+		}
+		if change.Operation == "delete" {
+			newPath = "/dev/null"
+		} else if newContent, err = checkpointContent(change.New, change.Path, toID == 0); err != nil {
+			return "", err
+		}
+
+		if strings.ContainsRune(oldContent, 0) || strings.ContainsRune(newContent, 0) {
+			fmt.Fprintf(&sb, "Binary files %s and %s differ\n", oldPath, newPath)
+		} else if diff := UnifiedDiff(oldPath, newPath, oldContent, newContent); diff != "" {
+			sb.WriteString(diff)
+		} else {
+			fmt.Fprintf(&sb, "mode change %s: %o -> %o\n", change.Path, change.Old.Mode, change.New.Mode)
+		}
+		if sb.Len() > checkpointMaxDiffSize {
+			sb.WriteString("\n[diff truncated; pass a path to narrow it down]\n")
+			break
+		}
+	}
+	return sb.String(), nil
+}
+
+// checkpointContent returns a snapshot file's content, read from disk for the working tree
+func checkpointContent(file CheckpointFile, path string, live bool) (string, error) {
+	if live {
+		content, err := os.ReadFile(filepath.FromSlash(path))
+		return string(content), err
+	}
+	content, err := checkpointBlob(file)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// formatCheckpointList renders checkpoints newest first
+func formatCheckpointList(checkpoints []*Checkpoint) string {
+	if len(checkpoints) == 0 {
+		return "No checkpoints"
+	}
+	result := "Available Checkpoints:\n"
+	for _, cp := range checkpoints {
+		result += fmt.Sprintf("- ID: %d, Name: %s, Description: %s, Files: %d, Time: %s",
+			cp.ID, cp.Name, cp.Description, cp.FileCount, cp.Timestamp.Format("2006-01-02 15:04:05"))
+		if cp.GitCommit != "" {
+			result += ", Git: " + gitCheckpointRef(cp.ID)
+		}
+		result += "\n"
+	}
+	return result
+}
+
+type CreateCheckpointInput struct {
+	Name        string `json:"name" jsonschema_description:"Name of the checkpoint"`
+	Description string `json:"description" jsonschema_description:"Description of the checkpoint"`
+}
+
+var CreateCheckpointInputSchema = GenerateSchema[CreateCheckpointInput]()
+
+func CreateCheckpoint(input json.RawMessage) (string, error) {
+	var cpInput CreateCheckpointInput
+	if err := json.Unmarshal(input, &cpInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	checkpoint, err := CreateProjectCheckpoint(cpInput.Name, cpInput.Description)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+
+	result := fmt.Sprintf("Successfully created checkpoint '%s' with ID %d (%d files)", checkpoint.Name, checkpoint.ID, checkpoint.FileCount)
+	if len(checkpoint.Skipped) > 0 {
+		result += fmt.Sprintf("\nSkipped %d files larger than %d bytes: %s", len(checkpoint.Skipped), checkpointMaxFileSize, strings.Join(checkpoint.Skipped, ", "))
+	}
+	return result, nil
+}
+
+var CreateCheckpointDefinition = ToolDefinition{
+	Name:        "create_checkpoint",
+	Description: "Create a checkpoint (snapshot) of the current project state. The content of every non-ignored file is saved so the checkpoint can be restored or diffed later.",
+	InputSchema: CreateCheckpointInputSchema,
+	Function:    CreateCheckpoint,
+}
+
+type RestoreCheckpointInput struct {
+	CheckpointID int  `json:"checkpoint_id" jsonschema_description:"ID of the checkpoint to restore"`
+	Preview      bool `json:"preview,omitempty" jsonschema_description:"Only list the files that would be created, modified or deleted"`
+}
+
+var RestoreCheckpointInputSchema = GenerateSchema[RestoreCheckpointInput]()
+
+func RestoreCheckpoint(input json.RawMessage) (string, error) {
+	var cpInput RestoreCheckpointInput
+	if err := json.Unmarshal(input, &cpInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	return RestoreProjectCheckpoint(cpInput.CheckpointID, cpInput.Preview)
+}
+
+var RestoreCheckpointDefinition = ToolDefinition{
+	Name:        "restore_checkpoint",
+	Description: "Restore the working tree to a previous checkpoint: files are rewritten, created or deleted to match it. Use preview first to see what will change. The current state is saved as a new checkpoint before restoring.",
+	InputSchema: RestoreCheckpointInputSchema,
+	Function:    RestoreCheckpoint,
+}
+
+type ListCheckpointsInput struct{}
+
+var ListCheckpointsInputSchema = GenerateSchema[ListCheckpointsInput]()
+
+func ListCheckpoints(input json.RawMessage) (string, error) {
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	checkpoints, err := globalDB.ListCheckpoints()
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	return formatCheckpointList(checkpoints), nil
+}
+
+var ListCheckpointsDefinition = ToolDefinition{
+	Name:        "list_checkpoints",
+	Description: "List all available project checkpoints.",
+	InputSchema: ListCheckpointsInputSchema,
+	Function:    ListCheckpoints,
+}
+
+type DiffCheckpointsInput struct {
+	FromID int    `json:"from_id" jsonschema_description:"ID of the older checkpoint"`
+	ToID   int    `json:"to_id,omitempty" jsonschema_description:"ID of the newer checkpoint; omit to compare with the current working tree"`
+	Path   string `json:"path,omitempty" jsonschema_description:"Only show changes to this file or directory"`
+}
+
+var DiffCheckpointsInputSchema = GenerateSchema[DiffCheckpointsInput]()
+
+func DiffCheckpointsTool(input json.RawMessage) (string, error) {
+	var diffInput DiffCheckpointsInput
+	if err := json.Unmarshal(input, &diffInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	return DiffCheckpoints(diffInput.FromID, diffInput.ToID, diffInput.Path)
+}
+
+var DiffCheckpointsDefinition = ToolDefinition{
+	Name:        "diff_checkpoints",
+	Description: "Show a unified diff between two checkpoints, or between a checkpoint and the current working tree.",
+	InputSchema: DiffCheckpointsInputSchema,
+	Function:    DiffCheckpointsTool,
+}
@@ -0,0 +1,192 @@
+// checkpoint_test.go - Checkpoints stored in the project database: create, restore, preview and diff
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// checkTestFileMissing verifies that a file in the working directory does not exist
+func checkTestFileMissing(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("%s exists: %v", path, err)
+	}
+}
+
+// useTestCheckpointTree makes an empty directory the working tree and stores
+// checkpoints in the project database
+func useTestCheckpointTree(t *testing.T, backend string) *ProjectDatabase {
+	t.Helper()
+	t.Setenv("EVE_GIT_CHECKPOINTS", "0")
+	pdb := openTestDatabase(t, backend, t.TempDir())
+	t.Cleanup(func() { pdb.Close() })
+	useTestDatabase(t, pdb)
+	t.Chdir(t.TempDir())
+	return pdb
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			useTestCheckpointTree(t, backend)
+			if err := os.Mkdir("dir", 0755); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, "a.txt", "one\n")
+			writeTestFile(t, "dir/b.txt", "two\n")
+
+			checkpoint, err := CreateProjectCheckpoint("base", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if checkpoint.FileCount != 2 {
+				t.Fatalf("checkpoint has %d files, want 2", checkpoint.FileCount)
+			}
+
+			writeTestFile(t, "a.txt", "one, edited\n")
+			writeTestFile(t, "c.txt", "new\n")
+			if err := os.Remove("dir/b.txt"); err != nil {
+				t.Fatal(err)
+			}
+
+			preview, err := RestoreProjectCheckpoint(checkpoint.ID, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range []string{"M a.txt", "D c.txt", "A dir/b.txt"} {
+				if !strings.Contains(preview, line) {
+					t.Errorf("preview lacks %q:\n%s", line, preview)
+				}
+			}
+			checkTestFile(t, "a.txt", "one, edited\n")
+
+			if _, err := RestoreProjectCheckpoint(checkpoint.ID, false); err != nil {
+				t.Fatal(err)
+			}
+			checkTestFile(t, "a.txt", "one\n")
+			checkTestFile(t, "dir/b.txt", "two\n")
+			checkTestFileMissing(t, "c.txt")
+			if output, err := RestoreProjectCheckpoint(checkpoint.ID, true); err != nil || !strings.Contains(output, "already matches") {
+				t.Fatalf("preview after restoring = %q, %v", output, err)
+			}
+
+			// The restore is undone as one change
+			if _, err := UndoChanges(1); err != nil {
+				t.Fatal(err)
+			}
+			checkTestFile(t, "a.txt", "one, edited\n")
+			checkTestFile(t, "c.txt", "new\n")
+			checkTestFileMissing(t, "dir/b.txt")
+		})
+	}
+}
+
+func TestCheckpointRestoreKeepsSkippedFiles(t *testing.T) {
+	useTestCheckpointTree(t, StorageFile)
+	writeTestFile(t, "a.txt", "one\n")
+	writeTestFile(t, "large.bin", strings.Repeat("x", checkpointMaxFileSize+1))
+
+	checkpoint, err := CreateProjectCheckpoint("base", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoint.Skipped) != 1 || checkpoint.Skipped[0] != "large.bin" {
+		t.Fatalf("skipped = %v", checkpoint.Skipped)
+	}
+
+	// A skipped file that has shrunk is in the working tree snapshot, but the
+	// checkpoint never knew its content
+	writeTestFile(t, "large.bin", "small now\n")
+	writeTestFile(t, "a.txt", "two\n")
+	output, err := RestoreProjectCheckpoint(checkpoint.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(output, "large.bin") {
+		t.Fatalf("restore touched the skipped file:\n%s", output)
+	}
+	checkTestFile(t, "a.txt", "one\n")
+	checkTestFile(t, "large.bin", "small now\n")
+
+	if diff, err := DiffCheckpoints(checkpoint.ID, 0, ""); err != nil || !strings.HasSuffix(diff, ": none") {
+		t.Fatalf("diff against the working tree = %q, %v", diff, err)
+	}
+}
+
+func TestDiffCheckpoints(t *testing.T) {
+	useTestCheckpointTree(t, StorageFile)
+	if err := os.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, "a.txt", "one\n")
+	writeTestFile(t, "dir/b.txt", "two\n")
+	first, err := CreateProjectCheckpoint("first", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, "a.txt", "one, edited\n")
+	writeTestFile(t, "dir/c.txt", "three\n")
+	second, err := CreateProjectCheckpoint("second", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		to     int
+		path   string
+		want   []string
+		absent []string
+	}{
+		{"between checkpoints", second.ID, "", []string{"M a.txt", "A dir/c.txt", "-one\n", "+one, edited\n", "+three\n"}, []string{"dir/b.txt"}},
+		{"against the working tree", 0, "", []string{"M a.txt", "A dir/c.txt", "D dir/b.txt", "-two\n"}, nil},
+		{"limited to a directory", 0, "dir", []string{"A dir/c.txt", "D dir/b.txt"}, []string{"a.txt"}},
+	}
+	for _, tt := range tests {
+		diff, err := DiffCheckpoints(first.ID, tt.to, tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(diff, want) {
+				t.Errorf("%s: diff lacks %q:\n%s", tt.name, want, diff)
+			}
+		}
+		for _, absent := range tt.absent {
+			if strings.Contains(diff, absent) {
+				t.Errorf("%s: diff mentions %q:\n%s", tt.name, absent, diff)
+			}
+		}
+	}
+}
+
+func TestCheckpointLegacyHashes(t *testing.T) {
+	pdb := useTestCheckpointTree(t, StorageFile)
+	writeTestFile(t, "a.txt", "one\n")
+
+	// Checkpoints taken before blobs were keyed on SHA-256 hold MD5 hashes
+	content := []byte("one\n")
+	hash := contentHash(string(content))
+	if err := pdb.store.PutBlob(hash, content); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := pdb.CreateCheckpoint("legacy", "", map[string]CheckpointFile{"a.txt": {Hash: hash, Mode: 0644, Size: 4}}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, err := RestoreProjectCheckpoint(checkpoint.ID, true); err != nil || !strings.Contains(output, "already matches") {
+		t.Fatalf("preview of an unchanged legacy checkpoint = %q, %v", output, err)
+	}
+
+	writeTestFile(t, "a.txt", "two\n")
+	if _, err := RestoreProjectCheckpoint(checkpoint.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	checkTestFile(t, "a.txt", "one\n")
+}
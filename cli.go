@@ -0,0 +1,347 @@
+// cli.go - Subcommands run from the command line or as REPL slash commands
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runSubcommand handles `eve <command> ...` invocations that do not start a chat session
+func runSubcommand(args []string) error {
+	var output string
+	var err error
+	switch args[0] {
+	case "checkpoint":
+		output, err = checkpointCommand(args[1:], true)
+	case "backup":
+		output, err = backupCommand(args[1:])
+	case "db":
+		output, err = dbCommand(args[1:])
+	case "query":
+		output, err = queryCommand(args[1:])
+	case "export":
+		output, err = exportCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q (available: checkpoint, backup, db, query, export)", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(output)
+	return nil
+}
+
+// checkpointUsage describes the checkpoint subcommands
+const checkpointUsage = `usage: checkpoint create <name> [description]
+       checkpoint list
+       checkpoint restore <id> [--yes]
+       checkpoint diff <from-id> [to-id] [path]`
+
+// checkpointCommand creates, lists, restores and diffs checkpoints. From the
+// command line a restore only shows its preview unless --yes is given.
+func checkpointCommand(args []string, requireConfirm bool) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("%s", checkpointUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) < 2 {
+			return "", fmt.Errorf("%s", checkpointUsage)
+		}
+		checkpoint, err := CreateProjectCheckpoint(args[1], strings.Join(args[2:], " "))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Created checkpoint %d (%s) with %d files", checkpoint.ID, checkpoint.Name, checkpoint.FileCount), nil
+	case "list":
+		if globalDB == nil {
+			return "", fmt.Errorf("database not initialized")
+		}
+		checkpoints, err := globalDB.ListCheckpoints()
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		return formatCheckpointList(checkpoints), nil
+	case "restore":
+		if len(args) < 2 {
+			return "", fmt.Errorf("%s", checkpointUsage)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid checkpoint id %q", args[1])
+		}
+		confirmed := len(args) > 2 && args[2] == "--yes"
+		if requireConfirm && !confirmed {
+			preview, err := RestoreProjectCheckpoint(id, true)
+			if err != nil {
+				return "", err
+			}
+			return preview + "\nRun again with --yes to restore.", nil
+		}
+		return RestoreProjectCheckpoint(id, false)
+	case "diff":
+		if len(args) < 2 {
+			return "", fmt.Errorf("%s", checkpointUsage)
+		}
+		from, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid checkpoint id %q", args[1])
+		}
+		to, path := 0, ""
+		if len(args) > 2 {
+			if to, err = strconv.Atoi(args[2]); err != nil {
+				to, path = 0, args[2]
+			} else if len(args) > 3 {
+				path = args[3]
+			}
+		}
+		return DiffCheckpoints(from, to, path)
+	}
+	return "", fmt.Errorf("%s", checkpointUsage)
+}
+
+// backupCommand creates, verifies and restores project backups
+func backupCommand(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("usage: backup create|verify|restore <file.tar.gz>")
+	}
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	path := args[1]
+	switch args[0] {
+	case "create":
+		if err := globalDB.BackupProject(path); err != nil {
+			return "", err
+		}
+		manifest, err := VerifyBackup(path)
+		if err != nil {
+			return "", fmt.Errorf("backup written but failed verification: %w", err)
+		}
+		return fmt.Sprintf("Backed up %d files to %s", len(manifest.Entries), path), nil
+	case "verify":
+		manifest, err := VerifyBackup(path)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s is intact: %d files, created %s", path, len(manifest.Entries), manifest.CreatedAt.Format("2006-01-02 15:04:05")), nil
+	case "restore":
+		if err := globalDB.RestoreProject(path); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Restored project data from %s", path), nil
+	}
+	return "", fmt.Errorf("usage: backup create|verify|restore <file.tar.gz>")
+}
+
+// dbUsage describes the db subcommands
+const dbUsage = `usage: db migrate [sqlite|file]
+       db stats
+       db prune [--dry-run]
+       db gc [--dry-run]
+       db compact`
+
+// dbCommand manages the project database storage
+func dbCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("%s", dbUsage)
+	}
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	dryRun := len(args) == 2 && args[1] == "--dry-run"
+
+	switch args[0] {
+	case "migrate":
+		if len(args) > 2 {
+			return "", fmt.Errorf("%s", dbUsage)
+		}
+		target := StorageSQLite
+		if len(args) == 2 {
+			target = args[1]
+		}
+		if target != StorageSQLite && target != StorageFile {
+			return "", fmt.Errorf("%s", dbUsage)
+		}
+
+		// The migration opens both stores itself, so release the current one first
+		source := globalDB.Backend()
+		var result string
+		err := globalDB.swapStore(func() error {
+			var err error
+			result, err = MigrateStorage(globalDB.projectDir, source, target)
+			return err
+		})
+		return result, err
+
+	case "stats":
+		stats, err := globalDB.Stats()
+		if err != nil {
+			return "", err
+		}
+		return formatStorageStats(globalDB, stats, NewRetentionConfigFromEnv()), nil
+
+	case "prune", "gc":
+		if len(args) > 2 || (len(args) == 2 && !dryRun) {
+			return "", fmt.Errorf("%s", dbUsage)
+		}
+		removed := map[string]int{}
+		if args[0] == "prune" {
+			var err error
+			if removed, err = globalDB.Prune(NewRetentionConfigFromEnv(), dryRun); err != nil {
+				return "", err
+			}
+		}
+		// A dry run cannot tell which blobs pruning would orphan
+		blobs, freed, err := globalDB.CollectGarbage(dryRun)
+		if err != nil {
+			return "", err
+		}
+		if args[0] == "gc" {
+			verb := "Removed"
+			if dryRun {
+				verb = "Would remove"
+			}
+			return fmt.Sprintf("%s %d orphaned blobs (%s)", verb, blobs, formatSize(freed)), nil
+		}
+		return formatPruneResult(removed, blobs, freed, dryRun), nil
+
+	case "compact":
+		if len(args) > 1 {
+			return "", fmt.Errorf("%s", dbUsage)
+		}
+		before, err := globalDB.Stats()
+		if err != nil {
+			return "", err
+		}
+		if err := globalDB.Compact(); err != nil {
+			return "", err
+		}
+		after, err := globalDB.Stats()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Compacted the %s store: %s -> %s on disk, %d -> %d files",
+			globalDB.Backend(), formatSize(before.DiskBytes), formatSize(after.DiskBytes), storeFiles(before), storeFiles(after)), nil
+	}
+	return "", fmt.Errorf("%s", dbUsage)
+}
+
+// storeFiles counts the files holding the records of the file store
+func storeFiles(stats *StorageStats) int {
+	files := 0
+	for _, table := range stats.Tables {
+		if table.Table != "blobs" {
+			files += table.Files
+		}
+	}
+	return files
+}
+
+// queryUsage describes the query and export subcommands
+const queryUsage = `usage: query <edits|checkpoints|multiplayer> [filters] [--limit n] [--format text|jsonl|csv]
+       export <edits|checkpoints|multiplayer> <file.jsonl|file.csv> [filters] [--limit n]
+filters: --path <path|dir/|glob> --since <time> --until <time> --user <name> --action <type>
+times are dates (2006-01-02), RFC 3339 timestamps, or ages such as 24h or 7d`
+
+// parseQueryArgs parses the filters of the query and export subcommands
+func parseQueryArgs(kind string, args []string) (ProjectQuery, string, error) {
+	q := ProjectQuery{Kind: kind}
+	var since, until, format string
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&q.Path, "path", "", "")
+	flags.StringVar(&since, "since", "", "")
+	flags.StringVar(&until, "until", "", "")
+	flags.StringVar(&q.User, "user", "", "")
+	flags.StringVar(&q.Action, "action", "", "")
+	flags.IntVar(&q.Limit, "limit", 0, "")
+	flags.StringVar(&format, "format", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		return q, "", fmt.Errorf("%s", queryUsage)
+	}
+
+	now := time.Now()
+	var err error
+	if since != "" {
+		if q.Since, err = parseQueryTime(since, now); err != nil {
+			return q, "", err
+		}
+	}
+	if until != "" {
+		if q.Until, err = parseQueryTime(until, now); err != nil {
+			return q, "", err
+		}
+	}
+	return q, format, nil
+}
+
+// queryCommand prints the edits, checkpoints or multiplayer actions
+// matching the filters, newest first
+func queryCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("%s", queryUsage)
+	}
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	q, format, err := parseQueryArgs(args[0], args[1:])
+	if err != nil {
+		return "", err
+	}
+	records, err := globalDB.Query(q)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := writeQueryResults(&out, q.Kind, format, records); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// exportCommand writes the matching records to a JSONL or CSV file; the
+// format follows the file extension unless --format is given
+func exportCommand(args []string) (string, error) {
+	if len(args) < 2 {
+		return "", fmt.Errorf("%s", queryUsage)
+	}
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	q, format, err := parseQueryArgs(args[0], args[2:])
+	if err != nil {
+		return "", err
+	}
+	path := args[1]
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if format != queryFormatJSONL && format != queryFormatCSV {
+		return "", fmt.Errorf("cannot export to %s: use a .jsonl or .csv file, or --format jsonl|csv", path)
+	}
+
+	records, err := globalDB.Query(q)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := writeQueryResults(&out, q.Kind, format, records); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(path, out.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Exported %d %s to %s", len(records), q.Kind, path), nil
+}
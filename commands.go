@@ -0,0 +1,106 @@
+// commands.go - REPL slash commands handled locally instead of by the model
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// handleCommand runs a slash command typed at the prompt. It returns false if
+// the input is not a command and should be sent to the model, such as a
+// message that starts with a path like /usr/bin/foo.
+func (a *GenericAgent) handleCommand(input string) bool {
+	if !strings.HasPrefix(input, "/") {
+		return false
+	}
+
+	fields := strings.Fields(input)
+	name, args := fields[0], fields[1:]
+	if strings.Contains(name[1:], "/") {
+		return false
+	}
+
+	var output string
+	var err error
+	switch name {
+	case "/help":
+		output = strings.Join([]string{
+			"/undo [n]  revert the last n tool-driven file changes",
+			"/redo [n]  re-apply the last n undone changes",
+			"/map       show the repository map sent to the model",
+			"/checkpoint create|list|restore|diff ...  manage working tree checkpoints",
+			"/query edits|checkpoints|multiplayer [--path p] [--since t] [--user u] [--action a] ...",
+			"           search the project's history",
+			"/tools [enable|disable <tool|package:name|category:name>...] [profile <name>]",
+			"           list tools or choose which ones are sent to the model",
+			"/help      show this help",
+		}, "\n")
+	case "/undo", "/redo":
+		count := 1
+		if len(args) > 0 {
+			if count, err = strconv.Atoi(args[0]); err != nil || count < 1 {
+				err = fmt.Errorf("usage: %s [n]", name)
+				break
+			}
+		}
+		if name == "/undo" {
+			output, err = UndoChanges(count)
+		} else {
+			output, err = RedoChanges(count)
+		}
+	case "/map":
+		output, err = RepositoryMap(".", repoMapBudget())
+		if err == nil && output == "" {
+			output = "Repository map is disabled (EVE_REPO_MAP_TOKENS=0)"
+		}
+	case "/checkpoint":
+		output, err = checkpointCommand(args, false)
+	case "/query":
+		output, err = queryCommand(args)
+	case "/tools":
+		output, err = a.toolsCommand(args)
+	default:
+		err = fmt.Errorf("unknown command %s (try /help)", name)
+	}
+
+	if err != nil {
+		fmt.Printf("\u001b[91merror\u001b[0m: %s\n", err.Error())
+	} else {
+		fmt.Println(output)
+	}
+	return true
+}
+
+// toolsCommand lists the registered tools or changes which ones are enabled
+func (a *GenericAgent) toolsCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return a.tools.Summary(), nil
+	}
+
+	switch args[0] {
+	case "enable", "disable":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: /tools %s <tool|package:name|category:name>...", args[0])
+		}
+		enable := args[0] == "enable"
+		changed, err := a.tools.SetEnabled(enable, args[1:]...)
+		if err != nil {
+			return "", err
+		}
+		verb := "Disabled"
+		if enable {
+			verb = "Enabled"
+		}
+		return fmt.Sprintf("%s %d tools (%d of %d enabled)", verb, changed, len(a.tools.Tools()), len(a.tools.Definitions())), nil
+	case "profile":
+		if len(args) != 2 {
+			return "", fmt.Errorf("usage: /tools profile <%s>", strings.Join(ToolProfileNames(), "|"))
+		}
+		if err := a.tools.ApplyProfile(args[1]); err != nil {
+			return "", err
+		}
+		return a.tools.Summary(), nil
+	}
+	return "", fmt.Errorf("usage: /tools [enable|disable <selector>...] [profile <name>]")
+}
@@ -3,7 +3,11 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ProviderType represents different LLM providers
@@ -20,6 +24,8 @@ type Config struct {
 	Provider ProviderType `json:"provider"`
 	APIKey   string       `json:"api_key"`
 	Model    string       `json:"model"`
+	HTTP     *HTTPConfig  `json:"http"`
+	Tools    *ToolsConfig `json:"tools"`
 }
 
 // NewConfigFromEnv creates a config from environment variables
@@ -49,6 +55,8 @@ func NewConfigFromEnv() (*Config, error) {
 		Provider: provider,
 		APIKey:   apiKey,
 		Model:    os.Getenv("LLM_MODEL"),
+		HTTP:     NewHTTPConfigFromEnv(),
+		Tools:    NewToolsConfigFromEnv(),
 	}, nil
 }
 
@@ -66,3 +74,280 @@ func (c *Config) CreateProvider() (LLMProvider, error) {
 		return nil, fmt.Errorf("unsupported provider: %s", c.Provider)
 	}
 }
+
+// EmbeddingConfig selects the embedder used by semantic_search
+type EmbeddingConfig struct {
+	Provider string `json:"provider"` // "openai", "ollama", "gemini" or "hash"
+	Model    string `json:"model"`
+	URL      string `json:"url"`
+	APIKey   string `json:"api_key"`
+}
+
+// NewEmbeddingConfigFromEnv reads the embedding configuration from
+// EVE_EMBEDDING_PROVIDER, EVE_EMBEDDING_MODEL and EVE_EMBEDDING_URL. The
+// offline hashing embedder is the default: remote embedders upload project
+// files, so they are only used when chosen explicitly, even if their API key
+// is set for chat.
+func NewEmbeddingConfigFromEnv() *EmbeddingConfig {
+	cfg := &EmbeddingConfig{
+		Provider: os.Getenv("EVE_EMBEDDING_PROVIDER"),
+		Model:    os.Getenv("EVE_EMBEDDING_MODEL"),
+		URL:      os.Getenv("EVE_EMBEDDING_URL"),
+	}
+
+	if cfg.Provider == "" {
+		cfg.Provider = "hash"
+	}
+
+	switch cfg.Provider {
+	case "openai":
+		cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+	case "gemini":
+		cfg.APIKey = os.Getenv("GEMINI_API_KEY")
+	case "ollama":
+		cfg.APIKey = os.Getenv("EVE_EMBEDDING_API_KEY")
+	}
+	return cfg
+}
+
+// CreateEmbedder creates the embedder described by the config
+func (c *EmbeddingConfig) CreateEmbedder() (Embedder, error) {
+	switch c.Provider {
+	case "openai":
+		url, model := c.URL, c.Model
+		if url == "" {
+			url = "https://api.openai.com/v1"
+		}
+		if model == "" {
+			model = "text-embedding-3-small"
+		}
+		if c.APIKey == "" && c.URL == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is required for the openai embedder")
+		}
+		return NewOpenAICompatibleEmbedder(url, c.APIKey, model), nil
+	case "ollama":
+		url, model := c.URL, c.Model
+		if url == "" {
+			url = "http://localhost:11434/v1"
+		}
+		if model == "" {
+			model = "nomic-embed-text"
+		}
+		return NewOpenAICompatibleEmbedder(url, c.APIKey, model), nil
+	case "gemini":
+		model := c.Model
+		if model == "" {
+			model = "text-embedding-004"
+		}
+		if c.APIKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is required for the gemini embedder")
+		}
+		return NewGeminiEmbedder(c.APIKey, model), nil
+	case "hash":
+		return NewHashEmbedder(512), nil
+	default:
+		return nil, fmt.Errorf("unsupported embedding provider: %s", c.Provider)
+	}
+}
+
+// HTTPConfig controls which hosts network tools may reach and how much they read
+type HTTPConfig struct {
+	AllowHosts       []string            `json:"allow_hosts"` // if set, only these hosts are reachable
+	DenyHosts        []string            `json:"deny_hosts"`
+	Secrets          map[string][]string `json:"secrets"` // environment variables requests may reference, and the hosts each may be sent to
+	Timeout          time.Duration       `json:"timeout"`
+	MaxResponseBytes int64               `json:"max_response_bytes"`
+}
+
+// NewHTTPConfigFromEnv reads the HTTP policy from EVE_HTTP_ALLOW_HOSTS and
+// EVE_HTTP_DENY_HOSTS (comma-separated; "*.example.com" matches subdomains),
+// EVE_HTTP_SECRETS, EVE_HTTP_TIMEOUT (seconds) and EVE_HTTP_MAX_BYTES
+func NewHTTPConfigFromEnv() *HTTPConfig {
+	cfg := &HTTPConfig{
+		AllowHosts:       splitList(strings.ToLower(os.Getenv("EVE_HTTP_ALLOW_HOSTS"))),
+		DenyHosts:        splitList(strings.ToLower(os.Getenv("EVE_HTTP_DENY_HOSTS"))),
+		Secrets:          parseHTTPSecrets(os.Getenv("EVE_HTTP_SECRETS")),
+		Timeout:          httpDefaultTimeout,
+		MaxResponseBytes: httpDefaultMaxResponseBytes,
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("EVE_HTTP_TIMEOUT")); err == nil && seconds > 0 {
+		cfg.Timeout = time.Duration(seconds) * time.Second
+	}
+	if n, err := strconv.ParseInt(os.Getenv("EVE_HTTP_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		cfg.MaxResponseBytes = n
+	}
+	return cfg
+}
+
+// parseHTTPSecrets parses comma-separated NAME=host|host entries, e.g.
+// "GITHUB_TOKEN=api.github.com|uploads.github.com". Entries without hosts
+// are ignored: a secret must be bound to the hosts that may receive it.
+func parseHTTPSecrets(value string) map[string][]string {
+	secrets := make(map[string][]string)
+	for _, entry := range strings.Split(value, ",") {
+		name, hosts, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		for _, host := range strings.Split(hosts, "|") {
+			if host = strings.ToLower(strings.TrimSpace(host)); name != "" && host != "" {
+				secrets[name] = append(secrets[name], host)
+			}
+		}
+	}
+	return secrets
+}
+
+// ToolsConfig selects which registered tools are sent to the model
+type ToolsConfig struct {
+	Profile string   `json:"profile"` // "all", "read-only", "coder" or "researcher"
+	Enable  []string `json:"enable"`  // tool names, package:<name> or category:<name>
+	Disable []string `json:"disable"`
+}
+
+// NewToolsConfigFromEnv reads EVE_TOOL_PROFILE, EVE_TOOLS_ENABLE and EVE_TOOLS_DISABLE
+func NewToolsConfigFromEnv() *ToolsConfig {
+	return &ToolsConfig{
+		Profile: os.Getenv("EVE_TOOL_PROFILE"),
+		Enable:  splitList(os.Getenv("EVE_TOOLS_ENABLE")),
+		Disable: splitList(os.Getenv("EVE_TOOLS_DISABLE")),
+	}
+}
+
+// RetentionPolicy limits how much of a table is kept; zero fields do not limit
+type RetentionPolicy struct {
+	MaxAge   time.Duration `json:"max_age"`
+	MaxCount int           `json:"max_count"` // per file for file versions
+	MaxSize  int64         `json:"max_size"`  // bytes of the records and the content they hold
+}
+
+// RetentionConfig holds the retention policies of the project database
+type RetentionConfig struct {
+	Edits       RetentionPolicy `json:"edits"`
+	Versions    RetentionPolicy `json:"versions"`
+	Checkpoints RetentionPolicy `json:"checkpoints"`
+	Multiplayer RetentionPolicy `json:"multiplayer"`
+}
+
+// NewRetentionConfigFromEnv reads EVE_RETENTION_EDITS, EVE_RETENTION_VERSIONS,
+// EVE_RETENTION_CHECKPOINTS and EVE_RETENTION_MULTIPLAYER, each a list of
+// limits such as "age=90d,count=1000,size=50MB", or "off" to keep everything.
+// By default the last 10000 edits, the last 100 versions of each file and 90
+// days of multiplayer actions are kept; checkpoints are never pruned.
+func NewRetentionConfigFromEnv() *RetentionConfig {
+	cfg := &RetentionConfig{
+		Edits:       RetentionPolicy{MaxCount: 10000},
+		Versions:    RetentionPolicy{MaxCount: 100},
+		Multiplayer: RetentionPolicy{MaxAge: 90 * 24 * time.Hour},
+	}
+	for name, policy := range map[string]*RetentionPolicy{
+		"EDITS":       &cfg.Edits,
+		"VERSIONS":    &cfg.Versions,
+		"CHECKPOINTS": &cfg.Checkpoints,
+		"MULTIPLAYER": &cfg.Multiplayer,
+	} {
+		value := os.Getenv("EVE_RETENTION_" + name)
+		if value == "" {
+			continue
+		}
+		parsed, err := ParseRetentionPolicy(value)
+		if err != nil {
+			log.Printf("Ignoring EVE_RETENTION_%s: %v", name, err)
+			continue
+		}
+		*policy = parsed
+	}
+	return cfg
+}
+
+// ParseRetentionPolicy parses comma-separated limits: age (a Go duration or
+// a number of days such as "30d"), count, and size (bytes with an optional
+// KB, MB or GB suffix). "off" or "none" means no limits.
+func ParseRetentionPolicy(value string) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "off" || value == "none" {
+		return policy, nil
+	}
+
+	for _, limit := range strings.Split(value, ",") {
+		key, arg, ok := strings.Cut(strings.TrimSpace(limit), "=")
+		if !ok {
+			return policy, fmt.Errorf("invalid limit %q (use age=, count= or size=)", limit)
+		}
+		var err error
+		switch strings.TrimSpace(key) {
+		case "age":
+			policy.MaxAge, err = parseRetentionAge(strings.TrimSpace(arg))
+		case "count":
+			policy.MaxCount, err = strconv.Atoi(strings.TrimSpace(arg))
+		case "size":
+			policy.MaxSize, err = parseByteSize(strings.TrimSpace(arg))
+		default:
+			return policy, fmt.Errorf("unknown limit %q (use age, count or size)", key)
+		}
+		if err != nil {
+			return policy, fmt.Errorf("invalid %s limit %q: %w", key, arg, err)
+		}
+	}
+	if policy.MaxAge < 0 || policy.MaxCount < 0 || policy.MaxSize < 0 {
+		return policy, fmt.Errorf("limits must not be negative")
+	}
+	return policy, nil
+}
+
+// parseRetentionAge parses a duration, accepting whole days such as "90d"
+func parseRetentionAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(value)
+}
+
+// parseByteSize parses a byte count with an optional KB, MB or GB suffix
+// (powers of 1024, as printed by formatSize)
+func parseByteSize(value string) (int64, error) {
+	value = strings.TrimSuffix(strings.ToUpper(strings.ReplaceAll(value, " ", "")), "B")
+	multiplier := int64(1)
+	for i, unit := range "KMG" {
+		if number, ok := strings.CutSuffix(value, string(unit)); ok {
+			value = number
+			multiplier = int64(1) << (10 * (i + 1))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	return n * multiplier, err
+}
+
+// String describes the policy, e.g. "age 90d, count 100"
+func (p RetentionPolicy) String() string {
+	var limits []string
+	if p.MaxAge > 0 {
+		if p.MaxAge%(24*time.Hour) == 0 {
+			limits = append(limits, fmt.Sprintf("age %dd", p.MaxAge/(24*time.Hour)))
+		} else {
+			limits = append(limits, "age "+p.MaxAge.String())
+		}
+	}
+	if p.MaxCount > 0 {
+		limits = append(limits, fmt.Sprintf("count %d", p.MaxCount))
+	}
+	if p.MaxSize > 0 {
+		limits = append(limits, "size "+formatSize(p.MaxSize))
+	}
+	if len(limits) == 0 {
+		return "keep everything"
+	}
+	return strings.Join(limits, ", ")
+}
+
+// splitList splits a comma-separated list, dropping empty items. Items keep
+// their case, since tool names are case-sensitive.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,601 @@
+// customtools.go - Tools declared in a project file and run from command or HTTP templates
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+const (
+	// customToolsFile is where project-specific tools are declared
+	customToolsFile = ".eve/tools.json"
+	// customToolDefaultTimeout bounds a custom command when no timeout is declared
+	customToolDefaultTimeout = 60 * time.Second
+	// customToolMaxOutput caps the output returned by a custom command
+	customToolMaxOutput = 100 * 1024
+)
+
+// customToolName restricts names to what every provider accepts
+var customToolName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+
+// placeholderPattern matches {{name}} argument placeholders in templates
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+// CustomToolsFile is the project file declaring custom tools and tool chains
+type CustomToolsFile struct {
+	Tools  []CustomToolSpec `json:"tools"`
+	Chains []ToolChainSpec  `json:"chains,omitempty"`
+}
+
+// CustomToolSpec declares one tool. Exactly one of Command and HTTP is set.
+// Templates reference arguments as {{name}}. Commands receive arguments as
+// positional parameters, so values are never parsed by the shell; in HTTP
+// templates they are percent-encoded in URLs, stripped of line breaks in
+// headers and escaped as JSON string content in bodies.
+type CustomToolSpec struct {
+	Name           string           `json:"name"`
+	Description    string           `json:"description"`
+	InputSchema    CustomToolSchema `json:"input_schema"`
+	Command        string           `json:"command,omitempty"`
+	WorkDir        string           `json:"workdir,omitempty"`
+	HTTP           *CustomToolHTTP  `json:"http,omitempty"`
+	TimeoutSeconds int              `json:"timeout_seconds,omitempty"`
+
+	script     string   // Command with placeholders replaced by positional parameters
+	scriptArgs []string // argument names passed as $1, $2, ...
+}
+
+// CustomToolHTTP is an HTTP request template
+type CustomToolHTTP struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// CustomToolSchema is the JSON schema of a custom tool's input object
+type CustomToolSchema struct {
+	Type       string                         `json:"type,omitempty"`
+	Properties map[string]*CustomToolProperty `json:"properties"`
+	Required   []string                       `json:"required,omitempty"`
+}
+
+// CustomToolProperty describes one argument
+type CustomToolProperty struct {
+	Type        string        `json:"type"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Items       interface{}   `json:"items,omitempty"`
+}
+
+// customToolTypes are the JSON schema types accepted for arguments
+var customToolTypes = map[string]bool{
+	"string": true, "integer": true, "number": true, "boolean": true, "array": true, "object": true,
+}
+
+// customToolsPath returns the declaration file, overridable with EVE_TOOLS_FILE
+func customToolsPath() string {
+	if path := os.Getenv("EVE_TOOLS_FILE"); path != "" {
+		return path
+	}
+	return customToolsFile
+}
+
+// LoadCustomTools reads and validates the tools and chains declared in path.
+// A missing file yields no tools. Names may not shadow the tools in registry,
+// and a chain may call those, custom tools and chains declared before it.
+// Chains look their steps up in registry when they run, so they can only
+// call tools that are enabled at that time.
+func LoadCustomTools(path string, registry *ToolRegistry) ([]ToolDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var file CustomToolsFile
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	names := map[string]bool{}
+	available := map[string]ToolDefinition{}
+	for _, tool := range registry.Definitions() {
+		names[tool.Name] = true
+		available[tool.Name] = tool
+	}
+
+	var tools []ToolDefinition
+	for i := range file.Tools {
+		spec := &file.Tools[i]
+		if err := spec.validate(names); err != nil {
+			return nil, fmt.Errorf("%s: tool %d (%s): %w", path, i+1, spec.Name, err)
+		}
+		definition := spec.definition()
+		names[spec.Name] = true
+		available[spec.Name] = definition
+		tools = append(tools, definition)
+	}
+	for i := range file.Chains {
+		chain := &file.Chains[i]
+		if err := chain.validate(names, available); err != nil {
+			return nil, fmt.Errorf("%s: chain %d (%s): %w", path, i+1, chain.Name, err)
+		}
+		definition := chain.definition(registry.Lookup)
+		names[chain.Name] = true
+		available[chain.Name] = definition
+		tools = append(tools, definition)
+	}
+	return tools, nil
+}
+
+// validate checks a declaration before it is offered to the model
+func (spec *CustomToolSpec) validate(taken map[string]bool) error {
+	if !customToolName.MatchString(spec.Name) {
+		return fmt.Errorf("name must start with a letter and contain only letters, digits, '_' or '-' (max 64)")
+	}
+	if taken[spec.Name] {
+		return fmt.Errorf("name %q is already used by another tool", spec.Name)
+	}
+	if strings.TrimSpace(spec.Description) == "" {
+		return fmt.Errorf("description is required")
+	}
+	if (spec.Command == "") == (spec.HTTP == nil) {
+		return fmt.Errorf("exactly one of command or http must be set")
+	}
+	if spec.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout_seconds must not be negative")
+	}
+
+	schema := &spec.InputSchema
+	if err := schema.validate(); err != nil {
+		return err
+	}
+
+	if placeholderPattern.MatchString(spec.WorkDir) {
+		return fmt.Errorf("workdir must not contain placeholders")
+	}
+	templates := []string{spec.Command}
+	if spec.Command != "" {
+		var err error
+		if spec.script, spec.scriptArgs, err = compileCommand(spec.Command); err != nil {
+			return err
+		}
+	}
+	if spec.HTTP != nil {
+		method := strings.ToUpper(spec.HTTP.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+		switch method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead:
+		default:
+			return fmt.Errorf("unsupported HTTP method %q", spec.HTTP.Method)
+		}
+		spec.HTTP.Method = method
+
+		u, err := url.Parse(placeholderPattern.ReplaceAllString(spec.HTTP.URL, "x"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("http.url must be an absolute http or https URL")
+		}
+		_, rest, _ := strings.Cut(spec.HTTP.URL, "://")
+		authority, _, _ := strings.Cut(rest, "/")
+		if placeholderPattern.MatchString(strings.Split(authority, "?")[0]) {
+			return fmt.Errorf("http.url must not take its host from an argument")
+		}
+		templates = append(templates, spec.HTTP.URL, spec.HTTP.Body)
+		for name, value := range spec.HTTP.Headers {
+			if placeholderPattern.MatchString(name) {
+				return fmt.Errorf("header name %q must not contain placeholders", name)
+			}
+			templates = append(templates, value)
+		}
+	}
+	for _, template := range templates {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+			if schema.Properties[match[1]] == nil {
+				return fmt.Errorf("template references undeclared argument {{%s}}", match[1])
+			}
+		}
+	}
+	return nil
+}
+
+// definition turns a validated declaration into a ToolDefinition
+func (spec *CustomToolSpec) definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        spec.Name,
+		Description: spec.Description,
+		InputSchema: spec.InputSchema.param(),
+		Function: func(input json.RawMessage) (string, error) {
+			return spec.run(input)
+		},
+	}
+}
+
+// run validates the arguments and executes the tool
+func (spec *CustomToolSpec) run(input json.RawMessage) (string, error) {
+	args, err := spec.InputSchema.arguments(input)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := customToolDefaultTimeout
+	if spec.TimeoutSeconds > 0 {
+		timeout = time.Duration(spec.TimeoutSeconds) * time.Second
+	}
+	if spec.HTTP != nil {
+		return spec.runHTTP(args, min(timeout, httpMaxTimeout))
+	}
+	return spec.runCommand(args, timeout)
+}
+
+// validate checks the declared properties and required list
+func (schema *CustomToolSchema) validate() error {
+	if schema.Type != "" && schema.Type != "object" {
+		return fmt.Errorf("input_schema type must be object")
+	}
+	if schema.Properties == nil {
+		schema.Properties = map[string]*CustomToolProperty{}
+	}
+	for name, prop := range schema.Properties {
+		if prop == nil || !customToolTypes[prop.Type] {
+			return fmt.Errorf("property %q must have a type of string, integer, number, boolean, array or object", name)
+		}
+		if prop.Default != nil {
+			if err := checkArgumentType(name, prop, prop.Default); err != nil {
+				return fmt.Errorf("default: %w", err)
+			}
+		}
+	}
+	for _, name := range schema.Required {
+		if schema.Properties[name] == nil {
+			return fmt.Errorf("required property %q is not declared", name)
+		}
+	}
+	return nil
+}
+
+// param converts the schema to the form sent to providers
+func (schema *CustomToolSchema) param() anthropic.ToolInputSchemaParam {
+	properties := map[string]interface{}{}
+	for name, prop := range schema.Properties {
+		properties[name] = prop
+	}
+	return anthropic.ToolInputSchemaParam{
+		Properties: properties,
+		Required:   schema.Required,
+	}
+}
+
+// arguments decodes the input and checks it against the schema, filling in
+// defaults
+func (schema *CustomToolSchema) arguments(input json.RawMessage) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if len(input) > 0 && string(input) != "null" {
+		decoder := json.NewDecoder(strings.NewReader(string(input)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&args); err != nil {
+			return nil, fmt.Errorf("input must be a JSON object: %w", err)
+		}
+	}
+
+	for name, value := range args {
+		prop := schema.Properties[name]
+		if prop == nil {
+			return nil, fmt.Errorf("unknown argument %q", name)
+		}
+		if err := checkArgumentType(name, prop, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range schema.Required {
+		if _, ok := args[name]; !ok {
+			return nil, fmt.Errorf("missing required argument %q", name)
+		}
+	}
+	for name, prop := range schema.Properties {
+		if _, ok := args[name]; !ok && prop.Default != nil {
+			args[name] = prop.Default
+		}
+	}
+	return args, nil
+}
+
+// checkArgumentType verifies a value against its declared type and enum
+func checkArgumentType(name string, prop *CustomToolProperty, value interface{}) error {
+	ok := false
+	switch prop.Type {
+	case "string":
+		_, ok = value.(string)
+	case "boolean":
+		_, ok = value.(bool)
+	case "number":
+		switch v := value.(type) {
+		case json.Number:
+			_, err := v.Float64()
+			ok = err == nil
+		case float64:
+			ok = true
+		}
+	case "integer":
+		switch v := value.(type) {
+		case json.Number:
+			_, err := v.Int64()
+			ok = err == nil
+		case float64:
+			ok = v == float64(int64(v))
+		}
+	case "array":
+		_, ok = value.([]interface{})
+	case "object":
+		_, ok = value.(map[string]interface{})
+	}
+	if !ok {
+		return fmt.Errorf("argument %q must be of type %s", name, prop.Type)
+	}
+
+	if len(prop.Enum) > 0 {
+		for _, allowed := range prop.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("argument %q must be one of %v", name, prop.Enum)
+	}
+	return nil
+}
+
+// argumentString renders a value for substitution; strings are used as-is
+// and other values as JSON
+func argumentString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// expandTemplate replaces {{name}} placeholders, escaping each value with escape
+func expandTemplate(template string, args map[string]interface{}, escape func(string) string) string {
+	return placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return escape(argumentString(args[name]))
+	})
+}
+
+// compileCommand replaces the placeholders of a command template with
+// positional parameters and returns the argument names in parameter order.
+// A placeholder becomes "${N}" where it is unquoted and ${N} inside double
+// quotes; either way the shell expands the value without parsing it.
+// Placeholders inside single quotes would not be expanded, so they are an
+// error.
+func compileCommand(template string) (string, []string, error) {
+	const (
+		unquoted = iota
+		double
+		backtick
+		subshell // $( ... ), which starts an unquoted context
+	)
+	stack := []int{unquoted}
+	var script strings.Builder
+	var names []string
+	index := map[string]int{}
+
+	for i := 0; i < len(template); {
+		top := stack[len(stack)-1]
+		if loc := placeholderPattern.FindStringSubmatchIndex(template[i:]); loc != nil && loc[0] == 0 {
+			name := template[i+loc[2] : i+loc[3]]
+			n, ok := index[name]
+			if !ok {
+				names = append(names, name)
+				n = len(names)
+				index[name] = n
+			}
+			if top == double {
+				fmt.Fprintf(&script, "${%d}", n)
+			} else {
+				fmt.Fprintf(&script, `"${%d}"`, n)
+			}
+			i += loc[1]
+			continue
+		}
+
+		c := template[i]
+		switch {
+		case c == '\\' && i+1 < len(template):
+			script.WriteString(template[i : i+2])
+			i += 2
+			continue
+		case c == '\'' && top != double:
+			end := strings.IndexByte(template[i+1:], '\'')
+			if end < 0 {
+				return "", nil, fmt.Errorf("command has an unterminated single quote")
+			}
+			quoted := template[i : i+end+2]
+			if placeholderPattern.MatchString(quoted) {
+				return "", nil, fmt.Errorf("command must not use placeholders inside single quotes")
+			}
+			script.WriteString(quoted)
+			i += len(quoted)
+			continue
+		case c == '#' && top != double && (i == 0 || strings.ContainsRune(" \t\n;&|(", rune(template[i-1]))):
+			// A comment runs to the end of the line
+			end := strings.IndexByte(template[i:], '\n')
+			if end < 0 {
+				end = len(template) - i
+			}
+			script.WriteString(template[i : i+end])
+			i += end
+			continue
+		case c == '"' && top == double:
+			stack = stack[:len(stack)-1]
+		case c == '"':
+			stack = append(stack, double)
+		case c == '`' && top == backtick:
+			stack = stack[:len(stack)-1]
+		case c == '`':
+			stack = append(stack, backtick)
+		case c == '$' && i+1 < len(template) && template[i+1] == '(':
+			stack = append(stack, subshell)
+			script.WriteString("$(")
+			i += 2
+			continue
+		case c == ')' && top == subshell:
+			stack = stack[:len(stack)-1]
+		}
+		script.WriteByte(c)
+		i++
+	}
+	if len(stack) != 1 {
+		return "", nil, fmt.Errorf("command has unbalanced quotes or command substitutions")
+	}
+	return script.String(), names, nil
+}
+
+// runCommand executes the compiled command with the arguments as positional
+// parameters
+func (spec *CustomToolSpec) runCommand(args map[string]interface{}, timeout time.Duration) (string, error) {
+	values := make([]string, len(spec.scriptArgs))
+	for i, name := range spec.scriptArgs {
+		values[i] = argumentString(args[name])
+	}
+	log.Printf("Running custom tool %s: %s %q", spec.Name, spec.Command, values)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// $0 is the tool name, so "${1}" is the first argument
+	cmd := exec.CommandContext(ctx, "bash", append([]string{"-c", spec.script, spec.Name}, values...)...)
+	cmd.Dir = spec.WorkDir
+
+	output, err := cmd.CombinedOutput()
+	result := string(output)
+	if len(result) > customToolMaxOutput {
+		result = truncateUTF8(result, customToolMaxOutput) + fmt.Sprintf("\n[output truncated at %d bytes]", customToolMaxOutput)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("%s timed out after %s, output: %s", spec.Name, timeout, result)
+	}
+	if err != nil {
+		return "", fmt.Errorf("command failed: %w, output: %s", err, result)
+	}
+	return result, nil
+}
+
+// runHTTP sends the HTTP template with escaped arguments through the HTTP policy
+func (spec *CustomToolSpec) runHTTP(args map[string]interface{}, timeout time.Duration) (string, error) {
+	rawURL := spec.HTTP.URL
+	path, query, hasQuery := strings.Cut(rawURL, "?")
+	rawURL = expandTemplate(path, args, url.PathEscape)
+	if hasQuery {
+		rawURL += "?" + expandTemplate(query, args, url.QueryEscape)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	cfg := globalHTTPConfig
+
+	// Secret references are expanded in the declared template only, before
+	// arguments are substituted, so an argument cannot reference a secret
+	headers := map[string]string{}
+	for name, value := range spec.HTTP.Headers {
+		template, err := cfg.expandSecretRefs(value, u.Hostname())
+		if err != nil {
+			return "", err
+		}
+		headers[name] = expandTemplate(template, args, func(s string) string {
+			return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+		})
+	}
+
+	var body io.Reader
+	if spec.HTTP.Body != "" {
+		contentType := ""
+		for name, value := range headers {
+			if strings.EqualFold(name, "Content-Type") {
+				contentType = value
+			}
+		}
+		if contentType == "" {
+			contentType = "application/json"
+			headers["Content-Type"] = contentType
+		}
+		body = strings.NewReader(expandTemplate(spec.HTTP.Body, args, bodyEscaper(contentType)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := newPolicyRequest(ctx, cfg, spec.HTTP.Method, rawURL, body, headers)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Running custom tool %s: %s %s\n%s", spec.Name, req.Method, req.URL.Redacted(), formatHeaders(req.Header))
+
+	resp, err := cfg.Client(timeout).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, truncated, err := readLimited(resp.Body, cfg.MaxResponseBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return formatHTTPResponse(resp, data, truncated, cfg.MaxResponseBytes), nil
+}
+
+// bodyEscaper returns how arguments are escaped in a request body of the
+// given content type: as JSON string content, as form values, or not at all
+func bodyEscaper(contentType string) func(string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return func(s string) string {
+			data, _ := json.Marshal(s)
+			return string(data[1 : len(data)-1])
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		return url.QueryEscape
+	}
+	return func(s string) string { return s }
+}
+
+// customToolNames lists tool names for log messages
+func customToolNames(tools []ToolDefinition) string {
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Name
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,113 @@
+// customtools_test.go - Argument quoting of command templates and HTTP request bodies
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		script   string
+		args     []string
+		err      string
+	}{
+		{"unquoted", "echo {{msg}}", `echo "${1}"`, []string{"msg"}, ""},
+		{"double quotes", `grep "{{pattern}}" {{file}}`, `grep "${1}" "${2}"`, []string{"pattern", "file"}, ""},
+		{"repeated argument", "cp {{a}} {{a}}.bak", `cp "${1}" "${1}".bak`, []string{"a"}, ""},
+		{"command substitution", "echo $(cat {{f}})", `echo $(cat "${1}")`, []string{"f"}, ""},
+		{"substitution inside double quotes", `echo "$(cat {{f}})"`, `echo "$(cat "${1}")"`, []string{"f"}, ""},
+		{"backticks", "echo `cat {{f}}`", "echo `cat \"${1}\"`", []string{"f"}, ""},
+		{"escaped quote", `echo \"{{x}}`, `echo \""${1}"`, []string{"x"}, ""},
+		{"single quotes without placeholders", `echo '{' {{x}}`, `echo '{' "${1}"`, []string{"x"}, ""},
+		{"comment", "ls {{dir}} # {{x}}", `ls "${1}" # {{x}}`, []string{"dir"}, ""},
+		{"placeholder in single quotes", "echo '{{x}}'", "", nil, "inside single quotes"},
+		{"unterminated single quote", "echo 'abc", "", nil, "unterminated single quote"},
+		{"unbalanced double quote", `echo "{{x}}`, "", nil, "unbalanced"},
+		{"unbalanced substitution", "echo $(cat {{x}}", "", nil, "unbalanced"},
+	}
+	for _, tt := range tests {
+		script, args, err := compileCommand(tt.template)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || script != tt.script || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: got %q %v, %v, want %q %v", tt.name, script, args, err, tt.script, tt.args)
+		}
+	}
+}
+
+func TestRunCommandPassesArgumentsAsData(t *testing.T) {
+	dir := t.TempDir()
+	spec := &CustomToolSpec{Name: "echo_tool", Command: `echo "[{{a}}]" {{b}} $(echo {{c}})`, WorkDir: dir}
+	var err error
+	if spec.script, spec.scriptArgs, err = compileCommand(spec.Command); err != nil {
+		t.Fatal(err)
+	}
+
+	args := map[string]interface{}{
+		"a": `"; touch pwned; echo "`,
+		"b": "$(touch pwned) *",
+		"c": "`touch pwned`",
+	}
+	output, err := spec.runCommand(args, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[\"; touch pwned; echo \"] $(touch pwned) * `touch pwned`\n"; output != want {
+		t.Fatalf("output = %q, want %q", output, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+		t.Fatal("an argument was run as a command")
+	}
+}
+
+func TestRunHTTPBody(t *testing.T) {
+	type request struct{ contentType, body string }
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{r.Header.Get("Content-Type"), string(body)}
+	}))
+	defer server.Close()
+
+	previous := globalHTTPConfig
+	globalHTTPConfig = &HTTPConfig{Timeout: 5 * time.Second, MaxResponseBytes: httpDefaultMaxResponseBytes}
+	defer func() { globalHTTPConfig = previous }()
+
+	value := `say "hi" & bye`
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		body        string
+		contentType string
+		want        string
+	}{
+		{"JSON by default", nil, `{"text": "{{v}}"}`, "application/json", `{"text": "say \"hi\" \u0026 bye"}`},
+		{"lower-case JSON header", map[string]string{"content-type": "application/vnd.api+json"}, `{"text": "{{v}}"}`, "application/vnd.api+json", `{"text": "say \"hi\" \u0026 bye"}`},
+		{"form", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, "text={{v}}", "application/x-www-form-urlencoded", "text=say+%22hi%22+%26+bye"},
+		{"plain text", map[string]string{"CONTENT-TYPE": "text/plain; charset=utf-8"}, "Message: {{v}}", "text/plain; charset=utf-8", "Message: " + value},
+	}
+	for _, tt := range tests {
+		spec := &CustomToolSpec{Name: "post", HTTP: &CustomToolHTTP{Method: http.MethodPost, URL: server.URL, Headers: tt.headers, Body: tt.body}}
+		if _, err := spec.runHTTP(map[string]interface{}{"v": value}, 5*time.Second); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := <-received
+		if got.contentType != tt.contentType || got.body != tt.want {
+			t.Errorf("%s: got %q with body %q, want %q with body %q", tt.name, got.contentType, got.body, tt.contentType, tt.want)
+		}
+	}
+}
@@ -2,20 +2,26 @@ package main
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
+	"sync"
 	"time"
 )
 
-// ProjectDatabase manages project data using file-based storage
+// ProjectDatabase manages project data on top of a Storage backend. Caches
+// (embedding index, fetched pages) are always kept as files in projectDir.
+//
+// It is safe for concurrent use: the backends serialize their own writes,
+// and mu keeps the backend from being closed or swapped while a call is
+// using it.
 type ProjectDatabase struct {
 	projectDir string
-	nextID     map[string]int
+	mu         sync.RWMutex
+	store      Storage
 }
 
 // ProjectFile represents a file in the project
@@ -30,24 +36,55 @@ type ProjectFile struct {
 	IsActive   bool      `json:"is_active"`
 }
 
-// EditHistory tracks all edits made to files
-type EditHistory struct {
+// FileVersion is one saved version of a project file; the content is stored as a blob
+type FileVersion struct {
 	ID        int       `json:"id"`
 	FileID    int       `json:"file_id"`
-	OldHash   string    `json:"old_hash"`
-	NewHash   string    `json:"new_hash"`
-	Diff      string    `json:"diff"`
-	Timestamp time.Time `json:"timestamp"`
-	User      string    `json:"user"`
+	Path      string    `json:"path"`
+	Version   int       `json:"version"`
+	Hash      string    `json:"hash"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Note      string    `json:"note,omitempty"` // e.g. "restored from version 2"
+}
+
+// EditHistory tracks all edits made to files
+type EditHistory struct {
+	ID        int         `json:"id"`
+	FileID    int         `json:"file_id"`
+	Path      string      `json:"path"`
+	Operation string      `json:"operation"` // "create", "modify" or "delete"
+	Tool      string      `json:"tool"`
+	OldHash   string      `json:"old_hash"`
+	NewHash   string      `json:"new_hash"`
+	Diff      string      `json:"diff"`
+	Timestamp time.Time   `json:"timestamp"`
+	User      string      `json:"user"`
+	Session   string      `json:"session"`
+	Group     string      `json:"group"`          // edits made by the same tool call share a group
+	Undone    bool        `json:"undone"`         // set while the edit is reverted by undo
+	Mode      os.FileMode `json:"mode,omitempty"` // permissions of the file, used when undo or redo recreates it
 }
 
 // Checkpoint represents a project snapshot
 type Checkpoint struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Timestamp   time.Time `json:"timestamp"`
-	FileCount   int       `json:"file_count"`
+	ID          int                       `json:"id"`
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	Timestamp   time.Time                 `json:"timestamp"`
+	FileCount   int                       `json:"file_count"`
+	Files       map[string]CheckpointFile `json:"files,omitempty"`      // working tree content by relative path
+	Skipped     []string                  `json:"skipped,omitempty"`    // files too large to snapshot
+	GitCommit   string                    `json:"git_commit,omitempty"` // shadow commit holding the contents, for checkpoints stored in git
+}
+
+// CheckpointFile is one file captured by a checkpoint. The content is stored
+// as a blob, or as a git object for checkpoints stored in git.
+type CheckpointFile struct {
+	Hash    string      `json:"hash"`
+	Mode    os.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	GitBlob string      `json:"git_blob,omitempty"`
 }
 
 // MCPIntegration represents an MCP integration
@@ -69,7 +106,9 @@ type MultiplayerAction struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// NewProjectDatabase creates a new database connection (file-based)
+// NewProjectDatabase opens the project database. The storage backend is
+// chosen by EVE_DB_BACKEND, defaulting to SQLite when a database exists in
+// the project directory and to JSON files otherwise.
 func NewProjectDatabase(dbPath string) (*ProjectDatabase, error) {
 	projectDir := filepath.Dir(dbPath)
 	if projectDir == "." {
@@ -80,349 +119,422 @@ func NewProjectDatabase(dbPath string) (*ProjectDatabase, error) {
 		return nil, fmt.Errorf("failed to create project directory: %w", err)
 	}
 
-	pdb := &ProjectDatabase{
-		projectDir: projectDir,
-		nextID:     make(map[string]int),
+	pdb := &ProjectDatabase{projectDir: projectDir}
+	if err := pdb.openStore(); err != nil {
+		return nil, err
 	}
-
-	// Initialize nextID counters
-	pdb.loadNextIDs()
-
 	return pdb, nil
 }
 
-// Close closes the database connection (no-op for file-based storage)
+// Close closes the storage backend
 func (pdb *ProjectDatabase) Close() error {
-	pdb.saveNextIDs()
-	return nil
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+	return pdb.store.Close()
 }
 
-// loadNextIDs loads the next ID counters from file
-func (pdb *ProjectDatabase) loadNextIDs() {
-	idFile := filepath.Join(pdb.projectDir, "next_ids.json")
-	if data, err := ioutil.ReadFile(idFile); err == nil {
-		json.Unmarshal(data, &pdb.nextID)
-	}
+// reopen closes the storage backend, flushing anything it buffers, and
+// opens it again
+func (pdb *ProjectDatabase) reopen() error {
+	return pdb.swapStore(func() error { return nil })
 }
 
-// saveNextIDs saves the next ID counters to file
-func (pdb *ProjectDatabase) saveNextIDs() {
-	idFile := filepath.Join(pdb.projectDir, "next_ids.json")
-	if data, err := json.MarshalIndent(pdb.nextID, "", "  "); err == nil {
-		ioutil.WriteFile(idFile, data, 0644)
+// swapStore closes the storage backend, runs fn while no other call can use
+// it, and then opens whichever backend is found in the project directory.
+// The backend is reopened even if fn fails.
+func (pdb *ProjectDatabase) swapStore(fn func() error) error {
+	pdb.mu.Lock()
+	defer pdb.mu.Unlock()
+
+	if err := pdb.store.Close(); err != nil {
+		return fmt.Errorf("failed to close project database: %w", err)
+	}
+	err := fn()
+	if openErr := pdb.openStore(); openErr != nil && err == nil {
+		err = openErr
 	}
+	return err
 }
 
-// getNextID returns the next ID for a table
-func (pdb *ProjectDatabase) getNextID(table string) int {
-	id := pdb.nextID[table]
-	pdb.nextID[table] = id + 1
-	return id + 1
+// openStore opens the backend found in the project directory. Callers
+// other than NewProjectDatabase must hold mu.
+func (pdb *ProjectDatabase) openStore() error {
+	store, err := openStorage(storageBackend(pdb.projectDir), pdb.projectDir)
+	if err != nil {
+		return err
+	}
+	pdb.store = store
+	return nil
 }
 
-// SaveFile saves a file to the project
-func (pdb *ProjectDatabase) SaveFile(path, content string) error {
-	hash := fmt.Sprintf("%x", md5.Sum([]byte(content)))
-
-	// Check if file exists
-	existing, err := pdb.GetFile(path)
-	if err == nil && existing.IsActive {
-		// Update existing file
-		existing.Content = content
-		existing.Hash = hash
-		existing.Version++
-		existing.ModifiedAt = time.Now()
-		return pdb.saveFileRecord(existing)
-	}
+// Backend returns the name of the storage backend in use
+func (pdb *ProjectDatabase) Backend() string {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.Name()
+}
 
-	// Create new file
-	file := &ProjectFile{
-		ID:         pdb.getNextID("files"),
-		Path:       path,
-		Content:    content,
-		Hash:       hash,
-		Version:    1,
-		CreatedAt:  time.Now(),
-		ModifiedAt: time.Now(),
-		IsActive:   true,
-	}
+// contentHash returns the MD5 hash kept in file records to detect unchanged
+// content. Blobs are addressed by blobHash.
+func contentHash(content string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(content)))
+}
 
-	return pdb.saveFileRecord(file)
+// blobHash returns the SHA-256 hash that blobs are stored under
+func blobHash(content []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(content))
 }
 
-// saveFileRecord saves a file record to disk
-func (pdb *ProjectDatabase) saveFileRecord(file *ProjectFile) error {
-	dir := filepath.Join(pdb.projectDir, "files")
-	os.MkdirAll(dir, 0755)
+// legacyBlobHash reports whether hash is an MD5 hash, which blobs were
+// stored under before they were keyed on SHA-256
+func legacyBlobHash(hash string) bool {
+	return len(hash) == 2*md5.Size
+}
 
-	filePath := filepath.Join(dir, fmt.Sprintf("%d.json", file.ID))
-	data, err := json.MarshalIndent(file, "", "  ")
-	if err != nil {
-		return err
+// hashMatches reports whether content is the content stored under hash
+func hashMatches(hash string, content []byte) bool {
+	if legacyBlobHash(hash) {
+		return contentHash(string(content)) == hash
 	}
+	return blobHash(content) == hash
+}
 
-	return ioutil.WriteFile(filePath, data, 0644)
+// SaveFile saves a file to the project. Every version is kept; saving
+// unchanged content does not create a new one.
+func (pdb *ProjectDatabase) SaveFile(path, content string) error {
+	_, err := pdb.saveFileVersion(path, content, "")
+	return err
 }
 
-// GetFile retrieves a file from the project
-func (pdb *ProjectDatabase) GetFile(path string) (*ProjectFile, error) {
-	dir := filepath.Join(pdb.projectDir, "files")
-	files, err := ioutil.ReadDir(dir)
-	if err != nil {
-		return nil, err
+// saveFileVersion stores content as the newest version of path and returns
+// that version
+func (pdb *ProjectDatabase) saveFileVersion(path, content, note string) (*FileVersion, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	var saved *FileVersion
+	err := pdb.store.Transaction(func(tx Storage) error {
+		file, err := tx.GetFile(path)
+		if err != nil {
+			file = nil
+		}
+		versions, err := tx.ListFileVersions(path)
+		if err != nil {
+			return err
+		}
+		_, versions, err = saveFileContent(tx, file, versions, path, content, note)
+		if err != nil {
+			return err
+		}
+		saved = versions[len(versions)-1]
+		return nil
+	})
+	return saved, err
+}
+
+// pendingFileVersion is a file content to be saved by saveFileVersions
+type pendingFileVersion struct {
+	Path    string
+	Content string
+	Note    string
+}
+
+// saveFileVersions saves many files and marks the deleted paths deleted in
+// one transaction. The file records and versions are read once and indexed
+// by path, since the file backend scans a whole table for every lookup.
+func (pdb *ProjectDatabase) saveFileVersions(saves []pendingFileVersion, deleted []string) error {
+	if len(saves) == 0 && len(deleted) == 0 {
+		return nil
 	}
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	return pdb.store.Transaction(func(tx Storage) error {
+		files, err := tx.ListFiles()
+		if err != nil {
+			return err
+		}
+		allVersions, err := tx.ListFileVersions("")
+		if err != nil {
+			return err
+		}
+		byPath := make(map[string]*ProjectFile, len(files))
+		for _, file := range files {
+			byPath[file.Path] = file
+		}
+		versions := map[string][]*FileVersion{}
+		for _, version := range allVersions {
+			versions[version.Path] = append(versions[version.Path], version)
+		}
 
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".json") {
-			filePath := filepath.Join(dir, file.Name())
-			data, err := ioutil.ReadFile(filePath)
+		for _, save := range saves {
+			file, updated, err := saveFileContent(tx, byPath[save.Path], versions[save.Path], save.Path, save.Content, save.Note)
 			if err != nil {
-				continue
+				return fmt.Errorf("%s: %w", save.Path, err)
 			}
-
-			var f ProjectFile
-			if err := json.Unmarshal(data, &f); err != nil {
+			byPath[save.Path] = file
+			versions[save.Path] = updated
+		}
+		for _, path := range deleted {
+			file, ok := byPath[path]
+			if !ok {
 				continue
 			}
-
-			if f.Path == path && f.IsActive {
-				return &f, nil
+			file.IsActive = false
+			file.ModifiedAt = time.Now()
+			if err := tx.PutFile(file); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
 			}
+			delete(byPath, path)
 		}
-	}
+		return nil
+	})
+}
 
-	return nil, fmt.Errorf("file not found")
+// DeleteFile marks a file as deleted. Its versions are kept.
+func (pdb *ProjectDatabase) DeleteFile(path string) error {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	return pdb.store.Transaction(func(tx Storage) error {
+		file, err := tx.GetFile(path)
+		if err != nil {
+			return nil
+		}
+		file.IsActive = false
+		file.ModifiedAt = time.Now()
+		return tx.PutFile(file)
+	})
+}
+
+// GetFile retrieves a file from the project
+func (pdb *ProjectDatabase) GetFile(path string) (*ProjectFile, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.GetFile(path)
 }
 
 // ListFiles returns all active files in the project
 func (pdb *ProjectDatabase) ListFiles() ([]*ProjectFile, error) {
-	dir := filepath.Join(pdb.projectDir, "files")
-	files, err := ioutil.ReadDir(dir)
-	if err != nil {
-		return nil, err
-	}
-
-	var result []*ProjectFile
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".json") {
-			filePath := filepath.Join(dir, file.Name())
-			data, err := ioutil.ReadFile(filePath)
-			if err != nil {
-				continue
-			}
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.ListFiles()
+}
 
-			var f ProjectFile
-			if err := json.Unmarshal(data, &f); err != nil {
-				continue
-			}
+// RecordEdit stores an edit history entry, linking it to the tracked file if there is one
+func (pdb *ProjectDatabase) RecordEdit(edit *EditHistory) error {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
 
-			if f.IsActive {
-				result = append(result, &f)
+	return pdb.store.Transaction(func(tx Storage) error {
+		if edit.FileID == 0 {
+			if file, err := tx.GetFile(edit.Path); err == nil {
+				edit.FileID = file.ID
 			}
 		}
-	}
+		edit.ID = 0
+		if edit.Timestamp.IsZero() {
+			edit.Timestamp = time.Now()
+		}
+		return tx.PutEdit(edit)
+	})
+}
 
-	return result, nil
+// UpdateEdit rewrites an existing edit history entry
+func (pdb *ProjectDatabase) UpdateEdit(edit *EditHistory) error {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.PutEdit(edit)
 }
 
-// CreateCheckpoint creates a new checkpoint
-func (pdb *ProjectDatabase) CreateCheckpoint(name, description string) (*Checkpoint, error) {
-	files, err := pdb.ListFiles()
-	if err != nil {
-		return nil, err
-	}
+// SaveBlob stores content addressed by its hash and returns the hash.
+// Identical content is only stored once.
+func (pdb *ProjectDatabase) SaveBlob(content []byte) (string, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
 
-	checkpoint := &Checkpoint{
-		ID:          pdb.getNextID("checkpoints"),
-		Name:        name,
-		Description: description,
-		Timestamp:   time.Now(),
-		FileCount:   len(files),
-	}
+	hash := blobHash(content)
+	return hash, pdb.store.PutBlob(hash, content)
+}
+
+// GetBlob returns the content stored under hash
+func (pdb *ProjectDatabase) GetBlob(hash string) ([]byte, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.GetBlob(hash)
+}
+
+// LoadRedoStack returns the edit groups that can be redone, most recent last
+func (pdb *ProjectDatabase) LoadRedoStack() []string {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	var stack []string
+	pdb.store.GetState("redo_stack", &stack)
+	return stack
+}
 
-	return checkpoint, pdb.saveCheckpointRecord(checkpoint)
+// SaveRedoStack persists the redo stack
+func (pdb *ProjectDatabase) SaveRedoStack(stack []string) error {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.PutState("redo_stack", stack)
 }
 
-// saveCheckpointRecord saves a checkpoint record
-func (pdb *ProjectDatabase) saveCheckpointRecord(checkpoint *Checkpoint) error {
-	dir := filepath.Join(pdb.projectDir, "checkpoints")
-	os.MkdirAll(dir, 0755)
+// LoadWorkingTreeState loads the working tree tracker's last scan into
+// state and reports whether there was one
+func (pdb *ProjectDatabase) LoadWorkingTreeState(state interface{}) (bool, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.GetState("working_tree", state)
+}
+
+// SaveWorkingTreeState persists the working tree tracker's last scan
+func (pdb *ProjectDatabase) SaveWorkingTreeState(state interface{}) error {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.PutState("working_tree", state)
+}
 
-	filePath := filepath.Join(dir, fmt.Sprintf("%d.json", checkpoint.ID))
-	data, err := json.MarshalIndent(checkpoint, "", "  ")
+// LoadEmbeddingIndex reads the semantic search index into index. A missing
+// index is not an error.
+func (pdb *ProjectDatabase) LoadEmbeddingIndex(index interface{}) error {
+	data, err := ioutil.ReadFile(filepath.Join(pdb.projectDir, "embeddings", "index.json"))
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		return err
 	}
+	return json.Unmarshal(data, index)
+}
 
-	return ioutil.WriteFile(filePath, data, 0644)
+// SaveEmbeddingIndex persists the semantic search index
+func (pdb *ProjectDatabase) SaveEmbeddingIndex(index interface{}) error {
+	dir := filepath.Join(pdb.projectDir, "embeddings")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "index.json"), data, 0644)
 }
 
-// ListCheckpoints returns all checkpoints
-func (pdb *ProjectDatabase) ListCheckpoints() ([]*Checkpoint, error) {
-	dir := filepath.Join(pdb.projectDir, "checkpoints")
-	files, err := ioutil.ReadDir(dir)
+// GetWebCache loads the cached page for url into page. It reports false if
+// the page is not cached.
+func (pdb *ProjectDatabase) GetWebCache(url string, page interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(pdb.projectDir, "web_cache", contentHash(url)+".json"))
 	if err != nil {
-		return nil, err
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
 	}
+	return true, json.Unmarshal(data, page)
+}
 
-	var result []*Checkpoint
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".json") {
-			filePath := filepath.Join(dir, file.Name())
-			data, err := ioutil.ReadFile(filePath)
-			if err != nil {
-				continue
-			}
+// SaveWebCache stores a fetched page keyed by its URL
+func (pdb *ProjectDatabase) SaveWebCache(url string, page interface{}) error {
+	dir := filepath.Join(pdb.projectDir, "web_cache")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, contentHash(url)+".json"), data, 0644)
+}
 
-			var c Checkpoint
-			if err := json.Unmarshal(data, &c); err != nil {
-				continue
-			}
+// GetEditHistory returns edit history entries (newest first), optionally filtered by path
+func (pdb *ProjectDatabase) GetEditHistory(path string, limit int) ([]*EditHistory, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.ListEdits(path, limit)
+}
 
-			result = append(result, &c)
-		}
+// CreateCheckpoint records a checkpoint of files whose contents have already
+// been stored with SaveBlob, or in the git commit gitCommit when it is set
+func (pdb *ProjectDatabase) CreateCheckpoint(name, description string, files map[string]CheckpointFile, skipped []string, gitCommit string) (*Checkpoint, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	checkpoint := &Checkpoint{
+		Name:        name,
+		Description: description,
+		Timestamp:   time.Now(),
+		FileCount:   len(files),
+		Files:       files,
+		Skipped:     skipped,
+		GitCommit:   gitCommit,
 	}
 
-	// Sort by timestamp (newest first)
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].Timestamp.After(result[j].Timestamp)
-	})
+	return checkpoint, pdb.store.PutCheckpoint(checkpoint)
+}
 
-	return result, nil
+// GetCheckpoint returns the checkpoint with the given ID
+func (pdb *ProjectDatabase) GetCheckpoint(id int) (*Checkpoint, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.GetCheckpoint(id)
+}
+
+// ListCheckpoints returns all checkpoints, newest first
+func (pdb *ProjectDatabase) ListCheckpoints() ([]*Checkpoint, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.ListCheckpoints()
 }
 
 // AddMCPIntegration adds a new MCP integration
 func (pdb *ProjectDatabase) AddMCPIntegration(name, mcpType string, config map[string]interface{}) error {
-	integration := &MCPIntegration{
-		ID:        pdb.getNextID("mcp"),
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.PutMCPIntegration(&MCPIntegration{
 		Name:      name,
 		Type:      mcpType,
 		Config:    config,
 		CreatedAt: time.Now(),
 		IsActive:  true,
-	}
-
-	return pdb.saveMCPRecord(integration)
-}
-
-// saveMCPRecord saves an MCP integration record
-func (pdb *ProjectDatabase) saveMCPRecord(integration *MCPIntegration) error {
-	dir := filepath.Join(pdb.projectDir, "mcp")
-	os.MkdirAll(dir, 0755)
-
-	filePath := filepath.Join(dir, fmt.Sprintf("%d.json", integration.ID))
-	data, err := json.MarshalIndent(integration, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return ioutil.WriteFile(filePath, data, 0644)
+	})
 }
 
-// GetMCPIntegrations returns all MCP integrations
+// GetMCPIntegrations returns the active MCP integrations
 func (pdb *ProjectDatabase) GetMCPIntegrations() ([]*MCPIntegration, error) {
-	dir := filepath.Join(pdb.projectDir, "mcp")
-	files, err := ioutil.ReadDir(dir)
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	integrations, err := pdb.store.ListMCPIntegrations()
 	if err != nil {
 		return nil, err
 	}
 
 	var result []*MCPIntegration
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".json") {
-			filePath := filepath.Join(dir, file.Name())
-			data, err := ioutil.ReadFile(filePath)
-			if err != nil {
-				continue
-			}
-
-			var m MCPIntegration
-			if err := json.Unmarshal(data, &m); err != nil {
-				continue
-			}
-
-			if m.IsActive {
-				result = append(result, &m)
-			}
+	for _, m := range integrations {
+		if m.IsActive {
+			result = append(result, m)
 		}
 	}
-
 	return result, nil
 }
 
 // RecordMultiplayerAction records a multiplayer action
 func (pdb *ProjectDatabase) RecordMultiplayerAction(user, action, data string) error {
-	mpAction := &MultiplayerAction{
-		ID:        pdb.getNextID("multiplayer"),
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.PutMultiplayerAction(&MultiplayerAction{
 		User:      user,
 		Action:    action,
 		Data:      data,
 		Timestamp: time.Now(),
-	}
-
-	return pdb.saveMultiplayerRecord(mpAction)
-}
-
-// saveMultiplayerRecord saves a multiplayer action record
-func (pdb *ProjectDatabase) saveMultiplayerRecord(action *MultiplayerAction) error {
-	dir := filepath.Join(pdb.projectDir, "multiplayer")
-	os.MkdirAll(dir, 0755)
-
-	filePath := filepath.Join(dir, fmt.Sprintf("%d.json", action.ID))
-	data, err := json.MarshalIndent(action, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return ioutil.WriteFile(filePath, data, 0644)
-}
-
-// GetMultiplayerHistory returns multiplayer action history
-func (pdb *ProjectDatabase) GetMultiplayerHistory(limit int) ([]*MultiplayerAction, error) {
-	dir := filepath.Join(pdb.projectDir, "multiplayer")
-	files, err := ioutil.ReadDir(dir)
-	if err != nil {
-		return nil, err
-	}
-
-	var result []*MultiplayerAction
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".json") {
-			filePath := filepath.Join(dir, file.Name())
-			data, err := ioutil.ReadFile(filePath)
-			if err != nil {
-				continue
-			}
-
-			var a MultiplayerAction
-			if err := json.Unmarshal(data, &a); err != nil {
-				continue
-			}
-
-			result = append(result, &a)
-		}
-	}
-
-	// Sort by timestamp (newest first)
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].Timestamp.After(result[j].Timestamp)
 	})
-
-	// Apply limit
-	if limit > 0 && len(result) > limit {
-		result = result[:limit]
-	}
-
-	return result, nil
 }
 
-// BackupProject creates a backup of the project
-func (pdb *ProjectDatabase) BackupProject(backupPath string) error {
-	// For file-based storage, we can just copy the directory
-	return fmt.Errorf("backup not implemented for file-based storage")
-}
-
-// RestoreProject restores a project from backup
-func (pdb *ProjectDatabase) RestoreProject(backupPath string) error {
-	return fmt.Errorf("restore not implemented for file-based storage")
+// GetMultiplayerHistory returns multiplayer action history, newest first
+func (pdb *ProjectDatabase) GetMultiplayerHistory(limit int) ([]*MultiplayerAction, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.ListMultiplayerActions(limit)
 }
@@ -0,0 +1,291 @@
+// database_test.go - Concurrency tests for the project database; run with -race
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// openTestDatabase opens a project database in dir with the given backend
+func openTestDatabase(t *testing.T, backend, dir string) *ProjectDatabase {
+	t.Helper()
+	t.Setenv("EVE_DB_BACKEND", backend)
+	pdb, err := NewProjectDatabase(filepath.Join(dir, "project.db"))
+	if err != nil {
+		t.Fatalf("NewProjectDatabase: %v", err)
+	}
+	return pdb
+}
+
+// checkEdits verifies that the store holds want edits with distinct IDs
+func checkEdits(t *testing.T, pdb *ProjectDatabase, want int) {
+	t.Helper()
+	edits, err := pdb.GetEditHistory("", 0)
+	if err != nil {
+		t.Fatalf("GetEditHistory: %v", err)
+	}
+	if len(edits) != want {
+		t.Fatalf("got %d edits, want %d", len(edits), want)
+	}
+	seen := make(map[int]bool)
+	for _, edit := range edits {
+		if seen[edit.ID] {
+			t.Fatalf("edit ID %d assigned twice", edit.ID)
+		}
+		seen[edit.ID] = true
+	}
+}
+
+func TestProjectDatabaseConcurrentGoroutines(t *testing.T) {
+	const workers, perWorker = 8, 20
+
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			pdb := openTestDatabase(t, backend, t.TempDir())
+			defer pdb.Close()
+
+			var wg sync.WaitGroup
+			errs := make(chan error, workers*perWorker*3)
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < perWorker; i++ {
+						path := fmt.Sprintf("w%d/file%d.go", w, i)
+						errs <- pdb.SaveFile(path, "content")
+						errs <- pdb.SaveFile("shared.go", fmt.Sprintf("%d-%d", w, i))
+						errs <- pdb.RecordEdit(&EditHistory{Path: path, Operation: "create", Tool: "test"})
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			checkEdits(t, pdb, workers*perWorker)
+
+			files, err := pdb.ListFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != workers*perWorker+1 {
+				t.Fatalf("got %d files, want %d", len(files), workers*perWorker+1)
+			}
+			shared, err := pdb.GetFile("shared.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Every save of the shared file must be counted exactly once
+			if shared.Version != workers*perWorker {
+				t.Fatalf("shared.go is at version %d, want %d", shared.Version, workers*perWorker)
+			}
+		})
+	}
+}
+
+// TestProjectDatabaseSharedDirectory opens the same directory several times,
+// the way separate EVE processes would, and writes through all of them
+func TestProjectDatabaseSharedDirectory(t *testing.T) {
+	const instances, perInstance = 4, 25
+
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			dbs := make([]*ProjectDatabase, instances)
+			for i := range dbs {
+				dbs[i] = openTestDatabase(t, backend, dir)
+				defer dbs[i].Close()
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, instances*perInstance)
+			for _, pdb := range dbs {
+				wg.Add(1)
+				go func(pdb *ProjectDatabase) {
+					defer wg.Done()
+					for i := 0; i < perInstance; i++ {
+						errs <- pdb.RecordEdit(&EditHistory{Path: "main.go", Operation: "modify", Tool: "test"})
+					}
+				}(pdb)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			checkEdits(t, dbs[0], instances*perInstance)
+		})
+	}
+}
+
+// TestFileStoreIDsSurviveCrash checks that IDs are not reused when the
+// database was never closed, or when next_ids.json lags behind the records
+func TestFileStoreIDsSurviveCrash(t *testing.T) {
+	dir := t.TempDir()
+	pdb := openTestDatabase(t, StorageFile, dir)
+	for i := 0; i < 3; i++ {
+		if err := pdb.RecordEdit(&EditHistory{Path: "a.go", Operation: "modify"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// No Close: the process is gone
+
+	pdb = openTestDatabase(t, StorageFile, dir)
+	edit := &EditHistory{Path: "a.go", Operation: "modify"}
+	if err := pdb.RecordEdit(edit); err != nil {
+		t.Fatal(err)
+	}
+	if edit.ID != 4 {
+		t.Fatalf("edit after restart got ID %d, want 4", edit.ID)
+	}
+
+	// Counters written by older versions only on exit can be stale
+	if err := os.WriteFile(filepath.Join(dir, "next_ids.json"), []byte(`{"edits": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pdb = openTestDatabase(t, StorageFile, dir)
+	edit = &EditHistory{Path: "a.go", Operation: "modify"}
+	if err := pdb.RecordEdit(edit); err != nil {
+		t.Fatal(err)
+	}
+	if edit.ID != 5 {
+		t.Fatalf("edit with stale counters got ID %d, want 5", edit.ID)
+	}
+	checkEdits(t, pdb, 5)
+}
+
+// TestProjectDatabaseReopenDuringWrites swaps the backend while other
+// goroutines keep writing, as backup and restore do
+func TestProjectDatabaseReopenDuringWrites(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			pdb := openTestDatabase(t, backend, t.TempDir())
+			defer pdb.Close()
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 60)
+			for w := 0; w < 2; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 25; i++ {
+						errs <- pdb.RecordEdit(&EditHistory{Path: "b.go", Operation: "modify"})
+					}
+				}()
+			}
+			for i := 0; i < 10; i++ {
+				errs <- pdb.reopen()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			checkEdits(t, pdb, 50)
+		})
+	}
+}
+
+// TestFileStoreTransactionRollback checks that a failed transaction leaves
+// no records, blobs, state or ID allocations behind
+func TestFileStoreTransactionRollback(t *testing.T) {
+	dir := t.TempDir()
+	store := newFileStore(dir)
+	kept := &EditHistory{Path: "a.go", Operation: "modify"}
+	if err := store.PutEdit(kept); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutState("redo_stack", []string{"g1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := store.Transaction(func(tx Storage) error {
+		if err := tx.PutEdit(&EditHistory{Path: "b.go", Operation: "create"}); err != nil {
+			return err
+		}
+		if err := tx.PutEdit(&EditHistory{ID: kept.ID, Path: "a.go", Operation: "delete"}); err != nil {
+			return err
+		}
+		if err := tx.PutBlob("tx-blob", []byte("content")); err != nil {
+			return err
+		}
+		if err := tx.PutState("redo_stack", []string{"g2"}); err != nil {
+			return err
+		}
+		return fmt.Errorf("fail")
+	})
+	if err == nil || err.Error() != "fail" {
+		t.Fatalf("Transaction error = %v, want fail", err)
+	}
+
+	edits, err := store.ListEdits("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 1 || edits[0].Operation != "modify" {
+		t.Fatalf("edits after rollback = %+v, want the original edit only", edits)
+	}
+	if _, err := store.GetBlob("tx-blob"); err == nil {
+		t.Fatal("blob written by the failed transaction remains")
+	}
+	var redo []string
+	if _, err := store.GetState("redo_stack", &redo); err != nil || len(redo) != 1 || redo[0] != "g1" {
+		t.Fatalf("redo_stack after rollback = %v (%v), want [g1]", redo, err)
+	}
+
+	edit := &EditHistory{Path: "c.go", Operation: "create"}
+	if err := store.PutEdit(edit); err != nil {
+		t.Fatal(err)
+	}
+	if edit.ID != 2 {
+		t.Fatalf("edit after rollback got ID %d, want 2", edit.ID)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".eve-tmp-tx-*")); len(matches) > 0 {
+		t.Fatalf("transaction journal left behind: %v", matches)
+	}
+}
+
+// TestMigrateStorageKeepsDeletedFiles checks that records of deleted files,
+// which versions and edits still refer to, are migrated
+func TestMigrateStorageKeepsDeletedFiles(t *testing.T) {
+	dir := t.TempDir()
+	pdb := openTestDatabase(t, StorageFile, dir)
+	for _, path := range []string{"a.go", "b.go"} {
+		if err := pdb.SaveFile(path, "package main\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pdb.DeleteFile("a.go"); err != nil {
+		t.Fatal(err)
+	}
+	pdb.Close()
+
+	if _, err := MigrateStorage(pdb.projectDir, StorageFile, StorageSQLite); err != nil {
+		t.Fatalf("MigrateStorage: %v", err)
+	}
+	store, err := openStorage(StorageSQLite, pdb.projectDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	files, err := store.ListAllFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].IsActive || !files[1].IsActive {
+		t.Fatalf("migrated files = %+v, want a.go deleted and b.go active", files)
+	}
+}
@@ -0,0 +1,239 @@
+// diff.go - Line-based unified diff generation
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContextLines = 3    // unchanged lines shown around each hunk
+	diffMaxEditCost  = 1000 // changed lines searched for a minimal diff; more are diffed as one block
+)
+
+// diffOp is a single line-level operation in an edit script
+type diffOp struct {
+	Kind byte // ' ' for context, '-' for deletion, '+' for insertion
+	Text string
+}
+
+// splitLines splits text into lines, keeping the trailing newline on each line
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a minimal line edit script turning a into b
+func diffLines(a, b []string) []diffOp {
+	// Trim the common prefix and suffix so the search only sees the changed region
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{Kind: ' ', Text: line})
+	}
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	if mid := myersDiff(midA, midB, diffMaxEditCost); mid != nil {
+		ops = append(ops, mid...)
+	} else {
+		// Too different to search for a minimal script: replace the whole region
+		for _, line := range midA {
+			ops = append(ops, diffOp{Kind: '-', Text: line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{Kind: '+', Text: line})
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{Kind: ' ', Text: line})
+	}
+
+	return ops
+}
+
+// myersDiff finds a shortest edit script turning a into b with Myers' O(ND)
+// algorithm. It returns nil if the script needs more than maxCost insertions
+// and deletions, which bounds both time and memory.
+func myersDiff(a, b []string, maxCost int) []diffOp {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return []diffOp{}
+	}
+	maxCost = min(maxCost, n+m)
+
+	// v[offset+k] is the furthest x reached on diagonal k = x-y. trace[d]
+	// keeps diagonals -d-1..d+1 as they were before round d, for the walk back.
+	offset := maxCost + 1
+	v := make([]int, 2*maxCost+3)
+	var trace [][]int
+	end := -1
+	for d := 0; d <= maxCost && end < 0; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // insertion: down from diagonal k+1
+			} else {
+				x = v[offset+k-1] + 1 // deletion: right from diagonal k-1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				end = d
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return nil
+	}
+
+	// Walk back from the end, collecting operations in reverse
+	var ops []diffOp
+	x, y := n, m
+	for d := end; d >= 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{Kind: ' ', Text: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{Kind: '+', Text: b[y-1]})
+			} else {
+				ops = append(ops, diffOp{Kind: '-', Text: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// UnifiedDiff returns a unified diff between oldContent and newContent.
+// An empty string is returned when the contents are identical.
+func UnifiedDiff(oldPath, newPath, oldContent, newContent string) string {
+	if oldContent == newContent {
+		return ""
+	}
+
+	ops := diffLines(splitLines(oldContent), splitLines(newContent))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldPath, newPath)
+
+	// Walk the edit script and group changes that are close together into hunks
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(ops); {
+		if ops[start].Kind == ' ' {
+			oldLine++
+			newLine++
+			start++
+			continue
+		}
+
+		// Extend the hunk until we see more than 2*context unchanged lines in a row
+		end := start
+		for end < len(ops) {
+			if ops[end].Kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContextLines {
+				break
+			}
+			end = run
+		}
+
+		before := start
+		for before > 0 && start-before < diffContextLines && ops[before-1].Kind == ' ' {
+			before--
+		}
+		after := end
+		for after < len(ops) && after-end < diffContextLines && ops[after].Kind == ' ' {
+			after++
+		}
+
+		hunkOldStart := oldLine - (start - before)
+		hunkNewStart := newLine - (start - before)
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, op := range ops[before:after] {
+			switch op.Kind {
+			case ' ':
+				oldCount++
+				newCount++
+			case '-':
+				oldCount++
+			case '+':
+				newCount++
+			}
+			body.WriteByte(op.Kind)
+			body.WriteString(op.Text)
+			if !strings.HasSuffix(op.Text, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(hunkOldStart, oldCount), hunkRange(hunkNewStart, newCount))
+		sb.WriteString(body.String())
+
+		for _, op := range ops[start:after] {
+			if op.Kind != '+' {
+				oldLine++
+			}
+			if op.Kind != '-' {
+				newLine++
+			}
+		}
+		start = after
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats a hunk range the way diff(1) does
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,120 @@
+// diff_test.go - Line edit scripts and unified diff output
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", ""},
+		{"modify", "a\nb\nc\n", "a\nB\nc\n", "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"create", "", "a\nb\n", "--- a/f\n+++ b/f\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"delete", "a\n", "", "--- a/f\n+++ b/f\n@@ -1 +0,0 @@\n-a\n"},
+		{"missing newline", "a\nb", "a\nc", "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\nX\n3\n4\n5\n6\n7\n8\n9\n10\n11\nY\n",
+			"--- a/f\n+++ b/f\n@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+Y\n",
+		},
+		{
+			"close changes share a hunk",
+			"1\n2\n3\n4\n5\n6\n7\n",
+			"1\nX\n3\n4\n5\nY\n7\n",
+			"--- a/f\n+++ b/f\n@@ -1,7 +1,7 @@\n 1\n-2\n+X\n 3\n 4\n 5\n-6\n+Y\n 7\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := UnifiedDiff("a/f", "b/f", tt.old, tt.new); got != tt.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// checkEditScript verifies that ops turns a into b and returns the number of
+// changed lines
+func checkEditScript(t *testing.T, a, b []string, ops []diffOp) int {
+	t.Helper()
+	var gotA, gotB []string
+	changed := 0
+	for _, op := range ops {
+		if op.Kind != '+' {
+			gotA = append(gotA, op.Text)
+		}
+		if op.Kind != '-' {
+			gotB = append(gotB, op.Text)
+		}
+		if op.Kind != ' ' {
+			changed++
+		}
+	}
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Fatalf("edit script does not turn %q into %q: %v", a, b, ops)
+	}
+	return changed
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a'+rng.Intn(3))) + "\n"
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := randomLines(), randomLines()
+		changed := checkEditScript(t, a, b, diffLines(a, b))
+		if want := len(a) + len(b) - 2*lcsLength(a, b); changed != want {
+			t.Fatalf("diff of %q and %q changes %d lines, want %d", a, b, changed, want)
+		}
+	}
+}
+
+func TestDiffLinesLargeChange(t *testing.T) {
+	// Two unrelated large files exceed the edit cost and become one block
+	var a, b []string
+	for i := 0; i < 20000; i++ {
+		a = append(a, fmt.Sprintf("old %d\n", i))
+		b = append(b, fmt.Sprintf("new %d\n", i))
+	}
+	a[10000], b[10000] = "shared\n", "shared\n"
+	if changed := checkEditScript(t, a, b, diffLines(a, b)); changed != len(a)+len(b) {
+		t.Fatalf("changed %d lines, want the whole region of %d", changed, len(a)+len(b))
+	}
+
+	// Scattered edits in a large file are still diffed line by line
+	c := append([]string(nil), a...)
+	for i := 0; i < len(c); i += 100 {
+		c[i] = "edited\n"
+	}
+	if changed := checkEditScript(t, a, c, diffLines(a, c)); changed != 2*200 {
+		t.Fatalf("changed %d lines, want 400", changed)
+	}
+}
@@ -0,0 +1,62 @@
+// edit.go - Edit engine shared by the file editing tools
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EditOperation describes a single search-and-replace on a file
+type EditOperation struct {
+	OldStr     string `json:"old_string" jsonschema_description:"The exact text to replace. Must match exactly once unless replace_all is set."`
+	NewStr     string `json:"new_string" jsonschema_description:"The text to replace old_string with."`
+	ReplaceAll bool   `json:"replace_all,omitempty" jsonschema_description:"Replace every occurrence of old_string instead of requiring a unique match."`
+}
+
+// EditResult summarizes the outcome of applying a batch of edits
+type EditResult struct {
+	Content      string
+	Replacements int
+	Diff         string
+}
+
+// ApplyEdits applies edits to content in order. Each edit sees the output of
+// the previous one. If any edit fails, no result is returned so callers can
+// leave the file untouched.
+func ApplyEdits(path, content string, edits []EditOperation) (*EditResult, error) {
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("no edits provided")
+	}
+
+	newContent := content
+	replacements := 0
+	for i, edit := range edits {
+		if edit.OldStr == "" {
+			return nil, fmt.Errorf("edit %d: old_string must not be empty", i+1)
+		}
+		if edit.OldStr == edit.NewStr {
+			return nil, fmt.Errorf("edit %d: old_string and new_string must be different", i+1)
+		}
+
+		count := strings.Count(newContent, edit.OldStr)
+		if count == 0 {
+			return nil, fmt.Errorf("edit %d: old_string not found in %s", i+1, path)
+		}
+		if count > 1 && !edit.ReplaceAll {
+			return nil, fmt.Errorf("edit %d: old_string found %d times in %s, must be unique (add more context or set replace_all)", i+1, count, path)
+		}
+
+		if edit.ReplaceAll {
+			newContent = strings.ReplaceAll(newContent, edit.OldStr, edit.NewStr)
+		} else {
+			newContent = strings.Replace(newContent, edit.OldStr, edit.NewStr, 1)
+		}
+		replacements += count
+	}
+
+	return &EditResult{
+		Content:      newContent,
+		Replacements: replacements,
+		Diff:         UnifiedDiff("a/"+path, "b/"+path, content, newContent),
+	}, nil
+}
@@ -0,0 +1,57 @@
+// edit_test.go - Search-and-replace edits shared by the file editing tools
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyEdits(t *testing.T) {
+	const content = "alpha\nbeta\nalpha\ngamma\n"
+	tests := []struct {
+		name         string
+		edits        []EditOperation
+		want         string
+		replacements int
+		err          string
+	}{
+		{"unique match", []EditOperation{{OldStr: "beta", NewStr: "BETA"}}, "alpha\nBETA\nalpha\ngamma\n", 1, ""},
+		{"ambiguous match", []EditOperation{{OldStr: "alpha", NewStr: "ALPHA"}}, "", 0, "found 2 times"},
+		{"replace all", []EditOperation{{OldStr: "alpha", NewStr: "ALPHA", ReplaceAll: true}}, "ALPHA\nbeta\nALPHA\ngamma\n", 2, ""},
+		{"context makes a match unique", []EditOperation{{OldStr: "alpha\ngamma", NewStr: "delta"}}, "alpha\nbeta\ndelta\n", 1, ""},
+		{"not found", []EditOperation{{OldStr: "omega", NewStr: "x"}}, "", 0, "not found"},
+		{"empty old string", []EditOperation{{OldStr: "", NewStr: "x"}}, "", 0, "must not be empty"},
+		{"no change", []EditOperation{{OldStr: "beta", NewStr: "beta"}}, "", 0, "must be different"},
+		{"no edits", nil, "", 0, "no edits"},
+		{
+			"batch sees earlier edits",
+			[]EditOperation{{OldStr: "beta", NewStr: "omega"}, {OldStr: "omega\nalpha", NewStr: "done"}},
+			"alpha\ndone\ngamma\n", 2, "",
+		},
+		{
+			"failing edit in a batch",
+			[]EditOperation{{OldStr: "beta", NewStr: "BETA"}, {OldStr: "beta", NewStr: "x"}},
+			"", 0, "edit 2: old_string not found",
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := ApplyEdits("f.txt", content, tt.edits)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) || result != nil {
+				t.Errorf("%s: got %v, %v, want error %q", tt.name, result, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if result.Content != tt.want || result.Replacements != tt.replacements {
+			t.Errorf("%s: got %q with %d replacements, want %q with %d", tt.name, result.Content, result.Replacements, tt.want, tt.replacements)
+		}
+		if result.Diff != UnifiedDiff("a/f.txt", "b/f.txt", content, tt.want) {
+			t.Errorf("%s: diff does not match the content:\n%s", tt.name, result.Diff)
+		}
+	}
+}
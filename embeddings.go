@@ -0,0 +1,273 @@
+// embeddings.go - Pluggable text embedders for semantic search
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// Embedder turns text into vectors for semantic search
+type Embedder interface {
+	// Embed returns one vector per input text, in order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+
+	// Name identifies the embedder and model; indexes built with a different
+	// name are discarded and rebuilt
+	Name() string
+}
+
+// OpenAICompatibleEmbedder calls an OpenAI-style /embeddings endpoint. This
+// covers the OpenAI API as well as local model servers such as Ollama,
+// LM Studio and llama.cpp that expose the same API.
+type OpenAICompatibleEmbedder struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewOpenAICompatibleEmbedder creates an embedder for an OpenAI-style endpoint
+func NewOpenAICompatibleEmbedder(baseURL, apiKey, model string) *OpenAICompatibleEmbedder {
+	return &OpenAICompatibleEmbedder{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Name returns the embedder identity
+func (e *OpenAICompatibleEmbedder) Name() string {
+	return "openai-compatible:" + e.baseURL + ":" + e.model
+}
+
+// Embed sends the texts to the /embeddings endpoint
+func (e *OpenAICompatibleEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": e.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 256*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding request failed: %s: %s", resp.Status, truncateUTF8(string(data), 500))
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding response: %w", err)
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding response has %d vectors for %d inputs", len(parsed.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, d := range parsed.Data {
+		index := d.Index
+		if index < 0 || index >= len(texts) {
+			index = i
+		}
+		vectors[index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// GeminiEmbedder uses the Gemini embedding API
+type GeminiEmbedder struct {
+	apiKey string
+	model  string
+}
+
+// NewGeminiEmbedder creates a Gemini embedder
+func NewGeminiEmbedder(apiKey, model string) *GeminiEmbedder {
+	return &GeminiEmbedder{apiKey: apiKey, model: model}
+}
+
+// Name returns the embedder identity
+func (e *GeminiEmbedder) Name() string {
+	return "gemini:" + e.model
+}
+
+// Embed embeds the texts in a single batch request
+func (e *GeminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(e.apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
+	}
+	defer client.Close()
+
+	model := client.EmbeddingModel(e.model)
+	batch := model.NewBatch()
+	for _, text := range texts {
+		batch.AddContent(genai.Text(text))
+	}
+	res, err := model.BatchEmbedContents(ctx, batch)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	if len(res.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding response has %d vectors for %d inputs", len(res.Embeddings), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, emb := range res.Embeddings {
+		vectors[i] = emb.Values
+	}
+	return vectors, nil
+}
+
+// HashEmbedder is an offline fallback that hashes identifiers and words into
+// a fixed-size vector. It captures vocabulary overlap rather than meaning, but
+// needs no model and keeps semantic_search usable without network access.
+type HashEmbedder struct {
+	dims int
+}
+
+// NewHashEmbedder creates a hashing embedder with the given dimensionality
+func NewHashEmbedder(dims int) *HashEmbedder {
+	if dims <= 0 {
+		dims = 512
+	}
+	return &HashEmbedder{dims: dims}
+}
+
+// Name returns the embedder identity
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash:%d", e.dims)
+}
+
+// Embed hashes the tokens of each text
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := make([]float32, e.dims)
+		for _, token := range embeddingTokens(text) {
+			h := fnv.New32a()
+			h.Write([]byte(token))
+			sum := h.Sum32()
+			sign := float32(1)
+			if sum&1 == 1 {
+				sign = -1
+			}
+			vec[int(sum>>1)%e.dims] += sign
+		}
+		normalize(vec)
+		vectors[i] = vec
+	}
+	return vectors, nil
+}
+
+// embeddingTokens splits text into lower-case words, also splitting
+// camelCase and snake_case identifiers into their parts
+func embeddingTokens(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	var tokens []string
+	for _, word := range words {
+		tokens = append(tokens, strings.ToLower(word))
+		for _, part := range splitIdentifier(word) {
+			if len(part) > 1 && !strings.EqualFold(part, word) {
+				tokens = append(tokens, strings.ToLower(part))
+			}
+		}
+	}
+	return tokens
+}
+
+// splitIdentifier splits camelCase and snake_case identifiers
+func splitIdentifier(word string) []string {
+	var parts []string
+	var current []rune
+	runes := []rune(word)
+	for i, r := range runes {
+		if r == '_' {
+			if len(current) > 0 {
+				parts = append(parts, string(current))
+			}
+			current = nil
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) && len(current) > 0 &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			parts = append(parts, string(current))
+			current = nil
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
+
+// normalize scales vec to unit length in place
+func normalize(vec []float32) {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vec {
+		vec[i] /= norm
+	}
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
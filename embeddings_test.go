@@ -0,0 +1,72 @@
+// embeddings_test.go - Tokenizing and the offline hash embedder
+package main
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEmbeddingTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"retry the request", []string{"retry", "the", "request"}},
+		{"parseHTTPRequest", []string{"parsehttprequest", "parse", "http", "request"}},
+		{"max_retry_count = 3", []string{"max_retry_count", "max", "retry", "count", "3"}},
+		{"a.b(c)", []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		if got := embeddingTokens(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("embeddingTokens(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHashEmbedder(t *testing.T) {
+	e := NewHashEmbedder(0)
+	if e.Name() != "hash:512" {
+		t.Fatalf("default embedder is %s", e.Name())
+	}
+
+	texts := []string{
+		"func retryRequest(client *http.Client) error",
+		"the request is retried by retryRequest",
+		"render the sidebar menu in the template",
+		"",
+	}
+	vectors, err := e.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("got %d vectors for %d texts", len(vectors), len(texts))
+	}
+	for i, vec := range vectors[:3] {
+		var sum float64
+		for _, v := range vec {
+			sum += float64(v) * float64(v)
+		}
+		if len(vec) != 512 || math.Abs(sum-1) > 1e-5 {
+			t.Errorf("vector %d has %d dimensions and squared length %f", i, len(vec), sum)
+		}
+	}
+
+	// Texts sharing vocabulary are closer than unrelated ones
+	related := cosineSimilarity(vectors[0], vectors[1])
+	unrelated := cosineSimilarity(vectors[0], vectors[2])
+	if related <= unrelated {
+		t.Errorf("related similarity %f is not above unrelated %f", related, unrelated)
+	}
+	if got := cosineSimilarity(vectors[0], vectors[3]); got != 0 {
+		t.Errorf("similarity with an empty text = %f", got)
+	}
+
+	// The same text always embeds to the same vector
+	again, err := e.Embed(context.Background(), texts[:1])
+	if err != nil || !reflect.DeepEqual(again[0], vectors[0]) {
+		t.Fatalf("embedding is not deterministic: %v", err)
+	}
+}
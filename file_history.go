@@ -0,0 +1,320 @@
+// file_history.go - Version history of files saved to the project database
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// legacyVersionNote marks the current content of files saved before every
+// version was kept
+const legacyVersionNote = "saved before version history was kept"
+
+// recordFileVersion stores the file's current content as a blob and records
+// it as a version
+func recordFileVersion(tx Storage, file *ProjectFile, note string) (*FileVersion, error) {
+	hash := blobHash([]byte(file.Content))
+	if err := tx.PutBlob(hash, []byte(file.Content)); err != nil {
+		return nil, err
+	}
+	version := &FileVersion{
+		FileID:    file.ID,
+		Path:      file.Path,
+		Version:   file.Version,
+		Hash:      hash,
+		Size:      len(file.Content),
+		CreatedAt: file.ModifiedAt,
+		Note:      note,
+	}
+	return version, tx.PutFileVersion(version)
+}
+
+// saveFileContent stores content as the newest version of path, given the
+// path's active file record (nil if there is none) and its versions, oldest
+// first. It returns the file record and the updated versions; saving
+// unchanged content does not create a new version.
+func saveFileContent(tx Storage, file *ProjectFile, versions []*FileVersion, path, content, note string) (*ProjectFile, []*FileVersion, error) {
+	hash := contentHash(content)
+	if file != nil {
+		// Files saved before version history existed only have their current content
+		if n := len(versions); n == 0 || versions[n-1].Version != file.Version {
+			legacy, err := recordFileVersion(tx, file, legacyVersionNote)
+			if err != nil {
+				return nil, nil, err
+			}
+			versions = append(versions, legacy)
+		}
+		if file.Hash == hash {
+			return file, versions, nil
+		}
+		file.Content = content
+		file.Hash = hash
+		file.Version++
+		file.ModifiedAt = time.Now()
+	} else {
+		file = &ProjectFile{
+			Path:       path,
+			Content:    content,
+			Hash:       hash,
+			Version:    1,
+			CreatedAt:  time.Now(),
+			ModifiedAt: time.Now(),
+			IsActive:   true,
+		}
+		// A path deleted earlier continues its version numbering
+		if n := len(versions); n > 0 {
+			file.Version = versions[n-1].Version + 1
+		}
+	}
+	if err := tx.PutFile(file); err != nil {
+		return nil, nil, err
+	}
+
+	version, err := recordFileVersion(tx, file, note)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, append(versions, version), nil
+}
+
+// fileVersions returns every version of path, oldest first. The current
+// content of a file saved before version history was kept is included with
+// ID 0; it is recorded on the next save. The caller must hold pdb.mu.
+func (pdb *ProjectDatabase) fileVersions(path string) ([]*FileVersion, error) {
+	versions, err := pdb.store.ListFileVersions(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := pdb.store.GetFile(path)
+	if err == nil && (len(versions) == 0 || versions[len(versions)-1].Version != file.Version) {
+		versions = append(versions, &FileVersion{
+			FileID:    file.ID,
+			Path:      file.Path,
+			Version:   file.Version,
+			Hash:      file.Hash,
+			Size:      len(file.Content),
+			CreatedAt: file.ModifiedAt,
+			Note:      legacyVersionNote,
+		})
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%s has not been saved to the project database", path)
+	}
+	return versions, nil
+}
+
+// findFileVersion returns the given version from versions; 0 selects the
+// current one
+func findFileVersion(versions []*FileVersion, version int) (*FileVersion, error) {
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no version %d (versions %d-%d)", versions[0].Path, version, versions[0].Version, versions[len(versions)-1].Version)
+}
+
+// versionContent loads the content of a version. The caller must hold pdb.mu.
+func (pdb *ProjectDatabase) versionContent(v *FileVersion) (string, error) {
+	if v.ID == 0 {
+		file, err := pdb.store.GetFile(v.Path)
+		if err != nil {
+			return "", err
+		}
+		return file.Content, nil
+	}
+
+	content, err := pdb.store.GetBlob(v.Hash)
+	if err != nil {
+		return "", fmt.Errorf("content of %s version %d is missing: %w", v.Path, v.Version, err)
+	}
+	return string(content), nil
+}
+
+// FileVersions returns every saved version of path, oldest first
+func (pdb *ProjectDatabase) FileVersions(path string) ([]*FileVersion, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.fileVersions(path)
+}
+
+// GetFileVersion returns a version of path and its content; version 0
+// selects the current one
+func (pdb *ProjectDatabase) GetFileVersion(path string, version int) (*FileVersion, string, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	versions, err := pdb.fileVersions(path)
+	if err != nil {
+		return nil, "", err
+	}
+	v, err := findFileVersion(versions, version)
+	if err != nil {
+		return nil, "", err
+	}
+	content, err := pdb.versionContent(v)
+	return v, content, err
+}
+
+// DiffFileVersions returns a unified diff between two versions of path. A
+// zero to selects the current version and a zero from the one before to.
+func (pdb *ProjectDatabase) DiffFileVersions(path string, from, to int) (string, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	versions, err := pdb.fileVersions(path)
+	if err != nil {
+		return "", err
+	}
+	newer, err := findFileVersion(versions, to)
+	if err != nil {
+		return "", err
+	}
+	if from == 0 {
+		from = newer.Version - 1
+		if from < versions[0].Version {
+			return "", fmt.Errorf("version %d is the first version of %s", newer.Version, path)
+		}
+	}
+	older, err := findFileVersion(versions, from)
+	if err != nil {
+		return "", err
+	}
+
+	oldContent, err := pdb.versionContent(older)
+	if err != nil {
+		return "", err
+	}
+	newContent, err := pdb.versionContent(newer)
+	if err != nil {
+		return "", err
+	}
+
+	diff := UnifiedDiff(fmt.Sprintf("%s@v%d", path, older.Version), fmt.Sprintf("%s@v%d", path, newer.Version), oldContent, newContent)
+	if diff == "" {
+		return fmt.Sprintf("No differences between versions %d and %d of %s", older.Version, newer.Version, path), nil
+	}
+	return diff, nil
+}
+
+// RestoreFileVersion makes the content of an earlier version current again.
+// The restore is saved as a new version, so no history is lost.
+func (pdb *ProjectDatabase) RestoreFileVersion(path string, version int) (*FileVersion, error) {
+	pdb.mu.RLock()
+	versions, err := pdb.fileVersions(path)
+	var content string
+	if err == nil {
+		var v *FileVersion
+		if v, err = findFileVersion(versions, version); err == nil {
+			if v == versions[len(versions)-1] {
+				err = fmt.Errorf("version %d is already the current version of %s", version, path)
+			} else {
+				content, err = pdb.versionContent(v)
+			}
+		}
+	}
+	pdb.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return pdb.saveFileVersion(path, content, fmt.Sprintf("restored from version %d", version))
+}
+
+// shortHash abbreviates a content hash for display; records written by old
+// versions may hold a shorter hash or none at all
+func shortHash(hash string) string {
+	if hash == "" {
+		return "-"
+	}
+	return hash[:min(len(hash), 8)]
+}
+
+// formatFileVersions lists the versions of a file, newest first
+func formatFileVersions(path string, versions []*FileVersion) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "History of %s (%d versions, newest first):\n", path, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		fmt.Fprintf(&sb, "- v%d  %s  %d bytes  %s", v.Version, v.CreatedAt.Format("2006-01-02 15:04:05"), v.Size, shortHash(v.Hash))
+		if i == len(versions)-1 {
+			sb.WriteString("  (current)")
+		}
+		if v.Note != "" {
+			fmt.Fprintf(&sb, "  [%s]", v.Note)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+type FileHistoryInput struct {
+	Path    string `json:"path" jsonschema_description:"Path of the file as saved to the project database"`
+	Action  string `json:"action,omitempty" jsonschema_description:"list (default): list versions; show: print one version; diff: compare two versions; restore: make an earlier version current again"`
+	Version int    `json:"version,omitempty" jsonschema_description:"Version to show or restore; for show, omit for the current version"`
+	From    int    `json:"from,omitempty" jsonschema_description:"Older version for diff; omit for the version before 'to'"`
+	To      int    `json:"to,omitempty" jsonschema_description:"Newer version for diff; omit for the current version"`
+}
+
+var FileHistoryInputSchema = GenerateSchema[FileHistoryInput]()
+
+func FileHistory(input json.RawMessage) (string, error) {
+	var historyInput FileHistoryInput
+	if err := json.Unmarshal(input, &historyInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	if historyInput.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	switch historyInput.Action {
+	case "", "list":
+		versions, err := globalDB.FileVersions(historyInput.Path)
+		if err != nil {
+			return "", err
+		}
+		return formatFileVersions(historyInput.Path, versions), nil
+
+	case "show":
+		v, content, err := globalDB.GetFileVersion(historyInput.Path, historyInput.Version)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Version %d of %s (saved %s, %d bytes):\n\n%s",
+			v.Version, v.Path, v.CreatedAt.Format("2006-01-02 15:04:05"), v.Size, content), nil
+
+	case "diff":
+		return globalDB.DiffFileVersions(historyInput.Path, historyInput.From, historyInput.To)
+
+	case "restore":
+		if historyInput.Version == 0 {
+			return "", fmt.Errorf("version is required for restore")
+		}
+		v, err := globalDB.RestoreFileVersion(historyInput.Path, historyInput.Version)
+		if err != nil {
+			return "", fmt.Errorf("failed to restore %s: %w", historyInput.Path, err)
+		}
+		return fmt.Sprintf("Restored %s in the project database to the content of version %d, saved as version %d. The working tree was not changed.",
+			v.Path, historyInput.Version, v.Version), nil
+
+	default:
+		return "", fmt.Errorf("unknown action %q (use list, show, diff or restore)", historyInput.Action)
+	}
+}
+
+var FileHistoryDefinition = ToolDefinition{
+	Name:        "file_history",
+	Description: "Show how a file saved to the project database evolved: list its versions, print any version, diff two versions, or restore an earlier version as a new version.",
+	InputSchema: FileHistoryInputSchema,
+	Function:    FileHistory,
+}
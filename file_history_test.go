@@ -0,0 +1,147 @@
+// file_history_test.go - Versions of files saved to the project database: backfill, list, diff and restore
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileHistoryLegacyBackfill(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			pdb := openTestDatabase(t, backend, t.TempDir())
+			defer pdb.Close()
+
+			// A file saved before version history was kept has a record at
+			// version 3 but no versions
+			legacy := &ProjectFile{
+				Path:       "a.txt",
+				Content:    "old\n",
+				Hash:       contentHash("old\n"),
+				Version:    3,
+				CreatedAt:  time.Now(),
+				ModifiedAt: time.Now(),
+				IsActive:   true,
+			}
+			if err := pdb.store.PutFile(legacy); err != nil {
+				t.Fatal(err)
+			}
+			versions, err := pdb.FileVersions("a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions) != 1 || versions[0].ID != 0 || versions[0].Version != 3 || versions[0].Note != legacyVersionNote {
+				t.Fatalf("versions of a legacy file = %+v", versions)
+			}
+			if _, content, err := pdb.GetFileVersion("a.txt", 3); err != nil || content != "old\n" {
+				t.Fatalf("legacy content = %q, %v", content, err)
+			}
+
+			// Saving unchanged content records the legacy version once
+			for range 2 {
+				if err := pdb.SaveFile("a.txt", "old\n"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			versions, err = pdb.FileVersions("a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions) != 1 || versions[0].ID == 0 || !hashMatches(versions[0].Hash, []byte("old\n")) {
+				t.Fatalf("versions after saving unchanged content = %+v", versions)
+			}
+
+			if err := pdb.SaveFile("a.txt", "new\n"); err != nil {
+				t.Fatal(err)
+			}
+			versions, err = pdb.FileVersions("a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions) != 2 || versions[0].Version != 3 || versions[1].Version != 4 {
+				t.Fatalf("versions after a change = %+v", versions)
+			}
+			if _, content, err := pdb.GetFileVersion("a.txt", 3); err != nil || content != "old\n" {
+				t.Fatalf("backfilled content = %q, %v", content, err)
+			}
+		})
+	}
+}
+
+func TestFormatFileVersionsShortHashes(t *testing.T) {
+	versions := []*FileVersion{
+		{Version: 1, Hash: "", Note: legacyVersionNote},
+		{Version: 2, Hash: "abc"},
+		{Version: 3, Hash: blobHash([]byte("x"))},
+	}
+	got := formatFileVersions("a.txt", versions)
+	for _, want := range []string{"- v3 ", blobHash([]byte("x"))[:8] + "  (current)", "0 bytes  abc\n", "0 bytes  -  [" + legacyVersionNote + "]"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("history lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestFileHistoryTool(t *testing.T) {
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	useTestDatabase(t, pdb)
+	for _, content := range []string{"one\n", "two\n", "three\n"} {
+		if err := pdb.SaveFile("a.txt", content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		err   string
+	}{
+		{"list", `{"path": "a.txt"}`, []string{"(3 versions, newest first)", "- v3 ", "(current)", "- v1 "}, ""},
+		{"show", `{"path": "a.txt", "action": "show", "version": 1}`, []string{"Version 1 of a.txt", "\n\none\n"}, ""},
+		{"diff with the previous version", `{"path": "a.txt", "action": "diff"}`, []string{"a.txt@v2", "a.txt@v3", "-two", "+three"}, ""},
+		{"diff of chosen versions", `{"path": "a.txt", "action": "diff", "from": 1, "to": 2}`, []string{"a.txt@v1", "-one", "+two"}, ""},
+		{"diff of the first version", `{"path": "a.txt", "action": "diff", "to": 1}`, nil, "version 1 is the first version"},
+		{"unknown version", `{"path": "a.txt", "action": "show", "version": 9}`, nil, "a.txt has no version 9 (versions 1-3)"},
+		{"restore the current version", `{"path": "a.txt", "action": "restore", "version": 3}`, nil, "already the current version"},
+		{"unsaved file", `{"path": "b.txt"}`, nil, "has not been saved"},
+		{"unknown action", `{"path": "a.txt", "action": "drop"}`, nil, `unknown action "drop"`},
+	}
+	for _, tt := range tests {
+		output, err := FileHistory(json.RawMessage(tt.input))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(output, want) {
+				t.Errorf("%s: output lacks %q:\n%s", tt.name, want, output)
+			}
+		}
+	}
+
+	// A restore is saved as a new version, keeping the history
+	output, err := FileHistory(json.RawMessage(`{"path": "a.txt", "action": "restore", "version": 1}`))
+	if err != nil || !strings.Contains(output, "content of version 1, saved as version 4") {
+		t.Fatalf("restore = %q, %v", output, err)
+	}
+	v, content, err := pdb.GetFileVersion("a.txt", 0)
+	if err != nil || v.Version != 4 || content != "one\n" || v.Note != "restored from version 1" {
+		t.Fatalf("current version after restore = %+v, %q, %v", v, content, err)
+	}
+	file, err := pdb.GetFile("a.txt")
+	if err != nil || file.Content != "one\n" {
+		t.Fatalf("file after restore = %+v, %v", file, err)
+	}
+	if diff, err := pdb.DiffFileVersions("a.txt", 1, 4); err != nil || !strings.HasPrefix(diff, "No differences") {
+		t.Fatalf("diff of the restored version = %q, %v", diff, err)
+	}
+}
@@ -0,0 +1,916 @@
+// file_store.go - Storage backend keeping one JSON file per record
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileStoreLockName is the lock file serializing writers across processes
+const fileStoreLockName = ".lock"
+
+// Compacted records live in segment files, <table>/segment-<n>.jsonl, with
+// one JSON record per line
+const (
+	fileStoreSegmentPrefix  = "segment-"
+	fileStoreSegmentSuffix  = ".jsonl"
+	fileStoreSegmentRecords = 5000 // records per segment written by Compact
+)
+
+// fileStore keeps each record as <projectDir>/<table>/<id>.json, blobs as
+// <projectDir>/blobs/<hash> and state values as <projectDir>/<key>.json.
+// Compact moves records into segment files. A record file takes precedence
+// over a copy in a segment, and a later segment over an earlier one, so a
+// record replaced after compaction, or a compaction interrupted halfway,
+// still reads back correctly.
+//
+// Writes that allocate IDs or replace records hold a mutex and an advisory
+// lock on <projectDir>/.lock, so goroutines and other EVE processes sharing
+// the directory never hand out the same ID. Counters are saved to
+// next_ids.json as soon as an ID is allocated and every file is replaced
+// atomically, so a crash cannot lead to reused IDs or torn records.
+type fileStore struct {
+	projectDir string
+	shared     *fileStoreShared
+	inTx       bool              // set on the view passed to a Transaction callback, which already holds the lock
+	journal    *fileStoreJournal // originals of the files changed by the transaction
+}
+
+// fileStoreJournal keeps the original of every file a transaction replaces
+// or removes, as a hard link (or copy) in a temporary directory, so the
+// transaction can be rolled back
+type fileStoreJournal struct {
+	dir   string
+	saved map[string]string // changed path -> saved original; "" if the file did not exist
+}
+
+// save keeps the original of path before its first change. It does nothing
+// outside a transaction.
+func (j *fileStoreJournal) save(path string) error {
+	if j == nil {
+		return nil
+	}
+	if _, ok := j.saved[path]; ok {
+		return nil
+	}
+
+	original := filepath.Join(j.dir, strconv.Itoa(len(j.saved)))
+	if err := os.Link(path, original); err != nil {
+		if os.IsNotExist(err) {
+			j.saved[path] = ""
+			return nil
+		}
+		// Hard links are not supported everywhere
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to save %s for rollback: %w", path, err)
+		}
+		if err := ioutil.WriteFile(original, data, 0644); err != nil {
+			return fmt.Errorf("failed to save %s for rollback: %w", path, err)
+		}
+	}
+	j.saved[path] = original
+	return nil
+}
+
+// rollback puts every changed file back into its original state
+func (j *fileStoreJournal) rollback() error {
+	var failed []string
+	for path, original := range j.saved {
+		var err error
+		if original == "" {
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = os.Rename(original, path)
+		}
+		if err != nil {
+			failed = append(failed, path)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("could not restore %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// fileStoreShared is the state shared by a store and its transaction views
+type fileStoreShared struct {
+	mu      sync.Mutex
+	checked map[string]bool // tables whose counter was checked against existing records
+}
+
+// newFileStore opens the file store in projectDir
+func newFileStore(projectDir string) *fileStore {
+	return &fileStore{
+		projectDir: projectDir,
+		shared:     &fileStoreShared{checked: make(map[string]bool)},
+	}
+}
+
+func (s *fileStore) Name() string {
+	return StorageFile
+}
+
+// Close is a no-op; nothing is buffered in memory
+func (s *fileStore) Close() error {
+	return nil
+}
+
+// exclusive runs fn while holding the store's mutex and the lock file
+func (s *fileStore) exclusive(fn func() error) error {
+	if s.inTx {
+		return fn()
+	}
+
+	s.shared.mu.Lock()
+	defer s.shared.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.projectDir, fileStoreLockName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("failed to lock project data: %w", err)
+	}
+	defer unlockFile(f)
+
+	return fn()
+}
+
+// assignID returns id, or allocates the next ID for table when id is zero.
+// It must be called from inside exclusive. The counters are re-read from
+// disk so allocations by other processes are seen, and saved before
+// returning. Explicit IDs move the counter forward so later inserts do not
+// reuse them.
+func (s *fileStore) assignID(table string, id int) (int, error) {
+	idFile := filepath.Join(s.projectDir, "next_ids.json")
+	nextID := map[string]int{}
+	if data, err := ioutil.ReadFile(idFile); err == nil {
+		if err := json.Unmarshal(data, &nextID); err != nil {
+			return 0, fmt.Errorf("%s is corrupt: %w", idFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	// Counters saved only on exit by older versions can lag behind the records
+	if !s.shared.checked[table] {
+		if highest := s.highestRecordID(table); highest > nextID[table] {
+			nextID[table] = highest
+		}
+		s.shared.checked[table] = true
+	}
+
+	if id == 0 {
+		id = nextID[table] + 1
+	}
+	if id <= nextID[table] {
+		return id, nil
+	}
+	nextID[table] = id
+
+	data, err := json.MarshalIndent(nextID, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := s.journal.save(idFile); err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(idFile, data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to save ID counters: %w", err)
+	}
+	return id, nil
+}
+
+// highestRecordID returns the largest record ID present in a table
+func (s *fileStore) highestRecordID(table string) int {
+	records, _ := s.loadTable(table)
+	highest := 0
+	for id := range records {
+		if id > highest {
+			highest = id
+		}
+	}
+	return highest
+}
+
+// putRecord assigns the record's ID if needed and writes it, as one locked step
+func (s *fileStore) putRecord(table string, id *int, record interface{}) error {
+	return s.exclusive(func() error {
+		assigned, err := s.assignID(table, *id)
+		if err != nil {
+			return err
+		}
+		*id = assigned
+		return s.writeRecord(table, assigned, record)
+	})
+}
+
+// writeRecord saves a record as <table>/<id>.json
+func (s *fileStore) writeRecord(table string, id int, record interface{}) error {
+	dir := filepath.Join(s.projectDir, table)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d.json", id))
+	if err := s.journal.save(path); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// recordFileID returns the ID of a record file name, <id>.json
+func recordFileID(name string) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+	return id, err == nil && strings.HasSuffix(name, ".json")
+}
+
+// segmentNumber returns the number of a segment file name
+func segmentNumber(name string) (int, bool) {
+	if !strings.HasPrefix(name, fileStoreSegmentPrefix) || !strings.HasSuffix(name, fileStoreSegmentSuffix) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, fileStoreSegmentPrefix), fileStoreSegmentSuffix))
+	return n, err == nil
+}
+
+// segmentName returns the file name of segment n; the padding keeps
+// directory listings in segment order
+func segmentName(n int) string {
+	return fmt.Sprintf("%s%06d%s", fileStoreSegmentPrefix, n, fileStoreSegmentSuffix)
+}
+
+// segmentLineID returns the ID of a record line in a segment
+func segmentLineID(line []byte) (int, bool) {
+	var key struct {
+		ID int `json:"id"`
+	}
+	if len(line) == 0 || json.Unmarshal(line, &key) != nil {
+		return 0, false
+	}
+	return key.ID, true
+}
+
+// loadTable reads every record of a table as raw JSON keyed by ID. A
+// missing table is empty; unreadable records are skipped. A file removed
+// while reading, by a compaction in another process, causes a re-read.
+func (s *fileStore) loadTable(table string) (map[int]json.RawMessage, error) {
+	for attempt := 1; ; attempt++ {
+		records, err := s.readTable(table)
+		if errors.Is(err, fs.ErrNotExist) && attempt < 5 {
+			continue
+		}
+		return records, err
+	}
+}
+
+// readTable reads the segments of a table, oldest first, and then its
+// record files
+func (s *fileStore) readTable(table string) (map[int]json.RawMessage, error) {
+	dir := filepath.Join(s.projectDir, table)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	records := make(map[int]json.RawMessage)
+	for _, entry := range entries {
+		if _, ok := segmentNumber(entry.Name()); !ok {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if id, ok := segmentLineID(line); ok {
+				records[id] = json.RawMessage(line)
+			}
+		}
+	}
+	for _, entry := range entries {
+		id, ok := recordFileID(entry.Name())
+		if !ok {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		records[id] = data
+	}
+	return records, nil
+}
+
+// sortedIDs returns the IDs of records in ascending order
+func sortedIDs(records map[int]json.RawMessage) []int {
+	ids := make([]int, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// readRecords loads every record of a table in ID order. A missing table
+// is empty; unreadable records are skipped.
+func readRecords[T any](s *fileStore, table string) ([]*T, error) {
+	records, err := s.loadTable(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*T
+	for _, id := range sortedIDs(records) {
+		var record T
+		if err := json.Unmarshal(records[id], &record); err != nil {
+			continue
+		}
+		result = append(result, &record)
+	}
+	return result, nil
+}
+
+func (s *fileStore) PutFile(file *ProjectFile) error {
+	return s.putRecord("files", &file.ID, file)
+}
+
+// GetFile scans the file records for an active file with the given path
+func (s *fileStore) GetFile(path string) (*ProjectFile, error) {
+	files, err := readRecords[ProjectFile](s, "files")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Path == path && f.IsActive {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("file not found")
+}
+
+func (s *fileStore) ListFiles() ([]*ProjectFile, error) {
+	files, err := readRecords[ProjectFile](s, "files")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*ProjectFile
+	for _, f := range files {
+		if f.IsActive {
+			result = append(result, f)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (s *fileStore) ListAllFiles() ([]*ProjectFile, error) {
+	return readRecords[ProjectFile](s, "files")
+}
+
+func (s *fileStore) PutFileVersion(version *FileVersion) error {
+	return s.putRecord("versions", &version.ID, version)
+}
+
+func (s *fileStore) ListFileVersions(path string) ([]*FileVersion, error) {
+	versions, err := readRecords[FileVersion](s, "versions")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*FileVersion
+	for _, v := range versions {
+		if path == "" || v.Path == path {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (s *fileStore) PutEdit(edit *EditHistory) error {
+	return s.putRecord("edits", &edit.ID, edit)
+}
+
+func (s *fileStore) ListEdits(path string, limit int) ([]*EditHistory, error) {
+	edits, err := readRecords[EditHistory](s, "edits")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*EditHistory
+	for _, e := range edits {
+		if path == "" || e.Path == path {
+			result = append(result, e)
+		}
+	}
+
+	// Sort by ID (newest first); IDs are allocated in edit order
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID > result[j].ID
+	})
+
+	// Apply limit
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (s *fileStore) PutCheckpoint(checkpoint *Checkpoint) error {
+	return s.putRecord("checkpoints", &checkpoint.ID, checkpoint)
+}
+
+func (s *fileStore) GetCheckpoint(id int) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.projectDir, "checkpoints", fmt.Sprintf("%d.json", id)))
+	if err != nil {
+		// Compacted checkpoints are only found in segments
+		records, err := s.loadTable("checkpoints")
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if data, ok = records[id]; !ok {
+			return nil, fmt.Errorf("checkpoint %d not found", id)
+		}
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %d: %w", id, err)
+	}
+	return &checkpoint, nil
+}
+
+func (s *fileStore) ListCheckpoints() ([]*Checkpoint, error) {
+	result, err := readRecords[Checkpoint](s, "checkpoints")
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort by timestamp (newest first)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.After(result[j].Timestamp)
+	})
+	return result, nil
+}
+
+func (s *fileStore) PutMCPIntegration(integration *MCPIntegration) error {
+	return s.putRecord("mcp", &integration.ID, integration)
+}
+
+func (s *fileStore) ListMCPIntegrations() ([]*MCPIntegration, error) {
+	result, err := readRecords[MCPIntegration](s, "mcp")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (s *fileStore) PutMultiplayerAction(action *MultiplayerAction) error {
+	return s.putRecord("multiplayer", &action.ID, action)
+}
+
+func (s *fileStore) ListMultiplayerActions(limit int) ([]*MultiplayerAction, error) {
+	result, err := readRecords[MultiplayerAction](s, "multiplayer")
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort by timestamp (newest first)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.After(result[j].Timestamp)
+	})
+
+	// Apply limit
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// findRecords returns the records selected by filter from records sorted
+// newest first
+func findRecords[T any](records []*T, filter RecordFilter, key func(*T) (string, time.Time)) []*T {
+	var result []*T
+	for _, record := range records {
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+		if filter.matches(key(record)) {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+func (s *fileStore) FindEdits(filter RecordFilter) ([]*EditHistory, error) {
+	edits, err := s.ListEdits(filter.Path, 0)
+	if err != nil {
+		return nil, err
+	}
+	return findRecords(edits, filter, func(e *EditHistory) (string, time.Time) { return e.Path, e.Timestamp }), nil
+}
+
+func (s *fileStore) FindCheckpoints(filter RecordFilter) ([]*Checkpoint, error) {
+	checkpoints, err := s.ListCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	return findRecords(checkpoints, filter.withoutPath(), func(c *Checkpoint) (string, time.Time) { return "", c.Timestamp }), nil
+}
+
+func (s *fileStore) FindMultiplayerActions(filter RecordFilter) ([]*MultiplayerAction, error) {
+	actions, err := s.ListMultiplayerActions(0)
+	if err != nil {
+		return nil, err
+	}
+	return findRecords(actions, filter.withoutPath(), func(a *MultiplayerAction) (string, time.Time) { return "", a.Timestamp }), nil
+}
+
+// PutBlob writes new blobs without a lock: blobs are immutable and written
+// atomically, so concurrent writers of the same hash produce the same file.
+// The modification time of a blob is its storage time. Refreshing it for an
+// existing blob takes the lock DeleteBlob holds, so garbage collection cannot
+// remove the blob between checking its age and the refresh.
+func (s *fileStore) PutBlob(hash string, content []byte) error {
+	dir := filepath.Join(s.projectDir, "blobs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	blobPath := filepath.Join(dir, hash)
+	if _, err := os.Stat(blobPath); err == nil {
+		refreshed := false
+		err := s.exclusive(func() error {
+			now := time.Now()
+			err := os.Chtimes(blobPath, now, now)
+			if os.IsNotExist(err) {
+				return nil
+			}
+			refreshed = err == nil
+			return err
+		})
+		if err != nil || refreshed {
+			return err
+		}
+		// Collected in the meantime, so it is written again
+	}
+	if err := s.journal.save(blobPath); err != nil {
+		return err
+	}
+	return writeFileAtomic(blobPath, content, 0644)
+}
+
+func (s *fileStore) GetBlob(hash string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filepath.Join(s.projectDir, "blobs", hash))
+	if err != nil {
+		return nil, fmt.Errorf("blob %s not found: %w", hash, err)
+	}
+	return content, nil
+}
+
+func (s *fileStore) ListBlobs() ([]BlobInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(s.projectDir, "blobs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var blobs []BlobInfo
+	for _, entry := range entries {
+		// Skip temp files of blobs being written
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, BlobInfo{Hash: entry.Name(), Size: info.Size(), StoredAt: info.ModTime()})
+	}
+	return blobs, nil
+}
+
+func (s *fileStore) DeleteBlob(hash string, storedBefore time.Time) (bool, error) {
+	blobPath := filepath.Join(s.projectDir, "blobs", hash)
+	removed := false
+	err := s.exclusive(func() error {
+		info, err := os.Stat(blobPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.ModTime().After(storedBefore) {
+			return nil
+		}
+		if err := s.journal.save(blobPath); err != nil {
+			return err
+		}
+		if err := os.Remove(blobPath); err != nil {
+			return err
+		}
+		removed = true
+		return nil
+	})
+	return removed, err
+}
+
+// DeleteRecords removes the record files of ids and rewrites the segments
+// holding any of them
+func (s *fileStore) DeleteRecords(table string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	remove := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	dir := filepath.Join(s.projectDir, table)
+	return s.exclusive(func() error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if id, ok := recordFileID(entry.Name()); ok {
+				if remove[id] {
+					if err := s.journal.save(path); err != nil {
+						return err
+					}
+					if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+						return err
+					}
+				}
+				continue
+			}
+			if _, ok := segmentNumber(entry.Name()); !ok {
+				continue
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var kept bytes.Buffer
+			changed := false
+			for _, line := range bytes.Split(data, []byte("\n")) {
+				if len(line) == 0 {
+					continue
+				}
+				if id, ok := segmentLineID(line); ok && remove[id] {
+					changed = true
+					continue
+				}
+				kept.Write(line)
+				kept.WriteByte('\n')
+			}
+
+			if changed {
+				if err := s.journal.save(path); err != nil {
+					return err
+				}
+			}
+			switch {
+			case !changed:
+			case kept.Len() == 0:
+				err = os.Remove(path)
+			default:
+				err = writeFileAtomic(path, kept.Bytes(), 0644)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Compact moves the record files of every table into segments
+func (s *fileStore) Compact() error {
+	return s.exclusive(func() error {
+		for _, table := range storageTables {
+			if err := s.compactTable(table); err != nil {
+				return fmt.Errorf("failed to compact %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// compactTable rewrites a table with record files as segments of up to
+// fileStoreSegmentRecords records. The new segments are written before
+// anything is removed, so a crash leaves every record readable.
+func (s *fileStore) compactTable(table string) error {
+	dir := filepath.Join(s.projectDir, table)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var segments, recordFiles []string
+	next := 1
+	for _, entry := range entries {
+		if n, ok := segmentNumber(entry.Name()); ok {
+			segments = append(segments, entry.Name())
+			if n >= next {
+				next = n + 1
+			}
+		} else if _, ok := recordFileID(entry.Name()); ok {
+			recordFiles = append(recordFiles, entry.Name())
+		}
+	}
+	if len(recordFiles) == 0 {
+		return nil
+	}
+
+	records, err := s.readTable(table)
+	if err != nil {
+		return err
+	}
+	ids := sortedIDs(records)
+	// Records that are not valid JSON keep their own file
+	keep := make(map[string]bool)
+	for start := 0; start < len(ids); start += fileStoreSegmentRecords {
+		var segment bytes.Buffer
+		for _, id := range ids[start:min(start+fileStoreSegmentRecords, len(ids))] {
+			if err := json.Compact(&segment, records[id]); err != nil {
+				keep[fmt.Sprintf("%d.json", id)] = true
+				continue
+			}
+			segment.WriteByte('\n')
+		}
+		if err := writeFileAtomic(filepath.Join(dir, segmentName(next)), segment.Bytes(), 0644); err != nil {
+			return err
+		}
+		next++
+	}
+
+	for _, name := range segments {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	for _, name := range recordFiles {
+		if keep[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirUsage returns the total size and number of the files below dir
+func dirUsage(dir string) (int64, int) {
+	var size int64
+	count := 0
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+			count++
+		}
+		return nil
+	})
+	return size, count
+}
+
+func (s *fileStore) Stats() (*StorageStats, error) {
+	stats := &StorageStats{}
+	for _, table := range storageTables {
+		records, err := s.loadTable(table)
+		if err != nil {
+			return nil, err
+		}
+		usage := TableStats{Table: table, Records: len(records)}
+		usage.Bytes, usage.Files = dirUsage(filepath.Join(s.projectDir, table))
+		stats.Tables = append(stats.Tables, usage)
+		stats.DiskBytes += usage.Bytes
+	}
+
+	blobs := TableStats{Table: "blobs"}
+	blobs.Bytes, blobs.Files = dirUsage(filepath.Join(s.projectDir, "blobs"))
+	blobs.Records = blobs.Files
+	stats.Tables = append(stats.Tables, blobs)
+	stats.DiskBytes += blobs.Bytes
+
+	// State values and ID counters
+	entries, err := os.ReadDir(s.projectDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") {
+			if info, err := entry.Info(); err == nil {
+				stats.DiskBytes += info.Size()
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (s *fileStore) GetState(key string, value interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.projectDir, key+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+func (s *fileStore) PutState(key string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.projectDir, key+".json")
+	return s.exclusive(func() error {
+		if err := s.journal.save(path); err != nil {
+			return err
+		}
+		return writeFileAtomic(path, data, 0644)
+	})
+}
+
+// Transaction runs fn while holding the store's lock, so its reads and
+// writes are isolated from other writers. The original of every file fn
+// changes is journaled, and restored if fn fails; a crash while fn runs can
+// still leave part of its writes behind. Nested calls join the outer
+// transaction.
+func (s *fileStore) Transaction(fn func(Storage) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	return s.exclusive(func() error {
+		dir, err := os.MkdirTemp(s.projectDir, ".eve-tmp-tx-*")
+		if err != nil {
+			return fmt.Errorf("failed to create transaction journal: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		journal := &fileStoreJournal{dir: dir, saved: make(map[string]string)}
+		err = fn(&fileStore{projectDir: s.projectDir, shared: s.shared, inTx: true, journal: journal})
+		if err != nil {
+			if rollbackErr := journal.rollback(); rollbackErr != nil {
+				return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+			}
+		}
+		return err
+	})
+}
+
+// Snapshot runs fn while holding the store's lock, so no record changes
+// while the files are copied
+func (s *fileStore) Snapshot(fn func(replacements map[string]string) error) error {
+	return s.exclusive(func() error {
+		return fn(nil)
+	})
+}
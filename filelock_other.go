@@ -0,0 +1,17 @@
+//go:build !unix
+
+// filelock_other.go - File locking fallback for platforms without flock
+package main
+
+import "os"
+
+// lockFile is a no-op here: goroutines are still serialized by the store's
+// mutex, but separate processes sharing a project directory are not
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile releases a lock taken with lockFile
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,68 @@
+// fileutil_test.go - Atomic writes of files and symlinks
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := writeFileAtomic(path, []byte("one"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("new file: %v, %v", info, err)
+	}
+
+	// An existing file keeps its mode
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkTestFile(t, path, "two")
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0755 {
+		t.Fatalf("rewritten file: %v, %v", info, err)
+	}
+
+	if err := writeFileAtomic(dir, []byte("x"), 0644); err == nil {
+		t.Fatal("a directory was replaced")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("temp files were left behind: %v, %v", entries, err)
+	}
+}
+
+func TestWriteFileAtomicFollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "real"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "real", "config.txt")
+	writeTestFile(t, target, "old")
+	link := filepath.Join(dir, "config.txt")
+	if err := os.Symlink(filepath.Join("real", "config.txt"), link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+
+	if err := writeFileAtomic(link, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symlink was replaced: %v, %v", info, err)
+	}
+	checkTestFile(t, target, "new")
+
+	dangling := filepath.Join(dir, "dangling.txt")
+	if err := os.Symlink("missing.txt", dangling); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(dangling, []byte("x"), 0644); err == nil {
+		t.Fatal("wrote through a dangling symlink")
+	}
+}
@@ -54,6 +54,16 @@ func (p *GeminiProvider) SendMessage(ctx context.Context, conversation []Message
 	// Get the Gemini model
 	model := p.client.GenerativeModel(p.model)
 
+	// System messages become the model's system instruction
+	for _, msg := range conversation {
+		if content, ok := msg.Content.(string); ok && msg.Role == "system" {
+			if model.SystemInstruction == nil {
+				model.SystemInstruction = &genai.Content{}
+			}
+			model.SystemInstruction.Parts = append(model.SystemInstruction.Parts, genai.Text(content))
+		}
+	}
+
 	// Configure the model for function calling if tools are provided
 	if len(tools) > 0 {
 		var geminiTools []*genai.Tool
@@ -0,0 +1,840 @@
+// git.go - Git tools built on the local git binary, with structured JSON output
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gitTimeout        = 30 * time.Second
+	gitMaxPatchSize   = 100000 // characters of patch returned by git_diff
+	gitDefaultLog     = 20
+	gitMaxLog         = 200
+	gitMaxBlameLines  = 500
+	gitDefaultBlameTo = 100 // lines blamed when no end line is given
+)
+
+// runGit runs git with args in the working directory and returns stdout.
+// No shell is involved, and git never prompts for credentials or an editor.
+func runGit(args ...string) (string, error) {
+	return runGitWithInput("", args...)
+}
+
+// runGitWithInput runs git like runGit, feeding stdin to it
+func runGitWithInput(stdin string, args ...string) (string, error) {
+	return execGit(nil, stdin, args...)
+}
+
+// execGit runs git with additional environment variables and stdin
+func execGit(env []string, stdin string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "core.quotepath=off", "-c", "color.ui=false"}, args...)...)
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true", "GIT_PAGER=cat"), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Printf("Running git %s", strings.Join(args, " "))
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("git %s timed out after %s", args[0], gitTimeout)
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("git %s failed: %s", args[0], message)
+	}
+	return stdout.String(), nil
+}
+
+// gitJSON renders a tool result as indented JSON
+func gitJSON(value interface{}) (string, error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// checkGitArgument rejects values that git would parse as options
+func checkGitArgument(name, value string) error {
+	if strings.HasPrefix(value, "-") {
+		return fmt.Errorf("%s must not start with '-': %q", name, value)
+	}
+	return nil
+}
+
+// gitStatusNames translates git's status letters
+var gitStatusNames = map[byte]string{
+	'A': "added",
+	'M': "modified",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'T': "type changed",
+	'U': "unmerged",
+}
+
+// GitFileChange is one changed path in the index or working tree
+type GitFileChange struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+	Status  string `json:"status"`
+}
+
+// GitStatus is the result of git_status
+type GitStatus struct {
+	Branch     string          `json:"branch"` // "(detached)" when HEAD is detached
+	Commit     string          `json:"commit,omitempty"`
+	Upstream   string          `json:"upstream,omitempty"`
+	Ahead      int             `json:"ahead"`
+	Behind     int             `json:"behind"`
+	Clean      bool            `json:"clean"`
+	Staged     []GitFileChange `json:"staged,omitempty"`
+	Unstaged   []GitFileChange `json:"unstaged,omitempty"`
+	Untracked  []string        `json:"untracked,omitempty"`
+	Conflicted []string        `json:"conflicted,omitempty"`
+}
+
+// parseGitStatus parses `git status --porcelain=v2 --branch -z`
+func parseGitStatus(output string) *GitStatus {
+	status := &GitStatus{}
+	records := strings.Split(output, "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		switch {
+		case strings.HasPrefix(record, "# branch.oid "):
+			status.Commit = strings.TrimPrefix(record, "# branch.oid ")
+		case strings.HasPrefix(record, "# branch.head "):
+			status.Branch = strings.TrimPrefix(record, "# branch.head ")
+		case strings.HasPrefix(record, "# branch.upstream "):
+			status.Upstream = strings.TrimPrefix(record, "# branch.upstream ")
+		case strings.HasPrefix(record, "# branch.ab "):
+			fmt.Sscanf(strings.TrimPrefix(record, "# branch.ab "), "+%d -%d", &status.Ahead, &status.Behind)
+		case strings.HasPrefix(record, "1 "), strings.HasPrefix(record, "2 "):
+			// 1 XY sub mH mI mW hH hI path
+			// 2 XY sub mH mI mW hH hI Xscore path, followed by the original path
+			fieldCount := 9
+			if record[0] == '2' {
+				fieldCount = 10
+			}
+			fields := strings.SplitN(record, " ", fieldCount)
+			if len(fields) < fieldCount {
+				continue
+			}
+			change := GitFileChange{Path: fields[fieldCount-1]}
+			if record[0] == '2' && i+1 < len(records) {
+				i++
+				change.OldPath = records[i]
+			}
+			xy := fields[1]
+			if xy[0] != '.' {
+				staged := change
+				staged.Status = gitStatusNames[xy[0]]
+				status.Staged = append(status.Staged, staged)
+			}
+			if xy[1] != '.' {
+				unstaged := change
+				unstaged.Status = gitStatusNames[xy[1]]
+				unstaged.OldPath = ""
+				status.Unstaged = append(status.Unstaged, unstaged)
+			}
+		case strings.HasPrefix(record, "u "):
+			fields := strings.SplitN(record, " ", 11)
+			if len(fields) == 11 {
+				status.Conflicted = append(status.Conflicted, fields[10])
+			}
+		case strings.HasPrefix(record, "? "):
+			status.Untracked = append(status.Untracked, strings.TrimPrefix(record, "? "))
+		}
+	}
+	if status.Commit == "(initial)" {
+		status.Commit = ""
+	}
+	status.Clean = len(status.Staged)+len(status.Unstaged)+len(status.Untracked)+len(status.Conflicted) == 0
+	return status
+}
+
+type GitStatusInput struct{}
+
+var GitStatusInputSchema = GenerateSchema[GitStatusInput]()
+
+func GitStatusTool(input json.RawMessage) (string, error) {
+	output, err := runGit("status", "--porcelain=v2", "--branch", "-z", "--untracked-files=all")
+	if err != nil {
+		return "", err
+	}
+	return gitJSON(parseGitStatus(output))
+}
+
+var GitStatusDefinition = ToolDefinition{
+	Name:        "git_status",
+	Description: "Show the git status as JSON: current branch and commit, upstream with ahead/behind counts, and staged, unstaged, untracked and conflicted files.",
+	InputSchema: GitStatusInputSchema,
+	Function:    GitStatusTool,
+}
+
+// GitDiffFile is one file in a diff
+type GitDiffFile struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"old_path,omitempty"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+}
+
+// GitDiff is the result of git_diff
+type GitDiff struct {
+	Mode      string        `json:"mode"`
+	Ref       string        `json:"ref,omitempty"`
+	Files     []GitDiffFile `json:"files"`
+	Additions int           `json:"additions"`
+	Deletions int           `json:"deletions"`
+	Patch     string        `json:"patch,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// gitDiffFiles lists the files changed by a diff with their line counts.
+// diffArgs select what is compared, e.g. "--cached" or a ref.
+func gitDiffFiles(diffArgs []string, paths []string) ([]GitDiffFile, error) {
+	nameStatus, err := runGit(append(append([]string{"diff", "--no-ext-diff", "--name-status", "-z", "-M"}, diffArgs...), append([]string{"--"}, paths...)...)...)
+	if err != nil {
+		return nil, err
+	}
+	numstat, err := runGit(append(append([]string{"diff", "--no-ext-diff", "--numstat", "-z", "-M"}, diffArgs...), append([]string{"--"}, paths...)...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// --name-status -z: STATUS\0path\0, or STATUS\0old\0new\0 for renames and copies
+	var files []GitDiffFile
+	byPath := map[string]int{}
+	fields := strings.Split(strings.TrimSuffix(nameStatus, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		file := GitDiffFile{Status: gitStatusNames[fields[i][0]], Path: fields[i+1]}
+		if fields[i][0] == 'R' || fields[i][0] == 'C' {
+			if i+2 >= len(fields) {
+				break
+			}
+			file.OldPath = fields[i+1]
+			file.Path = fields[i+2]
+			i++
+		}
+		byPath[file.Path] = len(files)
+		files = append(files, file)
+	}
+
+	// --numstat -z: ADD\tDEL\tpath\0, or ADD\tDEL\t\0old\0new\0 for renames
+	fields = strings.Split(strings.TrimSuffix(numstat, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		filePath := parts[2]
+		if filePath == "" && i+2 < len(fields) {
+			filePath = fields[i+2]
+			i += 2
+		}
+		index, ok := byPath[filePath]
+		if !ok {
+			continue
+		}
+		if parts[0] == "-" {
+			files[index].Binary = true
+			continue
+		}
+		files[index].Additions, _ = strconv.Atoi(parts[0])
+		files[index].Deletions, _ = strconv.Atoi(parts[1])
+	}
+	return files, nil
+}
+
+type GitDiffInput struct {
+	Mode     string   `json:"mode,omitempty" jsonschema_description:"unstaged (default): working tree against the index; staged: index against HEAD; ref: working tree against 'ref'"`
+	Ref      string   `json:"ref,omitempty" jsonschema_description:"Commit, branch or range for mode ref, e.g. main, HEAD~3 or main...HEAD"`
+	Paths    []string `json:"paths,omitempty" jsonschema_description:"Only diff these files or directories"`
+	StatOnly bool     `json:"stat_only,omitempty" jsonschema_description:"Return only the changed files and line counts, without the patch"`
+}
+
+var GitDiffInputSchema = GenerateSchema[GitDiffInput]()
+
+func GitDiffTool(input json.RawMessage) (string, error) {
+	var diffInput GitDiffInput
+	if err := json.Unmarshal(input, &diffInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	var diffArgs []string
+	switch diffInput.Mode {
+	case "", "unstaged":
+		diffInput.Mode = "unstaged"
+	case "staged":
+		diffArgs = []string{"--cached"}
+	case "ref":
+		if diffInput.Ref == "" {
+			return "", fmt.Errorf("ref is required for mode ref")
+		}
+		if err := checkGitArgument("ref", diffInput.Ref); err != nil {
+			return "", err
+		}
+		diffArgs = []string{diffInput.Ref}
+	default:
+		return "", fmt.Errorf("unknown mode %q (use unstaged, staged or ref)", diffInput.Mode)
+	}
+	if diffInput.Mode != "ref" && diffInput.Ref != "" {
+		return "", fmt.Errorf("ref is only used with mode ref")
+	}
+
+	files, err := gitDiffFiles(diffArgs, diffInput.Paths)
+	if err != nil {
+		return "", err
+	}
+	result := &GitDiff{Mode: diffInput.Mode, Ref: diffInput.Ref, Files: files}
+	if result.Files == nil {
+		result.Files = []GitDiffFile{}
+	}
+	for _, file := range files {
+		result.Additions += file.Additions
+		result.Deletions += file.Deletions
+	}
+
+	if !diffInput.StatOnly && len(files) > 0 {
+		patch, err := runGit(append(append([]string{"diff", "--no-ext-diff", "-M"}, diffArgs...), append([]string{"--"}, diffInput.Paths...)...)...)
+		if err != nil {
+			return "", err
+		}
+		if len(patch) > gitMaxPatchSize {
+			patch = truncateUTF8(patch, gitMaxPatchSize)
+			result.Truncated = true
+		}
+		result.Patch = patch
+	}
+	return gitJSON(result)
+}
+
+var GitDiffDefinition = ToolDefinition{
+	Name:        "git_diff",
+	Description: "Show git changes as JSON: unstaged changes, staged changes, or the working tree against a ref. Lists each file with its status and line counts, plus the unified patch unless stat_only is set.",
+	InputSchema: GitDiffInputSchema,
+	Function:    GitDiffTool,
+}
+
+// GitCommit is one entry of git_log
+type GitCommit struct {
+	Hash    string `json:"hash"`
+	Short   string `json:"short"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+}
+
+type GitLogInput struct {
+	Ref      string `json:"ref,omitempty" jsonschema_description:"Branch, commit or range to list (default HEAD)"`
+	Path     string `json:"path,omitempty" jsonschema_description:"Only list commits touching this file or directory"`
+	Author   string `json:"author,omitempty" jsonschema_description:"Only list commits whose author matches this pattern"`
+	Since    string `json:"since,omitempty" jsonschema_description:"Only list commits after this date, e.g. 2024-01-31 or '2 weeks ago'"`
+	MaxCount int    `json:"max_count,omitempty" jsonschema_description:"Maximum number of commits (default 20, max 200)"`
+}
+
+var GitLogInputSchema = GenerateSchema[GitLogInput]()
+
+func GitLogTool(input json.RawMessage) (string, error) {
+	var logInput GitLogInput
+	if err := json.Unmarshal(input, &logInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	maxCount := logInput.MaxCount
+	if maxCount <= 0 {
+		maxCount = gitDefaultLog
+	}
+	if maxCount > gitMaxLog {
+		maxCount = gitMaxLog
+	}
+
+	args := []string{"log", "--format=%H%x1f%h%x1f%an%x1f%ae%x1f%aI%x1f%s%x1e", fmt.Sprintf("--max-count=%d", maxCount)}
+	if logInput.Author != "" {
+		args = append(args, "--author="+logInput.Author)
+	}
+	if logInput.Since != "" {
+		args = append(args, "--since="+logInput.Since)
+	}
+	if logInput.Ref != "" {
+		if err := checkGitArgument("ref", logInput.Ref); err != nil {
+			return "", err
+		}
+		args = append(args, logInput.Ref)
+	}
+	args = append(args, "--")
+	if logInput.Path != "" {
+		args = append(args, logInput.Path)
+	}
+
+	output, err := runGit(args...)
+	if err != nil {
+		return "", err
+	}
+
+	commits := []GitCommit{}
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x1f")
+		if len(fields) != 6 {
+			continue
+		}
+		commits = append(commits, GitCommit{Hash: fields[0], Short: fields[1], Author: fields[2], Email: fields[3], Date: fields[4], Subject: fields[5]})
+	}
+	return gitJSON(commits)
+}
+
+var GitLogDefinition = ToolDefinition{
+	Name:        "git_log",
+	Description: "List git commits as JSON (hash, author, date, subject), optionally limited to a ref or range, a path, an author or a start date.",
+	InputSchema: GitLogInputSchema,
+	Function:    GitLogTool,
+}
+
+// GitBlameLine is one line of git_blame output
+type GitBlameLine struct {
+	Line    int    `json:"line"`
+	Commit  string `json:"commit"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Summary string `json:"summary"`
+	Content string `json:"content"`
+}
+
+// parseGitBlame parses `git blame --porcelain`. Commit details are only
+// printed the first time a commit appears, so they are remembered by hash.
+func parseGitBlame(output string) []GitBlameLine {
+	type commitInfo struct{ author, date, summary string }
+	commits := map[string]*commitInfo{}
+
+	var lines []GitBlameLine
+	var current *GitBlameLine
+	var info *commitInfo
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			if current != nil {
+				current.Content = line[1:]
+				current.Author, current.Date, current.Summary = info.author, info.date, info.summary
+				lines = append(lines, *current)
+				current = nil
+			}
+		case current == nil:
+			// Header: <sha> <original line> <final line> [<group size>]
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(fields[0]) < 40 {
+				continue
+			}
+			number, _ := strconv.Atoi(fields[2])
+			current = &GitBlameLine{Line: number, Commit: fields[0][:8]}
+			if info = commits[fields[0]]; info == nil {
+				info = &commitInfo{}
+				commits[fields[0]] = info
+			}
+		default:
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "author":
+				info.author = value
+			case "author-time":
+				if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+					info.date = time.Unix(seconds, 0).Format("2006-01-02")
+				}
+			case "summary":
+				info.summary = value
+			}
+		}
+	}
+	return lines
+}
+
+type GitBlameInput struct {
+	Path      string `json:"path" jsonschema_description:"File to blame"`
+	StartLine int    `json:"start_line,omitempty" jsonschema_description:"First line to blame (default 1)"`
+	EndLine   int    `json:"end_line,omitempty" jsonschema_description:"Last line to blame (default start_line + 99; at most 500 lines per call)"`
+	Ref       string `json:"ref,omitempty" jsonschema_description:"Blame the file as of this commit instead of the working tree"`
+}
+
+var GitBlameInputSchema = GenerateSchema[GitBlameInput]()
+
+func GitBlameTool(input json.RawMessage) (string, error) {
+	var blameInput GitBlameInput
+	if err := json.Unmarshal(input, &blameInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+	if blameInput.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	start := blameInput.StartLine
+	if start <= 0 {
+		start = 1
+	}
+	end := blameInput.EndLine
+	if end <= 0 {
+		end = start + gitDefaultBlameTo - 1
+	}
+	if end < start {
+		return "", fmt.Errorf("end_line %d is before start_line %d", end, start)
+	}
+	if end-start+1 > gitMaxBlameLines {
+		end = start + gitMaxBlameLines - 1
+	}
+
+	args := []string{"blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end)}
+	if blameInput.Ref != "" {
+		if err := checkGitArgument("ref", blameInput.Ref); err != nil {
+			return "", err
+		}
+		args = append(args, blameInput.Ref)
+	}
+	output, err := runGit(append(args, "--", blameInput.Path)...)
+	if err != nil && strings.Contains(err.Error(), "has only") && blameInput.EndLine <= 0 {
+		// The default range ran past the end of the file
+		args[3] = fmt.Sprintf("%d,", start)
+		output, err = runGit(append(args, "--", blameInput.Path)...)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return gitJSON(struct {
+		Path  string         `json:"path"`
+		Ref   string         `json:"ref,omitempty"`
+		Lines []GitBlameLine `json:"lines"`
+	}{blameInput.Path, blameInput.Ref, parseGitBlame(output)})
+}
+
+var GitBlameDefinition = ToolDefinition{
+	Name:        "git_blame",
+	Description: "Show who last changed each line in a range of a file, as JSON with the commit, author, date and commit summary of every line.",
+	InputSchema: GitBlameInputSchema,
+	Function:    GitBlameTool,
+}
+
+type GitCreateBranchInput struct {
+	Name       string `json:"name" jsonschema_description:"Name of the new branch"`
+	StartPoint string `json:"start_point,omitempty" jsonschema_description:"Commit or branch to start from (default HEAD)"`
+	Checkout   bool   `json:"checkout,omitempty" jsonschema_description:"Switch to the new branch; git refuses if that would overwrite uncommitted changes"`
+}
+
+var GitCreateBranchInputSchema = GenerateSchema[GitCreateBranchInput]()
+
+func GitCreateBranch(input json.RawMessage) (string, error) {
+	var branchInput GitCreateBranchInput
+	if err := json.Unmarshal(input, &branchInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+	if err := checkGitArgument("name", branchInput.Name); err != nil {
+		return "", err
+	}
+	if err := checkGitArgument("start_point", branchInput.StartPoint); err != nil {
+		return "", err
+	}
+	if _, err := runGit("check-ref-format", "--branch", branchInput.Name); err != nil {
+		return "", fmt.Errorf("invalid branch name %q", branchInput.Name)
+	}
+	if _, err := runGit("rev-parse", "--verify", "--quiet", "refs/heads/"+branchInput.Name); err == nil {
+		return "", fmt.Errorf("branch %s already exists; existing branches are never overwritten", branchInput.Name)
+	}
+
+	args := []string{"branch", branchInput.Name}
+	if branchInput.Checkout {
+		args = []string{"switch", "-c", branchInput.Name}
+	}
+	if branchInput.StartPoint != "" {
+		args = append(args, branchInput.StartPoint)
+	}
+	if _, err := runGit(args...); err != nil {
+		return "", err
+	}
+
+	commit, err := runGit("rev-parse", "refs/heads/"+branchInput.Name)
+	if err != nil {
+		return "", err
+	}
+	return gitJSON(map[string]interface{}{
+		"branch":      branchInput.Name,
+		"commit":      strings.TrimSpace(commit),
+		"checked_out": branchInput.Checkout,
+	})
+}
+
+var GitCreateBranchDefinition = ToolDefinition{
+	Name:        "git_create_branch",
+	Description: "Create a new git branch, optionally from a given start point and switching to it. Never overwrites an existing branch.",
+	InputSchema: GitCreateBranchInputSchema,
+	Function:    GitCreateBranch,
+}
+
+// generateCommitMessage describes staged changes: a subject naming what was
+// done to which files and a body listing every file with its line counts
+func generateCommitMessage(files []GitDiffFile) string {
+	verb := ""
+	for _, file := range files {
+		fileVerb := map[string]string{"added": "Add", "deleted": "Remove", "renamed": "Rename"}[file.Status]
+		if fileVerb == "" || (verb != "" && verb != fileVerb) {
+			verb = "Update"
+			break
+		}
+		verb = fileVerb
+	}
+
+	var target string
+	dir := path.Dir(files[0].Path)
+	for _, file := range files {
+		if path.Dir(file.Path) != dir {
+			dir = ""
+			break
+		}
+	}
+	switch {
+	case len(files) == 1 && files[0].Status == "renamed":
+		target = fmt.Sprintf("%s to %s", files[0].OldPath, files[0].Path)
+	case len(files) == 1:
+		target = files[0].Path
+	case len(files) <= 3:
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i] = path.Base(file.Path)
+		}
+		target = strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+		if dir != "" && dir != "." {
+			target += " in " + dir
+		}
+	case dir != "" && dir != ".":
+		target = fmt.Sprintf("%d files in %s", len(files), dir)
+	default:
+		target = fmt.Sprintf("%d files", len(files))
+	}
+
+	var body strings.Builder
+	for _, file := range files {
+		name := file.Path
+		if file.OldPath != "" {
+			name = file.OldPath + " -> " + file.Path
+		}
+		if file.Binary {
+			fmt.Fprintf(&body, "- %s %s (binary)\n", file.Status, name)
+		} else {
+			fmt.Fprintf(&body, "- %s %s (+%d -%d)\n", file.Status, name, file.Additions, file.Deletions)
+		}
+	}
+	return verb + " " + target + "\n\n" + body.String()
+}
+
+type GitCommitInput struct {
+	Paths   []string `json:"paths,omitempty" jsonschema_description:"Files or directories to stage before committing"`
+	All     bool     `json:"all,omitempty" jsonschema_description:"Stage every change, including untracked files, before committing"`
+	Message string   `json:"message,omitempty" jsonschema_description:"Commit message; omit to generate one from the staged changes"`
+}
+
+var GitCommitInputSchema = GenerateSchema[GitCommitInput]()
+
+func GitCommitTool(input json.RawMessage) (string, error) {
+	var commitInput GitCommitInput
+	if err := json.Unmarshal(input, &commitInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	if commitInput.All {
+		if _, err := runGit("add", "--all"); err != nil {
+			return "", err
+		}
+	} else if len(commitInput.Paths) > 0 {
+		if _, err := runGit(append([]string{"add", "--"}, commitInput.Paths...)...); err != nil {
+			return "", err
+		}
+	}
+
+	files, err := gitDiffFiles([]string{"--cached"}, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("nothing is staged; pass paths or all to stage changes")
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	message := strings.TrimSpace(commitInput.Message)
+	generated := message == ""
+	if generated {
+		message = generateCommitMessage(files)
+	}
+	// The message goes through stdin, so it is never interpreted by a shell
+	if _, err := runGitWithInput(message, "commit", "--quiet", "--file=-"); err != nil {
+		return "", err
+	}
+
+	commit, err := runGit("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	branch, _ := runGit("branch", "--show-current")
+	return gitJSON(map[string]interface{}{
+		"commit":            strings.TrimSpace(commit),
+		"branch":            strings.TrimSpace(branch),
+		"message":           message,
+		"message_generated": generated,
+		"files":             files,
+	})
+}
+
+var GitCommitDefinition = ToolDefinition{
+	Name:        "git_commit",
+	Description: "Stage the given paths (or everything) and create a git commit. The message is generated from the staged changes when none is given. Never amends, rewrites history or pushes.",
+	InputSchema: GitCommitInputSchema,
+	Function:    GitCommitTool,
+}
+
+// gitGlobalOptionsWithValue are git options that take the following word as their value
+var gitGlobalOptionsWithValue = map[string]bool{"-C": true, "-c": true, "--git-dir": true, "--work-tree": true, "--namespace": true}
+
+// destructiveGitCommand reports why a shell command contains a git
+// operation that discards work or rewrites history, or "" if it does not.
+// The check is a heuristic on the command's words; it is meant to catch
+// the model reaching for these operations, not to sandbox the shell.
+func destructiveGitCommand(command string) string {
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '\n' || r == '(' || r == ')' || r == '`'
+	})
+	for _, segment := range segments {
+		words := strings.Fields(strings.NewReplacer(`"`, "", "'", "").Replace(segment))
+		for i, word := range words {
+			if path.Base(word) != "git" {
+				continue
+			}
+			args := words[i+1:]
+			for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+				if gitGlobalOptionsWithValue[args[0]] && len(args) > 1 {
+					args = args[1:]
+				}
+				args = args[1:]
+			}
+			if len(args) > 0 {
+				if reason := destructiveGitArgs(args[0], args[1:]); reason != "" {
+					return reason
+				}
+			}
+			break
+		}
+	}
+	return ""
+}
+
+// destructiveGitArgs checks one git subcommand and its arguments
+func destructiveGitArgs(subcommand string, args []string) string {
+	has := func(options ...string) bool {
+		for _, arg := range args {
+			for _, option := range options {
+				if arg == option || (strings.HasPrefix(option, "--") && strings.HasPrefix(arg, option+"=")) {
+					return true
+				}
+				// Combined short flags such as -fd
+				if len(option) == 2 && option[0] == '-' && option[1] != '-' &&
+					len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && strings.ContainsRune(arg[1:], rune(option[1])) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	hasArg := func(values ...string) bool {
+		for _, arg := range args {
+			for _, value := range values {
+				if arg == value {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch subcommand {
+	case "push":
+		if has("--force", "-f", "--force-with-lease", "--mirror", "--delete", "-d", "--prune") {
+			return "force-pushes or deletes remote refs"
+		}
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, ":") {
+				return "force-pushes or deletes remote refs"
+			}
+		}
+	case "reset":
+		if has("--hard", "--merge", "--keep") {
+			return "discards uncommitted changes"
+		}
+	case "clean":
+		if has("-f", "--force") {
+			return "deletes untracked files"
+		}
+	case "checkout":
+		if has("-f", "--force") || hasArg("--", ".") {
+			return "discards uncommitted changes"
+		}
+	case "restore":
+		if !has("--staged", "-S") || has("--worktree", "-W") {
+			return "discards uncommitted changes"
+		}
+	case "switch":
+		if has("--discard-changes", "-f", "--force", "-C", "--force-create") {
+			return "discards uncommitted changes or overwrites a branch"
+		}
+	case "branch":
+		if has("-D", "-M", "-C", "--force", "-f") || (has("-d", "--delete") && has("-f", "--force")) {
+			return "force-deletes or overwrites a branch"
+		}
+	case "tag":
+		if has("-d", "--delete", "-f", "--force") {
+			return "deletes or overwrites a tag"
+		}
+	case "stash":
+		if hasArg("drop", "clear") {
+			return "deletes stashed changes"
+		}
+	case "commit":
+		if has("--amend") {
+			return "rewrites the last commit"
+		}
+	case "rebase", "filter-branch", "filter-repo", "replace":
+		return "rewrites history"
+	case "reflog":
+		if hasArg("expire", "delete") {
+			return "deletes reflog entries"
+		}
+	case "gc", "prune":
+		if subcommand == "prune" || has("--prune") {
+			return "permanently deletes unreachable objects"
+		}
+	case "update-ref":
+		if has("-d") {
+			return "deletes a ref"
+		}
+	case "worktree":
+		if hasArg("remove") && has("--force", "-f") {
+			return "discards changes in a worktree"
+		}
+	}
+	return ""
+}
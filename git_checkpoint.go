@@ -0,0 +1,254 @@
+// git_checkpoint.go - Checkpoints stored as shadow commits on hidden git refs
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitCheckpointRefPrefix is where checkpoint commits are kept. Refs outside
+// refs/heads and refs/tags do not show up as branches or tags, but keep the
+// commits from being garbage collected and can be inspected with git log,
+// git diff or git show.
+const gitCheckpointRefPrefix = "refs/eve/checkpoints/"
+
+// gitCheckpointRef returns the hidden ref of a checkpoint
+func gitCheckpointRef(id int) string {
+	return fmt.Sprintf("%s%d", gitCheckpointRefPrefix, id)
+}
+
+// gitCheckpointsEnabled reports whether checkpoints are stored in git: the
+// working directory must be the top level of a git work tree, and
+// EVE_GIT_CHECKPOINTS must not be "0", "false" or "off"
+func gitCheckpointsEnabled() bool {
+	switch os.Getenv("EVE_GIT_CHECKPOINTS") {
+	case "0", "false", "off":
+		return false
+	}
+	return atGitTopLevel()
+}
+
+// atGitTopLevel reports whether the working directory is the top level of a
+// git work tree
+func atGitTopLevel() bool {
+	top, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return false
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	topDir, err1 := filepath.EvalSymlinks(strings.TrimSpace(top))
+	wdDir, err2 := filepath.EvalSymlinks(wd)
+	return err1 == nil && err2 == nil && topDir == wdDir
+}
+
+// gitIdentityEnv supplies an author and committer when git has none
+// configured, so checkpoints work in fresh repositories
+func gitIdentityEnv() []string {
+	if _, err := runGit("var", "GIT_COMMITTER_IDENT"); err == nil {
+		return nil
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=EVE", "GIT_AUTHOR_EMAIL=eve@localhost",
+		"GIT_COMMITTER_NAME=EVE", "GIT_COMMITTER_EMAIL=eve@localhost",
+	}
+}
+
+// writeGitCheckpoint stores the snapshot files as a commit whose parent is
+// HEAD and returns its hash. The tree is built in a temporary index, so the
+// user's index, branch and working tree are left alone. The git blob of
+// every file is recorded in files.
+func writeGitCheckpoint(files map[string]CheckpointFile, message string) (string, error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		if strings.ContainsAny(path, "\n\x00") {
+			return "", fmt.Errorf("cannot store %q in git", path)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// --no-filters keeps the bytes exactly as they are on disk
+	var shas []string
+	if len(paths) > 0 {
+		output, err := runGitWithInput(strings.Join(paths, "\n")+"\n", "hash-object", "-w", "--no-filters", "--stdin-paths")
+		if err != nil {
+			return "", err
+		}
+		shas = strings.Fields(output)
+		if len(shas) != len(paths) {
+			return "", fmt.Errorf("git hash-object returned %d hashes for %d files", len(shas), len(paths))
+		}
+	}
+
+	var index strings.Builder
+	for i, path := range paths {
+		file := files[path]
+		mode := "100644"
+		if file.Mode&0111 != 0 {
+			mode = "100755"
+		}
+		fmt.Fprintf(&index, "%s %s\t%s\x00", mode, shas[i], path)
+		file.GitBlob = shas[i]
+		files[path] = file
+	}
+
+	tmp, err := os.MkdirTemp("", "eve-checkpoint-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	indexEnv := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+
+	if _, err := execGit(indexEnv, index.String(), "update-index", "--add", "-z", "--index-info"); err != nil {
+		return "", err
+	}
+	tree, err := execGit(indexEnv, "", "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"commit-tree", strings.TrimSpace(tree), "-F", "-"}
+	if head, err := runGit("rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err == nil {
+		args = append(args, "-p", strings.TrimSpace(head))
+	}
+	commit, err := execGit(gitIdentityEnv(), message, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(commit), nil
+}
+
+// createGitCheckpoint snapshots the working tree into a shadow commit and
+// points the checkpoint's hidden ref at it
+func createGitCheckpoint(name, description string) (*Checkpoint, error) {
+	files, skipped, err := snapshotWorkingTree(".", hashBlob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot working tree: %w", err)
+	}
+
+	commit, err := writeGitCheckpoint(files, fmt.Sprintf("EVE checkpoint: %s\n\n%s\n", name, description))
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := globalDB.CreateCheckpoint(name, description, files, skipped, commit)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runGit("update-ref", "-m", "EVE checkpoint "+name, gitCheckpointRef(checkpoint.ID), commit); err != nil {
+		return nil, fmt.Errorf("checkpoint %d saved as commit %s, but its ref could not be created: %w", checkpoint.ID, commit, err)
+	}
+	return checkpoint, nil
+}
+
+// resolveGitCheckpoint reads the file contents of a git-backed checkpoint
+// from its hidden ref, falling back to the recorded commit if the ref was
+// removed
+func resolveGitCheckpoint(checkpoint *Checkpoint) error {
+	commit, err := runGit("rev-parse", "--verify", "--quiet", gitCheckpointRef(checkpoint.ID)+"^{commit}")
+	if err != nil {
+		if _, err := runGit("cat-file", "-e", checkpoint.GitCommit+"^{commit}"); err != nil {
+			return fmt.Errorf("checkpoint %d is stored in git, but neither %s nor commit %s exists in this repository",
+				checkpoint.ID, gitCheckpointRef(checkpoint.ID), checkpoint.GitCommit)
+		}
+		commit = checkpoint.GitCommit
+	}
+
+	// <mode> SP <type> SP <object> TAB <path> NUL
+	listing, err := runGit("ls-tree", "-r", "-z", "--full-tree", strings.TrimSpace(commit))
+	if err != nil {
+		return err
+	}
+	blobs := map[string]string{}
+	for _, entry := range strings.Split(listing, "\x00") {
+		info, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+		if ok && len(fields) == 3 && fields[1] == "blob" {
+			blobs[path] = fields[2]
+		}
+	}
+
+	for path, file := range checkpoint.Files {
+		blob, ok := blobs[path]
+		if !ok {
+			return fmt.Errorf("%s is missing from the git commit of checkpoint %d", path, checkpoint.ID)
+		}
+		file.GitBlob = blob
+		checkpoint.Files[path] = file
+	}
+	return nil
+}
+
+// removeGitCheckpointRefs deletes the hidden refs of removed checkpoints, so
+// git can garbage collect their commits
+func removeGitCheckpointRefs(ids []int) {
+	if len(ids) == 0 || !atGitTopLevel() {
+		return
+	}
+	for _, id := range ids {
+		if _, err := runGit("update-ref", "-d", gitCheckpointRef(id)); err != nil {
+			log.Printf("Failed to remove %s: %v", gitCheckpointRef(id), err)
+		}
+	}
+}
+
+// bundleGitCheckpoints writes the commits of every checkpoint ref to a git
+// bundle at bundlePath, since the project database only holds their IDs. It
+// reports false when there are no checkpoint refs to bundle.
+func bundleGitCheckpoints(bundlePath string) (bool, error) {
+	if !atGitTopLevel() {
+		return false, nil
+	}
+	output, err := runGit("for-each-ref", "--format=%(refname)", gitCheckpointRefPrefix)
+	if err != nil {
+		return false, err
+	}
+	refs := strings.Fields(output)
+	if len(refs) == 0 {
+		return false, nil
+	}
+	if _, err := runGit(append([]string{"bundle", "create", "-q", bundlePath}, refs...)...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// verifyGitCheckpointBundle checks that a bundle can be fetched into the
+// repository: the working directory must be its top level and the bundle's
+// prerequisite commits must be present
+func verifyGitCheckpointBundle(bundlePath string) error {
+	if !atGitTopLevel() {
+		return fmt.Errorf("the backup holds git checkpoints, but the working directory is not the top level of a git work tree")
+	}
+	if _, err := runGit("bundle", "verify", "-q", bundlePath); err != nil {
+		return fmt.Errorf("the git checkpoints of the backup cannot be restored into this repository: %w", err)
+	}
+	return nil
+}
+
+// unbundleGitCheckpoints fetches the checkpoint refs of a bundle checked by
+// verifyGitCheckpointBundle into the repository, replacing the refs of
+// checkpoints with the same IDs
+func unbundleGitCheckpoints(bundlePath string) error {
+	_, err := runGit("fetch", "-q", "--no-tags", "--force", bundlePath, gitCheckpointRefPrefix+"*:"+gitCheckpointRefPrefix+"*")
+	return err
+}
+
+// checkpointBlob returns the content of a checkpoint file from git or the project database
+func checkpointBlob(file CheckpointFile) ([]byte, error) {
+	if file.GitBlob != "" {
+		content, err := runGit("cat-file", "blob", file.GitBlob)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(content), nil
+	}
+	return globalDB.GetBlob(file.Hash)
+}
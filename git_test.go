@@ -0,0 +1,66 @@
+// git_test.go - Detection of destructive git commands run through the shell
+package main
+
+import "testing"
+
+func TestDestructiveGitCommand(t *testing.T) {
+	tests := []struct {
+		command     string
+		destructive bool
+	}{
+		{"git status", false},
+		{"git diff HEAD~1", false},
+		{"git log --oneline -5", false},
+		{"git commit -m 'fix parser'", false},
+		{"git commit --amend --no-edit", true},
+		{"git commit --amend=yes", true},
+		{"git push origin main", false},
+		{"git push -u origin feature", false},
+		{"git push --force origin main", true},
+		{"git push -f origin main", true},
+		{"git push --force-with-lease", true},
+		{"git push origin +main", true},
+		{"git push origin +HEAD:main", true},
+		{"git push origin :old-branch", true},
+		{"git push origin --delete old-branch", true},
+		{"git reset HEAD file.go", false},
+		{"git reset --soft HEAD~1", false},
+		{"git reset --hard HEAD~1", true},
+		{"git clean -n", false},
+		{"git clean -f", true},
+		{"git clean -fd", true},
+		{"git clean -dfx", true},
+		{"git clean -nd", false},
+		{"git checkout -b feature", false},
+		{"git checkout main", false},
+		{"git checkout -- .", true},
+		{"git checkout -f main", true},
+		{"git restore --staged file.go", false},
+		{"git restore -S file.go", false},
+		{"git restore file.go", true},
+		{"git restore --staged --worktree file.go", true},
+		{"git switch -c feature", false},
+		{"git switch -C feature", true},
+		{"git branch -d merged", false},
+		{"git branch -D unmerged", true},
+		{"git branch -df unmerged", true},
+		{"git stash", false},
+		{"git stash drop", true},
+		{"git rebase -i HEAD~3", true},
+		{"git -C sub status", false},
+		{"git -C sub reset --hard", true},
+		{"git -C reset status", false},
+		{"git -c core.editor=true rebase main", true},
+		{"/usr/bin/git reset --hard", true},
+		{"cd sub && git clean -fd", true},
+		{"echo done; git push --force", true},
+		{"go test ./... | tee git.log", false},
+	}
+
+	for _, tt := range tests {
+		reason := destructiveGitCommand(tt.command)
+		if (reason != "") != tt.destructive {
+			t.Errorf("destructiveGitCommand(%q) = %q, want destructive %v", tt.command, reason, tt.destructive)
+		}
+	}
+}
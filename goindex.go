@@ -0,0 +1,590 @@
+// goindex.go - Go symbol index for definition, reference and implementer lookups
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// goSignatureMaxLen caps how much source is shown for one declaration
+const goSignatureMaxLen = 1500
+
+// goSymbol is a declaration found in the indexed Go code
+type goSymbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"` // "type", "interface", "func", "method", "var", "const"
+	Package   string `json:"package"`
+	Receiver  string `json:"receiver,omitempty"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+	obj       types.Object
+}
+
+// goPackage is one type-checked package (a directory and package name)
+type goPackage struct {
+	Path  string
+	Dir   string
+	Name  string
+	Files int
+	types *types.Package
+	info  *types.Info
+}
+
+// goIndex holds every package and symbol under a root directory
+type goIndex struct {
+	root        string
+	fingerprint string
+	fset        *token.FileSet
+	packages    []*goPackage
+	symbols     []*goSymbol
+}
+
+var (
+	goIndexMu    sync.Mutex
+	goIndexCache *goIndex
+)
+
+// moduleImporter type-checks the indexed packages when they are first
+// imported, so uses in other packages resolve to the same objects. Imports
+// from outside the index get empty packages so dependencies never have to be
+// compiled; declarations in the indexed code still resolve.
+type moduleImporter struct {
+	idx      *goIndex
+	sources  map[string]*goPackage // importable indexed packages by import path
+	packages map[string]*types.Package
+	checking map[*goPackage]bool
+	files    map[*goPackage][]*ast.File
+}
+
+func (im *moduleImporter) Import(importPath string) (*types.Package, error) {
+	if pkg, ok := im.packages[importPath]; ok {
+		return pkg, nil
+	}
+	if src, ok := im.sources[importPath]; ok && !im.checking[src] {
+		im.check(src)
+		return src.types, nil
+	}
+
+	// An import cycle gets a stand-in, the checked package replaces it later
+	pkg := types.NewPackage(importPath, path.Base(importPath))
+	pkg.MarkComplete()
+	if _, ok := im.sources[importPath]; !ok {
+		im.packages[importPath] = pkg
+	}
+	return pkg, nil
+}
+
+// check type-checks pkg unless that was done already, importing the indexed
+// packages it depends on first
+func (im *moduleImporter) check(pkg *goPackage) {
+	if pkg.types != nil || im.checking[pkg] {
+		return
+	}
+	im.checking[pkg] = true
+	defer delete(im.checking, pkg)
+
+	pkg.info = &types.Info{
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+		Types: make(map[ast.Expr]types.TypeAndValue),
+	}
+	conf := types.Config{
+		Importer: im,
+		// Errors are expected (missing dependencies, build-tagged files) and ignored
+		Error: func(error) {},
+	}
+	pkg.types, _ = conf.Check(pkg.Path, im.idx.fset, im.files[pkg], pkg.info)
+	if pkg.types == nil {
+		pkg.types = types.NewPackage(pkg.Path, pkg.Name)
+	}
+	if im.sources[pkg.Path] == pkg {
+		im.packages[pkg.Path] = pkg.types
+	}
+}
+
+// loadGoIndex returns the index for root, rebuilding it when any Go file changed
+func loadGoIndex(root string) (*goIndex, error) {
+	goIndexMu.Lock()
+	defer goIndexMu.Unlock()
+
+	files, fingerprint, err := goSourceFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	if goIndexCache != nil && goIndexCache.root == root && goIndexCache.fingerprint == fingerprint {
+		return goIndexCache, nil
+	}
+
+	idx, err := buildGoIndex(root, files)
+	if err != nil {
+		return nil, err
+	}
+	idx.fingerprint = fingerprint
+	goIndexCache = idx
+	return idx, nil
+}
+
+// goSourceFiles lists the Go files under root grouped by directory, plus a
+// fingerprint of their sizes and modification times
+func goSourceFiles(root string) (map[string][]string, string, error) {
+	files := make(map[string][]string)
+	var fp strings.Builder
+	err := walkIgnoring(root, false, func(relPath string, d fs.DirEntry) error {
+		if d.IsDir() || !strings.HasSuffix(relPath, ".go") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		dir := path.Dir(relPath)
+		files[dir] = append(files[dir], relPath)
+		fmt.Fprintf(&fp, "%s:%d:%d;", relPath, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return files, fp.String(), err
+}
+
+// goModulePath reads the module path from root/go.mod
+func goModulePath(root string) string {
+	f, err := os.Open(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "module" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// buildGoIndex parses and type-checks every package under root
+func buildGoIndex(root string, files map[string][]string) (*goIndex, error) {
+	idx := &goIndex{root: root, fset: token.NewFileSet()}
+	module := goModulePath(root)
+	importer := &moduleImporter{
+		idx:      idx,
+		sources:  map[string]*goPackage{},
+		packages: map[string]*types.Package{},
+		checking: map[*goPackage]bool{},
+		files:    map[*goPackage][]*ast.File{},
+	}
+
+	dirs := make([]string, 0, len(files))
+	for dir := range files {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		// A directory may hold several packages (e.g. foo and foo_test)
+		byName := make(map[string][]*ast.File)
+		var names []string
+		for _, rel := range files[dir] {
+			f, err := parser.ParseFile(idx.fset, filepath.Join(root, filepath.FromSlash(rel)), nil, parser.ParseComments)
+			if err != nil && f == nil {
+				continue
+			}
+			if _, seen := byName[f.Name.Name]; !seen {
+				names = append(names, f.Name.Name)
+			}
+			byName[f.Name.Name] = append(byName[f.Name.Name], f)
+		}
+		sort.Strings(names)
+
+		importPath := dir
+		if module != "" {
+			importPath = path.Join(module, dir)
+		}
+		for _, name := range names {
+			pkg := &goPackage{Path: importPath, Dir: dir, Name: name, Files: len(byName[name])}
+			idx.packages = append(idx.packages, pkg)
+			importer.files[pkg] = byName[name]
+
+			// The importable package of a directory is the largest one that
+			// is not an external test package
+			if current, ok := importer.sources[importPath]; !strings.HasSuffix(name, "_test") && (!ok || pkg.Files > current.Files) {
+				importer.sources[importPath] = pkg
+			}
+		}
+	}
+
+	for _, pkg := range idx.packages {
+		importer.check(pkg)
+	}
+	for _, pkg := range idx.packages {
+		idx.collectSymbols(pkg, importer.files[pkg])
+	}
+
+	log.Printf("Indexed %d Go packages with %d symbols", len(idx.packages), len(idx.symbols))
+	return idx, nil
+}
+
+// collectSymbols records the top-level declarations and methods of a package
+func (idx *goIndex) collectSymbols(pkg *goPackage, files []*ast.File) {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				obj := pkg.info.Defs[d.Name]
+				if obj == nil {
+					continue
+				}
+				sym := idx.newSymbol(pkg, obj, d.Doc)
+				sym.Kind = "func"
+				if d.Recv != nil && len(d.Recv.List) > 0 {
+					sym.Kind = "method"
+					sym.Receiver = receiverName(d.Recv.List[0].Type)
+				}
+				signature := *d
+				signature.Doc, signature.Body = nil, nil
+				sym.Signature = idx.nodeString(&signature)
+				idx.symbols = append(idx.symbols, sym)
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						obj := pkg.info.Defs[s.Name]
+						if obj == nil {
+							continue
+						}
+						doc := s.Doc
+						if doc == nil {
+							doc = d.Doc
+						}
+						sym := idx.newSymbol(pkg, obj, doc)
+						sym.Kind = "type"
+						if _, ok := s.Type.(*ast.InterfaceType); ok {
+							sym.Kind = "interface"
+						}
+						signature := *s
+						signature.Doc, signature.Comment = nil, nil
+						sym.Signature = "type " + idx.nodeString(&signature)
+						idx.symbols = append(idx.symbols, sym)
+					case *ast.ValueSpec:
+						for _, name := range s.Names {
+							obj := pkg.info.Defs[name]
+							if obj == nil || name.Name == "_" {
+								continue
+							}
+							doc := s.Doc
+							if doc == nil {
+								doc = d.Doc
+							}
+							sym := idx.newSymbol(pkg, obj, doc)
+							sym.Kind = "var"
+							if d.Tok == token.CONST {
+								sym.Kind = "const"
+							}
+							signature := *s
+							signature.Doc, signature.Comment = nil, nil
+							sym.Signature = d.Tok.String() + " " + idx.nodeString(&signature)
+							idx.symbols = append(idx.symbols, sym)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// nodeString prints a declaration as source, shortened if it is very long
+func (idx *goIndex) nodeString(node ast.Node) string {
+	var buf bytes.Buffer
+	config := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := config.Fprint(&buf, idx.fset, node); err != nil {
+		return ""
+	}
+	text := buf.String()
+	if len(text) > goSignatureMaxLen {
+		text = truncateUTF8(text, goSignatureMaxLen) + " ..."
+	}
+	return text
+}
+
+// newSymbol fills in the fields common to every symbol kind
+func (idx *goIndex) newSymbol(pkg *goPackage, obj types.Object, doc *ast.CommentGroup) *goSymbol {
+	pos := idx.fset.Position(obj.Pos())
+	sym := &goSymbol{
+		Name:    obj.Name(),
+		Package: pkg.Path,
+		File:    idx.relPath(pos.Filename),
+		Line:    pos.Line,
+		obj:     obj,
+	}
+	if doc != nil {
+		sym.Doc = strings.TrimSpace(doc.Text())
+	}
+	return sym
+}
+
+// relPath makes a file name relative to the index root for display
+func (idx *goIndex) relPath(filename string) string {
+	if rel, err := filepath.Rel(idx.root, filename); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filename
+}
+
+// receiverName returns the type name of a method receiver expression
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// lookup finds symbols by name. "Type.Method" restricts methods to a receiver.
+func (idx *goIndex) lookup(name string) []*goSymbol {
+	receiver := ""
+	if before, after, ok := strings.Cut(name, "."); ok {
+		receiver, name = before, after
+	}
+	var result []*goSymbol
+	for _, sym := range idx.symbols {
+		if sym.Name != name {
+			continue
+		}
+		if receiver != "" && sym.Receiver != receiver {
+			continue
+		}
+		result = append(result, sym)
+	}
+	return result
+}
+
+// references returns the positions where any of the given symbols are used
+func (idx *goIndex) references(syms []*goSymbol) []string {
+	targets := make(map[types.Object]bool)
+	for _, sym := range syms {
+		targets[sym.obj] = true
+	}
+
+	var refs []string
+	for _, pkg := range idx.packages {
+		for ident, obj := range pkg.info.Uses {
+			if targets[obj] {
+				pos := idx.fset.Position(ident.Pos())
+				refs = append(refs, fmt.Sprintf("%s:%d:%d", idx.relPath(pos.Filename), pos.Line, pos.Column))
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// implementers returns the named types that satisfy the given interface symbol
+func (idx *goIndex) implementers(iface *goSymbol) []*goSymbol {
+	it, ok := iface.obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil
+	}
+
+	var result []*goSymbol
+	for _, sym := range idx.symbols {
+		if sym.Kind != "type" {
+			continue
+		}
+		t := sym.obj.Type()
+		if types.Implements(t, it) || types.Implements(types.NewPointer(t), it) {
+			result = append(result, sym)
+		}
+	}
+	return result
+}
+
+// GoSymbolsInput is the input for the go_symbols tool
+type GoSymbolsInput struct {
+	Query   string `json:"query,omitempty" jsonschema_description:"Optional case-insensitive substring to filter symbol names."`
+	Kind    string `json:"kind,omitempty" jsonschema_description:"Optional kind filter: package, type, interface, func, method, var or const."`
+	Package string `json:"package,omitempty" jsonschema_description:"Optional package import path or directory to restrict results to."`
+}
+
+var GoSymbolsInputSchema = GenerateSchema[GoSymbolsInput]()
+
+func GoSymbols(input json.RawMessage) (string, error) {
+	var symInput GoSymbolsInput
+	if err := json.Unmarshal(input, &symInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	idx, err := loadGoIndex(".")
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if symInput.Kind == "package" {
+		for _, pkg := range idx.packages {
+			fmt.Fprintf(&sb, "%s (package %s, dir %s, %d files)\n", pkg.Path, pkg.Name, pkg.Dir, pkg.Files)
+		}
+		return sb.String(), nil
+	}
+
+	query := strings.ToLower(symInput.Query)
+	count := 0
+	for _, sym := range idx.symbols {
+		if query != "" && !strings.Contains(strings.ToLower(sym.Name), query) {
+			continue
+		}
+		if symInput.Kind != "" && sym.Kind != symInput.Kind {
+			continue
+		}
+		if symInput.Package != "" && sym.Package != symInput.Package && path.Dir(sym.File) != symInput.Package {
+			continue
+		}
+		name := sym.Name
+		if sym.Receiver != "" {
+			name = sym.Receiver + "." + name
+		}
+		fmt.Fprintf(&sb, "%s:%d: %s %s\n", sym.File, sym.Line, sym.Kind, name)
+		count++
+	}
+	if count == 0 {
+		return "No matching symbols found", nil
+	}
+	return sb.String(), nil
+}
+
+var GoSymbolsDefinition = ToolDefinition{
+	Name:        "go_symbols",
+	Description: "List Go packages and symbols (types, interfaces, functions, methods, variables, constants) in the project, optionally filtered by name, kind or package.",
+	InputSchema: GoSymbolsInputSchema,
+	Function:    GoSymbols,
+}
+
+// GoSymbolInput is the input for the symbol lookup tools
+type GoSymbolInput struct {
+	Name string `json:"name" jsonschema_description:"Symbol name, e.g. SendMessage, LLMProvider, or Type.Method such as AnthropicProvider.SendMessage."`
+}
+
+var GoSymbolInputSchema = GenerateSchema[GoSymbolInput]()
+
+func GoDefinition(input json.RawMessage) (string, error) {
+	_, syms, err := resolveGoSymbol(input)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, sym := range syms {
+		fmt.Fprintf(&sb, "%s:%d (%s, package %s)\n", sym.File, sym.Line, sym.Kind, sym.Package)
+		if sym.Doc != "" {
+			for _, line := range strings.Split(sym.Doc, "\n") {
+				sb.WriteString("// " + line + "\n")
+			}
+		}
+		sb.WriteString(sym.Signature + "\n\n")
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+var GoDefinitionDefinition = ToolDefinition{
+	Name:        "go_definition",
+	Description: "Find where a Go symbol is defined, with its signature and doc comment. Use Type.Method to pick a specific method implementation.",
+	InputSchema: GoSymbolInputSchema,
+	Function:    GoDefinition,
+}
+
+func GoReferences(input json.RawMessage) (string, error) {
+	idx, syms, err := resolveGoSymbol(input)
+	if err != nil {
+		return "", err
+	}
+
+	refs := idx.references(syms)
+	if len(refs) == 0 {
+		return "No references found", nil
+	}
+	return fmt.Sprintf("%d references:\n%s", len(refs), strings.Join(refs, "\n")), nil
+}
+
+var GoReferencesDefinition = ToolDefinition{
+	Name:        "go_references",
+	Description: "Find every place a Go symbol is referenced in the project, as file:line:column locations.",
+	InputSchema: GoSymbolInputSchema,
+	Function:    GoReferences,
+}
+
+func GoImplementers(input json.RawMessage) (string, error) {
+	idx, syms, err := resolveGoSymbol(input)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	found := false
+	for _, sym := range syms {
+		if sym.Kind != "interface" {
+			continue
+		}
+		found = true
+		impls := idx.implementers(sym)
+		fmt.Fprintf(&sb, "Implementers of %s (%s:%d):\n", sym.Name, sym.File, sym.Line)
+		if len(impls) == 0 {
+			sb.WriteString("  none\n")
+		}
+		for _, impl := range impls {
+			fmt.Fprintf(&sb, "  %s:%d: %s\n", impl.File, impl.Line, impl.Name)
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("%s is not an interface", syms[0].Name)
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+var GoImplementersDefinition = ToolDefinition{
+	Name:        "go_implementers",
+	Description: "List the Go types in the project that implement an interface, such as LLMProvider.",
+	InputSchema: GoSymbolInputSchema,
+	Function:    GoImplementers,
+}
+
+// resolveGoSymbol parses a GoSymbolInput and looks the name up in the index
+func resolveGoSymbol(input json.RawMessage) (*goIndex, []*goSymbol, error) {
+	var symInput GoSymbolInput
+	if err := json.Unmarshal(input, &symInput); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse input: %w", err)
+	}
+	if symInput.Name == "" {
+		return nil, nil, fmt.Errorf("name must not be empty")
+	}
+
+	idx, err := loadGoIndex(".")
+	if err != nil {
+		return nil, nil, err
+	}
+	syms := idx.lookup(symInput.Name)
+	if len(syms) == 0 {
+		return nil, nil, fmt.Errorf("no Go symbol named %s found", symInput.Name)
+	}
+	return idx, syms, nil
+}
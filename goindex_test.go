@@ -0,0 +1,145 @@
+// goindex_test.go - Go symbol lookups across the packages of a module
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testGoModule is a module whose packages use each other
+var testGoModule = map[string]string{
+	"go.mod": "module example.com/shapes\n\ngo 1.22\n",
+	"shape/shape.go": `package shape
+
+import "fmt"
+
+// Shape is anything with an area
+type Shape interface {
+	Area() float64
+}
+
+// Describe formats the area of s
+func Describe(s Shape) string {
+	return fmt.Sprintf("area %.1f", s.Area())
+}
+`,
+	"shape/shape_test.go": `package shape_test
+
+import "example.com/shapes/shape"
+
+var _ = shape.Describe
+`,
+	"square/square.go": `package square
+
+import "example.com/shapes/shape"
+
+// Square is a shape with equal sides
+type Square struct{ Side float64 }
+
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+// Label describes a square
+func Label(side float64) string {
+	return shape.Describe(Square{side})
+}
+`,
+	"main.go": `package main
+
+import (
+	"example.com/shapes/shape"
+	"example.com/shapes/square"
+)
+
+type circle struct{ r float64 }
+
+func (c *circle) Area() float64 { return 3 * c.r * c.r }
+
+func main() {
+	println(shape.Describe(&circle{1}), square.Label(2))
+}
+`,
+}
+
+// writeTestGoModule writes testGoModule to the working directory
+func writeTestGoModule(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	writeTestTree(t, ".", testGoModule)
+}
+
+func TestGoReferencesAcrossPackages(t *testing.T) {
+	writeTestGoModule(t)
+	output, err := GoReferences(json.RawMessage(`{"name": "Describe"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"3 references", "main.go:", "square/square.go:", "shape/shape_test.go:"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("references lack %q:\n%s", want, output)
+		}
+	}
+
+	output, err = GoReferences(json.RawMessage(`{"name": "Label"}`))
+	if err != nil || !strings.Contains(output, "1 references:\nmain.go:") {
+		t.Fatalf("references of Label = %q, %v", output, err)
+	}
+}
+
+func TestGoImplementersAcrossPackages(t *testing.T) {
+	writeTestGoModule(t)
+	output, err := GoImplementers(json.RawMessage(`{"name": "Shape"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"square/square.go:6: Square", "main.go:8: circle"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("implementers lack %q:\n%s", want, output)
+		}
+	}
+
+	if _, err := GoImplementers(json.RawMessage(`{"name": "Square"}`)); err == nil {
+		t.Fatal("a struct was accepted as an interface")
+	}
+}
+
+func TestGoSymbolsAndDefinition(t *testing.T) {
+	writeTestGoModule(t)
+	output, err := GoSymbols(json.RawMessage(`{"kind": "package"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"example.com/shapes (package main", "example.com/shapes/shape (package shape,", "example.com/shapes/shape (package shape_test,"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("packages lack %q:\n%s", want, output)
+		}
+	}
+
+	output, err = GoDefinition(json.RawMessage(`{"name": "Square.Area"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "square/square.go:8 (method, package example.com/shapes/square)") || !strings.Contains(output, "func (s Square) Area() float64") {
+		t.Fatalf("definition of Square.Area:\n%s", output)
+	}
+}
+
+func TestGoIndexImportCycle(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, dir := range []string{"a", "b"} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, "go.mod", "module example.com/cycle\n")
+	writeTestFile(t, "a/a.go", "package a\n\nimport \"example.com/cycle/b\"\n\nfunc A() { b.B() }\n")
+	writeTestFile(t, "b/b.go", "package b\n\nimport \"example.com/cycle/a\"\n\nfunc B() { a.A() }\n")
+
+	// The cycle does not stop indexing; the package checked first still
+	// resolves its uses of the other
+	output, err := GoReferences(json.RawMessage(`{"name": "B"}`))
+	if err != nil || !strings.Contains(output, "a/a.go:5") {
+		t.Fatalf("references of B = %q, %v", output, err)
+	}
+}
@@ -0,0 +1,97 @@
+// history.go - Edit history recording for mutating tools
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"sync/atomic"
+	"time"
+)
+
+// Identity attached to every edit history entry written by this process
+var (
+	globalSessionID = fmt.Sprintf("session-%d", time.Now().UnixNano())
+	globalUser      = currentUserName()
+)
+
+// changeGroupCounter numbers the tool calls that change files in this session
+var changeGroupCounter atomic.Int64
+
+// newChangeGroup returns an identifier shared by all file changes made by one tool call
+func newChangeGroup() string {
+	return fmt.Sprintf("%s-%d", globalSessionID, changeGroupCounter.Add(1))
+}
+
+// currentUserName returns the local user name, falling back to the environment
+func currentUserName() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// recordFileChange records a tool-driven file change in the project database.
+// oldContent is nil for newly created files and newContent is nil for deleted
+// files. Both versions are kept as blobs so the change can be undone later.
+// mode is the file's permissions before a delete; otherwise 0 reads them
+// from the written file. Failures are logged rather than returned because
+// the change itself has already been written.
+func recordFileChange(tool, group, path string, mode os.FileMode, oldContent, newContent []byte) {
+	if globalDB == nil {
+		return
+	}
+
+	edit := &EditHistory{
+		Path:    path,
+		Tool:    tool,
+		User:    globalUser,
+		Session: globalSessionID,
+		Group:   group,
+		Mode:    mode,
+	}
+	if mode == 0 {
+		if info, err := os.Stat(path); err == nil {
+			edit.Mode = info.Mode().Perm()
+		}
+	}
+
+	oldPath, newPath := "a/"+path, "b/"+path
+	switch {
+	case oldContent == nil:
+		edit.Operation = "create"
+		oldPath = "/dev/null"
+	case newContent == nil:
+		edit.Operation = "delete"
+		newPath = "/dev/null"
+	default:
+		edit.Operation = "modify"
+	}
+	var err error
+	if oldContent != nil {
+		if edit.OldHash, err = globalDB.SaveBlob(oldContent); err != nil {
+			log.Printf("Failed to store previous content of %s: %v", path, err)
+		}
+	}
+	if newContent != nil {
+		if edit.NewHash, err = globalDB.SaveBlob(newContent); err != nil {
+			log.Printf("Failed to store new content of %s: %v", path, err)
+		}
+	}
+	edit.Diff = UnifiedDiff(oldPath, newPath, string(oldContent), string(newContent))
+
+	if err := globalDB.RecordEdit(edit); err != nil {
+		log.Printf("Failed to record edit history for %s: %v", path, err)
+	}
+
+	// A new change invalidates anything that was waiting to be redone
+	if len(globalDB.LoadRedoStack()) > 0 {
+		if err := globalDB.SaveRedoStack(nil); err != nil {
+			log.Printf("Failed to clear redo stack: %v", err)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+// httpclient.go - Host policy, secret references and bounded HTTP for network tools
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// httpDefaultTimeout bounds a whole request including reading the body
+	httpDefaultTimeout = 30 * time.Second
+	// httpMaxTimeout is the longest timeout a tool call may ask for
+	httpMaxTimeout = 5 * time.Minute
+	// httpDefaultMaxResponseBytes caps how much of a response body is read
+	httpDefaultMaxResponseBytes = 1024 * 1024
+	// httpMaxRedirects caps redirects; every hop is checked against the host policy
+	httpMaxRedirects = 5
+)
+
+// metadataHosts are cloud instance metadata endpoints that are always blocked,
+// since they hand out credentials to anything running on the machine
+var metadataHosts = map[string]bool{
+	"169.254.169.254":          true,
+	"fd00:ec2::254":            true,
+	"100.100.100.200":          true,
+	"metadata":                 true,
+	"metadata.google.internal": true,
+	"metadata.azure.com":       true,
+	"instance-data":            true,
+}
+
+// globalHTTPConfig is the policy used by api_call and web_scraper
+var globalHTTPConfig = NewHTTPConfigFromEnv()
+
+// hostMatches reports whether host matches a pattern: an exact name or IP,
+// "*.example.com" or ".example.com" for subdomains, or a CIDR range
+func hostMatches(host, pattern string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		ip := net.ParseIP(host)
+		return ip != nil && network.Contains(ip)
+	}
+	if strings.HasPrefix(pattern, "*.") || strings.HasPrefix(pattern, ".") {
+		suffix := "." + strings.TrimLeft(pattern, "*.")
+		return strings.HasSuffix(host, suffix) || host == suffix[1:]
+	}
+	return host == pattern
+}
+
+// CheckURL validates a URL against the host policy before it is requested
+func (c *HTTPConfig) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q; only http and https are allowed", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("URL has no host")
+	}
+	return c.checkHost(host)
+}
+
+// checkHost applies the metadata block, deny list and allow list to a host
+// name or IP. Deny rules win over allow rules.
+func (c *HTTPConfig) checkHost(host string) error {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if metadataHosts[strings.TrimSuffix(host, ".")] {
+		return fmt.Errorf("host %s is a cloud metadata endpoint and is blocked", host)
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()) {
+		return fmt.Errorf("link-local address %s is blocked", host)
+	}
+	for _, pattern := range c.DenyHosts {
+		if hostMatches(host, pattern) {
+			return fmt.Errorf("host %s is denied by the HTTP policy", host)
+		}
+	}
+	if len(c.AllowHosts) > 0 {
+		for _, pattern := range c.AllowHosts {
+			if hostMatches(host, pattern) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host %s is not in the HTTP allow list", host)
+	}
+	return nil
+}
+
+// checkDialAddress is run for every connection after DNS resolution, so a
+// permitted name that resolves to a metadata or denied address is refused
+func (c *HTTPConfig) checkDialAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	if metadataHosts[ip.String()] || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return fmt.Errorf("address %s is blocked", ip)
+	}
+	for _, pattern := range c.DenyHosts {
+		if hostMatches(ip.String(), pattern) {
+			return fmt.Errorf("address %s is denied by the HTTP policy", ip)
+		}
+	}
+	return nil
+}
+
+// Client returns an HTTP client that enforces the policy on every
+// connection and redirect
+func (c *HTTPConfig) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return c.checkDialAddress(address)
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 c.proxy,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= httpMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", httpMaxRedirects)
+			}
+			if err := c.CheckURL(req.URL); err != nil {
+				return err
+			}
+			c.stripSecrets(req)
+			return nil
+		},
+	}
+}
+
+// httpProxy picks the proxy for a request; tests replace it
+var httpProxy = http.ProxyFromEnvironment
+
+// proxy returns the proxy for req. Behind a proxy the dialer only sees the
+// proxy's address, so the target host and every address it resolves to are
+// checked here before the request is handed to the proxy.
+func (c *HTTPConfig) proxy(req *http.Request) (*url.URL, error) {
+	proxyURL, err := httpProxy(req)
+	if err != nil || proxyURL == nil {
+		return proxyURL, err
+	}
+	host := req.URL.Hostname()
+	addrs, err := net.DefaultResolver.LookupIPAddr(req.Context(), host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot check %s before sending it to the proxy: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := c.checkDialAddress(net.JoinHostPort(addr.IP.String(), "0")); err != nil {
+			return nil, err
+		}
+	}
+	return proxyURL, nil
+}
+
+// requestTimeout returns the timeout for a tool call asking for seconds
+func (c *HTTPConfig) requestTimeout(seconds int) time.Duration {
+	timeout := c.Timeout
+	if seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	return min(timeout, httpMaxTimeout)
+}
+
+// readLimited reads at most limit bytes and reports whether more were available
+func readLimited(r io.Reader, limit int64) ([]byte, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(data)) > limit {
+		return data[:limit], true, nil
+	}
+	return data, false, nil
+}
+
+// secretRefPattern matches ${env:NAME} references
+var secretRefPattern = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// secretAllowed reports whether the secret in environment variable name may
+// be sent to host
+func (c *HTTPConfig) secretAllowed(name, host string) bool {
+	for _, pattern := range c.Secrets[name] {
+		if hostMatches(host, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandSecretRefs replaces ${env:NAME} references with environment values so
+// that credentials never pass through the model. Only variables declared in
+// the policy's Secrets may be referenced, and only in requests to the hosts
+// they are bound to; anything else could be echoed back to the model.
+func (c *HTTPConfig) expandSecretRefs(value, host string) (string, error) {
+	var refErr error
+	expanded := secretRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		name := secretRefPattern.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		switch {
+		case refErr != nil:
+		case len(c.Secrets[name]) == 0:
+			refErr = fmt.Errorf("environment variable %s is not declared in EVE_HTTP_SECRETS and cannot be referenced", name)
+		case !c.secretAllowed(name, host):
+			refErr = fmt.Errorf("environment variable %s may not be sent to host %s", name, host)
+		case !ok:
+			refErr = fmt.Errorf("environment variable %s referenced in request is not set", name)
+		}
+		return v
+	})
+	if refErr != nil {
+		return "", refErr
+	}
+	return expanded, nil
+}
+
+// stripSecrets removes headers carrying a declared secret from a redirected
+// request whose host the secret may not be sent to
+func (c *HTTPConfig) stripSecrets(req *http.Request) {
+	host := req.URL.Hostname()
+	for name := range c.Secrets {
+		secret := os.Getenv(name)
+		if secret == "" || c.secretAllowed(name, host) {
+			continue
+		}
+		for header, values := range req.Header {
+			for _, value := range values {
+				if strings.Contains(value, secret) {
+					req.Header.Del(header)
+					break
+				}
+			}
+		}
+	}
+}
+
+// sensitiveHeaderWords mark header names whose values must not be logged
+var sensitiveHeaderWords = []string{"auth", "token", "secret", "key", "cookie", "password", "session"}
+
+// isSensitiveHeader reports whether a header may carry credentials
+func isSensitiveHeader(name string) bool {
+	lower := strings.ToLower(name)
+	for _, word := range sensitiveHeaderWords {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatHeaders lists headers sorted by name, one per line, with credential
+// values replaced by [REDACTED]
+func formatHeaders(headers http.Header) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		for _, value := range headers[name] {
+			if isSensitiveHeader(name) {
+				value = "[REDACTED]"
+			}
+			fmt.Fprintf(&sb, "%s: %s\n", name, value)
+		}
+	}
+	return sb.String()
+}
+
+// newPolicyRequest builds a request with the given headers after checking the
+// URL. Secret references in headers must already be expanded.
+func newPolicyRequest(ctx context.Context, cfg *HTTPConfig, method, rawURL string, body io.Reader, headers map[string]string) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := cfg.CheckURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// formatHTTPResponse renders the status, headers and body of a response
+func formatHTTPResponse(resp *http.Response, body []byte, truncated bool, limit int64) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Status: %s\n", resp.Status)
+	sb.WriteString("Headers:\n")
+	for _, line := range strings.Split(strings.TrimRight(formatHeaders(resp.Header), "\n"), "\n") {
+		sb.WriteString("  " + line + "\n")
+	}
+	sb.WriteString("Body:\n")
+	sb.WriteString(formatResponseBody(resp.Header.Get("Content-Type"), body))
+	if truncated {
+		fmt.Fprintf(&sb, "\n[response truncated at %d bytes]", limit)
+	}
+	return sb.String()
+}
+
+// formatResponseBody pretty-prints JSON, passes text through and summarizes
+// binary content
+func formatResponseBody(contentType string, data []byte) string {
+	if len(data) == 0 {
+		return "(empty)"
+	}
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "" {
+		mediaType = http.DetectContentType(data)
+	}
+
+	isJSON := strings.HasSuffix(mediaType, "/json") || strings.HasSuffix(mediaType, "+json")
+	if isJSON || (strings.HasPrefix(mediaType, "text/plain") && json.Valid(data)) {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, data, "", "  "); err == nil {
+			return pretty.String()
+		}
+	}
+
+	isText := strings.HasPrefix(mediaType, "text/") || isJSON ||
+		strings.HasSuffix(mediaType, "xml") || strings.Contains(mediaType, "javascript") ||
+		mediaType == "application/x-www-form-urlencoded" || mediaType == "application/yaml"
+	if !isText && detectEncoding(data[:min(len(data), readFileSniffBytes)]) == "binary" {
+		return fmt.Sprintf("[binary response: %d bytes of %s]", len(data), mediaType)
+	}
+	return decodeText(data)
+}
@@ -0,0 +1,232 @@
+// httpclient_test.go - Host policy, redirects, proxies and secret references of network tools
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPConfigCheckURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     HTTPConfig
+		url     string
+		allowed bool
+	}{
+		{"no policy", HTTPConfig{}, "https://example.com/x", true},
+		{"unsupported scheme", HTTPConfig{}, "file:///etc/passwd", false},
+		{"aws metadata", HTTPConfig{}, "http://169.254.169.254/latest/meta-data/", false},
+		{"gcp metadata name", HTTPConfig{}, "http://metadata.google.internal/", false},
+		{"metadata with trailing dot", HTTPConfig{}, "http://metadata.google.internal./", false},
+		{"link-local", HTTPConfig{}, "http://169.254.1.2/", false},
+		{"ipv6 link-local", HTTPConfig{}, "http://[fe80::1]/", false},
+		{"metadata even when allowed", HTTPConfig{AllowHosts: []string{"169.254.169.254"}}, "http://169.254.169.254/", false},
+		{"allow list hit", HTTPConfig{AllowHosts: []string{"api.example.com"}}, "https://api.example.com/v1", true},
+		{"allow list miss", HTTPConfig{AllowHosts: []string{"api.example.com"}}, "https://other.example.com/", false},
+		{"allow subdomains", HTTPConfig{AllowHosts: []string{"*.example.com"}}, "https://a.b.example.com/", true},
+		{"allow pattern matches the domain itself", HTTPConfig{AllowHosts: []string{"*.example.com"}}, "https://example.com/", true},
+		{"allow pattern is not a suffix match", HTTPConfig{AllowHosts: []string{"*.example.com"}}, "https://badexample.com/", false},
+		{"host case is ignored", HTTPConfig{AllowHosts: []string{"api.example.com"}}, "https://API.Example.com/", true},
+		{"deny wins over allow", HTTPConfig{AllowHosts: []string{"*.example.com"}, DenyHosts: []string{"admin.example.com"}}, "https://admin.example.com/", false},
+		{"deny CIDR", HTTPConfig{DenyHosts: []string{"10.0.0.0/8"}}, "http://10.1.2.3/", false},
+		{"outside denied CIDR", HTTPConfig{DenyHosts: []string{"10.0.0.0/8"}}, "http://11.1.2.3/", true},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.cfg.CheckURL(u); (err == nil) != tt.allowed {
+			t.Errorf("%s: CheckURL(%s) = %v, want allowed %v", tt.name, tt.url, err, tt.allowed)
+		}
+	}
+}
+
+// testHTTPGet fetches rawURL with the policy's client
+func testHTTPGet(cfg *HTTPConfig, rawURL string, headers map[string]string) (*http.Response, error) {
+	req, err := newPolicyRequest(context.Background(), cfg, http.MethodGet, rawURL, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cfg.Client(5 * time.Second).Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+// localhostURL returns the URL of a test server under the name localhost
+func localhostURL(server *httptest.Server) string {
+	return strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+}
+
+func TestClientChecksResolvedAddresses(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits.Add(1) }))
+	defer server.Close()
+
+	// The name passes the host check; its address is denied when dialing
+	cfg := &HTTPConfig{DenyHosts: []string{"127.0.0.0/8", "::1/128"}}
+	if _, err := testHTTPGet(cfg, localhostURL(server), nil); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("request to a denied address = %v", err)
+	}
+	if hits.Load() != 0 {
+		t.Fatal("denied server was reached")
+	}
+
+	if _, err := testHTTPGet(&HTTPConfig{}, localhostURL(server), nil); err != nil {
+		t.Fatalf("request without policy: %v", err)
+	}
+}
+
+func TestClientRechecksRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	redirect := func(to string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, to, http.StatusFound)
+		}))
+	}
+
+	toMetadata := redirect("http://169.254.169.254/latest/meta-data/")
+	defer toMetadata.Close()
+	if _, err := testHTTPGet(&HTTPConfig{}, toMetadata.URL, nil); err == nil || !strings.Contains(err.Error(), "metadata") {
+		t.Fatalf("redirect to the metadata endpoint = %v", err)
+	}
+
+	toDenied := redirect(localhostURL(target))
+	defer toDenied.Close()
+	cfg := &HTTPConfig{DenyHosts: []string{"localhost"}}
+	if _, err := testHTTPGet(cfg, toDenied.URL, nil); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("redirect to a denied host = %v", err)
+	}
+
+	loop := httptest.NewServer(nil)
+	loop.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, loop.URL, http.StatusFound)
+	})
+	defer loop.Close()
+	if _, err := testHTTPGet(&HTTPConfig{}, loop.URL, nil); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Fatalf("redirect loop = %v", err)
+	}
+}
+
+func TestClientChecksTargetBehindProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { proxied.Add(1) }))
+	defer proxyServer.Close()
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	previous := httpProxy
+	httpProxy = func(*http.Request) (*url.URL, error) { return proxyURL, nil }
+	defer func() { httpProxy = previous }()
+
+	// The dialer only sees the proxy, so the target's addresses must be
+	// checked before the request is handed over
+	cfg := &HTTPConfig{DenyHosts: []string{"127.0.0.0/8", "::1/128"}}
+	if _, err := testHTTPGet(cfg, "http://localhost:1/", nil); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("proxied request to a denied address = %v", err)
+	}
+	if proxied.Load() != 0 {
+		t.Fatal("request for a denied address was sent to the proxy")
+	}
+
+	if _, err := testHTTPGet(&HTTPConfig{}, "http://localhost:1/", nil); err != nil {
+		t.Fatalf("proxied request: %v", err)
+	}
+	if proxied.Load() != 1 {
+		t.Fatal("request did not go through the proxy")
+	}
+}
+
+func TestExpandSecretRefs(t *testing.T) {
+	t.Setenv("TEST_API_TOKEN", "s3cret")
+	t.Setenv("TEST_UNDECLARED", "other")
+	cfg := &HTTPConfig{Secrets: map[string][]string{
+		"TEST_API_TOKEN": {"api.example.com"},
+		"TEST_UNSET":     {"api.example.com"},
+	}}
+
+	tests := []struct {
+		name  string
+		value string
+		host  string
+		want  string
+		err   string
+	}{
+		{"no references", "Bearer plain", "api.example.com", "Bearer plain", ""},
+		{"declared secret", "Bearer ${env:TEST_API_TOKEN}", "api.example.com", "Bearer s3cret", ""},
+		{"host case is ignored", "${env:TEST_API_TOKEN}", "API.example.com", "s3cret", ""},
+		{"wrong host", "Bearer ${env:TEST_API_TOKEN}", "evil.example.com", "", "may not be sent to host"},
+		{"undeclared variable", "${env:TEST_UNDECLARED}", "api.example.com", "", "not declared"},
+		{"unset variable", "${env:TEST_UNSET}", "api.example.com", "", "not set"},
+	}
+	for _, tt := range tests {
+		got, err := cfg.expandSecretRefs(tt.value, tt.host)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestAPICallSecrets(t *testing.T) {
+	t.Setenv("TEST_API_TOKEN", "s3cret")
+	var seen atomic.Value
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen.Store(r.Header.Get("Authorization"))
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, localhostURL(target), http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	previous := globalHTTPConfig
+	globalHTTPConfig = &HTTPConfig{
+		Secrets:          map[string][]string{"TEST_API_TOKEN": {"127.0.0.1"}},
+		Timeout:          5 * time.Second,
+		MaxResponseBytes: httpDefaultMaxResponseBytes,
+	}
+	defer func() { globalHTTPConfig = previous }()
+	call := func(rawURL string) (string, error) {
+		input, _ := json.Marshal(APICallInput{URL: rawURL, Headers: map[string]string{"Authorization": "Bearer ${env:TEST_API_TOKEN}"}})
+		return APICall(input)
+	}
+
+	output, err := call(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.Load() != "Bearer s3cret" {
+		t.Fatalf("server got Authorization %q", seen.Load())
+	}
+	if strings.Contains(output, "s3cret") {
+		t.Fatal("secret appears in the tool output")
+	}
+
+	// The secret is not sent to a host it is not bound to
+	if _, err := call(localhostURL(target)); err == nil {
+		t.Fatal("secret was expanded for a host it is not bound to")
+	}
+
+	// Nor is it carried along by a redirect to such a host
+	seen.Store("")
+	if _, err := call(redirect.URL); err != nil {
+		t.Fatal(err)
+	}
+	if seen.Load() != "" {
+		t.Fatalf("redirect carried Authorization %q to another host", seen.Load())
+	}
+}
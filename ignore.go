@@ -0,0 +1,267 @@
+// ignore.go - .gitignore/.eveignore matching and ignore-aware directory walking
+package main
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileNames are the per-directory files whose patterns are honored
+var ignoreFileNames = []string{".gitignore", ".eveignore"}
+
+// defaultIgnoredDirs are skipped even without an ignore file
+var defaultIgnoredDirs = map[string]bool{
+	".git":             true,
+	".devenv":          true,
+	"node_modules":     true,
+	"eve_project_data": true,
+}
+
+// isDefaultIgnoredDir reports whether a directory is skipped without an ignore
+// file, including project data set aside by a backup restore
+func isDefaultIgnoredDir(name string) bool {
+	return defaultIgnoredDirs[name] || strings.Contains(name, backupPreviousSuffix)
+}
+
+// ignoreRule is one compiled line of an ignore file
+type ignoreRule struct {
+	base     string // absolute directory containing the ignore file
+	regex    *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool // pattern contains a slash and is matched against the path from base
+}
+
+// ignoreMatcher holds the rules that apply to one directory, parents first
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// loadIgnoreDir returns a matcher extended with the ignore files found in dir
+func (m *ignoreMatcher) loadIgnoreDir(dir string) *ignoreMatcher {
+	var added []ignoreRule
+	for _, name := range ignoreFileNames {
+		added = append(added, parseIgnoreFile(filepath.Join(dir, name), dir)...)
+	}
+	if len(added) == 0 {
+		return m
+	}
+
+	rules := make([]ignoreRule, 0, len(m.rules)+len(added))
+	rules = append(rules, m.rules...)
+	rules = append(rules, added...)
+	return &ignoreMatcher{rules: rules}
+}
+
+// Ignored reports whether the absolute path is excluded. Later rules override
+// earlier ones, so a child directory's "!pattern" can re-include a file.
+func (m *ignoreMatcher) Ignored(absPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, absPath)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+
+		target := rel
+		if !rule.anchored {
+			target = filepath.Base(rel)
+		}
+		if rule.regex.MatchString(target) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// parseIgnoreFile reads gitignore-style patterns from path
+func parseIgnoreFile(path, base string) []ignoreRule {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreLine compiles one gitignore pattern
+func parseIgnoreLine(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	re, err := regexp.Compile("^" + globToRegex(line) + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.regex = re
+	return rule, true
+}
+
+// globToRegex converts a gitignore-style glob into a regular expression.
+// "*" and "?" never match "/", while "**" matches across directories.
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// matchGlob reports whether a slash-separated relative path matches glob.
+// Globs without a slash are matched against the base name.
+func matchGlob(glob, relPath string) bool {
+	re, err := regexp.Compile("^" + globToRegex(glob) + "$")
+	if err != nil {
+		return false
+	}
+	if !strings.Contains(glob, "/") {
+		return re.MatchString(filepath.Base(relPath))
+	}
+	return re.MatchString(relPath)
+}
+
+// ancestorIgnoreMatcher loads ignore files from the working directory down to
+// the parent of root, so that walking a subdirectory honors the same rules as
+// walking the whole project.
+func ancestorIgnoreMatcher(root string) *ignoreMatcher {
+	m := &ignoreMatcher{}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return m
+	}
+	rel, err := filepath.Rel(cwd, root)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return m
+	}
+
+	var dirs []string
+	for dir := filepath.Dir(root); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == cwd || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		m = m.loadIgnoreDir(dirs[i])
+	}
+	return m
+}
+
+// walkIgnoring walks root in lexical order, calling fn with slash-separated
+// paths relative to root for every entry that is not ignored. When
+// includeIgnored is set, ignore files and default exclusions are not applied.
+// fn may return filepath.SkipDir to prune a directory.
+func walkIgnoring(root string, includeIgnored bool, fn func(relPath string, d fs.DirEntry) error) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	matchers := map[string]*ignoreMatcher{}
+	if !includeIgnored {
+		matchers[absRoot] = ancestorIgnoreMatcher(absRoot).loadIgnoreDir(absRoot)
+	}
+
+	return filepath.WalkDir(absRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == absRoot {
+				return err
+			}
+			// Unreadable entries are skipped rather than aborting the walk
+			return nil
+		}
+		if path == absRoot {
+			return nil
+		}
+
+		if !includeIgnored {
+			if d.IsDir() && isDefaultIgnoredDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			parent := matchers[filepath.Dir(path)]
+			if parent.Ignored(path, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				matchers[path] = parent.loadIgnoreDir(path)
+			}
+		}
+
+		rel, err := filepath.Rel(absRoot, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), d)
+	})
+}
@@ -0,0 +1,103 @@
+// ignore_test.go - Ignore file patterns and ignore-aware directory walks
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestTree creates files, given by slash-separated paths, under root
+func writeTestTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, path, content)
+	}
+}
+
+// walkedPaths returns the paths walkIgnoring visits under root
+func walkedPaths(t *testing.T, root string, includeIgnored bool) []string {
+	t.Helper()
+	var paths []string
+	err := walkIgnoring(root, includeIgnored, func(relPath string, d fs.DirEntry) error {
+		if !d.IsDir() {
+			paths = append(paths, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", true},
+		{"*.go", "main.go.orig", false},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*.go", "cmd/sub/main.go", false},
+		{"cmd/**/*.go", "cmd/main.go", true},
+		{"cmd/**/*.go", "cmd/a/b/main.go", true},
+		{"**/testdata/*", "pkg/testdata/x.json", true},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"[ab].txt", "b.txt", true},
+		{"[!ab].txt", "b.txt", false},
+		{"[!ab].txt", "c.txt", true},
+		{"a+b(1).txt", "a+b(1).txt", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.glob, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWalkIgnoring(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		".gitignore":                          "*.log\nbuild/\n/top.txt\n# a comment\n",
+		".eveignore":                          "secret/\n",
+		"main.go":                             "",
+		"debug.log":                           "",
+		"top.txt":                             "",
+		"build/out.bin":                       "",
+		"secret/key.pem":                      "",
+		"node_modules/x/index.js":             "",
+		".git/HEAD":                           "",
+		"src/top.txt":                         "",
+		"src/app.log":                         "",
+		"src/.gitignore":                      "!keep.log\ngenerated/\n",
+		"src/keep.log":                        "",
+		"src/generated/gen.go":                "",
+		"src/lib/build":                       "",
+		"docs/build/index.html":               "",
+		"eve_project_data.before-restore-1/x": "",
+	})
+
+	want := []string{".eveignore", ".gitignore", "main.go", "src/.gitignore", "src/keep.log", "src/lib/build", "src/top.txt"}
+	if got := walkedPaths(t, root, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("walk = %v, want %v", got, want)
+	}
+
+	// Walking a subdirectory honors the ignore files above it
+	t.Chdir(root)
+	if got := walkedPaths(t, "src", false); !reflect.DeepEqual(got, []string{".gitignore", "keep.log", "lib/build", "top.txt"}) {
+		t.Errorf("walk of src = %v", got)
+	}
+
+	if got := walkedPaths(t, root, true); len(got) != 17 {
+		t.Errorf("walk including ignored files = %v", got)
+	}
+}
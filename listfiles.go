@@ -0,0 +1,216 @@
+// listfiles.go - Ignore-aware, depth-limited directory listing for list_files
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// listFilesDefaultMax is the default number of entries returned by list_files
+const listFilesDefaultMax = 1000
+
+// listFilesOptions controls what list_files returns
+type listFilesOptions struct {
+	MaxDepth       int // 0 means unlimited
+	Glob           string
+	IncludeSize    bool
+	IncludeModTime bool
+	MaxResults     int
+	Tree           bool
+	IncludeIgnored bool
+}
+
+// listEntry is one file or directory found by list_files
+type listEntry struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size,omitempty"`
+	Modified string `json:"modified,omitempty"`
+	isDir    bool
+}
+
+// listDirectory walks dir and renders the entries according to opts
+func listDirectory(dir string, opts listFilesOptions) (string, int, error) {
+	maxResults := opts.MaxResults
+	if maxResults <= 0 {
+		maxResults = listFilesDefaultMax
+	}
+
+	var entries []listEntry
+	omitted := 0
+	err := walkIgnoring(dir, opts.IncludeIgnored, func(relPath string, d fs.DirEntry) error {
+		depth := strings.Count(relPath, "/") + 1
+		if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// With a glob only matching files are listed; tree mode adds their parents later
+		if opts.Glob != "" && (d.IsDir() || !matchGlob(opts.Glob, relPath)) {
+			return nil
+		}
+
+		if len(entries) >= maxResults {
+			omitted++
+			return nil
+		}
+
+		entry := listEntry{Path: relPath, isDir: d.IsDir()}
+		if opts.IncludeSize || opts.IncludeModTime {
+			if info, err := d.Info(); err == nil {
+				if opts.IncludeSize && !d.IsDir() {
+					entry.Size = info.Size()
+				}
+				if opts.IncludeModTime {
+					entry.Modified = info.ModTime().Format(time.RFC3339)
+				}
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	var result string
+	if opts.Tree {
+		result = renderTree(dir, entries, opts)
+	} else {
+		result, err = renderList(entries, opts)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	if omitted > 0 {
+		result += fmt.Sprintf("\n[%d more entries omitted; raise max_results or narrow the path, max_depth or glob]", omitted)
+	}
+	return result, len(entries), nil
+}
+
+// renderList formats entries as the JSON array list_files has always returned,
+// or as objects when sizes or modification times were requested
+func renderList(entries []listEntry, opts listFilesOptions) (string, error) {
+	var data []byte
+	var err error
+	if opts.IncludeSize || opts.IncludeModTime {
+		for i := range entries {
+			if entries[i].isDir {
+				entries[i].Path += "/"
+			}
+		}
+		data, err = json.Marshal(entries)
+	} else {
+		paths := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if e.isDir {
+				paths = append(paths, e.Path+"/")
+			} else {
+				paths = append(paths, e.Path)
+			}
+		}
+		data, err = json.Marshal(paths)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal file list: %w", err)
+	}
+	return string(data), nil
+}
+
+// treeNode is a directory or file in the rendered tree
+type treeNode struct {
+	entry    *listEntry
+	children map[string]*treeNode
+}
+
+// renderTree draws entries as an indented tree rooted at dir
+func renderTree(dir string, entries []listEntry, opts listFilesOptions) string {
+	root := &treeNode{children: map[string]*treeNode{}}
+	for i := range entries {
+		node := root
+		parts := strings.Split(entries[i].Path, "/")
+		for _, part := range parts {
+			child, ok := node.children[part]
+			if !ok {
+				child = &treeNode{children: map[string]*treeNode{}}
+				node.children[part] = child
+			}
+			node = child
+		}
+		node.entry = &entries[i]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(filepath.ToSlash(filepath.Clean(dir)) + "/\n")
+	writeTree(&sb, root, "", opts)
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// writeTree writes the children of node, directories first, then files
+func writeTree(sb *strings.Builder, node *treeNode, prefix string, opts listFilesOptions) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		di, dj := node.children[names[i]].isDir(), node.children[names[j]].isDir()
+		if di != dj {
+			return di
+		}
+		return names[i] < names[j]
+	})
+
+	for i, name := range names {
+		child := node.children[name]
+		connector, indent := "├── ", "│   "
+		if i == len(names)-1 {
+			connector, indent = "└── ", "    "
+		}
+
+		label := name
+		if child.isDir() {
+			label += "/"
+		}
+		var details []string
+		if child.entry != nil {
+			if opts.IncludeSize && !child.entry.isDir {
+				details = append(details, formatSize(child.entry.Size))
+			}
+			if opts.IncludeModTime && child.entry.Modified != "" {
+				details = append(details, child.entry.Modified)
+			}
+		}
+		if len(details) > 0 {
+			label += " (" + strings.Join(details, ", ") + ")"
+		}
+
+		sb.WriteString(prefix + connector + label + "\n")
+		writeTree(sb, child, prefix+indent, opts)
+	}
+}
+
+// isDir reports whether a tree node is a directory, including implied parents
+func (n *treeNode) isDir() bool {
+	return len(n.children) > 0 || (n.entry != nil && n.entry.isDir)
+}
+
+// formatSize renders a byte count in human-readable units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,79 @@
+// listfiles_test.go - Depth, glob, result limits and tree output of list_files
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestListDirectory(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		".gitignore":       "*.log\n",
+		"main.go":          "package main\n",
+		"debug.log":        "",
+		"cmd/tool/tool.go": "",
+		"cmd/README":       strings.Repeat("x", 2048),
+		"pkg/a.go":         "",
+		"pkg/b.go":         "",
+	})
+
+	tests := []struct {
+		name  string
+		opts  listFilesOptions
+		want  string
+		count int
+	}{
+		{"everything", listFilesOptions{}, `[".gitignore","cmd/","cmd/README","cmd/tool/","cmd/tool/tool.go","main.go","pkg/","pkg/a.go","pkg/b.go"]`, 9},
+		{"depth", listFilesOptions{MaxDepth: 1}, `[".gitignore","cmd/","main.go","pkg/"]`, 4},
+		{"glob", listFilesOptions{Glob: "*.go"}, `["cmd/tool/tool.go","main.go","pkg/a.go","pkg/b.go"]`, 4},
+		{"glob with depth", listFilesOptions{Glob: "*.go", MaxDepth: 2}, `["main.go","pkg/a.go","pkg/b.go"]`, 3},
+		{"ignored files", listFilesOptions{Glob: "*.log", IncludeIgnored: true}, `["debug.log"]`, 1},
+		{"limit", listFilesOptions{MaxDepth: 1, MaxResults: 2}, "[\".gitignore\",\"cmd/\"]\n[2 more entries omitted; raise max_results or narrow the path, max_depth or glob]", 2},
+		{"size", listFilesOptions{Glob: "README", IncludeSize: true}, `[{"path":"cmd/README","size":2048}]`, 1},
+	}
+	for _, tt := range tests {
+		got, count, err := listDirectory(root, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want || count != tt.count {
+			t.Errorf("%s: got %s (%d entries), want %s (%d entries)", tt.name, got, count, tt.want, tt.count)
+		}
+	}
+}
+
+func TestListDirectoryTree(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestTree(t, ".", map[string]string{
+		"main.go":          "",
+		"cmd/README":       strings.Repeat("x", 2048),
+		"cmd/tool/tool.go": "",
+		"pkg/a.go":         "",
+	})
+
+	got, _, err := listDirectory(".", listFilesOptions{Tree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `./
+├── cmd/
+│   ├── tool/
+│   │   └── tool.go
+│   └── README
+├── pkg/
+│   └── a.go
+└── main.go`
+	if got != want {
+		t.Errorf("tree:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Parents of glob matches are drawn even though they are not listed
+	got, count, err := listDirectory(".", listFilesOptions{Tree: true, Glob: "README", IncludeSize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "./\n└── cmd/\n    └── README (2.0 KB)"; got != want || count != 1 {
+		t.Errorf("tree of glob matches (%d entries):\n%s\nwant:\n%s", count, got, want)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/invopop/jsonschema"
@@ -25,11 +24,22 @@ type ToolDefinition struct {
 
 // Input structs for tools
 type ReadFileInput struct {
-	Path string `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
+	Path        string `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
+	Offset      int    `json:"offset,omitempty" jsonschema_description:"Optional 1-based line number to start reading from."`
+	Limit       int    `json:"limit,omitempty" jsonschema_description:"Optional maximum number of lines to return."`
+	LineNumbers bool   `json:"line_numbers,omitempty" jsonschema_description:"Prefix each line with its line number."`
+	MaxBytes    int    `json:"max_bytes,omitempty" jsonschema_description:"Optional output budget in bytes (default 65536). Output past the budget is cut with a hint for the next offset."`
 }
 
 type ListFilesInput struct {
-	Path string `json:"path" jsonschema_description:"The relative path of a directory in the working directory."`
+	Path           string `json:"path" jsonschema_description:"The relative path of a directory in the working directory."`
+	MaxDepth       int    `json:"max_depth,omitempty" jsonschema_description:"Optional maximum depth to descend (1 lists only the immediate children)."`
+	Glob           string `json:"glob,omitempty" jsonschema_description:"Optional glob to filter files, e.g. '*.go' or 'src/**/*.ts'."`
+	IncludeSize    bool   `json:"include_size,omitempty" jsonschema_description:"Include file sizes in the output."`
+	IncludeModTime bool   `json:"include_modified,omitempty" jsonschema_description:"Include modification times in the output."`
+	MaxResults     int    `json:"max_results,omitempty" jsonschema_description:"Maximum number of entries to return (default 1000)."`
+	Format         string `json:"format,omitempty" jsonschema_description:"Output format: 'list' (default, JSON array) or 'tree'."`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" jsonschema_description:"Also list entries excluded by .gitignore/.eveignore and default exclusions such as node_modules."`
 }
 
 type BashInput struct {
@@ -37,13 +47,27 @@ type BashInput struct {
 }
 
 type EditFileInput struct {
-	Path   string `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
-	OldStr string `json:"old_string" jsonschema_description:"The text to replace in the file."`
-	NewStr string `json:"new_string" jsonschema_description:"The new text to replace the old text with."`
+	Path       string          `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
+	OldStr     string          `json:"old_string,omitempty" jsonschema_description:"The text to replace in the file. Must match exactly once unless replace_all is set. Leave empty with a non-existent path to create a new file."`
+	NewStr     string          `json:"new_string,omitempty" jsonschema_description:"The new text to replace the old text with."`
+	ReplaceAll bool            `json:"replace_all,omitempty" jsonschema_description:"Replace every occurrence of old_string instead of requiring a unique match."`
+	Edits      []EditOperation `json:"edits,omitempty" jsonschema_description:"Optional batch of edits applied in order to the same file. Either all edits succeed or the file is left unchanged."`
 }
 
 type CodeSearchInput struct {
-	Query string `json:"query" jsonschema_description:"The search query to find in the codebase."`
+	Query           string `json:"query" jsonschema_description:"The search query to find in the codebase."`
+	Regex           bool   `json:"regex,omitempty" jsonschema_description:"Treat the query as a regular expression (RE2 syntax) instead of literal text."`
+	CaseInsensitive bool   `json:"case_insensitive,omitempty" jsonschema_description:"Match without regard to case."`
+	Path            string `json:"path,omitempty" jsonschema_description:"Optional directory to search in (defaults to the working directory)."`
+	Glob            string `json:"glob,omitempty" jsonschema_description:"Optional glob to restrict which files are searched, e.g. '*.go' or 'webUI/**/*.ts'."`
+	Language        string `json:"language,omitempty" jsonschema_description:"Optional language filter such as go, typescript, python or markdown."`
+	Context         int    `json:"context,omitempty" jsonschema_description:"Number of lines to show before and after each match."`
+	Before          int    `json:"before,omitempty" jsonschema_description:"Number of lines to show before each match (overrides context)."`
+	After           int    `json:"after,omitempty" jsonschema_description:"Number of lines to show after each match (overrides context)."`
+	MaxPerFile      int    `json:"max_per_file,omitempty" jsonschema_description:"Maximum matches reported per file (default 20)."`
+	MaxResults      int    `json:"max_results,omitempty" jsonschema_description:"Maximum matches reported in total (default 200)."`
+	FilesOnly       bool   `json:"files_only,omitempty" jsonschema_description:"Only list the files that contain a match."`
+	IncludeIgnored  bool   `json:"include_ignored,omitempty" jsonschema_description:"Also search files excluded by .gitignore/.eveignore."`
 }
 
 // GenerateSchema generates a JSON schema for a given type
@@ -77,13 +101,18 @@ func ReadFile(input json.RawMessage) (string, error) {
 	}
 
 	log.Printf("Reading file: %s", readFileInput.Path)
-	content, err := os.ReadFile(readFileInput.Path)
+	content, err := readFileRange(readFileInput.Path, readFileOptions{
+		Offset:      readFileInput.Offset,
+		Limit:       readFileInput.Limit,
+		LineNumbers: readFileInput.LineNumbers,
+		MaxBytes:    readFileInput.MaxBytes,
+	})
 	if err != nil {
 		log.Printf("Failed to read file %s: %v", readFileInput.Path, err)
 		return "", err
 	}
 	log.Printf("Successfully read file %s (%d bytes)", readFileInput.Path, len(content))
-	return string(content), nil
+	return content, nil
 }
 
 func ListFiles(input json.RawMessage) (string, error) {
@@ -100,45 +129,26 @@ func ListFiles(input json.RawMessage) (string, error) {
 
 	log.Printf("Listing files in directory: %s", dir)
 
-	var files []string
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		relPath, err := filepath.Rel(dir, path)
-		if err != nil {
-			return err
-		}
-
-		// Skip .devenv directory and its contents
-		if info.IsDir() && (relPath == ".devenv" || strings.HasPrefix(relPath, ".devenv/")) {
-			return filepath.SkipDir
-		}
+	if listFilesInput.Format != "" && listFilesInput.Format != "list" && listFilesInput.Format != "tree" {
+		return "", fmt.Errorf("unknown format %q, expected 'list' or 'tree'", listFilesInput.Format)
+	}
 
-		if relPath != "." {
-			if info.IsDir() {
-				files = append(files, relPath+"/")
-			} else {
-				files = append(files, relPath)
-			}
-		}
-		return nil
+	result, count, err := listDirectory(dir, listFilesOptions{
+		MaxDepth:       listFilesInput.MaxDepth,
+		Glob:           listFilesInput.Glob,
+		IncludeSize:    listFilesInput.IncludeSize,
+		IncludeModTime: listFilesInput.IncludeModTime,
+		MaxResults:     listFilesInput.MaxResults,
+		Tree:           listFilesInput.Format == "tree",
+		IncludeIgnored: listFilesInput.IncludeIgnored,
 	})
-
 	if err != nil {
 		log.Printf("Failed to list files in %s: %v", dir, err)
 		return "", err
 	}
 
-	log.Printf("Successfully listed %d items in %s", len(files), dir)
-
-	result, err := json.Marshal(files)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal file list: %w", err)
-	}
-
-	return string(result), nil
+	log.Printf("Successfully listed %d items in %s", count, dir)
+	return result, nil
 }
 
 func Bash(input json.RawMessage) (string, error) {
@@ -148,6 +158,13 @@ func Bash(input json.RawMessage) (string, error) {
 		return "", fmt.Errorf("failed to unmarshal Bash input: %w", err)
 	}
 
+	if reason := destructiveGitCommand(bashInput.Command); reason != "" {
+		if approveAction == nil || !approveAction(fmt.Sprintf("The bash tool wants to run a git command that %s:\n  %s", reason, bashInput.Command)) {
+			log.Printf("Refused destructive git command: %s", bashInput.Command)
+			return "", fmt.Errorf("refused to run %q: it %s and the user did not approve it", bashInput.Command, reason)
+		}
+	}
+
 	log.Printf("Executing bash command: %s", bashInput.Command)
 
 	cmd := exec.Command("bash", "-c", bashInput.Command)
@@ -168,24 +185,68 @@ func EditFile(input json.RawMessage) (string, error) {
 		return "", fmt.Errorf("failed to unmarshal EditFile input: %w", err)
 	}
 
-	log.Printf("Editing file: %s", editFileInput.Path)
+	if editFileInput.Path == "" {
+		return "", fmt.Errorf("path must not be empty")
+	}
+
+	edits := editFileInput.Edits
+	if editFileInput.OldStr != "" || editFileInput.NewStr != "" {
+		edits = append([]EditOperation{{
+			OldStr:     editFileInput.OldStr,
+			NewStr:     editFileInput.NewStr,
+			ReplaceAll: editFileInput.ReplaceAll,
+		}}, edits...)
+	}
+
+	log.Printf("Editing file: %s (%d edits)", editFileInput.Path, len(edits))
 
 	content, err := os.ReadFile(editFileInput.Path)
 	if err != nil {
+		if os.IsNotExist(err) && len(edits) == 1 && edits[0].OldStr == "" {
+			log.Printf("File does not exist, creating new file: %s", editFileInput.Path)
+			return createNewFile(editFileInput.Path, edits[0].NewStr)
+		}
 		log.Printf("Failed to read file %s: %v", editFileInput.Path, err)
 		return "", err
 	}
 
-	newContent := strings.ReplaceAll(string(content), editFileInput.OldStr, editFileInput.NewStr)
+	result, err := ApplyEdits(editFileInput.Path, string(content), edits)
+	if err != nil {
+		log.Printf("EditFile failed for %s: %v", editFileInput.Path, err)
+		return "", err
+	}
 
-	err = os.WriteFile(editFileInput.Path, []byte(newContent), 0644)
+	err = writeFileAtomic(editFileInput.Path, []byte(result.Content), 0644)
 	if err != nil {
 		log.Printf("Failed to write file %s: %v", editFileInput.Path, err)
 		return "", err
 	}
+	recordFileChange("edit_file", newChangeGroup(), editFileInput.Path, 0, content, []byte(result.Content))
+
+	log.Printf("Successfully edited file %s (%d replacements)", editFileInput.Path, result.Replacements)
+	return fmt.Sprintf("Edited %s (%d replacements)\n%s", editFileInput.Path, result.Replacements, result.Diff), nil
+}
+
+func createNewFile(filePath, content string) (string, error) {
+	log.Printf("Creating new file: %s (%d bytes)", filePath, len(content))
+	dir := filepath.Dir(filePath)
+	if dir != "." {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			log.Printf("Failed to create directory %s: %v", dir, err)
+			return "", fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	err := writeFileAtomic(filePath, []byte(content), 0644)
+	if err != nil {
+		log.Printf("Failed to create file %s: %v", filePath, err)
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	recordFileChange("edit_file", newChangeGroup(), filePath, 0, nil, []byte(content))
 
-	log.Printf("Successfully edited file %s", editFileInput.Path)
-	return "File edited successfully", nil
+	log.Printf("Successfully created file %s", filePath)
+	return fmt.Sprintf("Created %s\n%s", filePath, UnifiedDiff("/dev/null", "b/"+filePath, "", content)), nil
 }
 
 func CodeSearch(input json.RawMessage) (string, error) {
@@ -197,26 +258,29 @@ func CodeSearch(input json.RawMessage) (string, error) {
 
 	log.Printf("Searching for code pattern: %s", codeSearchInput.Query)
 
-	// Simple implementation - search for the query in all .go files
-	var results []string
-	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() && strings.HasSuffix(path, ".go") {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return err
-			}
-
-			if strings.Contains(string(content), codeSearchInput.Query) {
-				results = append(results, path)
-			}
-		}
-		return nil
-	})
+	before, after := codeSearchInput.Context, codeSearchInput.Context
+	if codeSearchInput.Before > 0 {
+		before = codeSearchInput.Before
+	}
+	if codeSearchInput.After > 0 {
+		after = codeSearchInput.After
+	}
 
+	opts := searchOptions{
+		Pattern:         codeSearchInput.Query,
+		Regex:           codeSearchInput.Regex,
+		CaseInsensitive: codeSearchInput.CaseInsensitive,
+		Root:            codeSearchInput.Path,
+		Glob:            codeSearchInput.Glob,
+		Language:        codeSearchInput.Language,
+		Before:          before,
+		After:           after,
+		MaxPerFile:      codeSearchInput.MaxPerFile,
+		MaxResults:      codeSearchInput.MaxResults,
+		FilesOnly:       codeSearchInput.FilesOnly,
+		IncludeIgnored:  codeSearchInput.IncludeIgnored,
+	}
+	results, omitted, err := searchFiles(opts)
 	if err != nil {
 		log.Printf("Failed to search code: %v", err)
 		return "", err
@@ -224,25 +288,20 @@ func CodeSearch(input json.RawMessage) (string, error) {
 
 	log.Printf("Found %d files containing the search pattern", len(results))
 
-	result, err := json.Marshal(results)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal search results: %w", err)
-	}
-
-	return string(result), nil
+	return formatSearchResults(results, omitted, opts), nil
 }
 
 // Tool definitions with function implementations
 var ReadFileDefinition = ToolDefinition{
 	Name:        "read_file",
-	Description: "Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names.",
+	Description: "Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names. Large files are returned in windows: use offset and limit to page through them, and line_numbers to get line-numbered output.",
 	InputSchema: ReadFileInputSchema,
 	Function:    ReadFile,
 }
 
 var ListFilesDefinition = ToolDefinition{
 	Name:        "list_files",
-	Description: "List the contents of a given relative directory path. Use this when you want to see what files and directories are in a directory.",
+	Description: "List the contents of a given relative directory path. Use this when you want to see what files and directories are in a directory. Entries ignored by .gitignore/.eveignore are skipped; use max_depth, glob and format 'tree' to get a compact overview of large trees.",
 	InputSchema: ListFilesInputSchema,
 	Function:    ListFiles,
 }
@@ -256,14 +315,14 @@ var BashDefinition = ToolDefinition{
 
 var EditFileDefinition = ToolDefinition{
 	Name:        "edit_file",
-	Description: "Edit a file by replacing old text with new text. Use this when you need to modify file contents.",
+	Description: "Edit a file by replacing old text with new text. old_string must match exactly once unless replace_all is set; use edits to apply several replacements to one file atomically. Returns a unified diff of the change.",
 	InputSchema: EditFileInputSchema,
 	Function:    EditFile,
 }
 
 var CodeSearchDefinition = ToolDefinition{
 	Name:        "code_search",
-	Description: "Search for code patterns in the codebase. Use this when you need to find specific code or patterns.",
+	Description: "Search for code patterns in the codebase. Use this when you need to find specific code or patterns. Supports literal or regex queries, glob and language filters, and context lines around each match. Files ignored by .gitignore/.eveignore are skipped.",
 	InputSchema: CodeSearchInputSchema,
 	Function:    CodeSearch,
 }
@@ -0,0 +1,452 @@
+// maintenance.go - Retention policies, garbage collection and compaction of project data
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// blobGracePeriod protects recently stored blobs from garbage collection:
+// a blob is stored before the record that refers to it
+const blobGracePeriod = time.Hour
+
+// maintenanceInterval is how often chat sessions maintain the project
+// database on their own
+const maintenanceInterval = 24 * time.Hour
+
+// retentionTables are the tables retention policies apply to, in the order
+// they are reported
+var retentionTables = []string{"edits", "versions", "checkpoints", "multiplayer"}
+
+// policy returns the retention policy of a table
+func (c *RetentionConfig) policy(table string) RetentionPolicy {
+	switch table {
+	case "edits":
+		return c.Edits
+	case "versions":
+		return c.Versions
+	case "checkpoints":
+		return c.Checkpoints
+	case "multiplayer":
+		return c.Multiplayer
+	}
+	return RetentionPolicy{}
+}
+
+// retentionCandidate is a record, or a set of records removed together, that
+// a retention policy may remove
+type retentionCandidate struct {
+	ID      int
+	Members []int // further records kept or removed with this one
+	Time    time.Time
+	Size    int64
+	Group   string // counts apply per group, e.g. per path for file versions
+	Keep    bool   // never removed, e.g. the current version of a file
+}
+
+// expired returns the IDs of the candidates the policy removes. Candidates
+// are considered newest first: each is removed if it is older than MaxAge,
+// if its group already kept MaxCount newer records, or if keeping it would
+// take the kept records over MaxSize. A candidate's members count towards
+// MaxCount and are removed with it.
+func (p RetentionPolicy) expired(candidates []retentionCandidate, now time.Time) []int {
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].Time.Equal(candidates[j].Time) {
+			return candidates[i].Time.After(candidates[j].Time)
+		}
+		return candidates[i].ID > candidates[j].ID
+	})
+
+	kept := make(map[string]int)
+	var size int64
+	var ids []int
+	for _, c := range candidates {
+		drop := (p.MaxAge > 0 && now.Sub(c.Time) > p.MaxAge) ||
+			(p.MaxCount > 0 && kept[c.Group] >= p.MaxCount) ||
+			(p.MaxSize > 0 && size+c.Size > p.MaxSize)
+		if drop && !c.Keep {
+			ids = append(ids, c.ID)
+			ids = append(ids, c.Members...)
+			continue
+		}
+		kept[c.Group] += 1 + len(c.Members)
+		size += c.Size
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// encodedSize returns the size of a record encoded as JSON
+func encodedSize(record interface{}) int64 {
+	data, _ := json.Marshal(record)
+	return int64(len(data))
+}
+
+// retentionCandidates lists the records of a table for its retention
+// policy. gitCheckpoints collects the IDs of checkpoints stored in git.
+func retentionCandidates(tx Storage, table string, gitCheckpoints map[int]bool) ([]retentionCandidate, error) {
+	var candidates []retentionCandidate
+	switch table {
+	case "edits":
+		edits, err := tx.ListEdits("", 0)
+		if err != nil {
+			return nil, err
+		}
+		// The edits of a change group are undone together, so they are
+		// pruned together: a group is as recent as its newest edit, and is
+		// kept while one of its edits is undone so it can still be redone
+		groups := make(map[string]int)
+		for _, e := range edits {
+			if i, ok := groups[e.Group]; ok && e.Group != "" {
+				c := &candidates[i]
+				c.Members = append(c.Members, e.ID)
+				if e.Timestamp.After(c.Time) {
+					c.Time = e.Timestamp
+				}
+				c.Size += encodedSize(e)
+				c.Keep = c.Keep || e.Undone
+				continue
+			}
+			groups[e.Group] = len(candidates)
+			candidates = append(candidates, retentionCandidate{ID: e.ID, Time: e.Timestamp, Size: encodedSize(e), Keep: e.Undone})
+		}
+
+	case "versions":
+		files, err := tx.ListFiles()
+		if err != nil {
+			return nil, err
+		}
+		current := make(map[string]int, len(files))
+		for _, f := range files {
+			current[f.Path] = f.Version
+		}
+		versions, err := tx.ListFileVersions("")
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			candidates = append(candidates, retentionCandidate{
+				ID:    v.ID,
+				Time:  v.CreatedAt,
+				Size:  encodedSize(v) + int64(v.Size),
+				Group: v.Path,
+				Keep:  current[v.Path] == v.Version,
+			})
+		}
+
+	case "checkpoints":
+		checkpoints, err := tx.ListCheckpoints()
+		if err != nil {
+			return nil, err
+		}
+		for _, cp := range checkpoints {
+			size := encodedSize(cp)
+			if cp.GitCommit != "" {
+				gitCheckpoints[cp.ID] = true
+			} else {
+				for _, file := range cp.Files {
+					size += file.Size
+				}
+			}
+			candidates = append(candidates, retentionCandidate{ID: cp.ID, Time: cp.Timestamp, Size: size})
+		}
+
+	case "multiplayer":
+		actions, err := tx.ListMultiplayerActions(0)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range actions {
+			candidates = append(candidates, retentionCandidate{ID: a.ID, Time: a.Timestamp, Size: encodedSize(a)})
+		}
+	}
+	return candidates, nil
+}
+
+// Prune removes the records that fall outside the retention policies and
+// returns how many were removed from each table. With dryRun nothing is
+// removed. Hidden git refs of removed checkpoints are deleted; blobs are
+// left for CollectGarbage.
+func (pdb *ProjectDatabase) Prune(cfg *RetentionConfig, dryRun bool) (map[string]int, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	now := time.Now()
+	removed := make(map[string]int)
+	var removedGit []int
+	err := pdb.store.Transaction(func(tx Storage) error {
+		for _, table := range retentionTables {
+			gitCheckpoints := make(map[int]bool)
+			candidates, err := retentionCandidates(tx, table, gitCheckpoints)
+			if err != nil {
+				return fmt.Errorf("failed to list %s: %w", table, err)
+			}
+			ids := cfg.policy(table).expired(candidates, now)
+			removed[table] = len(ids)
+			if dryRun || len(ids) == 0 {
+				continue
+			}
+			if err := tx.DeleteRecords(table, ids); err != nil {
+				return fmt.Errorf("failed to prune %s: %w", table, err)
+			}
+			for _, id := range ids {
+				if gitCheckpoints[id] {
+					removedGit = append(removedGit, id)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	removeGitCheckpointRefs(removedGit)
+	return removed, nil
+}
+
+// referencedBlobs returns the hashes of the blobs that file versions,
+// checkpoints and edits refer to
+func referencedBlobs(tx Storage) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+
+	versions, err := tx.ListFileVersions("")
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		referenced[v.Hash] = true
+	}
+
+	checkpoints, err := tx.ListCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	for _, cp := range checkpoints {
+		for _, file := range cp.Files {
+			referenced[file.Hash] = true
+		}
+	}
+
+	edits, err := tx.ListEdits("", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range edits {
+		referenced[e.OldHash] = true
+		referenced[e.NewHash] = true
+	}
+	return referenced, nil
+}
+
+// CollectGarbage removes blobs that no file version, checkpoint or edit
+// refers to and returns how many were removed and their size. Blobs stored
+// within blobGracePeriod are kept. With dryRun nothing is removed.
+func (pdb *ProjectDatabase) CollectGarbage(dryRun bool) (int, int64, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	cutoff := time.Now().Add(-blobGracePeriod)
+	removed, freed := 0, int64(0)
+	err := pdb.store.Transaction(func(tx Storage) error {
+		referenced, err := referencedBlobs(tx)
+		if err != nil {
+			return err
+		}
+		blobs, err := tx.ListBlobs()
+		if err != nil {
+			return err
+		}
+
+		for _, blob := range blobs {
+			if referenced[blob.Hash] || blob.StoredAt.After(cutoff) {
+				continue
+			}
+			if !dryRun {
+				ok, err := tx.DeleteBlob(blob.Hash, cutoff)
+				if err != nil {
+					return fmt.Errorf("failed to remove blob %s: %w", blob.Hash, err)
+				}
+				if !ok {
+					continue
+				}
+			}
+			removed++
+			freed += blob.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return removed, freed, nil
+}
+
+// Compact rewrites the storage to release the space of removed records
+func (pdb *ProjectDatabase) Compact() error {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+	return pdb.store.Compact()
+}
+
+// projectCaches are directories of rebuildable data kept next to the store
+var projectCaches = []string{"embeddings", "web_cache"}
+
+// Stats reports the space used by each table of the project database and
+// by the caches kept in the project directory
+func (pdb *ProjectDatabase) Stats() (*StorageStats, error) {
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	stats, err := pdb.store.Stats()
+	if err != nil {
+		return nil, err
+	}
+	for _, cache := range projectCaches {
+		usage := TableStats{Table: cache}
+		usage.Bytes, usage.Files = dirUsage(filepath.Join(pdb.projectDir, cache))
+		usage.Records = usage.Files
+		stats.Tables = append(stats.Tables, usage)
+		stats.DiskBytes += usage.Bytes
+	}
+	return stats, nil
+}
+
+// needsCompaction reports whether compacting would release a worthwhile
+// amount of space: a quarter of a SQLite file unused, or a hundred record
+// files beyond what the file store's segments would need
+func needsCompaction(stats *StorageStats) bool {
+	if stats.FreeBytes > 0 {
+		return stats.FreeBytes*4 > stats.DiskBytes
+	}
+	extra := 0
+	for _, table := range stats.Tables {
+		if table.Table != "blobs" && table.Files > 0 {
+			extra += table.Files - (table.Records+fileStoreSegmentRecords-1)/fileStoreSegmentRecords
+		}
+	}
+	return extra >= 100
+}
+
+// formatPruneResult summarizes what Prune and CollectGarbage removed
+func formatPruneResult(removed map[string]int, blobs int, freed int64, dryRun bool) string {
+	names := map[string]string{
+		"edits":       "edits",
+		"versions":    "file versions",
+		"checkpoints": "checkpoints",
+		"multiplayer": "multiplayer actions",
+	}
+	var parts []string
+	for _, table := range retentionTables {
+		parts = append(parts, fmt.Sprintf("%d %s", removed[table], names[table]))
+	}
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	return fmt.Sprintf("%s %s and %d orphaned blobs (%s)", verb, strings.Join(parts, ", "), blobs, formatSize(freed))
+}
+
+// formatStorageStats renders the space used per table and the retention policies
+func formatStorageStats(pdb *ProjectDatabase, stats *StorageStats, cfg *RetentionConfig) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Project data in %s (%s store), %s on disk:\n\n", pdb.projectDir, pdb.Backend(), formatSize(stats.DiskBytes))
+	fmt.Fprintf(&sb, "%-12s %9s %10s %7s\n", "table", "records", "size", "files")
+	for _, table := range stats.Tables {
+		files := "-"
+		if table.Files > 0 {
+			files = fmt.Sprint(table.Files)
+		}
+		fmt.Fprintf(&sb, "%-12s %9d %10s %7s\n", table.Table, table.Records, formatSize(table.Bytes), files)
+	}
+	if stats.FreeBytes > 0 {
+		fmt.Fprintf(&sb, "\n%s of the database file is unused; `db compact` releases it\n", formatSize(stats.FreeBytes))
+	}
+
+	sb.WriteString("\nRetention:\n")
+	for _, table := range retentionTables {
+		policy := cfg.policy(table).String()
+		if table == "versions" && cfg.Versions.MaxCount > 0 {
+			policy = strings.Replace(policy, "count", "count per file", 1)
+		}
+		fmt.Fprintf(&sb, "  %-12s %s\n", table, policy)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// maintenanceState records when the project database was last maintained
+type maintenanceState struct {
+	LastRun time.Time `json:"last_run"`
+}
+
+// Maintain applies the retention policies, removes orphaned blobs and
+// compacts the storage if that releases enough space. It returns a summary
+// of what was removed.
+func (pdb *ProjectDatabase) Maintain(cfg *RetentionConfig) (string, error) {
+	removed, err := pdb.Prune(cfg, false)
+	if err != nil {
+		return "", err
+	}
+	blobs, freed, err := pdb.CollectGarbage(false)
+	if err != nil {
+		return "", err
+	}
+	summary := ""
+	total := blobs
+	for _, n := range removed {
+		total += n
+	}
+	if total > 0 {
+		summary = formatPruneResult(removed, blobs, freed, false)
+	}
+
+	pdb.mu.RLock()
+	stats, err := pdb.store.Stats()
+	if err == nil && needsCompaction(stats) {
+		err = pdb.store.Compact()
+	}
+	if err == nil {
+		err = pdb.store.PutState("maintenance", maintenanceState{LastRun: time.Now()})
+	}
+	pdb.mu.RUnlock()
+	return summary, err
+}
+
+// MaintainIfDue runs Maintain if it has not run for maintenanceInterval,
+// unless EVE_DB_MAINTENANCE is "0", "false" or "off"
+func (pdb *ProjectDatabase) MaintainIfDue(cfg *RetentionConfig) (string, error) {
+	switch os.Getenv("EVE_DB_MAINTENANCE") {
+	case "0", "false", "off":
+		return "", nil
+	}
+
+	var state maintenanceState
+	pdb.mu.RLock()
+	_, err := pdb.store.GetState("maintenance", &state)
+	pdb.mu.RUnlock()
+	if err == nil && time.Since(state.LastRun) < maintenanceInterval {
+		return "", nil
+	}
+	return pdb.Maintain(cfg)
+}
+
+// maintainDatabase runs the periodic maintenance at session start
+func (a *GenericAgent) maintainDatabase() {
+	if globalDB == nil {
+		return
+	}
+
+	summary, err := globalDB.MaintainIfDue(NewRetentionConfigFromEnv())
+	if err != nil {
+		fmt.Printf("⚠️  Project database maintenance failed: %s\n", err.Error())
+		return
+	}
+	if summary != "" {
+		fmt.Printf("🧹 %s\n", summary)
+	}
+}
@@ -0,0 +1,357 @@
+// maintenance_test.go - Retention policies and garbage collection of project data
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name       string
+		policy     RetentionPolicy
+		candidates []retentionCandidate
+		want       []int
+	}{
+		{
+			name:   "no limits",
+			policy: RetentionPolicy{},
+			candidates: []retentionCandidate{
+				{ID: 1, Time: ago(100 * day)},
+				{ID: 2, Time: ago(day)},
+			},
+		},
+		{
+			name:   "age",
+			policy: RetentionPolicy{MaxAge: 7 * day},
+			candidates: []retentionCandidate{
+				{ID: 1, Time: ago(10 * day)},
+				{ID: 2, Time: ago(8 * day)},
+				{ID: 3, Time: ago(6 * day)},
+			},
+			want: []int{1, 2},
+		},
+		{
+			name:   "count keeps the newest",
+			policy: RetentionPolicy{MaxCount: 2},
+			candidates: []retentionCandidate{
+				{ID: 3, Time: ago(3 * day)},
+				{ID: 1, Time: ago(day)},
+				{ID: 2, Time: ago(2 * day)},
+				{ID: 4, Time: ago(4 * day)},
+			},
+			want: []int{3, 4},
+		},
+		{
+			name:   "count breaks time ties by ID",
+			policy: RetentionPolicy{MaxCount: 1},
+			candidates: []retentionCandidate{
+				{ID: 1, Time: ago(day)},
+				{ID: 2, Time: ago(day)},
+			},
+			want: []int{1},
+		},
+		{
+			name:   "count per group",
+			policy: RetentionPolicy{MaxCount: 1},
+			candidates: []retentionCandidate{
+				{ID: 1, Time: ago(2 * day), Group: "a.go"},
+				{ID: 2, Time: ago(day), Group: "a.go"},
+				{ID: 3, Time: ago(3 * day), Group: "b.go"},
+			},
+			want: []int{1},
+		},
+		{
+			name:   "size",
+			policy: RetentionPolicy{MaxSize: 250},
+			candidates: []retentionCandidate{
+				{ID: 1, Time: ago(3 * day), Size: 100},
+				{ID: 2, Time: ago(2 * day), Size: 100},
+				{ID: 3, Time: ago(day), Size: 100},
+			},
+			want: []int{1},
+		},
+		{
+			name:   "size skips a large record but keeps older small ones",
+			policy: RetentionPolicy{MaxSize: 250},
+			candidates: []retentionCandidate{
+				{ID: 1, Time: ago(3 * day), Size: 100},
+				{ID: 2, Time: ago(2 * day), Size: 200},
+				{ID: 3, Time: ago(day), Size: 100},
+			},
+			want: []int{2},
+		},
+		{
+			name:   "kept records are never removed but still count",
+			policy: RetentionPolicy{MaxAge: day, MaxCount: 1},
+			candidates: []retentionCandidate{
+				{ID: 1, Time: ago(10 * day), Keep: true}, // undone edit or current version
+				{ID: 2, Time: ago(5 * day)},
+				{ID: 3, Time: ago(20 * day), Keep: true},
+			},
+			want: []int{2},
+		},
+		{
+			name:   "members are removed with their candidate",
+			policy: RetentionPolicy{MaxAge: 7 * day},
+			candidates: []retentionCandidate{
+				{ID: 5, Members: []int{1, 3}, Time: ago(10 * day)},
+				{ID: 4, Members: []int{2}, Time: ago(day)},
+			},
+			want: []int{1, 3, 5},
+		},
+		{
+			name:   "members count towards the limit",
+			policy: RetentionPolicy{MaxCount: 3},
+			candidates: []retentionCandidate{
+				{ID: 4, Members: []int{5, 6}, Time: ago(day)},
+				{ID: 3, Time: ago(2 * day)},
+				{ID: 2, Time: ago(3 * day)},
+			},
+			want: []int{2, 3},
+		},
+		{
+			name:   "a group straddling the count limit is kept whole",
+			policy: RetentionPolicy{MaxCount: 2},
+			candidates: []retentionCandidate{
+				{ID: 1, Time: ago(day)},
+				{ID: 2, Members: []int{3, 4}, Time: ago(2 * day)},
+				{ID: 5, Time: ago(3 * day)},
+			},
+			want: []int{5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.expired(tt.candidates, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordTestEdits records edits of the given groups, oldest first, and
+// returns their IDs
+func recordTestEdits(t *testing.T, pdb *ProjectDatabase, groups ...string) []int {
+	t.Helper()
+	start := time.Now().Add(-time.Hour)
+	var ids []int
+	for i, group := range groups {
+		edit := &EditHistory{Path: "a.txt", Operation: "modify", Tool: "test", Group: group, Timestamp: start.Add(time.Duration(i) * time.Minute)}
+		if err := pdb.RecordEdit(edit); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, edit.ID)
+	}
+	return ids
+}
+
+// remainingEdits returns the IDs of the stored edits
+func remainingEdits(t *testing.T, pdb *ProjectDatabase) map[int]bool {
+	t.Helper()
+	edits, err := pdb.GetEditHistory("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[int]bool)
+	for _, e := range edits {
+		ids[e.ID] = true
+	}
+	return ids
+}
+
+func TestPruneEditsByChangeGroup(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			pdb := openTestDatabase(t, backend, t.TempDir())
+			defer pdb.Close()
+			ids := recordTestEdits(t, pdb, "g1", "g1", "", "g2", "g2", "g2")
+
+			// The newest group alone fills the limit; g2 is not split and
+			// the older group and ungrouped edit go
+			removed, err := pdb.Prune(&RetentionConfig{Edits: RetentionPolicy{MaxCount: 2}}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed["edits"] != 3 {
+				t.Fatalf("removed %d edits, want 3", removed["edits"])
+			}
+			left := remainingEdits(t, pdb)
+			for i, id := range ids {
+				if want := i >= 3; left[id] != want {
+					t.Errorf("edit %d (group %d) kept = %v, want %v", id, i, left[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneKeepsGroupsWithUndoneEdits(t *testing.T) {
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	ids := recordTestEdits(t, pdb, "old", "old", "new")
+
+	edits, err := pdb.GetEditHistory("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range edits {
+		if e.ID == ids[1] {
+			e.Undone = true
+			if err := pdb.UpdateEdit(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, err := pdb.Prune(&RetentionConfig{Edits: RetentionPolicy{MaxCount: 1}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if left := remainingEdits(t, pdb); len(left) != 3 {
+		t.Fatalf("kept edits %v, want all 3", left)
+	}
+}
+
+func TestPruneKeepsCurrentFileVersion(t *testing.T) {
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	for _, content := range []string{"one", "two", "three"} {
+		if err := pdb.SaveFile("a.txt", content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := pdb.Prune(&RetentionConfig{Versions: RetentionPolicy{MaxAge: time.Nanosecond}}, false); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := pdb.FileVersions("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Version != 3 {
+		t.Fatalf("versions after pruning = %v, want only version 3", versions)
+	}
+}
+
+func TestReferencedBlobs(t *testing.T) {
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	if err := pdb.SaveFile("a.txt", "file content"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pdb.RecordEdit(&EditHistory{Path: "b.txt", Operation: "modify", Tool: "test", OldHash: "old-hash", NewHash: "new-hash"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pdb.CreateCheckpoint("cp", "", map[string]CheckpointFile{"c.txt": {Hash: "checkpoint-hash"}}, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	referenced, err := referencedBlobs(pdb.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{blobHash([]byte("file content")), "old-hash", "new-hash", "checkpoint-hash"} {
+		if !referenced[hash] {
+			t.Errorf("blob %s is not referenced", hash)
+		}
+	}
+	if referenced[blobHash([]byte("unrelated"))] {
+		t.Error("unrelated blob is referenced")
+	}
+}
+
+// ageTestBlobs makes every stored blob look stored d ago
+func ageTestBlobs(t *testing.T, pdb *ProjectDatabase, d time.Duration) {
+	t.Helper()
+	stored := time.Now().Add(-d)
+	switch store := pdb.store.(type) {
+	case *fileStore:
+		blobs, err := filepath.Glob(filepath.Join(store.projectDir, "blobs", "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, blob := range blobs {
+			if err := os.Chtimes(blob, stored, stored); err != nil {
+				t.Fatal(err)
+			}
+		}
+	case *sqliteStore:
+		if _, err := store.db.Exec(`UPDATE blobs SET stored_at = ?`, stored.UTC()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			pdb := openTestDatabase(t, backend, t.TempDir())
+			defer pdb.Close()
+			if err := pdb.SaveFile("a.txt", "kept"); err != nil {
+				t.Fatal(err)
+			}
+			orphan, err := pdb.SaveBlob([]byte("orphan"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Within the grace period the orphan may be about to be referenced
+			if removed, _, err := pdb.CollectGarbage(false); err != nil || removed != 0 {
+				t.Fatalf("CollectGarbage in the grace period = %d, %v", removed, err)
+			}
+
+			ageTestBlobs(t, pdb, 2*blobGracePeriod)
+			removed, freed, err := pdb.CollectGarbage(true)
+			if err != nil || removed != 1 || freed != int64(len("orphan")) {
+				t.Fatalf("CollectGarbage dry run = %d, %d, %v", removed, freed, err)
+			}
+			if _, err := pdb.GetBlob(orphan); err != nil {
+				t.Fatal("dry run removed the orphaned blob")
+			}
+
+			if removed, _, err := pdb.CollectGarbage(false); err != nil || removed != 1 {
+				t.Fatalf("CollectGarbage = %d, %v", removed, err)
+			}
+			if _, err := pdb.GetBlob(orphan); err == nil {
+				t.Fatal("orphaned blob was kept")
+			}
+			if _, err := pdb.GetBlob(blobHash([]byte("kept"))); err != nil {
+				t.Fatalf("referenced blob was removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestSavingBlobAgainRefreshesIt(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			pdb := openTestDatabase(t, backend, t.TempDir())
+			defer pdb.Close()
+			hash, err := pdb.SaveBlob([]byte("pending"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ageTestBlobs(t, pdb, 2*blobGracePeriod)
+
+			// Content about to be referenced again gets a new grace period
+			if _, err := pdb.SaveBlob([]byte("pending")); err != nil {
+				t.Fatal(err)
+			}
+			if removed, _, err := pdb.CollectGarbage(false); err != nil || removed != 0 {
+				t.Fatalf("CollectGarbage = %d, %v", removed, err)
+			}
+			if _, err := pdb.GetBlob(hash); err != nil {
+				t.Fatalf("refreshed blob was removed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,659 @@
+// patch.go - Multi-file unified diff application
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// patchMaxFuzz is the number of leading/trailing context lines that may be
+// ignored when a hunk does not match exactly
+const patchMaxFuzz = 2
+
+// patchHunk is a single @@ section of a file patch
+type patchHunk struct {
+	OldStart int
+	OldCount int
+	NewStart int
+	NewCount int
+	Lines    []string // each line keeps its ' ', '-' or '+' prefix
+	OldNoEOL bool
+	NewNoEOL bool
+}
+
+// filePatch holds every hunk that targets one file
+type filePatch struct {
+	OldPath  string
+	NewPath  string
+	IsNew    bool
+	IsDelete bool
+	Hunks    []patchHunk
+}
+
+// patchedFile is the in-memory outcome of applying a filePatch
+type patchedFile struct {
+	patch   *filePatch
+	content string
+	report  []string
+}
+
+// ApplyPatchInput is the input for the apply_patch tool
+type ApplyPatchInput struct {
+	Patch  string `json:"patch" jsonschema_description:"A unified diff covering one or more files. Supports new files (--- /dev/null), deletions (+++ /dev/null) and git-style renames."`
+	DryRun bool   `json:"dry_run,omitempty" jsonschema_description:"Check that the patch applies and report the result without changing any files."`
+}
+
+var ApplyPatchInputSchema = GenerateSchema[ApplyPatchInput]()
+
+// ApplyPatch applies a multi-file unified diff. Every hunk is applied in
+// memory first; files are only written once the whole patch applies, and
+// any write failure restores the files that were already changed.
+func ApplyPatch(input json.RawMessage) (string, error) {
+	var patchInput ApplyPatchInput
+	if err := json.Unmarshal(input, &patchInput); err != nil {
+		return "", fmt.Errorf("failed to unmarshal ApplyPatch input: %w", err)
+	}
+
+	patches, err := parsePatch(patchInput.Patch)
+	if err != nil {
+		return "", err
+	}
+	if err := checkPatchPaths(patches); err != nil {
+		return "", err
+	}
+
+	log.Printf("Applying patch to %d files (dry run: %v)", len(patches), patchInput.DryRun)
+
+	var results []*patchedFile
+	var report []string
+	failed := false
+	for _, fp := range patches {
+		result, err := applyFilePatch(fp)
+		if err != nil {
+			failed = true
+			report = append(report, fmt.Sprintf("%s %s: %v", patchOpLabel(fp), patchDisplayPath(fp), err))
+			if result != nil {
+				report = append(report, result.report...)
+			}
+			continue
+		}
+		results = append(results, result)
+		report = append(report, fmt.Sprintf("%s %s", patchOpLabel(fp), patchDisplayPath(fp)))
+		report = append(report, result.report...)
+	}
+
+	if failed {
+		log.Printf("Patch failed to apply, no files were changed")
+		return "", fmt.Errorf("patch does not apply, no files were changed:\n%s", strings.Join(report, "\n"))
+	}
+
+	if patchInput.DryRun {
+		return fmt.Sprintf("Patch applies cleanly to %d files (dry run, nothing written):\n%s", len(results), strings.Join(report, "\n")), nil
+	}
+
+	if err := writePatchedFiles(results); err != nil {
+		log.Printf("Failed to write patched files: %v", err)
+		return "", err
+	}
+
+	log.Printf("Successfully applied patch to %d files", len(results))
+	return fmt.Sprintf("Applied patch to %d files:\n%s", len(results), strings.Join(report, "\n")), nil
+}
+
+var ApplyPatchDefinition = ToolDefinition{
+	Name:        "apply_patch",
+	Description: "Apply a unified diff to one or more files, including creating, deleting and renaming files. Hunks are matched fuzzily if line numbers have drifted. If any hunk fails, no file is changed and the per-hunk report explains why.",
+	InputSchema: ApplyPatchInputSchema,
+	Function:    ApplyPatch,
+}
+
+// parsePatch splits a unified diff into per-file patches
+func parsePatch(text string) ([]*filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var patches []*filePatch
+	var cur *filePatch
+	sawOldHeader := false
+
+	flush := func() {
+		if cur != nil {
+			patches = append(patches, cur)
+		}
+		cur = nil
+		sawOldHeader = false
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			cur = &filePatch{}
+			if fields := strings.Fields(strings.TrimPrefix(line, "diff --git ")); len(fields) == 2 {
+				cur.OldPath = stripPatchPrefix(fields[0])
+				cur.NewPath = stripPatchPrefix(fields[1])
+			}
+		case cur != nil && len(cur.Hunks) == 0 && strings.HasPrefix(line, "new file mode"):
+			cur.IsNew = true
+		case cur != nil && len(cur.Hunks) == 0 && strings.HasPrefix(line, "deleted file mode"):
+			cur.IsDelete = true
+		case cur != nil && len(cur.Hunks) == 0 && strings.HasPrefix(line, "rename from "):
+			cur.OldPath = strings.TrimPrefix(line, "rename from ")
+		case cur != nil && len(cur.Hunks) == 0 && strings.HasPrefix(line, "rename to "):
+			cur.NewPath = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "--- "):
+			path := parsePatchPath(strings.TrimPrefix(line, "--- "))
+			// A header for a different file ends a git block that had no hunks (e.g. a pure rename)
+			otherFile := cur != nil && cur.OldPath != "" && path != "/dev/null" && path != cur.OldPath
+			if cur == nil || len(cur.Hunks) > 0 || sawOldHeader || otherFile {
+				flush()
+				cur = &filePatch{}
+			}
+			sawOldHeader = true
+			if path == "/dev/null" {
+				cur.IsNew = true
+			} else {
+				cur.OldPath = path
+			}
+		case strings.HasPrefix(line, "+++ ") && cur != nil:
+			path := parsePatchPath(strings.TrimPrefix(line, "+++ "))
+			if path == "/dev/null" {
+				cur.IsDelete = true
+			} else {
+				cur.NewPath = path
+			}
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk header without a file header", i+1)
+			}
+			hunk, consumed, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			cur.Hunks = append(cur.Hunks, *hunk)
+			i += consumed - 1
+		}
+	}
+	flush()
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file patches found in input")
+	}
+
+	for _, fp := range patches {
+		if fp.IsNew {
+			fp.OldPath = ""
+		}
+		if fp.IsDelete {
+			fp.NewPath = ""
+		}
+		for _, p := range []string{fp.OldPath, fp.NewPath} {
+			if p != "" && !filepath.IsLocal(p) {
+				return nil, fmt.Errorf("refusing to patch path outside the working directory: %s", p)
+			}
+		}
+		if fp.OldPath == "" && fp.NewPath == "" {
+			return nil, fmt.Errorf("file patch is missing both old and new paths")
+		}
+		if len(fp.Hunks) == 0 && !fp.IsDelete && fp.OldPath == fp.NewPath {
+			return nil, fmt.Errorf("file patch for %s has no hunks", fp.NewPath)
+		}
+	}
+
+	return patches, nil
+}
+
+// parseHunk parses a hunk starting at lines[start] and returns how many lines it used
+func parseHunk(lines []string, start int) (*patchHunk, int, error) {
+	header := lines[start]
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return nil, 0, fmt.Errorf("line %d: malformed hunk header %q", start+1, header)
+	}
+
+	hunk := &patchHunk{}
+	var err error
+	if hunk.OldStart, hunk.OldCount, err = parseHunkRange(fields[1][1:]); err != nil {
+		return nil, 0, fmt.Errorf("line %d: %w", start+1, err)
+	}
+	if hunk.NewStart, hunk.NewCount, err = parseHunkRange(fields[2][1:]); err != nil {
+		return nil, 0, fmt.Errorf("line %d: %w", start+1, err)
+	}
+
+	oldSeen, newSeen := 0, 0
+	i := start + 1
+	for ; i < len(lines) && (oldSeen < hunk.OldCount || newSeen < hunk.NewCount); i++ {
+		line := lines[i]
+		if line == "" {
+			// Some editors strip the single space from blank context lines
+			line = " "
+		}
+		switch line[0] {
+		case ' ':
+			oldSeen++
+			newSeen++
+		case '-':
+			oldSeen++
+		case '+':
+			newSeen++
+		case '\\':
+			markNoEOL(hunk)
+			continue
+		default:
+			return nil, 0, fmt.Errorf("line %d: unexpected line in hunk: %q", i+1, line)
+		}
+		hunk.Lines = append(hunk.Lines, line)
+	}
+
+	if oldSeen != hunk.OldCount || newSeen != hunk.NewCount {
+		return nil, 0, fmt.Errorf("line %d: hunk is truncated (expected -%d +%d lines, got -%d +%d)",
+			start+1, hunk.OldCount, hunk.NewCount, oldSeen, newSeen)
+	}
+
+	// A trailing "\ No newline at end of file" marker belongs to this hunk
+	if i < len(lines) && strings.HasPrefix(lines[i], "\\") {
+		markNoEOL(hunk)
+		i++
+	}
+
+	return hunk, i - start, nil
+}
+
+// markNoEOL records a "\ No newline at end of file" marker for the last hunk line
+func markNoEOL(hunk *patchHunk) {
+	if len(hunk.Lines) == 0 {
+		return
+	}
+	switch hunk.Lines[len(hunk.Lines)-1][0] {
+	case '-':
+		hunk.OldNoEOL = true
+	case '+':
+		hunk.NewNoEOL = true
+	default:
+		hunk.OldNoEOL = true
+		hunk.NewNoEOL = true
+	}
+}
+
+// parseHunkRange parses "start,count" or "start"
+func parseHunkRange(s string) (int, int, error) {
+	startStr, countStr, hasCount := strings.Cut(s, ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hunk range %q", s)
+	}
+	count := 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, fmt.Errorf("invalid hunk range %q", s)
+		}
+	}
+	return start, count, nil
+}
+
+// parsePatchPath extracts the path from a ---/+++ header, dropping timestamps
+func parsePatchPath(s string) string {
+	if idx := strings.Index(s, "\t"); idx >= 0 {
+		s = s[:idx]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return s
+	}
+	return stripPatchPrefix(s)
+}
+
+// stripPatchPrefix removes the a/ or b/ prefix used by git diffs
+func stripPatchPrefix(s string) string {
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		return s[2:]
+	}
+	return s
+}
+
+// checkPatchPaths rejects patches that touch a file more than once. Every
+// file patch is applied to the content on disk, so a second one would
+// silently replace the result of the first.
+func checkPatchPaths(patches []*filePatch) error {
+	seen := make(map[string]bool)
+	for _, fp := range patches {
+		paths := make(map[string]bool)
+		for _, path := range []string{fp.OldPath, fp.NewPath} {
+			if path != "" {
+				paths[filepath.Clean(path)] = true
+			}
+		}
+		for path := range paths {
+			if seen[path] {
+				return fmt.Errorf("patch changes %s more than once; merge its hunks into one file section", path)
+			}
+			seen[path] = true
+		}
+	}
+	return nil
+}
+
+// applyFilePatch applies all hunks of a file patch in memory
+func applyFilePatch(fp *filePatch) (*patchedFile, error) {
+	result := &patchedFile{patch: fp}
+
+	var original string
+	if !fp.IsNew {
+		content, err := os.ReadFile(fp.OldPath)
+		if err != nil {
+			return nil, err
+		}
+		original = string(content)
+	} else if _, err := os.Stat(fp.NewPath); err == nil {
+		return nil, fmt.Errorf("file already exists")
+	}
+	if fp.NewPath != "" && fp.OldPath != "" && fp.NewPath != fp.OldPath {
+		if _, err := os.Stat(fp.NewPath); err == nil {
+			return nil, fmt.Errorf("rename target %s already exists", fp.NewPath)
+		}
+	}
+
+	lines := strings.Split(original, "\n")
+	trailingNewline := true
+	if original == "" {
+		lines = nil
+	} else if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		trailingNewline = false
+	}
+
+	offset := 0
+	minPos := 0
+	failed := false
+	for n, hunk := range fp.Hunks {
+		oldLines, newLines := hunkSides(hunk.Lines)
+
+		expected := hunk.OldStart - 1 + offset
+		if hunk.OldCount == 0 {
+			expected = hunk.OldStart + offset
+		}
+
+		pos, fuzz, lead, trail := locateHunk(lines, hunk.Lines, expected, minPos)
+		if pos < 0 {
+			failed = true
+			result.report = append(result.report, fmt.Sprintf("  hunk %d (@@ -%d,%d +%d,%d @@): FAILED, context not found",
+				n+1, hunk.OldStart, hunk.OldCount, hunk.NewStart, hunk.NewCount))
+			continue
+		}
+
+		// When context was trimmed by fuzz, only replace the lines that still matched
+		matchedOld := oldLines[lead : len(oldLines)-trail]
+		replacement := newLines[lead : len(newLines)-trail]
+
+		updated := make([]string, 0, len(lines)-len(matchedOld)+len(replacement))
+		updated = append(updated, lines[:pos]...)
+		updated = append(updated, replacement...)
+		updated = append(updated, lines[pos+len(matchedOld):]...)
+		lines = updated
+
+		status := fmt.Sprintf("  hunk %d: applied at line %d", n+1, pos-lead+1)
+		if delta := pos - lead - expected; delta != 0 || fuzz > 0 {
+			status += fmt.Sprintf(" (offset %+d lines, fuzz %d)", delta, fuzz)
+		}
+		result.report = append(result.report, status)
+
+		offset += len(replacement) - len(matchedOld) + (pos - lead - expected)
+		minPos = pos + len(replacement)
+
+		if hunk.NewNoEOL {
+			trailingNewline = false
+		} else if hunk.OldNoEOL {
+			trailingNewline = true
+		}
+	}
+
+	if failed {
+		return result, fmt.Errorf("one or more hunks failed")
+	}
+
+	if fp.IsDelete {
+		if len(lines) != 0 {
+			return result, fmt.Errorf("file is not empty after removing the patched content")
+		}
+		return result, nil
+	}
+
+	content := strings.Join(lines, "\n")
+	if len(lines) > 0 && trailingNewline {
+		content += "\n"
+	}
+	result.content = content
+	return result, nil
+}
+
+// hunkSides returns the old and new line sequences of a hunk
+func hunkSides(hunkLines []string) ([]string, []string) {
+	var oldLines, newLines []string
+	for _, line := range hunkLines {
+		switch line[0] {
+		case ' ':
+			oldLines = append(oldLines, line[1:])
+			newLines = append(newLines, line[1:])
+		case '-':
+			oldLines = append(oldLines, line[1:])
+		case '+':
+			newLines = append(newLines, line[1:])
+		}
+	}
+	return oldLines, newLines
+}
+
+// locateHunk finds where a hunk's old side occurs in lines, preferring
+// positions close to expected. It first tries an exact match, then ignores
+// trailing whitespace, then drops up to patchMaxFuzz context lines from each
+// end. It returns the match position, the fuzz used, and how many
+// leading/trailing lines were dropped.
+func locateHunk(lines, hunkLines []string, expected, minPos int) (pos, fuzz, lead, trail int) {
+	oldLines, _ := hunkSides(hunkLines)
+	if len(oldLines) == 0 {
+		return clamp(expected, minPos, len(lines)), 0, 0, 0
+	}
+
+	exact := func(a, b string) bool { return a == b }
+	loose := func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") }
+
+	for fuzz = 0; fuzz <= patchMaxFuzz; fuzz++ {
+		lead = min(fuzz, leadingContext(hunkLines))
+		trail = min(fuzz, trailingContext(hunkLines))
+		if fuzz > 0 && lead+trail == 0 {
+			break
+		}
+		needle := oldLines[lead : len(oldLines)-trail]
+		if len(needle) == 0 {
+			break
+		}
+		for _, eq := range []func(a, b string) bool{exact, loose} {
+			if p := searchLines(lines, needle, expected+lead, minPos, eq); p >= 0 {
+				return p, fuzz, lead, trail
+			}
+		}
+	}
+
+	return -1, 0, 0, 0
+}
+
+// searchLines scans outwards from expected for the first position where needle matches
+func searchLines(lines, needle []string, expected, minPos int, eq func(a, b string) bool) int {
+	matches := func(p int) bool {
+		if p < minPos || p+len(needle) > len(lines) {
+			return false
+		}
+		for i, want := range needle {
+			if !eq(lines[p+i], want) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for d := 0; d <= len(lines); d++ {
+		if matches(expected - d) {
+			return expected - d
+		}
+		if d > 0 && matches(expected+d) {
+			return expected + d
+		}
+	}
+	return -1
+}
+
+// leadingContext counts the unchanged lines at the start of a hunk
+func leadingContext(hunkLines []string) int {
+	n := 0
+	for n < len(hunkLines) && hunkLines[n][0] == ' ' {
+		n++
+	}
+	return n
+}
+
+// trailingContext counts the unchanged lines at the end of a hunk
+func trailingContext(hunkLines []string) int {
+	n := 0
+	for n < len(hunkLines) && hunkLines[len(hunkLines)-1-n][0] == ' ' {
+		n++
+	}
+	return n
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// writePatchedFiles writes all results, restoring every touched file if a write fails
+func writePatchedFiles(results []*patchedFile) error {
+	type backup struct {
+		path    string
+		content []byte
+		mode    os.FileMode
+		existed bool
+	}
+	var backups []backup
+	saved := make(map[string]*backup)
+
+	save := func(path string) {
+		if path == "" || saved[path] != nil {
+			return
+		}
+		b := backup{path: path}
+		if info, err := os.Stat(path); err == nil {
+			if content, err := os.ReadFile(path); err == nil {
+				b.content, b.mode, b.existed = content, info.Mode().Perm(), true
+			}
+		}
+		backups = append(backups, b)
+		saved[path] = &b
+	}
+
+	// fail restores every touched file and reports whether that worked
+	fail := func(err error) error {
+		var failures []string
+		for i := len(backups) - 1; i >= 0; i-- {
+			b := backups[i]
+			var restoreErr error
+			if b.existed {
+				restoreErr = writeFileAtomic(b.path, b.content, b.mode)
+			} else if _, statErr := os.Lstat(b.path); statErr == nil {
+				restoreErr = os.Remove(b.path)
+			}
+			if restoreErr != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", b.path, restoreErr))
+			}
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("%w; rolling back failed, these files may be left patched: %s", err, strings.Join(failures, "; "))
+		}
+		return fmt.Errorf("%w; all changes rolled back", err)
+	}
+
+	for _, r := range results {
+		fp := r.patch
+		save(fp.OldPath)
+		save(fp.NewPath)
+
+		mode := os.FileMode(0644)
+		if fp.OldPath != "" {
+			if info, err := os.Stat(fp.OldPath); err == nil {
+				mode = info.Mode().Perm()
+			}
+		}
+
+		if fp.NewPath != "" {
+			if dir := filepath.Dir(fp.NewPath); dir != "." {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					return fail(fmt.Errorf("failed to create directory %s: %w", dir, err))
+				}
+			}
+			if err := writeFileAtomic(fp.NewPath, []byte(r.content), mode); err != nil {
+				return fail(fmt.Errorf("failed to write %s: %w", fp.NewPath, err))
+			}
+		}
+		if fp.OldPath != "" && fp.OldPath != fp.NewPath {
+			if err := os.Remove(fp.OldPath); err != nil {
+				return fail(fmt.Errorf("failed to remove %s: %w", fp.OldPath, err))
+			}
+		}
+	}
+
+	// Record history only once every file has been written
+	group := newChangeGroup()
+	for _, r := range results {
+		fp := r.patch
+		if fp.OldPath != "" && fp.OldPath != fp.NewPath {
+			recordFileChange("apply_patch", group, fp.OldPath, saved[fp.OldPath].mode, append([]byte{}, saved[fp.OldPath].content...), nil)
+		}
+		if fp.NewPath != "" {
+			var oldContent []byte
+			if b := saved[fp.NewPath]; b.existed {
+				oldContent = append([]byte{}, b.content...)
+			}
+			recordFileChange("apply_patch", group, fp.NewPath, 0, oldContent, []byte(r.content))
+		}
+	}
+
+	return nil
+}
+
+// patchOpLabel returns a one-letter status like git's name-status output
+func patchOpLabel(fp *filePatch) string {
+	switch {
+	case fp.IsNew:
+		return "A"
+	case fp.IsDelete:
+		return "D"
+	case fp.OldPath != fp.NewPath:
+		return "R"
+	default:
+		return "M"
+	}
+}
+
+// patchDisplayPath describes the file(s) a patch touches
+func patchDisplayPath(fp *filePatch) string {
+	switch {
+	case fp.IsNew:
+		return fp.NewPath
+	case fp.IsDelete:
+		return fp.OldPath
+	case fp.OldPath != fp.NewPath:
+		return fp.OldPath + " -> " + fp.NewPath
+	default:
+		return fp.NewPath
+	}
+}
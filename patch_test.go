@@ -0,0 +1,274 @@
+// patch_test.go - apply_patch hunk placement and rollback tests
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// applyTestPatch runs the apply_patch tool on patch
+func applyTestPatch(t *testing.T, patch string) (string, error) {
+	t.Helper()
+	input, err := json.Marshal(ApplyPatchInput{Patch: patch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ApplyPatch(input)
+}
+
+// writeTestFile creates a file in the working directory
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkTestFile verifies the content of a file in the working directory
+func checkTestFile(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	if string(got) != want {
+		t.Fatalf("%s = %q, want %q", path, got, want)
+	}
+}
+
+// numberedLines returns "line 1\n" ... "line n\n"
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestApplyPatchOffsetHunk(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// Five lines were added at the top since the patch was made
+	writeTestFile(t, "a.txt", "new 1\nnew 2\nnew 3\nnew 4\nnew 5\n"+numberedLines(10))
+
+	result, err := applyTestPatch(t, `--- a/a.txt
++++ b/a.txt
+@@ -4,3 +4,3 @@
+ line 4
+-line 5
++line five
+ line 6
+`)
+	if err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if !strings.Contains(result, "offset +5 lines") {
+		t.Errorf("report does not mention the offset:\n%s", result)
+	}
+	checkTestFile(t, "a.txt", "new 1\nnew 2\nnew 3\nnew 4\nnew 5\n"+strings.Replace(numberedLines(10), "line 5\n", "line five\n", 1))
+}
+
+func TestApplyPatchFuzzyContext(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// The outer context lines no longer match
+	writeTestFile(t, "a.txt", "ONE\ntwo\nthree\nfour\nFIVE\nsix\n")
+
+	result, err := applyTestPatch(t, `--- a/a.txt
++++ b/a.txt
+@@ -1,5 +1,5 @@
+ one
+ two
+ three
+-four
++4
+ five
+`)
+	if err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if !strings.Contains(result, "fuzz 1") {
+		t.Errorf("report does not mention the fuzz:\n%s", result)
+	}
+	checkTestFile(t, "a.txt", "ONE\ntwo\nthree\n4\nFIVE\nsix\n")
+}
+
+func TestApplyPatchAmbiguousMatchPrefersNearest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	block := "func f() {\n\treturn\n}\n"
+	writeTestFile(t, "a.go", block+"\n"+block+"\n"+block)
+
+	// The hunk claims line 5, which is where the second copy starts
+	_, err := applyTestPatch(t, `--- a/a.go
++++ b/a.go
+@@ -5,3 +5,3 @@
+ func f() {
+-	return
++	return // second
+ }
+`)
+	if err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	second := "func f() {\n\treturn // second\n}\n"
+	checkTestFile(t, "a.go", block+"\n"+second+"\n"+block)
+}
+
+func TestApplyPatchContextNotFound(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, "a.txt", "alpha\nbeta\ngamma\n")
+
+	_, err := applyTestPatch(t, `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ x
+-y
++z
+ w
+`)
+	if err == nil || !strings.Contains(err.Error(), "context not found") {
+		t.Fatalf("err = %v, want context not found", err)
+	}
+	checkTestFile(t, "a.txt", "alpha\nbeta\ngamma\n")
+}
+
+func TestApplyPatchCreateAndDelete(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, "old.txt", "bye\n")
+
+	_, err := applyTestPatch(t, `--- /dev/null
++++ b/dir/new.txt
+@@ -0,0 +1,2 @@
++hello
++world
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`)
+	if err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	checkTestFile(t, "dir/new.txt", "hello\nworld\n")
+	if _, err := os.Stat("old.txt"); !os.IsNotExist(err) {
+		t.Fatalf("old.txt still exists: %v", err)
+	}
+
+	// Creating a file that exists is refused
+	_, err = applyTestPatch(t, `--- /dev/null
++++ b/dir/new.txt
+@@ -0,0 +1 @@
++again
+`)
+	if err == nil {
+		t.Fatal("creating an existing file succeeded")
+	}
+	checkTestFile(t, "dir/new.txt", "hello\nworld\n")
+}
+
+func TestApplyPatchFailingHunkChangesNothing(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, "a.txt", "a\nb\nc\n")
+	writeTestFile(t, "b.txt", "x\ny\nz\n")
+
+	_, err := applyTestPatch(t, `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+--- a/b.txt
++++ b/b.txt
+@@ -1,3 +1,3 @@
+ nope
+-nope
++NOPE
+ nope
+`)
+	if err == nil {
+		t.Fatal("patch with a failing hunk applied")
+	}
+	checkTestFile(t, "a.txt", "a\nb\nc\n")
+	checkTestFile(t, "b.txt", "x\ny\nz\n")
+}
+
+func TestApplyPatchWriteFailureRollsBack(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, "a.txt", "a\nb\nc\n")
+	writeTestFile(t, "gone.txt", "bye\n")
+	// blocker is a file, so the directory for the last file cannot be created
+	writeTestFile(t, "blocker", "")
+
+	_, err := applyTestPatch(t, `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+--- /dev/null
++++ b/blocker/new.txt
+@@ -0,0 +1 @@
++hello
+`)
+	if err == nil || !strings.Contains(err.Error(), "all changes rolled back") {
+		t.Fatalf("patch with a failing write = %v", err)
+	}
+	checkTestFile(t, "a.txt", "a\nb\nc\n")
+	checkTestFile(t, "gone.txt", "bye\n")
+	if _, err := os.Stat("blocker/new.txt"); err == nil {
+		t.Fatal("blocker/new.txt was created")
+	}
+}
+
+func TestApplyPatchRejectsRepeatedPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, "a.txt", "a\nb\nc\n")
+	writeTestFile(t, "b.txt", "x\n")
+
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"same file twice", `--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+-a
++A
+ b
+--- a/a.txt
++++ b/a.txt
+@@ -2,2 +2,2 @@
+ b
+-c
++C
+`},
+		{"rename onto a patched file", `--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-x
++X
+--- a/a.txt
++++ b/b.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`},
+	}
+	for _, tt := range tests {
+		_, err := applyTestPatch(t, tt.patch)
+		if err == nil || !strings.Contains(err.Error(), "more than once") {
+			t.Errorf("%s: ApplyPatch = %v", tt.name, err)
+		}
+		checkTestFile(t, "a.txt", "a\nb\nc\n")
+		checkTestFile(t, "b.txt", "x\n")
+	}
+}
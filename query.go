@@ -0,0 +1,406 @@
+// query.go - Searching and exporting edit history, checkpoints and multiplayer actions
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of records that can be queried
+const (
+	queryEdits       = "edits"
+	queryCheckpoints = "checkpoints"
+	queryMultiplayer = "multiplayer"
+)
+
+// Output formats of query results
+const (
+	queryFormatText  = "text"
+	queryFormatJSONL = "jsonl"
+	queryFormatCSV   = "csv"
+)
+
+// ProjectQuery selects records of one kind. Empty fields do not filter.
+type ProjectQuery struct {
+	Kind   string
+	Path   string    // exact path, directory ending in "/", or glob such as *.go; checkpoints match on any captured file
+	Since  time.Time // inclusive
+	Until  time.Time // exclusive
+	User   string    // edit author; multiplayer actions match "session:user" or just the user
+	Action string    // edit operation or tool; multiplayer action
+	Limit  int       // applied to the newest matches
+}
+
+// validate checks the kind and that its filters apply to it
+func (q *ProjectQuery) validate() error {
+	switch q.Kind {
+	case queryEdits:
+	case queryCheckpoints:
+		if q.User != "" || q.Action != "" {
+			return fmt.Errorf("checkpoints can only be filtered by path and time")
+		}
+	case queryMultiplayer:
+		if q.Path != "" {
+			return fmt.Errorf("multiplayer actions cannot be filtered by path")
+		}
+	default:
+		return fmt.Errorf("unknown record kind %q (use %s, %s or %s)", q.Kind, queryEdits, queryCheckpoints, queryMultiplayer)
+	}
+
+	if _, err := path.Match(q.Path, ""); err != nil {
+		return fmt.Errorf("invalid path pattern %q: %w", q.Path, err)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return fmt.Errorf("until must be later than since")
+	}
+	return nil
+}
+
+// matchPath reports whether p is selected by the path filter. A pattern
+// without a slash also matches base names, so *.go finds Go files anywhere.
+func (q *ProjectQuery) matchPath(p string) bool {
+	switch {
+	case q.Path == "" || q.Path == p:
+		return true
+	case strings.HasSuffix(q.Path, "/"):
+		return strings.HasPrefix(p, q.Path)
+	}
+	if ok, _ := path.Match(q.Path, p); ok {
+		return true
+	}
+	if !strings.Contains(q.Path, "/") {
+		ok, _ := path.Match(q.Path, path.Base(p))
+		return ok
+	}
+	return false
+}
+
+// matchCheckpoint reports whether a checkpoint captured a file selected by
+// the path filter
+func (q *ProjectQuery) matchCheckpoint(c *Checkpoint) bool {
+	if q.Path == "" {
+		return true
+	}
+	for p := range c.Files {
+		if q.matchPath(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchUser reports whether user is selected by the user filter
+func (q *ProjectQuery) matchUser(user string) bool {
+	if q.User == "" || strings.EqualFold(user, q.User) {
+		return true
+	}
+	_, name, ok := strings.Cut(user, ":")
+	return ok && strings.EqualFold(name, q.User)
+}
+
+// recordFilter returns the part of the query the storage backend can apply
+// with its indexes: the time range, an exact path or directory, and the
+// limit when no other filter remains to be applied afterwards
+func (q *ProjectQuery) recordFilter() RecordFilter {
+	filter := RecordFilter{Since: q.Since, Until: q.Until}
+	pathDone := q.Path == ""
+	if q.Kind == queryEdits {
+		switch {
+		case strings.HasSuffix(q.Path, "/"):
+			filter.PathPrefix = q.Path
+			pathDone = true
+		case q.Path != "" && !strings.ContainsAny(q.Path, "*?["):
+			filter.Path = q.Path
+			pathDone = true
+		}
+	}
+	if pathDone && q.User == "" && q.Action == "" {
+		filter.Limit = q.Limit
+	}
+	return filter
+}
+
+// queryRecord is a record returned by a query
+type queryRecord interface {
+	summary() string    // one line for people and the model
+	csvRow() []string   // columns as listed in queryCSVHeaders
+	brief() queryRecord // a copy without bulky fields such as diffs
+}
+
+// queryCSVHeaders are the CSV columns of each kind
+var queryCSVHeaders = map[string][]string{
+	queryEdits:       {"id", "timestamp", "path", "operation", "tool", "user", "session", "group", "undone", "file_id", "old_hash", "new_hash", "diff"},
+	queryCheckpoints: {"id", "timestamp", "name", "description", "file_count", "skipped", "git_commit"},
+	queryMultiplayer: {"id", "timestamp", "user", "action", "data"},
+}
+
+// queryTimeFormat is used for timestamps in text output
+const queryTimeFormat = "2006-01-02 15:04:05"
+
+func (e *EditHistory) summary() string {
+	line := fmt.Sprintf("#%d %s %s %s (%s by %s)", e.ID, e.Timestamp.Format(queryTimeFormat), e.Operation, e.Path, e.Tool, e.User)
+	if e.Undone {
+		line += " [undone]"
+	}
+	return line
+}
+
+func (e *EditHistory) csvRow() []string {
+	return []string{strconv.Itoa(e.ID), e.Timestamp.Format(time.RFC3339), e.Path, e.Operation, e.Tool, e.User, e.Session, e.Group,
+		strconv.FormatBool(e.Undone), strconv.Itoa(e.FileID), e.OldHash, e.NewHash, e.Diff}
+}
+
+func (e *EditHistory) brief() queryRecord {
+	trimmed := *e
+	trimmed.Diff = ""
+	return &trimmed
+}
+
+func (c *Checkpoint) summary() string {
+	line := fmt.Sprintf("#%d %s %s (%d files", c.ID, c.Timestamp.Format(queryTimeFormat), c.Name, c.FileCount)
+	if c.GitCommit != "" {
+		line += ", " + gitCheckpointRef(c.ID)
+	}
+	line += ")"
+	if c.Description != "" {
+		line += ": " + c.Description
+	}
+	return line
+}
+
+func (c *Checkpoint) csvRow() []string {
+	return []string{strconv.Itoa(c.ID), c.Timestamp.Format(time.RFC3339), c.Name, c.Description,
+		strconv.Itoa(c.FileCount), strconv.Itoa(len(c.Skipped)), c.GitCommit}
+}
+
+func (c *Checkpoint) brief() queryRecord {
+	trimmed := *c
+	trimmed.Files = nil
+	return &trimmed
+}
+
+// querySummaryData is how much of a multiplayer action's data text output shows
+const querySummaryData = 100
+
+func (a *MultiplayerAction) summary() string {
+	data := strings.Join(strings.Fields(a.Data), " ")
+	if runes := []rune(data); len(runes) > querySummaryData {
+		data = string(runes[:querySummaryData]) + "..."
+	}
+	return fmt.Sprintf("#%d %s %s %s: %s", a.ID, a.Timestamp.Format(queryTimeFormat), a.User, a.Action, data)
+}
+
+func (a *MultiplayerAction) csvRow() []string {
+	return []string{strconv.Itoa(a.ID), a.Timestamp.Format(time.RFC3339), a.User, a.Action, a.Data}
+}
+
+func (a *MultiplayerAction) brief() queryRecord {
+	return a
+}
+
+// Query returns the records matching q, newest first
+func (pdb *ProjectDatabase) Query(q ProjectQuery) ([]queryRecord, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	pdb.mu.RLock()
+	defer pdb.mu.RUnlock()
+
+	filter := q.recordFilter()
+	var records []queryRecord
+	switch q.Kind {
+	case queryEdits:
+		edits, err := pdb.store.FindEdits(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range edits {
+			if q.matchPath(e.Path) && q.matchUser(e.User) &&
+				(q.Action == "" || strings.EqualFold(e.Operation, q.Action) || strings.EqualFold(e.Tool, q.Action)) {
+				records = append(records, e)
+			}
+		}
+
+	case queryCheckpoints:
+		checkpoints, err := pdb.store.FindCheckpoints(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range checkpoints {
+			if q.matchCheckpoint(c) {
+				records = append(records, c)
+			}
+		}
+
+	case queryMultiplayer:
+		actions, err := pdb.store.FindMultiplayerActions(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range actions {
+			if q.matchUser(a.User) && (q.Action == "" || strings.EqualFold(a.Action, q.Action)) {
+				records = append(records, a)
+			}
+		}
+	}
+
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[:q.Limit]
+	}
+	return records, nil
+}
+
+// writeQueryResults writes records of kind as text, JSONL or CSV
+func writeQueryResults(w io.Writer, kind, format string, records []queryRecord) error {
+	switch format {
+	case queryFormatText, "":
+		if len(records) == 0 {
+			_, err := fmt.Fprintf(w, "No matching %s\n", kind)
+			return err
+		}
+		for _, record := range records {
+			if _, err := fmt.Fprintln(w, record.summary()); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case queryFormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case queryFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(queryCSVHeaders[kind]); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := writer.Write(record.csvRow()); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown format %q (use %s, %s or %s)", format, queryFormatText, queryFormatJSONL, queryFormatCSV)
+}
+
+// parseQueryTime parses a time filter: an RFC 3339 timestamp, a local date
+// or date and time, or an age such as "24h" or "7d" counted back from now
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if age, err := parseRetentionAge(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use a date such as 2006-01-02, an RFC 3339 timestamp, or an age such as 24h or 7d)", value)
+}
+
+// queryDefaultLimit and queryMaxLimit bound the records returned to the
+// model, and queryMaxOutput the size of the output
+const (
+	queryDefaultLimit = 50
+	queryMaxLimit     = 500
+	queryMaxOutput    = 100 * 1024
+)
+
+type QueryProjectDataInput struct {
+	Kind   string `json:"kind" jsonschema_description:"Records to search: edits (file edit history), checkpoints or multiplayer (multiplayer actions)"`
+	Path   string `json:"path,omitempty" jsonschema_description:"Exact path, directory ending in '/', or glob such as '*.go'; for checkpoints, any captured file"`
+	Since  string `json:"since,omitempty" jsonschema_description:"Only records at or after this time: a date (2006-01-02), an RFC 3339 timestamp, or an age such as 24h or 7d"`
+	Until  string `json:"until,omitempty" jsonschema_description:"Only records before this time, in the same forms as since"`
+	User   string `json:"user,omitempty" jsonschema_description:"Only records by this user"`
+	Action string `json:"action,omitempty" jsonschema_description:"For edits an operation (create, modify, delete) or tool name; for multiplayer the action"`
+	Limit  int    `json:"limit,omitempty" jsonschema_description:"Maximum number of records, newest first (default 50, at most 500)"`
+	Format string `json:"format,omitempty" jsonschema_description:"text (default, one line per record), jsonl (one JSON record per line) or csv"`
+	Full   bool   `json:"full,omitempty" jsonschema_description:"Include edit diffs and the files captured by checkpoints in jsonl and csv output"`
+}
+
+var QueryProjectDataInputSchema = GenerateSchema[QueryProjectDataInput]()
+
+func QueryProjectData(input json.RawMessage) (string, error) {
+	var queryInput QueryProjectDataInput
+	if err := json.Unmarshal(input, &queryInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	q := ProjectQuery{
+		Kind:   queryInput.Kind,
+		Path:   queryInput.Path,
+		User:   queryInput.User,
+		Action: queryInput.Action,
+		Limit:  queryInput.Limit,
+	}
+	if q.Limit <= 0 {
+		q.Limit = queryDefaultLimit
+	}
+	if q.Limit > queryMaxLimit {
+		q.Limit = queryMaxLimit
+	}
+	now := time.Now()
+	var err error
+	if queryInput.Since != "" {
+		if q.Since, err = parseQueryTime(queryInput.Since, now); err != nil {
+			return "", err
+		}
+	}
+	if queryInput.Until != "" {
+		if q.Until, err = parseQueryTime(queryInput.Until, now); err != nil {
+			return "", err
+		}
+	}
+
+	records, err := globalDB.Query(q)
+	if err != nil {
+		return "", err
+	}
+	if !queryInput.Full {
+		for i, record := range records {
+			records[i] = record.brief()
+		}
+	}
+	var out bytes.Buffer
+	if err := writeQueryResults(&out, q.Kind, queryInput.Format, records); err != nil {
+		return "", err
+	}
+
+	result := out.String()
+	if len(result) > queryMaxOutput {
+		// Cut at a line boundary so every JSONL line stays valid
+		result = truncateUTF8(result, queryMaxOutput)
+		if i := strings.LastIndexByte(result, '\n'); i >= 0 {
+			result = result[:i+1]
+		}
+		result += fmt.Sprintf("[output truncated at %d bytes; narrow the query or lower the limit]\n", queryMaxOutput)
+	}
+	return result, nil
+}
+
+var QueryProjectDataDefinition = ToolDefinition{
+	Name:        "query_project_data",
+	Description: "Search the project's edit history, checkpoints and multiplayer actions by path, time range, user and action type. Read-only; returns one line per record, or records as JSONL or CSV without diffs and checkpoint file lists unless full is set.",
+	InputSchema: QueryProjectDataInputSchema,
+	Function:    QueryProjectData,
+}
@@ -0,0 +1,121 @@
+// query_test.go - Filtering and output of project data queries
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queryIDs returns the IDs of the records a query returns
+func queryIDs(t *testing.T, pdb *ProjectDatabase, q ProjectQuery) []int {
+	t.Helper()
+	records, err := pdb.Query(q)
+	if err != nil {
+		t.Fatalf("Query(%+v): %v", q, err)
+	}
+	var ids []int
+	for _, record := range records {
+		switch r := record.(type) {
+		case *EditHistory:
+			ids = append(ids, r.ID)
+		case *Checkpoint:
+			ids = append(ids, r.ID)
+		case *MultiplayerAction:
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+func TestQueryFilters(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			pdb := openTestDatabase(t, backend, t.TempDir())
+			defer pdb.Close()
+			edits := []struct{ path, user string }{
+				{"main.go", "ann"},
+				{"cmd/run.go", "bob"},
+				{"cmd/sub/x.go", "ann"},
+				{"cmd.txt", "ann"},
+				{"README.md", "bob"},
+			}
+			for i, e := range edits {
+				// Local times must compare by instant, whatever the zone
+				ts := start.Add(time.Duration(i) * time.Hour).In(time.FixedZone("test", 5*3600))
+				if err := pdb.RecordEdit(&EditHistory{Path: e.path, Operation: "modify", Tool: "test", User: e.user, Timestamp: ts}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if err := pdb.RecordMultiplayerAction("s:ann", "chat", fmt.Sprint(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				name string
+				q    ProjectQuery
+				want []int
+			}{
+				{"all", ProjectQuery{Kind: queryEdits}, []int{5, 4, 3, 2, 1}},
+				{"exact path", ProjectQuery{Kind: queryEdits, Path: "cmd/run.go"}, []int{2}},
+				{"directory", ProjectQuery{Kind: queryEdits, Path: "cmd/"}, []int{3, 2}},
+				{"glob", ProjectQuery{Kind: queryEdits, Path: "*.go"}, []int{3, 2, 1}},
+				{"since", ProjectQuery{Kind: queryEdits, Since: start.Add(3 * time.Hour)}, []int{5, 4}},
+				{"until", ProjectQuery{Kind: queryEdits, Until: start.Add(time.Hour)}, []int{1}},
+				{"range", ProjectQuery{Kind: queryEdits, Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)}, []int{3, 2}},
+				{"limit", ProjectQuery{Kind: queryEdits, Limit: 2}, []int{5, 4}},
+				{"limit after user filter", ProjectQuery{Kind: queryEdits, User: "ann", Limit: 2}, []int{4, 3}},
+				{"limit after glob", ProjectQuery{Kind: queryEdits, Path: "*.go", Limit: 1}, []int{3}},
+				{"directory and time", ProjectQuery{Kind: queryEdits, Path: "cmd/", Since: start.Add(2 * time.Hour)}, []int{3}},
+				{"multiplayer limit", ProjectQuery{Kind: queryMultiplayer, Limit: 2}, []int{3, 2}},
+				{"multiplayer until", ProjectQuery{Kind: queryMultiplayer, Until: start}, nil},
+			}
+			for _, tt := range tests {
+				if got := queryIDs(t, pdb, tt.q); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryProjectDataOutput(t *testing.T) {
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	useTestDatabase(t, pdb)
+	diff := strings.Repeat("+added line\n", 200)
+	for i := 0; i < 100; i++ {
+		if err := pdb.RecordEdit(&EditHistory{Path: fmt.Sprintf("f%d.go", i), Operation: "modify", Tool: "test", Diff: diff}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	brief, err := QueryProjectData(json.RawMessage(`{"kind":"edits","format":"jsonl","limit":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edit EditHistory
+	if err := json.Unmarshal([]byte(brief), &edit); err != nil || edit.Diff != "" || edit.Path != "f99.go" {
+		t.Fatalf("brief record = %+v, %v", edit, err)
+	}
+
+	full, err := QueryProjectData(json.RawMessage(`{"kind":"edits","format":"jsonl","limit":500,"full":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full) > queryMaxOutput+100 || !strings.Contains(full, "[output truncated") {
+		t.Fatalf("output of %d bytes was not truncated", len(full))
+	}
+	lines := strings.Split(strings.TrimSuffix(full, "\n"), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		if err := json.Unmarshal([]byte(line), &edit); err != nil || edit.Diff != diff {
+			t.Fatalf("truncated output has a broken record: %v", err)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// readfile.go - Ranged, budgeted and encoding-aware file reading for read_file
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	// readFileMaxBytes is the default output budget for a single read_file call
+	readFileMaxBytes = 64 * 1024
+	// readFileHardMaxBytes caps the budget a caller may ask for
+	readFileHardMaxBytes = 1024 * 1024
+	// readFileSniffBytes is how much of the file is inspected for binary content
+	readFileSniffBytes = 8 * 1024
+)
+
+// readFileOptions controls which part of a file read_file returns
+type readFileOptions struct {
+	Offset      int // 1-based first line, 0 means start of file
+	Limit       int // maximum number of lines, 0 means no limit
+	LineNumbers bool
+	MaxBytes    int
+}
+
+// readFileRange reads a file according to opts. Small files read without any
+// options are returned verbatim; everything else goes through the line
+// window, which stops at the byte budget and says how to continue.
+func readFileRange(path string, opts readFileOptions) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory, use list_files instead", path)
+	}
+
+	budget := opts.MaxBytes
+	if budget <= 0 {
+		budget = readFileMaxBytes
+	}
+	budget = min(budget, readFileHardMaxBytes)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sniff := make([]byte, readFileSniffBytes)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	sniff = sniff[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	encoding := detectEncoding(sniff)
+	if encoding == "binary" {
+		return fmt.Sprintf("%s is a binary file (%d bytes, %s); its contents are not shown. Use bash with a tool like xxd or file to inspect it.",
+			path, info.Size(), http.DetectContentType(sniff)), nil
+	}
+
+	var reader io.Reader = f
+	if strings.HasPrefix(encoding, "utf-16") {
+		// UTF-16 files are decoded up front; they are rare and rarely large
+		raw, err := io.ReadAll(io.LimitReader(f, int64(readFileHardMaxBytes)*4))
+		if err != nil {
+			return "", err
+		}
+		reader = strings.NewReader(decodeUTF16(raw, encoding == "utf-16le"))
+	}
+
+	plain := opts.Offset <= 1 && opts.Limit == 0 && !opts.LineNumbers
+	if plain && info.Size() <= int64(budget) {
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return "", err
+		}
+		return decodeText(content), nil
+	}
+
+	return readLineWindow(path, bufio.NewReader(reader), opts, budget)
+}
+
+// readLineWindow returns the requested lines from r, stopping at the byte
+// budget. Reading ends as soon as the window is complete, and only the part
+// of a line that can be shown is kept in memory.
+func readLineWindow(path string, r *bufio.Reader, opts readFileOptions, budget int) (string, error) {
+	start := max(opts.Offset, 1)
+
+	var out strings.Builder
+	lineNo := 0
+	lastShown := 0
+	more := false
+	cutLine := false
+	for {
+		if opts.Limit > 0 && lineNo >= start-1+opts.Limit {
+			_, err := r.Peek(1)
+			more = err == nil
+			break
+		}
+
+		// Lines before the window are skipped without keeping them
+		keep := budget + 1
+		if lineNo+1 < start {
+			keep = 0
+		}
+		line, n, err := readCappedLine(r, keep)
+		if n == 0 && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", err
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		lineNo++
+		if lineNo < start {
+			continue
+		}
+
+		text := decodeText(line)
+		if opts.LineNumbers {
+			text = fmt.Sprintf("%6d\t%s", lineNo, text)
+		}
+		if out.Len()+len(text) > budget {
+			if lastShown == 0 {
+				// A single line larger than the budget is cut rather than dropped
+				out.WriteString(truncateUTF8(text, budget))
+				out.WriteString("\n")
+				lastShown = lineNo
+				cutLine = true
+			}
+			more = lastShown < lineNo
+			if !more {
+				_, peekErr := r.Peek(1)
+				more = peekErr == nil
+			}
+			break
+		}
+		out.WriteString(text)
+		lastShown = lineNo
+	}
+
+	if lastShown == 0 {
+		if lineNo == 0 {
+			return "", nil
+		}
+		return "", fmt.Errorf("offset %d is past the end of %s (%d lines)", start, path, lineNo)
+	}
+
+	if more || cutLine {
+		if !strings.HasSuffix(out.String(), "\n") {
+			out.WriteString("\n")
+		}
+		if cutLine {
+			fmt.Fprintf(&out, "[line %d is longer than the %d byte budget and was cut; raise max_bytes or use bash to see all of it]\n", lastShown, budget)
+		}
+		if more {
+			fmt.Fprintf(&out, "[showing lines %d-%d; the file continues, read on with offset=%d]\n", start, lastShown, lastShown+1)
+		}
+	}
+
+	return out.String(), nil
+}
+
+// readCappedLine reads the next line from r, newline included, and returns
+// at most limit bytes of it along with the line's full length. The rest of a
+// longer line is read and discarded.
+func readCappedLine(r *bufio.Reader, limit int) ([]byte, int, error) {
+	var line []byte
+	n := 0
+	for {
+		chunk, err := r.ReadSlice('\n')
+		n += len(chunk)
+		if room := limit - len(line); room > 0 {
+			line = append(line, chunk[:min(room, len(chunk))]...)
+		}
+		if err != bufio.ErrBufferFull {
+			return line, n, err
+		}
+	}
+}
+
+// detectEncoding classifies the start of a file as "utf-8", "utf-16le",
+// "utf-16be", "latin-1" or "binary"
+func detectEncoding(sniff []byte) string {
+	switch {
+	case bytes.HasPrefix(sniff, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(sniff, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	case bytes.IndexByte(sniff, 0) >= 0:
+		return "binary"
+	}
+
+	// Cut a possibly incomplete rune at the end of the sniffed block
+	check := sniff
+	for i := 0; i < utf8.UTFMax && len(check) > 0 && !utf8.Valid(check); i++ {
+		check = check[:len(check)-1]
+	}
+	if utf8.Valid(check) {
+		return "utf-8"
+	}
+
+	// Mostly-printable text that is not UTF-8 is treated as Latin-1
+	control := 0
+	for _, b := range sniff {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' {
+			control++
+		}
+	}
+	if control*10 > len(sniff) {
+		return "binary"
+	}
+	return "latin-1"
+}
+
+// decodeText converts bytes to a string, stripping a UTF-8 BOM and decoding
+// invalid UTF-8 as Latin-1
+func decodeText(b []byte) string {
+	b = bytes.TrimPrefix(b, []byte{0xEF, 0xBB, 0xBF})
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// decodeUTF16 decodes UTF-16 text, skipping the byte order mark
+func decodeUTF16(b []byte, littleEndian bool) string {
+	if len(b) >= 2 {
+		b = b[2:]
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if littleEndian {
+			units[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+		} else {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
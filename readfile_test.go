@@ -0,0 +1,115 @@
+// readfile_test.go - Line windows, byte budgets and long lines of read_file
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadFileRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	var content strings.Builder
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	writeTestFile(t, path, content.String())
+
+	tests := []struct {
+		name string
+		opts readFileOptions
+		want string
+		err  string
+	}{
+		{"whole file", readFileOptions{}, content.String(), ""},
+		{"window", readFileOptions{Offset: 2, Limit: 2}, "line 2\nline 3\n[showing lines 2-3; the file continues, read on with offset=4]\n", ""},
+		{"window at the end", readFileOptions{Offset: 9, Limit: 5}, "line 9\nline 10\n", ""},
+		{"line numbers", readFileOptions{Offset: 10, LineNumbers: true}, "    10\tline 10\n", ""},
+		{"budget", readFileOptions{MaxBytes: 15}, "line 1\nline 2\n[showing lines 1-2; the file continues, read on with offset=3]\n", ""},
+		{"line longer than the budget", readFileOptions{Offset: 3, MaxBytes: 4}, "line\n[line 3 is longer than the 4 byte budget and was cut; raise max_bytes or use bash to see all of it]\n[showing lines 3-3; the file continues, read on with offset=4]\n", ""},
+		{"offset past the end", readFileOptions{Offset: 11}, "", "offset 11 is past the end"},
+	}
+	for _, tt := range tests {
+		got, err := readFileRange(path, tt.opts)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// errAfterWindow is returned by the reader when read_file reads on after the window
+var errAfterWindow = errors.New("read past the window")
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errAfterWindow }
+
+func TestReadLineWindowStopsAtWindow(t *testing.T) {
+	r := bufio.NewReaderSize(io.MultiReader(strings.NewReader("a\nb\nc\n"), failingReader{}), 16)
+	got, err := readLineWindow("f", r, readFileOptions{Offset: 1, Limit: 2}, readFileMaxBytes)
+	if err != nil {
+		t.Fatalf("readLineWindow read on after the window: %v", err)
+	}
+	if !strings.HasPrefix(got, "a\nb\n[showing lines 1-2;") {
+		t.Fatalf("got %q", got)
+	}
+
+	r = bufio.NewReaderSize(io.MultiReader(strings.NewReader("aaaa\nbbbb\ncccc\n"), failingReader{}), 16)
+	if _, err := readLineWindow("f", r, readFileOptions{}, 6); err != nil {
+		t.Fatalf("readLineWindow read on after the budget: %v", err)
+	}
+}
+
+// longLineReader yields a line of size bytes followed by a short one
+type longLineReader struct {
+	size int
+	tail io.Reader
+}
+
+func (r *longLineReader) Read(p []byte) (int, error) {
+	if r.size == 0 {
+		return r.tail.Read(p)
+	}
+	n := min(len(p), r.size)
+	for i := range p[:n] {
+		p[i] = 'x'
+	}
+	r.size -= n
+	return n, nil
+}
+
+func TestReadLineWindowLongLine(t *testing.T) {
+	const size = 64 << 20
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	r := bufio.NewReader(&longLineReader{size: size, tail: strings.NewReader("\nshort\n")})
+	got, err := readLineWindow("f", r, readFileOptions{Offset: 1, Limit: 2}, 100)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, strings.Repeat("x", 100)+"\n[line 1 is longer") {
+		t.Fatalf("long line was not cut to the budget: %.200q", got)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/8 {
+		t.Fatalf("reading a %d byte line allocated %d bytes", size, allocated)
+	}
+
+	// A long line before the window is skipped the same way
+	r = bufio.NewReader(&longLineReader{size: size, tail: strings.NewReader("\nshort\n")})
+	got, err = readLineWindow("f", r, readFileOptions{Offset: 2}, 100)
+	if err != nil || got != "short\n" {
+		t.Fatalf("line after a long line = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,287 @@
+// registry.go - Tool registry with packages, categories, profiles and per-session enable/disable
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ToolCategory describes what a tool can do, so profiles can select tools by capability
+type ToolCategory string
+
+const (
+	CategoryRead    ToolCategory = "read"    // inspects files without changing them
+	CategorySearch  ToolCategory = "search"  // searches code and symbols
+	CategoryWrite   ToolCategory = "write"   // changes files in the workspace
+	CategoryExec    ToolCategory = "exec"    // runs shell commands
+	CategoryNetwork ToolCategory = "network" // talks to remote services
+	CategoryProject ToolCategory = "project" // project database, checkpoints and integrations
+	CategoryCustom  ToolCategory = "custom"  // tools and chains from .eve/tools.json
+)
+
+// toolProfiles maps a profile name to the categories it enables. The "all"
+// profile enables every registered tool.
+var toolProfiles = map[string][]ToolCategory{
+	"read-only":  {CategoryRead, CategorySearch},
+	"coder":      {CategoryRead, CategorySearch, CategoryWrite, CategoryExec, CategoryProject, CategoryCustom},
+	"researcher": {CategoryRead, CategorySearch, CategoryNetwork},
+}
+
+// registeredTool is a tool definition with its registry metadata
+type registeredTool struct {
+	Definition ToolDefinition
+	Package    string
+	Category   ToolCategory
+	Enabled    bool
+}
+
+// ToolRegistry holds every known tool and tracks which ones are sent to the model
+type ToolRegistry struct {
+	tools   []*registeredTool
+	byName  map[string]*registeredTool
+	profile string
+}
+
+// NewToolRegistry creates an empty registry
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		byName:  make(map[string]*registeredTool),
+		profile: "all",
+	}
+}
+
+// Register adds the tools of a package under one category. Tools are enabled
+// when registered; names must be unique across packages.
+func (r *ToolRegistry) Register(pkg string, category ToolCategory, tools ...ToolDefinition) error {
+	for _, tool := range tools {
+		if existing, ok := r.byName[tool.Name]; ok {
+			return fmt.Errorf("tool %s from package %s is already registered by package %s", tool.Name, pkg, existing.Package)
+		}
+		entry := &registeredTool{Definition: tool, Package: pkg, Category: category, Enabled: true}
+		r.tools = append(r.tools, entry)
+		r.byName[tool.Name] = entry
+	}
+	return nil
+}
+
+// Definitions returns every registered tool, enabled or not
+func (r *ToolRegistry) Definitions() []ToolDefinition {
+	tools := make([]ToolDefinition, 0, len(r.tools))
+	for _, entry := range r.tools {
+		tools = append(tools, entry.Definition)
+	}
+	return tools
+}
+
+// Tools returns the enabled tools in registration order
+func (r *ToolRegistry) Tools() []ToolDefinition {
+	var tools []ToolDefinition
+	for _, entry := range r.tools {
+		if entry.Enabled {
+			tools = append(tools, entry.Definition)
+		}
+	}
+	return tools
+}
+
+// Mutating reports whether the named tool can change files. Only tools in
+// the read, search and network categories are known not to.
+func (r *ToolRegistry) Mutating(name string) bool {
+	entry, ok := r.byName[name]
+	if !ok {
+		return false
+	}
+	switch entry.Category {
+	case CategoryRead, CategorySearch, CategoryNetwork:
+		return false
+	}
+	return true
+}
+
+// Lookup returns an enabled tool by name
+func (r *ToolRegistry) Lookup(name string) (ToolDefinition, bool) {
+	entry, ok := r.byName[name]
+	if !ok || !entry.Enabled {
+		return ToolDefinition{}, false
+	}
+	return entry.Definition, true
+}
+
+// match returns the tools selected by a selector: a tool name,
+// "package:<name>", "category:<name>" or "all"
+func (r *ToolRegistry) match(selector string) ([]*registeredTool, error) {
+	var matched []*registeredTool
+	kind, value, qualified := strings.Cut(selector, ":")
+	for _, entry := range r.tools {
+		switch {
+		case selector == "all" || selector == "*":
+			matched = append(matched, entry)
+		case qualified && kind == "package":
+			if entry.Package == value {
+				matched = append(matched, entry)
+			}
+		case qualified && kind == "category":
+			if string(entry.Category) == value {
+				matched = append(matched, entry)
+			}
+		case !qualified && entry.Definition.Name == selector:
+			matched = append(matched, entry)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no tools match %q", selector)
+	}
+	return matched, nil
+}
+
+// SetEnabled enables or disables the tools matched by the selectors and
+// returns how many tools changed state
+func (r *ToolRegistry) SetEnabled(enabled bool, selectors ...string) (int, error) {
+	var matched []*registeredTool
+	for _, selector := range selectors {
+		entries, err := r.match(selector)
+		if err != nil {
+			return 0, err
+		}
+		matched = append(matched, entries...)
+	}
+
+	changed := 0
+	for _, entry := range matched {
+		if entry.Enabled != enabled {
+			entry.Enabled = enabled
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// ApplyProfile enables exactly the tools whose category belongs to the profile;
+// later enable/disable calls adjust the selection without changing the profile
+func (r *ToolRegistry) ApplyProfile(name string) error {
+	if name == "all" {
+		for _, entry := range r.tools {
+			entry.Enabled = true
+		}
+		r.profile = name
+		return nil
+	}
+
+	categories, ok := toolProfiles[name]
+	if !ok {
+		return fmt.Errorf("unknown tool profile %q (available: %s)", name, strings.Join(ToolProfileNames(), ", "))
+	}
+	allowed := make(map[ToolCategory]bool, len(categories))
+	for _, category := range categories {
+		allowed[category] = true
+	}
+	for _, entry := range r.tools {
+		entry.Enabled = allowed[entry.Category]
+	}
+	r.profile = name
+	return nil
+}
+
+// Configure applies a profile and then the enable and disable lists. Every
+// entry that matches is applied; the errors of the others are returned
+// together.
+func (r *ToolRegistry) Configure(config *ToolsConfig) error {
+	if config == nil {
+		return nil
+	}
+	var errs []error
+	if config.Profile != "" {
+		if err := r.ApplyProfile(config.Profile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, selector := range config.Enable {
+		if _, err := r.SetEnabled(true, selector); err != nil {
+			errs = append(errs, fmt.Errorf("EVE_TOOLS_ENABLE: %w", err))
+		}
+	}
+	for _, selector := range config.Disable {
+		if _, err := r.SetEnabled(false, selector); err != nil {
+			errs = append(errs, fmt.Errorf("EVE_TOOLS_DISABLE: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Summary lists the registered tools grouped by package
+func (r *ToolRegistry) Summary() string {
+	var packages []string
+	byPackage := make(map[string][]*registeredTool)
+	enabled := 0
+	for _, entry := range r.tools {
+		if _, ok := byPackage[entry.Package]; !ok {
+			packages = append(packages, entry.Package)
+		}
+		byPackage[entry.Package] = append(byPackage[entry.Package], entry)
+		if entry.Enabled {
+			enabled++
+		}
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Profile: %s (%d of %d tools enabled)\n", r.profile, enabled, len(r.tools))
+	for _, pkg := range packages {
+		fmt.Fprintf(&result, "\n%s:\n", pkg)
+		for _, entry := range byPackage[pkg] {
+			mark := " "
+			if entry.Enabled {
+				mark = "x"
+			}
+			fmt.Fprintf(&result, "  [%s] %-26s %s\n", mark, entry.Definition.Name, entry.Category)
+		}
+	}
+	return strings.TrimRight(result.String(), "\n")
+}
+
+// ToolProfileNames returns the available profile names
+func ToolProfileNames() []string {
+	names := []string{"all"}
+	for name := range toolProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// registerBuiltinTools registers the tools compiled into EVE
+func registerBuiltinTools(r *ToolRegistry) error {
+	packages := []struct {
+		name     string
+		category ToolCategory
+		tools    []ToolDefinition
+	}{
+		{"files", CategoryRead, []ToolDefinition{ReadFileDefinition, ListFilesDefinition}},
+		{"shell", CategoryExec, []ToolDefinition{BashDefinition}},
+		{"edit", CategoryWrite, []ToolDefinition{EditFileDefinition, ApplyPatchDefinition, UndoEditsDefinition}},
+		{"search", CategorySearch, []ToolDefinition{CodeSearchDefinition, SemanticSearchDefinition}},
+		{"goindex", CategorySearch, []ToolDefinition{GoSymbolsDefinition, GoDefinitionDefinition, GoReferencesDefinition, GoImplementersDefinition}},
+		{"git", CategoryRead, []ToolDefinition{GitStatusDefinition, GitDiffDefinition, GitLogDefinition, GitBlameDefinition}},
+		{"git", CategoryWrite, []ToolDefinition{GitCreateBranchDefinition, GitCommitDefinition}},
+		{"web", CategoryNetwork, []ToolDefinition{APICallDefinition, WebScraperDefinition}},
+		{"project", CategoryProject, []ToolDefinition{
+			SaveToDatabaseDefinition,
+			FileHistoryDefinition,
+			CreateCheckpointDefinition,
+			RestoreCheckpointDefinition,
+			ListCheckpointsDefinition,
+			DiffCheckpointsDefinition,
+			AddMCPIntegrationDefinition,
+			RecordMultiplayerActionDefinition,
+			BackupProjectDefinition,
+		}},
+		{"project", CategoryRead, []ToolDefinition{QueryProjectDataDefinition}},
+	}
+	for _, pkg := range packages {
+		if err := r.Register(pkg.name, pkg.category, pkg.tools...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// registry_test.go - Tool registration, selectors, profiles and enable/disable
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestRegistry registers one tool per category
+func newTestRegistry(t *testing.T) *ToolRegistry {
+	t.Helper()
+	var calls []string
+	r := NewToolRegistry()
+	tools := []struct {
+		pkg      string
+		category ToolCategory
+		name     string
+	}{
+		{"files", CategoryRead, "read"},
+		{"search", CategorySearch, "grep"},
+		{"edit", CategoryWrite, "edit"},
+		{"shell", CategoryExec, "bash"},
+		{"web", CategoryNetwork, "fetch"},
+		{"project", CategoryProject, "checkpoint"},
+		{"custom", CategoryCustom, "deploy"},
+	}
+	for _, tool := range tools {
+		if err := r.Register(tool.pkg, tool.category, testRegistryTool(tool.name, &calls)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+// enabledToolNames lists the names of the enabled tools in registration order
+func enabledToolNames(r *ToolRegistry) []string {
+	var names []string
+	for _, tool := range r.Tools() {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := newTestRegistry(t)
+	var calls []string
+	err := r.Register("other", CategoryRead, testRegistryTool("bash", &calls))
+	if err == nil || !strings.Contains(err.Error(), "already registered by package shell") {
+		t.Fatalf("duplicate registration = %v", err)
+	}
+	if len(r.Definitions()) != 7 || len(r.Tools()) != 7 {
+		t.Fatalf("%d tools registered, %d enabled", len(r.Definitions()), len(r.Tools()))
+	}
+
+	for name, want := range map[string]bool{"read": false, "grep": false, "fetch": false, "edit": true, "bash": true, "deploy": true, "missing": false} {
+		if got := r.Mutating(name); got != want {
+			t.Errorf("Mutating(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestRegistryProfiles(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    []string
+	}{
+		{"read-only", []string{"read", "grep"}},
+		{"researcher", []string{"read", "grep", "fetch"}},
+		{"coder", []string{"read", "grep", "edit", "bash", "checkpoint", "deploy"}},
+		{"all", []string{"read", "grep", "edit", "bash", "fetch", "checkpoint", "deploy"}},
+	}
+	r := newTestRegistry(t)
+	for _, tt := range tests {
+		if err := r.ApplyProfile(tt.profile); err != nil {
+			t.Fatalf("%s: %v", tt.profile, err)
+		}
+		if got := enabledToolNames(r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: enabled %v, want %v", tt.profile, got, tt.want)
+		}
+		if !strings.HasPrefix(r.Summary(), "Profile: "+tt.profile+" ") {
+			t.Errorf("%s: summary:\n%s", tt.profile, r.Summary())
+		}
+	}
+
+	if err := r.ApplyProfile("admin"); err == nil || !strings.Contains(err.Error(), "available: all, coder, read-only, researcher") {
+		t.Fatalf("unknown profile = %v", err)
+	}
+	if _, ok := r.Lookup("fetch"); !ok {
+		t.Fatal("an unknown profile changed the enabled tools")
+	}
+}
+
+func TestRegistrySetEnabled(t *testing.T) {
+	r := newTestRegistry(t)
+	if err := r.ApplyProfile("read-only"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		enabled   bool
+		selectors []string
+		changed   int
+		want      []string
+	}{
+		{"tool", true, []string{"bash"}, 1, []string{"read", "grep", "bash"}},
+		{"already enabled", true, []string{"bash", "read"}, 0, []string{"read", "grep", "bash"}},
+		{"package", true, []string{"package:web"}, 1, []string{"read", "grep", "bash", "fetch"}},
+		{"category", false, []string{"category:search", "category:exec"}, 2, []string{"read", "fetch"}},
+		{"all", true, []string{"all"}, 5, []string{"read", "grep", "edit", "bash", "fetch", "checkpoint", "deploy"}},
+	}
+	for _, tt := range tests {
+		changed, err := r.SetEnabled(tt.enabled, tt.selectors...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := enabledToolNames(r); changed != tt.changed || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %d changed, enabled %v; want %d, %v", tt.name, changed, got, tt.changed, tt.want)
+		}
+	}
+
+	// A selector that matches nothing fails without applying the others
+	if _, err := r.SetEnabled(false, "bash", "package:missing"); err == nil || !strings.Contains(err.Error(), `no tools match "package:missing"`) {
+		t.Fatalf("unmatched selector = %v", err)
+	}
+	if _, ok := r.Lookup("bash"); !ok {
+		t.Fatal("a failed SetEnabled disabled a tool")
+	}
+
+	if _, err := r.SetEnabled(false, "bash"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Lookup("bash"); ok {
+		t.Fatal("Lookup returned a disabled tool")
+	}
+	if len(r.Definitions()) != 7 {
+		t.Fatal("Definitions left out a disabled tool")
+	}
+	if !strings.Contains(r.Summary(), "[ ] bash") || !strings.Contains(r.Summary(), "[x] read") {
+		t.Fatalf("summary:\n%s", r.Summary())
+	}
+}
+
+func TestRegistryConfigure(t *testing.T) {
+	r := newTestRegistry(t)
+	err := r.Configure(&ToolsConfig{
+		Profile: "read-only",
+		Enable:  []string{"category:exec", "nosuchtool"},
+		Disable: []string{"grep"},
+	})
+	if err == nil || !strings.Contains(err.Error(), `EVE_TOOLS_ENABLE: no tools match "nosuchtool"`) {
+		t.Fatalf("Configure error = %v", err)
+	}
+
+	// The entries that matched are still applied
+	if got, want := enabledToolNames(r), []string{"read", "bash"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("enabled %v, want %v", got, want)
+	}
+	if err := r.Configure(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterBuiltinTools(t *testing.T) {
+	r := NewToolRegistry()
+	if err := registerBuiltinTools(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ApplyProfile("read-only"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tool := range r.Tools() {
+		if r.Mutating(tool.Name) {
+			t.Errorf("read-only profile enables %s, which can change files", tool.Name)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// repomap.go - Compact repository map sent to the model as a system prompt
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// repoMapDefaultTokens is the default token budget for the repository map
+	repoMapDefaultTokens = 2000
+	// repoMapCharsPerToken approximates tokens from text length
+	repoMapCharsPerToken = 4
+	// repoMapMaxSymbolsPerFile caps the symbols listed for a single file
+	repoMapMaxSymbolsPerFile = 10
+	// repoMapMaxSymbolLen shortens long declarations
+	repoMapMaxSymbolLen = 100
+	// repoMapMaxTreeDepth limits the directory tree section
+	repoMapMaxTreeDepth = 3
+)
+
+// repoMapSymbolPatterns find top-level declarations in languages other than
+// Go, which is handled by the Go symbol index
+var repoMapSymbolPatterns = map[string][]*regexp.Regexp{
+	".py": {regexp.MustCompile(`^(?:async\s+)?(?:def|class)\s+\w+.*`)},
+	".js": {regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?(?:function\*?|class)\s+\w+.*`),
+		regexp.MustCompile(`^export\s+(?:const|let)\s+\w+.*`)},
+	".ts": {regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?(?:async\s+)?(?:function\*?|class|interface|type|enum)\s+\w+.*`),
+		regexp.MustCompile(`^export\s+(?:const|let)\s+\w+.*`)},
+	".rs":   {regexp.MustCompile(`^(?:pub(?:\([\w:]+\))?\s+)?(?:async\s+)?(?:fn|struct|enum|trait|impl|mod|type)\b.*`)},
+	".java": {regexp.MustCompile(`^\s{0,4}(?:public|protected|private)?\s*(?:abstract\s+|final\s+|static\s+)*(?:class|interface|enum|record)\s+\w+.*`)},
+	".rb":   {regexp.MustCompile(`^\s{0,2}(?:class|module|def)\s+\S+.*`)},
+	".nix":  {regexp.MustCompile(`^\s{0,2}[\w-]+\s*=\s*(?:\{|rec\s*\{|pkgs\.|\w+:).*`)},
+}
+
+func init() {
+	repoMapSymbolPatterns[".jsx"] = repoMapSymbolPatterns[".js"]
+	repoMapSymbolPatterns[".mjs"] = repoMapSymbolPatterns[".js"]
+	repoMapSymbolPatterns[".tsx"] = repoMapSymbolPatterns[".ts"]
+}
+
+// repoMapImportantFiles are ranked first because they explain a project
+var repoMapImportantFiles = map[string]bool{
+	"readme.md": true, "readme": true, "go.mod": true, "package.json": true,
+	"cargo.toml": true, "pyproject.toml": true, "flake.nix": true, "makefile": true,
+	"main.go": true, "claude.md": true, "agents.md": true,
+}
+
+// repoMapFile is a file considered for the map
+type repoMapFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Symbols []string
+	Score   float64
+}
+
+var (
+	repoMapMu          sync.Mutex
+	repoMapFingerprint string
+	repoMapText        string
+)
+
+// repoMapBudget returns the token budget from EVE_REPO_MAP_TOKENS; 0 disables the map
+func repoMapBudget() int {
+	if value := os.Getenv("EVE_REPO_MAP_TOKENS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return repoMapDefaultTokens
+}
+
+// RepositoryMap returns the map for root, regenerating it only when a file
+// was added, removed or modified since the last call
+func RepositoryMap(root string, budget int) (string, error) {
+	if budget <= 0 {
+		return "", nil
+	}
+
+	repoMapMu.Lock()
+	defer repoMapMu.Unlock()
+
+	var files []*repoMapFile
+	var fp strings.Builder
+	err := walkIgnoring(root, false, func(relPath string, d fs.DirEntry) error {
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		files = append(files, &repoMapFile{Path: relPath, Size: info.Size(), ModTime: info.ModTime()})
+		fmt.Fprintf(&fp, "%s:%d:%d;", relPath, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	fingerprint := fmt.Sprintf("%s|%d|%s", root, budget, fp.String())
+	if fingerprint == repoMapFingerprint {
+		return repoMapText, nil
+	}
+
+	refs := repoMapGoSymbols(root, files)
+	repoMapOtherSymbols(root, files)
+	rankRepoMapFiles(files, refs)
+
+	repoMapFingerprint = fingerprint
+	repoMapText = renderRepoMap(files, budget)
+	log.Printf("Generated repository map for %d files (%d chars)", len(files), len(repoMapText))
+	return repoMapText, nil
+}
+
+// repoMapGoSymbols fills in symbols for Go files from the Go index and returns
+// how often each file's declarations are used from other files
+func repoMapGoSymbols(root string, files []*repoMapFile) map[string]int {
+	refs := map[string]int{}
+	hasGo := false
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, ".go") {
+			hasGo = true
+			break
+		}
+	}
+	if !hasGo {
+		return refs
+	}
+
+	idx, err := loadGoIndex(root)
+	if err != nil {
+		log.Printf("Repository map: failed to index Go code: %v", err)
+		return refs
+	}
+
+	byFile := map[string][]*goSymbol{}
+	for _, sym := range idx.symbols {
+		byFile[sym.File] = append(byFile[sym.File], sym)
+	}
+	for _, f := range files {
+		syms := byFile[f.Path]
+		sort.SliceStable(syms, func(i, j int) bool {
+			return repoMapGoPriority(syms[i]) < repoMapGoPriority(syms[j])
+		})
+		for _, sym := range syms {
+			if (sym.Kind == "var" || sym.Kind == "const") && !token.IsExported(sym.Name) {
+				continue
+			}
+			f.Symbols = append(f.Symbols, repoMapGoSymbol(sym))
+		}
+	}
+
+	for _, pkg := range idx.packages {
+		for ident, obj := range pkg.info.Uses {
+			if obj == nil || obj.Pkg() != pkg.types || !obj.Pos().IsValid() {
+				continue
+			}
+			if _, isField := obj.(*types.Var); isField && obj.Parent() != pkg.types.Scope() {
+				continue
+			}
+			def, use := idx.fset.Position(obj.Pos()), idx.fset.Position(ident.Pos())
+			if def.Filename != use.Filename {
+				refs[idx.relPath(def.Filename)]++
+			}
+		}
+	}
+	return refs
+}
+
+// repoMapGoPriority orders a file's symbols: exported before unexported,
+// then types, functions, methods and values
+func repoMapGoPriority(sym *goSymbol) int {
+	priority := map[string]int{"interface": 0, "type": 0, "func": 1, "method": 2}[sym.Kind]
+	if sym.Kind == "var" || sym.Kind == "const" {
+		priority = 3
+	}
+	if !token.IsExported(sym.Name) {
+		priority += 4
+	}
+	return priority
+}
+
+// repoMapGoSymbol renders the first line of a Go declaration
+func repoMapGoSymbol(sym *goSymbol) string {
+	line, _, _ := strings.Cut(sym.Signature, "\n")
+	line = strings.TrimSuffix(strings.TrimSpace(line), "{")
+	line = strings.TrimSpace(line)
+	if sym.Kind == "var" || sym.Kind == "const" {
+		// Values are shown by name only; initializers are rarely useful
+		line = sym.Kind + " " + sym.Name
+	}
+	return truncateUTF8(line, repoMapMaxSymbolLen)
+}
+
+// repoMapOtherSymbols extracts declarations from non-Go source files
+func repoMapOtherSymbols(root string, files []*repoMapFile) {
+	for _, f := range files {
+		patterns := repoMapSymbolPatterns[strings.ToLower(path.Ext(f.Path))]
+		if patterns == nil || f.Size > searchMaxFileSize {
+			continue
+		}
+		lines, _, ok := readTextLines(filepath.Join(root, filepath.FromSlash(f.Path)))
+		if !ok {
+			continue
+		}
+		for _, line := range lines {
+			for _, re := range patterns {
+				if match := re.FindString(strings.TrimRight(line, "\r")); match != "" {
+					match = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(match), "{"))
+					match = strings.TrimSuffix(match, ":")
+					f.Symbols = append(f.Symbols, truncateUTF8(match, repoMapMaxSymbolLen))
+					break
+				}
+			}
+		}
+	}
+}
+
+// rankRepoMapFiles orders files by how central they are likely to be: files
+// used from elsewhere, well-known entry points, shallow paths and recently
+// modified files come first
+func rankRepoMapFiles(files []*repoMapFile, refs map[string]int) {
+	now := time.Now()
+	for _, f := range files {
+		score := float64(refs[f.Path])
+		score += 0.2 * float64(min(len(f.Symbols), 50))
+		if repoMapImportantFiles[strings.ToLower(path.Base(f.Path))] {
+			score += 20
+		}
+		score -= 0.5 * float64(strings.Count(f.Path, "/"))
+		if age := now.Sub(f.ModTime); age < 24*time.Hour {
+			score += 5
+		} else if age < 7*24*time.Hour {
+			score += 2
+		}
+		if len(f.Symbols) == 0 {
+			score -= 5
+		}
+		f.Score = score
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Score != files[j].Score {
+			return files[i].Score > files[j].Score
+		}
+		return files[i].Path < files[j].Path
+	})
+}
+
+// renderRepoMap writes the directory tree and as many ranked files as fit in
+// the token budget
+func renderRepoMap(files []*repoMapFile, budget int) string {
+	maxChars := budget * repoMapCharsPerToken
+
+	var sb strings.Builder
+	sb.WriteString("Repository map (directories with file counts, then files ranked by relevance with their top-level symbols):\n\n")
+	sb.WriteString(renderRepoMapTree(files, maxChars/4))
+	sb.WriteString("\n")
+
+	omitted := 0
+	for _, f := range files {
+		var entry strings.Builder
+		entry.WriteString(f.Path + "\n")
+		for i, sym := range f.Symbols {
+			if i == repoMapMaxSymbolsPerFile {
+				fmt.Fprintf(&entry, "  ... %d more\n", len(f.Symbols)-i)
+				break
+			}
+			entry.WriteString("  " + sym + "\n")
+		}
+		if sb.Len()+entry.Len() > maxChars {
+			omitted++
+			continue
+		}
+		sb.WriteString(entry.String())
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&sb, "[%d more files not shown; use list_files or code_search to explore]\n", omitted)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// renderRepoMapTree lists directories up to repoMapMaxTreeDepth with the
+// number of files below each, truncated to maxChars
+func renderRepoMapTree(files []*repoMapFile, maxChars int) string {
+	counts := map[string]int{}
+	for _, f := range files {
+		for dir := path.Dir(f.Path); dir != "."; dir = path.Dir(dir) {
+			counts[dir]++
+		}
+	}
+	dirs := make([]string, 0, len(counts))
+	for dir := range counts {
+		if strings.Count(dir, "/") < repoMapMaxTreeDepth {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "./ (%d files)\n", len(files))
+	for i, dir := range dirs {
+		line := fmt.Sprintf("%s%s/ (%d files)\n", strings.Repeat("  ", strings.Count(dir, "/")+1), path.Base(dir), counts[dir])
+		if sb.Len()+len(line) > maxChars {
+			fmt.Fprintf(&sb, "  [%d more directories]\n", len(dirs)-i)
+			break
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// withSystemPrompt prepends the system prompt, including the current
+// repository map, to the conversation sent to the provider. The map is not
+// stored in the conversation, so it is always current. It is built once per
+// user turn and again only after a tool changed files, not for every request.
+func (a *GenericAgent) withSystemPrompt(conversation []Message) []Message {
+	if !a.repoMapValid {
+		repoMap, err := RepositoryMap(".", repoMapBudget())
+		if err != nil && a.verbose {
+			log.Printf("Failed to build repository map: %v", err)
+		}
+		a.repoMap, a.repoMapValid = repoMap, true
+	}
+	if a.repoMap == "" {
+		return conversation
+	}
+
+	messages := make([]Message, 0, len(conversation)+1)
+	messages = append(messages, Message{Role: "system", Content: a.repoMap})
+	return append(messages, conversation...)
+}
@@ -0,0 +1,583 @@
+// scraper.go - Page fetching, caching and HTML-to-Markdown conversion for web_scraper
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	// webMaxPageBytes caps how much of a page is downloaded
+	webMaxPageBytes = 2 * 1024 * 1024
+	// webDefaultMaxChars caps the text returned to the model
+	webDefaultMaxChars = 40000
+	// webCacheTTL is how long a fetched page is served from the cache
+	webCacheTTL = 15 * time.Minute
+	// webUserAgent identifies the scraper to servers
+	webUserAgent = "eve-web-scraper/1.0"
+)
+
+// webNoiseSelector matches page chrome that is never part of the readable content
+const webNoiseSelector = "script, style, noscript, template, iframe, svg, canvas, form, button, " +
+	"input, select, nav, aside, body > header, body > footer, [role=navigation], [aria-hidden=true]"
+
+// webNoiseClass matches class or id values of boilerplate containers
+var webNoiseClass = regexp.MustCompile(`(?i)\b(sidebar|advert|ads|cookie|banner|promo|share|social|comments?|related|newsletter|breadcrumbs?)\b`)
+
+// webPage is a fetched page, as stored in the cache
+type webPage struct {
+	URL         string    `json:"url"`
+	FinalURL    string    `json:"final_url"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	Truncated   bool      `json:"truncated"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// fetchPage downloads a page through the HTTP policy, serving it from the
+// on-disk cache when a fresh copy exists
+func fetchPage(rawURL string, timeoutSeconds int, useCache bool) (*webPage, bool, error) {
+	if useCache && globalDB != nil {
+		var cached webPage
+		if ok, err := globalDB.GetWebCache(rawURL, &cached); err == nil && ok && time.Since(cached.FetchedAt) < webCacheTTL {
+			return &cached, true, nil
+		}
+	}
+
+	cfg := globalHTTPConfig
+	timeout := cfg.requestTimeout(timeoutSeconds)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := newPolicyRequest(ctx, cfg, http.MethodGet, rawURL, nil, map[string]string{
+		"User-Agent": webUserAgent,
+		"Accept":     "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.5",
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := cfg.Client(timeout).Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, false, fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
+	}
+	body, truncated, err := readLimited(resp.Body, webMaxPageBytes)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", rawURL, err)
+	}
+
+	page := &webPage{
+		URL:         rawURL,
+		FinalURL:    resp.Request.URL.String(),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        body,
+		Truncated:   truncated,
+		FetchedAt:   time.Now(),
+	}
+	if globalDB != nil {
+		if err := globalDB.SaveWebCache(rawURL, page); err != nil {
+			log.Printf("Failed to cache %s: %v", rawURL, err)
+		}
+	}
+	return page, false, nil
+}
+
+// isHTML reports whether a page should be parsed as HTML
+func (p *webPage) isHTML() bool {
+	mediaType, _, _ := mime.ParseMediaType(p.ContentType)
+	if mediaType == "" {
+		return strings.Contains(http.DetectContentType(p.Body), "html")
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// readableContent strips page chrome and returns the element most likely to
+// hold the main content: an article or main element, or else the container
+// with the most paragraph text
+func readableContent(doc *goquery.Document) *goquery.Selection {
+	doc.Find(webNoiseSelector).Remove()
+	doc.Find("div, section, ul, header, footer").Each(func(_ int, s *goquery.Selection) {
+		if webNoiseClass.MatchString(s.AttrOr("class", "") + " " + s.AttrOr("id", "")) {
+			s.Remove()
+		}
+	})
+
+	for _, selector := range []string{"article", "main", "[role=main]"} {
+		if s := doc.Find(selector); s.Length() > 0 {
+			best := s.First()
+			s.Each(func(_ int, candidate *goquery.Selection) {
+				if len(candidate.Text()) > len(best.Text()) {
+					best = candidate
+				}
+			})
+			return best
+		}
+	}
+
+	scores := map[*html.Node]int{}
+	var best *html.Node
+	doc.Find("p, pre, li, td").Each(func(_ int, s *goquery.Selection) {
+		length := len(strings.TrimSpace(s.Text()))
+		parent := s.Parent()
+		if parent.Length() == 0 {
+			return
+		}
+		node := parent.Nodes[0]
+		scores[node] += length
+		if best == nil || scores[node] > scores[best] {
+			best = node
+		}
+		if grandparent := parent.Parent(); grandparent.Length() > 0 {
+			scores[grandparent.Nodes[0]] += length / 2
+		}
+	})
+	if best != nil && scores[best] >= 200 {
+		return goquery.NewDocumentFromNode(best).Selection
+	}
+	return doc.Find("body")
+}
+
+// pageLinks returns the unique absolute links in sel as a Markdown list
+func pageLinks(sel *goquery.Selection, base *url.URL) string {
+	var sb strings.Builder
+	seen := map[string]bool{}
+	sel.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		href := resolveLink(base, a.AttrOr("href", ""))
+		if href == "" || seen[href] {
+			return
+		}
+		seen[href] = true
+		text := strings.Join(strings.Fields(a.Text()), " ")
+		if text == "" {
+			text = a.AttrOr("title", href)
+		}
+		fmt.Fprintf(&sb, "- [%s](%s)\n", escapeMarkdownText(text), href)
+	})
+	return sb.String()
+}
+
+// resolveLink makes href absolute. Fragment-only and script links are dropped.
+func resolveLink(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	return u.String()
+}
+
+// escapeMarkdownText escapes the characters that would break link text
+func escapeMarkdownText(text string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`).Replace(text)
+}
+
+// htmlToMarkdown converts the nodes of sel to Markdown, resolving relative
+// links and images against base
+func htmlToMarkdown(sel *goquery.Selection, base *url.URL) string {
+	w := &markdownWriter{base: base, lineStart: true}
+	for _, node := range sel.Nodes {
+		w.node(node)
+	}
+	return strings.TrimSpace(w.sb.String())
+}
+
+// markdownWriter streams Markdown while tracking line starts, so nested
+// lists and block quotes can prefix every line they contain
+type markdownWriter struct {
+	sb           strings.Builder
+	base         *url.URL
+	prefixes     []string // indentation or "> " for each open list item or quote
+	marker       string   // list marker replacing the innermost prefix on the next line
+	lineStart    bool
+	newlines     int // newlines at the end of the output
+	pendingSpace bool
+}
+
+// startLine writes the line prefixes if a new line is beginning
+func (w *markdownWriter) startLine() {
+	if !w.lineStart {
+		return
+	}
+	prefix := strings.Join(w.prefixes, "")
+	if w.marker != "" && len(w.prefixes) > 0 {
+		prefix = strings.Join(w.prefixes[:len(w.prefixes)-1], "") + w.marker
+		w.marker = ""
+	}
+	w.sb.WriteString(prefix)
+	w.lineStart = false
+	w.newlines = 0
+}
+
+// text writes inline text with whitespace collapsed
+func (w *markdownWriter) text(s string) {
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			if !w.lineStart {
+				w.pendingSpace = true
+			}
+			continue
+		}
+		if w.lineStart {
+			w.startLine()
+		} else if w.pendingSpace {
+			w.sb.WriteByte(' ')
+		}
+		w.pendingSpace = false
+		w.sb.WriteRune(r)
+	}
+}
+
+// open writes markup that begins an inline span, such as "**" or "["
+func (w *markdownWriter) open(s string) {
+	if w.lineStart {
+		w.startLine()
+	} else if w.pendingSpace {
+		w.sb.WriteByte(' ')
+	}
+	w.pendingSpace = false
+	w.sb.WriteString(s)
+}
+
+// close writes markup that ends an inline span; a pending space stays pending
+// so the span does not end in whitespace
+func (w *markdownWriter) close(s string) {
+	if w.lineStart {
+		w.startLine()
+	}
+	w.sb.WriteString(s)
+}
+
+// newline ends the current line and ensures at least count line breaks
+func (w *markdownWriter) newline(count int) {
+	if w.sb.Len() == 0 {
+		return
+	}
+	w.pendingSpace = false
+	for w.newlines < count {
+		if w.newlines > 0 {
+			// Blank lines inside quotes keep the quote marker
+			w.sb.WriteString(strings.TrimRight(strings.Join(w.prefixes, ""), " "))
+		}
+		w.sb.WriteByte('\n')
+		w.newlines++
+	}
+	w.lineStart = true
+}
+
+// rawLines writes preformatted text line by line with the current prefixes
+func (w *markdownWriter) rawLines(s string) {
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		w.lineStart = true
+		w.startLine()
+		w.sb.WriteString(strings.TrimRight(line, " \t\r"))
+		w.sb.WriteByte('\n')
+		w.newlines = 1
+	}
+	w.lineStart = true
+}
+
+// children converts the children of n
+func (w *markdownWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+// node converts one HTML node
+func (w *markdownWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		w.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "script", "style", "noscript", "template", "head", "svg", "iframe", "button", "form":
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.Data[1:])
+		w.newline(2)
+		w.open(strings.Repeat("#", level) + " ")
+		w.children(n)
+		w.newline(2)
+	case "p", "div", "section", "article", "main", "header", "footer", "figure", "figcaption", "dl", "details", "summary":
+		w.newline(2)
+		w.children(n)
+		w.newline(2)
+	case "dt", "dd":
+		w.newline(1)
+		w.children(n)
+		w.newline(1)
+	case "br":
+		w.newline(1)
+	case "hr":
+		w.newline(2)
+		w.open("---")
+		w.newline(2)
+	case "strong", "b":
+		w.inline(n, "**")
+	case "em", "i":
+		w.inline(n, "*")
+	case "del", "s":
+		w.inline(n, "~~")
+	case "code", "kbd", "samp":
+		text := nodeText(n)
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		opening, closing := "`", "`"
+		if strings.Contains(text, "`") {
+			opening, closing = "`` ", " ``"
+		}
+		w.open(opening)
+		w.sb.WriteString(strings.Join(strings.Fields(text), " "))
+		w.close(closing)
+	case "pre":
+		w.newline(2)
+		w.open("```" + codeLanguage(n))
+		w.newline(1)
+		w.rawLines(nodeText(n))
+		w.open("```")
+		w.newline(2)
+	case "a":
+		w.link(n)
+	case "img":
+		src := resolveLink(w.base, attr(n, "src"))
+		if src != "" {
+			w.open("![" + escapeMarkdownText(attr(n, "alt")) + "](" + src + ")")
+		}
+	case "ul", "ol":
+		w.list(n)
+	case "blockquote":
+		w.newline(2)
+		w.prefixes = append(w.prefixes, "> ")
+		w.children(n)
+		w.newline(1)
+		w.prefixes = w.prefixes[:len(w.prefixes)-1]
+		w.newline(2)
+	case "table":
+		w.table(n)
+	default:
+		w.children(n)
+	}
+}
+
+// inline wraps the children of n in a Markdown emphasis marker
+func (w *markdownWriter) inline(n *html.Node, marker string) {
+	if strings.TrimSpace(nodeText(n)) == "" {
+		w.children(n)
+		return
+	}
+	w.open(marker)
+	w.children(n)
+	w.close(marker)
+}
+
+// link writes an anchor as [text](url), or just its text for unusable links
+func (w *markdownWriter) link(n *html.Node) {
+	href := resolveLink(w.base, attr(n, "href"))
+	if href == "" {
+		w.children(n)
+		return
+	}
+	if strings.TrimSpace(nodeText(n)) == "" && !hasDescendant(n, "img") {
+		return
+	}
+	w.open("[")
+	w.children(n)
+	w.close("](" + href + ")")
+}
+
+// list writes an ordered or unordered list, indenting nested content
+func (w *markdownWriter) list(n *html.Node) {
+	w.newline(1)
+	if len(w.prefixes) == 0 {
+		w.newline(2)
+	}
+	index := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		index = start
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = strconv.Itoa(index) + ". "
+			index++
+		}
+		w.newline(1)
+		w.prefixes = append(w.prefixes, strings.Repeat(" ", len(marker)))
+		w.marker = marker
+		w.children(c)
+		w.newline(1)
+		w.marker = ""
+		w.prefixes = w.prefixes[:len(w.prefixes)-1]
+	}
+	if len(w.prefixes) == 0 {
+		w.newline(2)
+	}
+}
+
+// table writes a GitHub-flavored Markdown table; the first row is the header
+func (w *markdownWriter) table(n *html.Node) {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "thead", "tbody", "tfoot":
+				walk(c)
+			case "tr":
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						sub := &markdownWriter{base: w.base, lineStart: true}
+						sub.children(cell)
+						text := strings.Join(strings.Fields(sub.sb.String()), " ")
+						row = append(row, strings.ReplaceAll(text, "|", `\|`))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	w.newline(2)
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		w.lineStart = true
+		w.startLine()
+		w.sb.WriteString("| " + strings.Join(row, " | ") + " |")
+		w.newlines = 0
+		w.newline(1)
+		if i == 0 {
+			w.startLine()
+			w.sb.WriteString("|" + strings.Repeat(" --- |", columns))
+			w.newlines = 0
+			w.newline(1)
+		}
+	}
+	w.newline(2)
+}
+
+// codeLanguage reads a language-xxx or lang-xxx class from a pre or its code child
+func codeLanguage(n *html.Node) string {
+	classes := attr(n, "class")
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "code" {
+			classes += " " + attr(c, "class")
+		}
+	}
+	for _, class := range strings.Fields(classes) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if strings.HasPrefix(class, prefix) {
+				return strings.TrimPrefix(class, prefix)
+			}
+		}
+	}
+	return ""
+}
+
+// nodeText returns the raw text content of n
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			sb.WriteString(node.Data)
+		}
+		if node.Type == html.ElementNode && node.Data == "br" {
+			sb.WriteByte('\n')
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// hasDescendant reports whether n contains an element named tag
+func hasDescendant(n *html.Node, tag string) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if (c.Type == html.ElementNode && c.Data == tag) || hasDescendant(c, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// attr returns the value of an attribute of n
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// collapseBlankLines removes trailing spaces and runs of blank lines
+func collapseBlankLines(text string) string {
+	lines := strings.Split(text, "\n")
+	var out []string
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
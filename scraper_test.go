@@ -0,0 +1,195 @@
+// scraper_test.go - web_scraper tests against local httptest fixtures
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const scraperFixturePage = `<!DOCTYPE html>
+<html>
+<head><title>Fixture Page</title><style>body { color: red; }</style></head>
+<body>
+<header><a href="/">Home</a> <a href="/about">About</a></header>
+<nav><ul><li><a href="/nav">Navigation</a></li></ul></nav>
+<article>
+  <h1>Getting   Started</h1>
+  <p>Install the <strong>tool</strong> and read the <a href="/docs/guide.html">guide</a>.</p>
+  <pre><code class="language-go">func main() {
+	fmt.Println("hi")
+}</code></pre>
+  <ul>
+    <li>First item</li>
+    <li>Second item
+      <ol><li>Nested</li></ol>
+    </li>
+  </ul>
+  <table>
+    <tr><th>Name</th><th>Value</th></tr>
+    <tr><td>alpha</td><td>1 | 2</td></tr>
+  </table>
+  <img src="img/logo.png" alt="Logo">
+</article>
+<div class="sidebar"><p>Buy now</p></div>
+<script>alert("x")</script>
+<footer>Copyright</footer>
+</body>
+</html>`
+
+// newScraperFixture serves the fixture pages and isolates the cache
+func newScraperFixture(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	db, err := NewProjectDatabase(filepath.Join(t.TempDir(), "eve_project.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	previousDB := globalDB
+	globalDB = db
+	t.Cleanup(func() { globalDB = previousDB })
+
+	var hits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(scraperFixturePage))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><p>" + strings.Repeat("x", webMaxPageBytes+1000) + "</p></body></html>"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+		w.Write([]byte("<p>late</p>"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+// scrape runs the web_scraper tool with the given input
+func scrape(t *testing.T, input map[string]interface{}) (string, error) {
+	t.Helper()
+	data, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WebScraper(data)
+}
+
+func TestWebScraperMarkdown(t *testing.T) {
+	server, _ := newScraperFixture(t)
+
+	out, err := scrape(t, map[string]interface{}{"url": server.URL + "/page"})
+	if err != nil {
+		t.Fatalf("WebScraper failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"Title: Fixture Page",
+		"# Getting Started",
+		"Install the **tool** and read the [guide](" + server.URL + "/docs/guide.html).",
+		"```go\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n```",
+		"- First item",
+		"- Second item\n  1. Nested",
+		"| Name | Value |\n| --- | --- |\n| alpha | 1 \\| 2 |",
+		"![Logo](" + server.URL + "/img/logo.png)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"Navigation", "Buy now", "alert", "Copyright", "color: red"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output should not contain %q:\n%s", unwanted, out)
+		}
+	}
+}
+
+func TestWebScraperSelectorModes(t *testing.T) {
+	server, _ := newScraperFixture(t)
+
+	out, err := scrape(t, map[string]interface{}{"url": server.URL + "/page", "selector": "h1"})
+	if err != nil {
+		t.Fatalf("text mode failed: %v", err)
+	}
+	if !strings.HasSuffix(out, "Getting   Started") {
+		t.Errorf("text mode returned %q", out)
+	}
+
+	out, err = scrape(t, map[string]interface{}{"url": server.URL + "/page", "selector": "a", "attribute": "href"})
+	if err != nil {
+		t.Fatalf("attribute mode failed: %v", err)
+	}
+	if !strings.Contains(out, server.URL+"/about\n") || !strings.Contains(out, server.URL+"/docs/guide.html") {
+		t.Errorf("attribute mode returned %q", out)
+	}
+
+	out, err = scrape(t, map[string]interface{}{"url": server.URL + "/page", "mode": "links"})
+	if err != nil {
+		t.Fatalf("links mode failed: %v", err)
+	}
+	if !strings.Contains(out, "- [About]("+server.URL+"/about)") || strings.Count(out, "/about)") != 1 {
+		t.Errorf("links mode returned %q", out)
+	}
+
+	out, err = scrape(t, map[string]interface{}{"url": server.URL + "/page", "selector": ".does-not-exist"})
+	if err != nil || !strings.Contains(out, "No elements match") {
+		t.Errorf("unmatched selector returned %q, %v", out, err)
+	}
+
+	if _, err := scrape(t, map[string]interface{}{"url": server.URL + "/page", "attribute": "href"}); err == nil {
+		t.Error("attribute without selector should fail")
+	}
+}
+
+func TestWebScraperCache(t *testing.T) {
+	server, hits := newScraperFixture(t)
+
+	for i := 0; i < 2; i++ {
+		out, err := scrape(t, map[string]interface{}{"url": server.URL + "/page", "selector": "h1"})
+		if err != nil {
+			t.Fatalf("fetch %d failed: %v", i, err)
+		}
+		if cached := strings.Contains(out, "(cached"); cached != (i == 1) {
+			t.Errorf("fetch %d: cached=%v, output %q", i, cached, out)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected 1 request with caching, got %d", hits.Load())
+	}
+
+	if _, err := scrape(t, map[string]interface{}{"url": server.URL + "/page", "selector": "h1", "no_cache": true}); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("no_cache should refetch, got %d requests", hits.Load())
+	}
+}
+
+func TestWebScraperLimits(t *testing.T) {
+	server, _ := newScraperFixture(t)
+
+	out, err := scrape(t, map[string]interface{}{"url": server.URL + "/large", "max_chars": 100})
+	if err != nil {
+		t.Fatalf("large page failed: %v", err)
+	}
+	if !strings.Contains(out, "[page truncated at") || !strings.Contains(out, "[output truncated at 100 characters") {
+		t.Errorf("large page not truncated: %q", out)
+	}
+
+	if _, err := scrape(t, map[string]interface{}{"url": server.URL + "/slow", "timeout_seconds": 1}); err == nil {
+		t.Error("slow page should time out")
+	}
+	if _, err := scrape(t, map[string]interface{}{"url": server.URL + "/missing"}); err == nil {
+		t.Error("404 should be an error")
+	}
+}
@@ -0,0 +1,290 @@
+// search.go - Pure-Go regex code search used by code_search
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// searchDefaultMaxPerFile caps matches reported for a single file
+	searchDefaultMaxPerFile = 20
+	// searchDefaultMaxResults caps matches reported across all files
+	searchDefaultMaxResults = 200
+	// searchMaxFileSize skips files that are too large to be source code
+	searchMaxFileSize = 4 * 1024 * 1024
+)
+
+// languageExtensions maps language filter names to file extensions
+var languageExtensions = map[string][]string{
+	"go":         {".go"},
+	"typescript": {".ts", ".tsx"},
+	"javascript": {".js", ".jsx", ".mjs", ".cjs"},
+	"python":     {".py"},
+	"rust":       {".rs"},
+	"java":       {".java"},
+	"c":          {".c", ".h"},
+	"cpp":        {".cc", ".cpp", ".cxx", ".hpp", ".hh", ".h"},
+	"html":       {".html", ".htm"},
+	"css":        {".css", ".scss"},
+	"markdown":   {".md", ".markdown"},
+	"json":       {".json"},
+	"yaml":       {".yaml", ".yml"},
+	"nix":        {".nix"},
+	"shell":      {".sh", ".bash"},
+}
+
+// languageAliases lets callers use common short names
+var languageAliases = map[string]string{
+	"ts": "typescript", "js": "javascript", "py": "python", "rs": "rust",
+	"c++": "cpp", "md": "markdown", "yml": "yaml", "sh": "shell", "golang": "go",
+}
+
+// searchOptions controls a code search
+type searchOptions struct {
+	Pattern         string
+	Regex           bool
+	CaseInsensitive bool
+	Root            string
+	Glob            string
+	Language        string
+	Before          int
+	After           int
+	MaxPerFile      int
+	MaxResults      int
+	FilesOnly       bool
+	IncludeIgnored  bool
+}
+
+// searchMatch is a matching line with its surrounding context
+type searchMatch struct {
+	Line    int
+	Text    string
+	Context []searchContextLine
+}
+
+// searchContextLine is a line shown around a match
+type searchContextLine struct {
+	Line    int
+	Text    string
+	IsMatch bool
+}
+
+// searchFileResult holds the matches found in one file
+type searchFileResult struct {
+	Path      string
+	Matches   []searchMatch
+	Truncated bool
+}
+
+// compileSearchPattern builds the matcher for a search
+func compileSearchPattern(opts searchOptions) (*regexp.Regexp, error) {
+	pattern := opts.Pattern
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.CaseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	return re, nil
+}
+
+// languageFilter returns the extensions for a language name
+func languageFilter(language string) ([]string, error) {
+	if language == "" {
+		return nil, nil
+	}
+	name := strings.ToLower(language)
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	exts, ok := languageExtensions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown language %q", language)
+	}
+	return exts, nil
+}
+
+// searchFiles runs a search over the tree under opts.Root. Files are visited
+// in lexical order so results are identical across platforms.
+func searchFiles(opts searchOptions) ([]searchFileResult, int, error) {
+	if opts.Pattern == "" {
+		return nil, 0, fmt.Errorf("search query must not be empty")
+	}
+	re, err := compileSearchPattern(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	exts, err := languageFilter(opts.Language)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+	maxPerFile := opts.MaxPerFile
+	if maxPerFile <= 0 {
+		maxPerFile = searchDefaultMaxPerFile
+	}
+	maxResults := opts.MaxResults
+	if maxResults <= 0 {
+		maxResults = searchDefaultMaxResults
+	}
+
+	var results []searchFileResult
+	total := 0
+	omitted := 0
+	err = walkIgnoring(root, opts.IncludeIgnored, func(relPath string, d fs.DirEntry) error {
+		if d.IsDir() {
+			return nil
+		}
+		if opts.Glob != "" && !matchGlob(opts.Glob, relPath) {
+			return nil
+		}
+		if exts != nil && !hasExtension(relPath, exts) {
+			return nil
+		}
+		if total >= maxResults {
+			omitted++
+			return nil
+		}
+
+		path := filepath.Join(root, filepath.FromSlash(relPath))
+		result, err := searchFile(path, re, opts, min(maxPerFile, maxResults-total))
+		if err != nil || result == nil {
+			return nil
+		}
+		result.Path = filepath.ToSlash(path)
+		results = append(results, *result)
+		total += len(result.Matches)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results, omitted, nil
+}
+
+// hasExtension reports whether path ends in one of exts
+func hasExtension(path string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// searchFile returns the matches in one file, or nil if there are none
+func searchFile(path string, re *regexp.Regexp, opts searchOptions, limit int) (*searchFileResult, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > searchMaxFileSize {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if detectEncoding(content[:min(len(content), readFileSniffBytes)]) == "binary" {
+		return nil, nil
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), searchMaxFileSize)
+	for scanner.Scan() {
+		lines = append(lines, decodeText(scanner.Bytes()))
+	}
+
+	result := &searchFileResult{}
+	for i, line := range lines {
+		if !re.MatchString(line) {
+			continue
+		}
+		if len(result.Matches) >= limit {
+			result.Truncated = true
+			break
+		}
+		if opts.FilesOnly {
+			result.Matches = append(result.Matches, searchMatch{Line: i + 1, Text: line})
+			break
+		}
+
+		match := searchMatch{Line: i + 1, Text: line}
+		for j := max(0, i-opts.Before); j <= min(len(lines)-1, i+opts.After); j++ {
+			match.Context = append(match.Context, searchContextLine{
+				Line:    j + 1,
+				Text:    lines[j],
+				IsMatch: re.MatchString(lines[j]),
+			})
+		}
+		result.Matches = append(result.Matches, match)
+	}
+
+	if len(result.Matches) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// formatSearchResults renders results in a grep-like layout: "path:line:text"
+// for matches and "path-line-text" for context, with "--" between
+// non-adjacent blocks
+func formatSearchResults(results []searchFileResult, omitted int, opts searchOptions) string {
+	var sb strings.Builder
+	total := 0
+	for _, r := range results {
+		total += len(r.Matches)
+		if opts.FilesOnly {
+			sb.WriteString(r.Path + "\n")
+			continue
+		}
+
+		lastPrinted := 0
+		for _, m := range r.Matches {
+			lines := m.Context
+			if len(lines) == 0 {
+				lines = []searchContextLine{{Line: m.Line, Text: m.Text, IsMatch: true}}
+			}
+			for _, l := range lines {
+				if l.Line <= lastPrinted {
+					continue
+				}
+				if lastPrinted > 0 && l.Line > lastPrinted+1 && (opts.Before > 0 || opts.After > 0) {
+					sb.WriteString("--\n")
+				}
+				sep := "-"
+				if l.IsMatch {
+					sep = ":"
+				}
+				fmt.Fprintf(&sb, "%s%s%d%s%s\n", r.Path, sep, l.Line, sep, l.Text)
+				lastPrinted = l.Line
+			}
+		}
+		if r.Truncated {
+			fmt.Fprintf(&sb, "%s: [more matches in this file omitted]\n", r.Path)
+		}
+	}
+
+	if total == 0 {
+		return "No matches found"
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&sb, "[result limit reached; %d more files not searched. Narrow the path, glob or language]\n", omitted)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
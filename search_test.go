@@ -0,0 +1,97 @@
+// search_test.go - Regex, glob, language and context handling of code_search
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// runTestSearch searches the working directory and formats the results
+func runTestSearch(t *testing.T, opts searchOptions) string {
+	t.Helper()
+	results, omitted, err := searchFiles(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return formatSearchResults(results, omitted, opts)
+}
+
+func TestSearchFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestTree(t, ".", map[string]string{
+		".gitignore":    "vendor/\n",
+		"main.go":       "package main\n\nfunc main() {\n\tRun()\n}\n",
+		"run.go":        "package main\n\n// Run starts the server\nfunc Run() {}\n",
+		"web/app.ts":    "export function run() {}\n",
+		"vendor/dep.go": "func Run() {}\n",
+		"image.bin":     "Run\x00\x01\x02",
+	})
+
+	tests := []struct {
+		name string
+		opts searchOptions
+		want string
+	}{
+		{"literal", searchOptions{Pattern: "Run()"}, "main.go:4:\tRun()\nrun.go:4:func Run() {}"},
+		{"literal is not a regex", searchOptions{Pattern: "R.n"}, "No matches found"},
+		{"regex", searchOptions{Pattern: `^func \w+\(`, Regex: true}, "main.go:3:func main() {\nrun.go:4:func Run() {}"},
+		{"case insensitive", searchOptions{Pattern: "function run", CaseInsensitive: true}, "web/app.ts:1:export function run() {}"},
+		{"glob", searchOptions{Pattern: "Run", Glob: "r*.go"}, "run.go:3:// Run starts the server\nrun.go:4:func Run() {}"},
+		{"language alias", searchOptions{Pattern: "run", Language: "ts"}, "web/app.ts:1:export function run() {}"},
+		{"ignored files", searchOptions{Pattern: "Run", Glob: "vendor/*", IncludeIgnored: true}, "vendor/dep.go:1:func Run() {}"},
+		{"files only", searchOptions{Pattern: "Run", FilesOnly: true}, "main.go\nrun.go"},
+		{"per file limit", searchOptions{Pattern: "Run", Glob: "run.go", MaxPerFile: 1}, "run.go:3:// Run starts the server\nrun.go: [more matches in this file omitted]"},
+		{"result limit", searchOptions{Pattern: "main", MaxResults: 2}, "main.go:1:package main\nmain.go:3:func main() {\n[result limit reached; 2 more files not searched. Narrow the path, glob or language]"},
+	}
+	for _, tt := range tests {
+		if got := runTestSearch(t, tt.opts); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFilesErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	tests := []struct {
+		name string
+		opts searchOptions
+		err  string
+	}{
+		{"empty query", searchOptions{}, "must not be empty"},
+		{"bad regex", searchOptions{Pattern: "(", Regex: true}, "invalid regular expression"},
+		{"unknown language", searchOptions{Pattern: "x", Language: "cobol"}, `unknown language "cobol"`},
+	}
+	for _, tt := range tests {
+		if _, _, err := searchFiles(tt.opts); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestSearchContext(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var content strings.Builder
+	for _, line := range []string{"a", "match 1", "b", "c", "d", "e", "match 2", "match 3", "f"} {
+		content.WriteString(line + "\n")
+	}
+	writeTestFile(t, "f.txt", content.String())
+
+	// Overlapping context is printed once and separate blocks are split by "--"
+	got := runTestSearch(t, searchOptions{Pattern: "match", Before: 1, After: 1})
+	want := `f.txt-1-a
+f.txt:2:match 1
+f.txt-3-b
+--
+f.txt-6-e
+f.txt:7:match 2
+f.txt:8:match 3
+f.txt-9-f`
+	if got != want {
+		t.Errorf("context:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = runTestSearch(t, searchOptions{Pattern: "match 1", After: 3})
+	if want := "f.txt:2:match 1\nf.txt-3-b\nf.txt-4-c\nf.txt-5-d"; got != want {
+		t.Errorf("context after:\n%s\nwant:\n%s", got, want)
+	}
+}
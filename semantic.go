@@ -0,0 +1,389 @@
+// semantic.go - Embedding index over project files and the semantic_search tool
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// semanticChunkLines is the number of lines embedded per chunk
+	semanticChunkLines = 60
+	// semanticChunkOverlap is the number of lines shared by adjacent chunks
+	semanticChunkOverlap = 10
+	// semanticMaxChunkBytes caps the text sent to the embedder for one chunk
+	semanticMaxChunkBytes = 6000
+	// semanticMaxFileSize skips files too large to be useful source code
+	semanticMaxFileSize = 1024 * 1024
+	// semanticBatchSize is the number of chunks embedded per request
+	semanticBatchSize = 64
+	// semanticDefaultTopK is the number of results returned by default
+	semanticDefaultTopK = 10
+	// semanticSnippetLines is the number of chunk lines shown per result
+	semanticSnippetLines = 12
+)
+
+// semanticChunk is an embedded range of lines in a file
+type semanticChunk struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Vector    []byte `json:"vector"` // little-endian float32s
+	vec       []float32
+}
+
+// semanticFile holds the chunks of one indexed file
+type semanticFile struct {
+	Hash    string          `json:"hash"`
+	Size    int64           `json:"size"`
+	ModTime time.Time       `json:"mod_time"`
+	Chunks  []semanticChunk `json:"chunks"`
+}
+
+// semanticIndex is the persisted embedding index, keyed by slash-separated path
+type semanticIndex struct {
+	Embedder string                   `json:"embedder"`
+	Updated  time.Time                `json:"updated"`
+	Files    map[string]*semanticFile `json:"files"`
+}
+
+// semanticIndexStats summarizes an index update
+type semanticIndexStats struct {
+	Files    int
+	Embedded int
+	Removed  int
+	Chunks   int
+}
+
+var (
+	semanticMu    sync.Mutex
+	semanticCache *semanticIndex
+)
+
+// encodeVector packs a vector for storage
+func encodeVector(vec []float32) []byte {
+	buf := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeVector unpacks a stored vector
+func decodeVector(buf []byte) []float32 {
+	vec := make([]float32, len(buf)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vec
+}
+
+// chunkLines splits lines into overlapping windows, returning 1-based
+// inclusive line ranges. Windows containing only whitespace are dropped.
+func chunkLines(lines []string) [][2]int {
+	var ranges [][2]int
+	step := semanticChunkLines - semanticChunkOverlap
+	for start := 0; start < len(lines); start += step {
+		end := min(start+semanticChunkLines, len(lines))
+		if strings.TrimSpace(strings.Join(lines[start:end], "")) != "" {
+			ranges = append(ranges, [2]int{start + 1, end})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return ranges
+}
+
+// readTextLines returns the lines of a text file, or ok=false for binary files
+func readTextLines(path string) ([]string, []byte, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	if detectEncoding(content[:min(len(content), readFileSniffBytes)]) == "binary" {
+		return nil, nil, false
+	}
+	return strings.Split(decodeText(content), "\n"), content, true
+}
+
+// loadSemanticIndex returns the cached index, reading it from the project
+// data directory on first use. An index built by another embedder is dropped.
+func loadSemanticIndex(embedder Embedder) *semanticIndex {
+	if semanticCache == nil {
+		semanticCache = &semanticIndex{}
+		if err := globalDB.LoadEmbeddingIndex(semanticCache); err != nil {
+			log.Printf("Failed to load embedding index, rebuilding: %v", err)
+			semanticCache = &semanticIndex{}
+		}
+	}
+	if semanticCache.Embedder != embedder.Name() || semanticCache.Files == nil {
+		semanticCache = &semanticIndex{Embedder: embedder.Name(), Files: map[string]*semanticFile{}}
+	}
+	return semanticCache
+}
+
+// pendingChunk is a chunk waiting to be embedded
+type pendingChunk struct {
+	path  string
+	index int
+	text  string
+}
+
+// updateSemanticIndex brings the index up to date with the files under root.
+// Files are only re-embedded when their content hash changes; size and
+// modification time are used to skip hashing unchanged files. Progress is
+// saved even when embedding fails part way.
+func updateSemanticIndex(ctx context.Context, embedder Embedder, root string, rebuild bool) (*semanticIndex, semanticIndexStats, error) {
+	var stats semanticIndexStats
+	if rebuild {
+		semanticCache = &semanticIndex{Embedder: embedder.Name(), Files: map[string]*semanticFile{}}
+	}
+	idx := loadSemanticIndex(embedder)
+
+	seen := map[string]bool{}
+	changed := map[string]*semanticFile{}
+	var pending []pendingChunk
+	err := walkIgnoring(root, false, func(relPath string, d fs.DirEntry) error {
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > semanticMaxFileSize || info.Size() == 0 {
+			return nil
+		}
+		seen[relPath] = true
+		stats.Files++
+
+		existing := idx.Files[relPath]
+		if existing != nil && existing.Size == info.Size() && existing.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+
+		lines, content, ok := readTextLines(filepath.Join(root, filepath.FromSlash(relPath)))
+		if !ok {
+			delete(seen, relPath)
+			stats.Files--
+			return nil
+		}
+		hash := contentHash(string(content))
+		if existing != nil && existing.Hash == hash {
+			existing.Size, existing.ModTime = info.Size(), info.ModTime()
+			return nil
+		}
+
+		file := &semanticFile{Hash: hash, Size: info.Size(), ModTime: info.ModTime()}
+		for _, r := range chunkLines(lines) {
+			text := relPath + "\n" + strings.Join(lines[r[0]-1:r[1]], "\n")
+			pending = append(pending, pendingChunk{
+				path:  relPath,
+				index: len(file.Chunks),
+				text:  truncateUTF8(text, semanticMaxChunkBytes),
+			})
+			file.Chunks = append(file.Chunks, semanticChunk{StartLine: r[0], EndLine: r[1]})
+		}
+		changed[relPath] = file
+		return nil
+	})
+	if err != nil {
+		return nil, stats, err
+	}
+
+	dirty := false
+	for path := range idx.Files {
+		if !seen[path] {
+			delete(idx.Files, path)
+			stats.Removed++
+			dirty = true
+		}
+	}
+
+	// Files are committed to the index once all of their chunks are embedded
+	remaining := map[string]int{}
+	for _, p := range pending {
+		remaining[p.path]++
+	}
+	for path, file := range changed {
+		if len(file.Chunks) == 0 {
+			idx.Files[path] = file
+			stats.Embedded++
+			dirty = true
+		}
+	}
+
+	var embedErr error
+	for start := 0; start < len(pending); start += semanticBatchSize {
+		batch := pending[start:min(start+semanticBatchSize, len(pending))]
+		texts := make([]string, len(batch))
+		for i, p := range batch {
+			texts[i] = p.text
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			embedErr = fmt.Errorf("failed to embed chunks: %w", err)
+			break
+		}
+		for i, p := range batch {
+			file := changed[p.path]
+			file.Chunks[p.index].Vector = encodeVector(vectors[i])
+			file.Chunks[p.index].vec = vectors[i]
+			remaining[p.path]--
+			if remaining[p.path] == 0 {
+				idx.Files[p.path] = file
+				stats.Embedded++
+				dirty = true
+			}
+		}
+	}
+
+	if dirty || rebuild {
+		idx.Updated = time.Now()
+		if err := globalDB.SaveEmbeddingIndex(idx); err != nil {
+			log.Printf("Failed to save embedding index: %v", err)
+		}
+	}
+	for _, file := range idx.Files {
+		stats.Chunks += len(file.Chunks)
+	}
+	return idx, stats, embedErr
+}
+
+// semanticResult is a ranked chunk
+type semanticResult struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Score     float64
+}
+
+// searchSemanticIndex ranks the indexed chunks against a query vector
+func searchSemanticIndex(idx *semanticIndex, query []float32, pathPrefix, glob string, topK int) []semanticResult {
+	pathPrefix = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(pathPrefix)), "./")
+	if pathPrefix == "." {
+		pathPrefix = ""
+	}
+
+	var results []semanticResult
+	for path, file := range idx.Files {
+		if pathPrefix != "" && path != pathPrefix && !strings.HasPrefix(path, pathPrefix+"/") {
+			continue
+		}
+		if glob != "" && !matchGlob(glob, path) {
+			continue
+		}
+		for i := range file.Chunks {
+			chunk := &file.Chunks[i]
+			if chunk.vec == nil {
+				chunk.vec = decodeVector(chunk.Vector)
+			}
+			results = append(results, semanticResult{
+				Path:      path,
+				StartLine: chunk.StartLine,
+				EndLine:   chunk.EndLine,
+				Score:     cosineSimilarity(query, chunk.vec),
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].StartLine < results[j].StartLine
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+type SemanticSearchInput struct {
+	Query   string `json:"query" jsonschema_description:"Natural language description of the code to find, e.g. 'where are HTTP retries configured'."`
+	TopK    int    `json:"top_k,omitempty" jsonschema_description:"Optional number of results to return (default 10)."`
+	Path    string `json:"path,omitempty" jsonschema_description:"Optional directory or file to restrict results to."`
+	Glob    string `json:"glob,omitempty" jsonschema_description:"Optional glob to filter files, e.g. '*.go' or 'internal/**/*.ts'."`
+	Reindex bool   `json:"reindex,omitempty" jsonschema_description:"Optional. Discard the stored index and re-embed every file."`
+}
+
+var SemanticSearchInputSchema = GenerateSchema[SemanticSearchInput]()
+
+func SemanticSearch(input json.RawMessage) (string, error) {
+	var searchInput SemanticSearchInput
+	if err := json.Unmarshal(input, &searchInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+	if strings.TrimSpace(searchInput.Query) == "" {
+		return "", fmt.Errorf("query must not be empty")
+	}
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	topK := searchInput.TopK
+	if topK <= 0 {
+		topK = semanticDefaultTopK
+	}
+
+	embedder, err := NewEmbeddingConfigFromEnv().CreateEmbedder()
+	if err != nil {
+		return "", err
+	}
+
+	semanticMu.Lock()
+	defer semanticMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	idx, stats, err := updateSemanticIndex(ctx, embedder, ".", searchInput.Reindex)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Semantic index: %d files, %d chunks, %d re-embedded, %d removed (%s)",
+		stats.Files, stats.Chunks, stats.Embedded, stats.Removed, embedder.Name())
+
+	vectors, err := embedder.Embed(ctx, []string{searchInput.Query})
+	if err != nil {
+		return "", fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	results := searchSemanticIndex(idx, vectors[0], searchInput.Path, searchInput.Glob, topK)
+	if len(results) == 0 {
+		return "No indexed files match", nil
+	}
+
+	var sb strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&sb, "%s:%d-%d (score %.3f)\n", r.Path, r.StartLine, r.EndLine, r.Score)
+		if lines, _, ok := readTextLines(filepath.FromSlash(r.Path)); ok && r.StartLine <= len(lines) {
+			end := min(r.EndLine, len(lines), r.StartLine+semanticSnippetLines-1)
+			for i := r.StartLine; i <= end; i++ {
+				fmt.Fprintf(&sb, "  %d| %s\n", i, lines[i-1])
+			}
+			if end < r.EndLine {
+				sb.WriteString("  ...\n")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+var SemanticSearchDefinition = ToolDefinition{
+	Name:        "semantic_search",
+	Description: "Find code by meaning rather than exact text. Project files are split into chunks and embedded; the index is stored in the project data directory and only changed files are re-embedded. Configure the embedder with EVE_EMBEDDING_PROVIDER (hash, the offline default, or openai, ollama or gemini, which send file contents to that service), EVE_EMBEDDING_MODEL and EVE_EMBEDDING_URL. Use code_search for exact identifiers.",
+	InputSchema: SemanticSearchInputSchema,
+	Function:    SemanticSearch,
+}
@@ -0,0 +1,162 @@
+// semantic_test.go - Chunking, incremental indexing and ranking of semantic_search
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingEmbedder is a hash embedder that counts the texts it embeds and
+// fails once fail is set
+type countingEmbedder struct {
+	*HashEmbedder
+	texts int
+	fail  bool
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.fail {
+		return nil, errors.New("embedder unavailable")
+	}
+	e.texts += len(texts)
+	return e.HashEmbedder.Embed(ctx, texts)
+}
+
+// useTestSemanticIndex starts from an empty in-memory index and a fresh project database
+func useTestSemanticIndex(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	t.Cleanup(func() { pdb.Close() })
+	useTestDatabase(t, pdb)
+	semanticCache = nil
+	t.Cleanup(func() { semanticCache = nil })
+}
+
+func TestChunkLines(t *testing.T) {
+	lines := make([]string, 130)
+	for i := range lines {
+		lines[i] = "x"
+	}
+	want := [][2]int{{1, 60}, {51, 110}, {101, 130}}
+	if got := chunkLines(lines); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("chunks = %v, want %v", got, want)
+	}
+
+	// Windows holding only whitespace are dropped
+	for i := 60; i < 130; i++ {
+		lines[i] = "  "
+	}
+	if got := chunkLines(lines); len(got) != 2 {
+		t.Errorf("chunks with a blank tail = %v", got)
+	}
+}
+
+func TestUpdateSemanticIndex(t *testing.T) {
+	useTestSemanticIndex(t)
+	writeTestTree(t, ".", map[string]string{
+		"retry.go":  "package http\n\nfunc retryRequest() {}\n",
+		"menu.go":   "package ui\n\nfunc renderMenu() {}\n",
+		"empty.txt": "",
+		"image.png": "\x89PNG\x00\x00\x00",
+	})
+	e := &countingEmbedder{HashEmbedder: NewHashEmbedder(64)}
+
+	_, stats, err := updateSemanticIndex(context.Background(), e, ".", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 2 || stats.Embedded != 2 || stats.Chunks != 2 || e.texts != 2 {
+		t.Fatalf("first update: %+v, %d texts embedded", stats, e.texts)
+	}
+
+	// Unchanged files and files only touched are not embedded again
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes("menu.go", future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, stats, err = updateSemanticIndex(context.Background(), e, ".", false); err != nil || stats.Embedded != 0 || e.texts != 2 {
+		t.Fatalf("update without changes: %+v, %d texts embedded, %v", stats, e.texts, err)
+	}
+
+	writeTestFile(t, "retry.go", "package http\n\nfunc retryRequestWithBackoff() {}\n")
+	if err := os.Remove("menu.go"); err != nil {
+		t.Fatal(err)
+	}
+	if _, stats, err = updateSemanticIndex(context.Background(), e, ".", false); err != nil || stats.Embedded != 1 || stats.Removed != 1 || e.texts != 3 {
+		t.Fatalf("update after changes: %+v, %d texts embedded, %v", stats, e.texts, err)
+	}
+
+	// The index is saved and reloaded from the project database
+	semanticCache = nil
+	idx := loadSemanticIndex(e)
+	if len(idx.Files) != 1 || idx.Files["retry.go"] == nil {
+		t.Fatalf("reloaded index holds %v", idx.Files)
+	}
+
+	// A failing embedder leaves the changed file out of the index
+	writeTestFile(t, "retry.go", "package http\n")
+	e.fail = true
+	if _, _, err = updateSemanticIndex(context.Background(), e, ".", false); err == nil {
+		t.Fatal("embedding failure was not reported")
+	}
+	if idx.Files["retry.go"].Hash == contentHash("package http\n") {
+		t.Fatal("a file that failed to embed was committed to the index")
+	}
+
+	// Another embedder starts a new index
+	if idx := loadSemanticIndex(NewHashEmbedder(32)); len(idx.Files) != 0 {
+		t.Fatalf("index of another embedder holds %v", idx.Files)
+	}
+}
+
+func TestSemanticSearch(t *testing.T) {
+	useTestSemanticIndex(t)
+	t.Setenv("EVE_EMBEDDING_PROVIDER", "hash")
+	writeTestTree(t, ".", map[string]string{
+		"net/retry.go":  "package net\n\n// retryRequest retries a failed HTTP request with backoff\nfunc retryRequest() {}\n",
+		"net/client.go": "package net\n\n// Client sends HTTP requests\ntype Client struct{}\n",
+		"ui/menu.go":    "package ui\n\n// renderMenu draws the sidebar menu\nfunc renderMenu() {}\n",
+		"docs/retry.md": "Failed requests are retried with backoff.\n",
+	})
+
+	output, err := SemanticSearch(json.RawMessage(`{"query": "retry a failed request with backoff", "top_k": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(output, "net/retry.go:1-5 (score ") || !strings.Contains(output, "  3| // retryRequest retries") {
+		t.Fatalf("best match is not net/retry.go:\n%s", output)
+	}
+	if strings.Contains(output, "ui/menu.go") || strings.Count(output, "(score ") != 2 {
+		t.Fatalf("top 2 results:\n%s", output)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		results int
+		want    string
+	}{
+		{"path", `{"query": "retry", "path": "ui"}`, 1, "ui/menu.go:1-5"},
+		{"glob", `{"query": "retry", "glob": "*.md"}`, 1, "docs/retry.md:1-2"},
+		{"no files", `{"query": "retry", "path": "missing"}`, 0, "No indexed files match"},
+	}
+	for _, tt := range tests {
+		output, err := SemanticSearch(json.RawMessage(tt.input))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if strings.Count(output, "(score ") != tt.results || !strings.Contains(output, tt.want) {
+			t.Errorf("%s: want %d results with %q:\n%s", tt.name, tt.results, tt.want, output)
+		}
+	}
+
+	if _, err := SemanticSearch(json.RawMessage(`{"query": " "}`)); err == nil {
+		t.Fatal("an empty query was accepted")
+	}
+}
@@ -0,0 +1,665 @@
+// sqlite_store.go - Storage backend using a SQLite database
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteMigrations are applied in order; each entry is one schema version.
+// Applied versions are recorded in schema_migrations, so new migrations must
+// only ever be appended.
+var sqliteMigrations = []string{
+	// 1: initial schema
+	`CREATE TABLE files (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		path        TEXT NOT NULL,
+		content     TEXT NOT NULL,
+		hash        TEXT NOT NULL,
+		version     INTEGER NOT NULL,
+		created_at  TIMESTAMP NOT NULL,
+		modified_at TIMESTAMP NOT NULL,
+		is_active   BOOLEAN NOT NULL
+	);
+	CREATE INDEX idx_files_path ON files(path, is_active);
+
+	CREATE TABLE edits (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		file_id   INTEGER NOT NULL,
+		path      TEXT NOT NULL,
+		operation TEXT NOT NULL,
+		tool      TEXT NOT NULL,
+		old_hash  TEXT NOT NULL,
+		new_hash  TEXT NOT NULL,
+		diff      TEXT NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		user      TEXT NOT NULL,
+		session   TEXT NOT NULL,
+		grp       TEXT NOT NULL,
+		undone    BOOLEAN NOT NULL
+	);
+	CREATE INDEX idx_edits_path ON edits(path);
+	CREATE INDEX idx_edits_timestamp ON edits(timestamp);
+
+	CREATE TABLE checkpoints (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		timestamp   TIMESTAMP NOT NULL,
+		file_count  INTEGER NOT NULL,
+		files       TEXT NOT NULL,
+		skipped     TEXT NOT NULL
+	);
+	CREATE INDEX idx_checkpoints_timestamp ON checkpoints(timestamp);
+
+	CREATE TABLE mcp_integrations (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name       TEXT NOT NULL,
+		type       TEXT NOT NULL,
+		config     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		is_active  BOOLEAN NOT NULL
+	);
+
+	CREATE TABLE multiplayer_actions (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		user      TEXT NOT NULL,
+		action    TEXT NOT NULL,
+		data      TEXT NOT NULL,
+		timestamp TIMESTAMP NOT NULL
+	);
+	CREATE INDEX idx_multiplayer_timestamp ON multiplayer_actions(timestamp);
+
+	CREATE TABLE blobs (
+		hash    TEXT PRIMARY KEY,
+		content BLOB NOT NULL
+	);
+
+	CREATE TABLE state (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+
+	// 2: file version history; contents are stored as blobs
+	`CREATE TABLE file_versions (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		file_id    INTEGER NOT NULL,
+		path       TEXT NOT NULL,
+		version    INTEGER NOT NULL,
+		hash       TEXT NOT NULL,
+		size       INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		note       TEXT NOT NULL
+	);
+	CREATE INDEX idx_file_versions_path ON file_versions(path, version);`,
+
+	// 3: checkpoints stored as git shadow commits
+	`ALTER TABLE checkpoints ADD COLUMN git_commit TEXT NOT NULL DEFAULT '';`,
+
+	// 4: blob storage times for garbage collection; NULL for older blobs
+	`ALTER TABLE blobs ADD COLUMN stored_at TIMESTAMP;`,
+
+	// 5: file permissions of edits, used when undo or redo recreates a file
+	`ALTER TABLE edits ADD COLUMN mode INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// sqliteTableNames maps storageTables to the SQLite tables holding them
+var sqliteTableNames = map[string]string{
+	"files":       "files",
+	"versions":    "file_versions",
+	"edits":       "edits",
+	"checkpoints": "checkpoints",
+	"mcp":         "mcp_integrations",
+	"multiplayer": "multiplayer_actions",
+}
+
+// sqlQuerier is the part of *sql.DB and *sql.Tx used by the store
+type sqlQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqliteStore keeps project records in SQLite. Inside a transaction db is
+// nil and q is the *sql.Tx.
+type sqliteStore struct {
+	db *sql.DB
+	q  sqlQuerier
+}
+
+// openSQLiteStore opens (creating if needed) the database at path and
+// brings its schema up to date
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	// Immediate transactions take the write lock up front, so concurrent
+	// writers from other processes wait on the busy timeout instead of
+	// failing when a read lock cannot be upgraded
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_loc=auto&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	// A single connection keeps transactions and the busy timeout simple
+	db.SetMaxOpenConns(1)
+
+	store := &sqliteStore{db: db, q: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// migrate applies the schema migrations that have not been applied yet
+func (s *sqliteStore) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	if current > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, len(sqliteMigrations))
+	}
+
+	for version := current + 1; version <= len(sqliteMigrations); version++ {
+		err := s.Transaction(func(tx Storage) error {
+			q := tx.(*sqliteStore).q
+			// Another process opening the database may have applied it meanwhile
+			var applied int
+			if err := q.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, version).Scan(&applied); err != nil || applied > 0 {
+				return err
+			}
+			if _, err := q.Exec(sqliteMigrations[version-1]); err != nil {
+				return err
+			}
+			_, err := q.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, version, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) Name() string {
+	return StorageSQLite
+}
+
+func (s *sqliteStore) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Transaction runs fn inside a SQL transaction. Nested calls join the outer transaction.
+func (s *sqliteStore) Transaction(fn func(Storage) error) error {
+	if s.db == nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&sqliteStore{q: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsert inserts a row, letting SQLite assign the ID when *id is zero, and
+// replaces the row with that ID otherwise
+func (s *sqliteStore) upsert(table string, id *int, columns []string, values ...interface{}) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	if *id != 0 {
+		columns = append([]string{"id"}, columns...)
+		values = append([]interface{}{*id}, values...)
+		placeholders = "?, " + placeholders
+	}
+
+	query := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders)
+	result, err := s.q.Exec(query, values...)
+	if err != nil {
+		return err
+	}
+	if *id == 0 {
+		newID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		*id = int(newID)
+	}
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryAll runs a query and scans every row with scan
+func queryAll[T any](s *sqliteStore, scan func(rowScanner) (*T, error), query string, args ...interface{}) ([]*T, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*T
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, record)
+	}
+	return result, rows.Err()
+}
+
+// limitClause returns a LIMIT clause, or nothing when limit is not positive
+func limitClause(limit int) string {
+	if limit > 0 {
+		return fmt.Sprintf(" LIMIT %d", limit)
+	}
+	return ""
+}
+
+const fileColumns = "id, path, content, hash, version, created_at, modified_at, is_active"
+
+func scanFile(row rowScanner) (*ProjectFile, error) {
+	var f ProjectFile
+	err := row.Scan(&f.ID, &f.Path, &f.Content, &f.Hash, &f.Version, &f.CreatedAt, &f.ModifiedAt, &f.IsActive)
+	return &f, err
+}
+
+func (s *sqliteStore) PutFile(file *ProjectFile) error {
+	return s.upsert("files", &file.ID,
+		[]string{"path", "content", "hash", "version", "created_at", "modified_at", "is_active"},
+		file.Path, file.Content, file.Hash, file.Version, file.CreatedAt.UTC(), file.ModifiedAt.UTC(), file.IsActive)
+}
+
+func (s *sqliteStore) GetFile(path string) (*ProjectFile, error) {
+	file, err := scanFile(s.q.QueryRow(`SELECT `+fileColumns+` FROM files WHERE path = ? AND is_active ORDER BY id DESC LIMIT 1`, path))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("file not found")
+	}
+	return file, err
+}
+
+func (s *sqliteStore) ListFiles() ([]*ProjectFile, error) {
+	return queryAll(s, scanFile, `SELECT `+fileColumns+` FROM files WHERE is_active ORDER BY id`)
+}
+
+func (s *sqliteStore) ListAllFiles() ([]*ProjectFile, error) {
+	return queryAll(s, scanFile, `SELECT `+fileColumns+` FROM files ORDER BY id`)
+}
+
+const fileVersionColumns = "id, file_id, path, version, hash, size, created_at, note"
+
+func scanFileVersion(row rowScanner) (*FileVersion, error) {
+	var v FileVersion
+	err := row.Scan(&v.ID, &v.FileID, &v.Path, &v.Version, &v.Hash, &v.Size, &v.CreatedAt, &v.Note)
+	return &v, err
+}
+
+func (s *sqliteStore) PutFileVersion(version *FileVersion) error {
+	return s.upsert("file_versions", &version.ID,
+		[]string{"file_id", "path", "version", "hash", "size", "created_at", "note"},
+		version.FileID, version.Path, version.Version, version.Hash, version.Size, version.CreatedAt.UTC(), version.Note)
+}
+
+func (s *sqliteStore) ListFileVersions(path string) ([]*FileVersion, error) {
+	if path == "" {
+		return queryAll(s, scanFileVersion, `SELECT `+fileVersionColumns+` FROM file_versions ORDER BY id`)
+	}
+	return queryAll(s, scanFileVersion, `SELECT `+fileVersionColumns+` FROM file_versions WHERE path = ? ORDER BY id`, path)
+}
+
+const editColumns = "id, file_id, path, operation, tool, old_hash, new_hash, diff, timestamp, user, session, grp, undone, mode"
+
+func scanEdit(row rowScanner) (*EditHistory, error) {
+	var e EditHistory
+	err := row.Scan(&e.ID, &e.FileID, &e.Path, &e.Operation, &e.Tool, &e.OldHash, &e.NewHash, &e.Diff,
+		&e.Timestamp, &e.User, &e.Session, &e.Group, &e.Undone, &e.Mode)
+	return &e, err
+}
+
+func (s *sqliteStore) PutEdit(edit *EditHistory) error {
+	return s.upsert("edits", &edit.ID,
+		[]string{"file_id", "path", "operation", "tool", "old_hash", "new_hash", "diff", "timestamp", "user", "session", "grp", "undone", "mode"},
+		edit.FileID, edit.Path, edit.Operation, edit.Tool, edit.OldHash, edit.NewHash, edit.Diff,
+		edit.Timestamp.UTC(), edit.User, edit.Session, edit.Group, edit.Undone, edit.Mode)
+}
+
+func (s *sqliteStore) ListEdits(path string, limit int) ([]*EditHistory, error) {
+	if path == "" {
+		return queryAll(s, scanEdit, `SELECT `+editColumns+` FROM edits ORDER BY id DESC`+limitClause(limit))
+	}
+	return queryAll(s, scanEdit, `SELECT `+editColumns+` FROM edits WHERE path = ? ORDER BY id DESC`+limitClause(limit), path)
+}
+
+// filterClause returns the WHERE clause selecting the records of filter and
+// its arguments; pathColumn is "" for tables without paths. Timestamps are
+// stored in UTC, whose text form sorts in time order, so the comparisons
+// use the timestamp indexes.
+func filterClause(filter RecordFilter, pathColumn string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if pathColumn != "" && filter.Path != "" {
+		conditions = append(conditions, pathColumn+" = ?")
+		args = append(args, filter.Path)
+	}
+	if prefix := filter.PathPrefix; pathColumn != "" && prefix != "" {
+		// Paths from the prefix up to the next possible last character
+		conditions = append(conditions, pathColumn+" >= ? AND "+pathColumn+" < ?")
+		args = append(args, prefix, prefix[:len(prefix)-1]+string(rune(prefix[len(prefix)-1]+1)))
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, filter.Until.UTC())
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *sqliteStore) FindEdits(filter RecordFilter) ([]*EditHistory, error) {
+	where, args := filterClause(filter, "path")
+	return queryAll(s, scanEdit, `SELECT `+editColumns+` FROM edits`+where+` ORDER BY id DESC`+limitClause(filter.Limit), args...)
+}
+
+const checkpointColumns = "id, name, description, timestamp, file_count, files, skipped, git_commit"
+
+func scanCheckpoint(row rowScanner) (*Checkpoint, error) {
+	var c Checkpoint
+	var files, skipped string
+	if err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Timestamp, &c.FileCount, &files, &skipped, &c.GitCommit); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(files), &c.Files); err != nil {
+		return nil, fmt.Errorf("checkpoint %d has corrupt files: %w", c.ID, err)
+	}
+	if err := json.Unmarshal([]byte(skipped), &c.Skipped); err != nil {
+		return nil, fmt.Errorf("checkpoint %d has corrupt skipped list: %w", c.ID, err)
+	}
+	return &c, nil
+}
+
+func (s *sqliteStore) PutCheckpoint(checkpoint *Checkpoint) error {
+	files, err := json.Marshal(checkpoint.Files)
+	if err != nil {
+		return err
+	}
+	skipped, err := json.Marshal(checkpoint.Skipped)
+	if err != nil {
+		return err
+	}
+	return s.upsert("checkpoints", &checkpoint.ID,
+		[]string{"name", "description", "timestamp", "file_count", "files", "skipped", "git_commit"},
+		checkpoint.Name, checkpoint.Description, checkpoint.Timestamp.UTC(), checkpoint.FileCount, string(files), string(skipped), checkpoint.GitCommit)
+}
+
+func (s *sqliteStore) GetCheckpoint(id int) (*Checkpoint, error) {
+	checkpoint, err := scanCheckpoint(s.q.QueryRow(`SELECT `+checkpointColumns+` FROM checkpoints WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("checkpoint %d not found", id)
+	}
+	return checkpoint, err
+}
+
+func (s *sqliteStore) ListCheckpoints() ([]*Checkpoint, error) {
+	return queryAll(s, scanCheckpoint, `SELECT `+checkpointColumns+` FROM checkpoints ORDER BY timestamp DESC, id DESC`)
+}
+
+func (s *sqliteStore) FindCheckpoints(filter RecordFilter) ([]*Checkpoint, error) {
+	where, args := filterClause(filter, "")
+	return queryAll(s, scanCheckpoint, `SELECT `+checkpointColumns+` FROM checkpoints`+where+` ORDER BY timestamp DESC, id DESC`+limitClause(filter.Limit), args...)
+}
+
+func scanMCPIntegration(row rowScanner) (*MCPIntegration, error) {
+	var m MCPIntegration
+	var config string
+	if err := row.Scan(&m.ID, &m.Name, &m.Type, &config, &m.CreatedAt, &m.IsActive); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(config), &m.Config); err != nil {
+		return nil, fmt.Errorf("MCP integration %d has corrupt config: %w", m.ID, err)
+	}
+	return &m, nil
+}
+
+func (s *sqliteStore) PutMCPIntegration(integration *MCPIntegration) error {
+	config, err := json.Marshal(integration.Config)
+	if err != nil {
+		return err
+	}
+	return s.upsert("mcp_integrations", &integration.ID,
+		[]string{"name", "type", "config", "created_at", "is_active"},
+		integration.Name, integration.Type, string(config), integration.CreatedAt.UTC(), integration.IsActive)
+}
+
+func (s *sqliteStore) ListMCPIntegrations() ([]*MCPIntegration, error) {
+	return queryAll(s, scanMCPIntegration, `SELECT id, name, type, config, created_at, is_active FROM mcp_integrations ORDER BY id`)
+}
+
+func scanMultiplayerAction(row rowScanner) (*MultiplayerAction, error) {
+	var a MultiplayerAction
+	err := row.Scan(&a.ID, &a.User, &a.Action, &a.Data, &a.Timestamp)
+	return &a, err
+}
+
+func (s *sqliteStore) PutMultiplayerAction(action *MultiplayerAction) error {
+	return s.upsert("multiplayer_actions", &action.ID,
+		[]string{"user", "action", "data", "timestamp"},
+		action.User, action.Action, action.Data, action.Timestamp.UTC())
+}
+
+func (s *sqliteStore) ListMultiplayerActions(limit int) ([]*MultiplayerAction, error) {
+	return queryAll(s, scanMultiplayerAction,
+		`SELECT id, user, action, data, timestamp FROM multiplayer_actions ORDER BY timestamp DESC, id DESC`+limitClause(limit))
+}
+
+func (s *sqliteStore) FindMultiplayerActions(filter RecordFilter) ([]*MultiplayerAction, error) {
+	where, args := filterClause(filter, "")
+	return queryAll(s, scanMultiplayerAction,
+		`SELECT id, user, action, data, timestamp FROM multiplayer_actions`+where+` ORDER BY timestamp DESC, id DESC`+limitClause(filter.Limit), args...)
+}
+
+func (s *sqliteStore) PutBlob(hash string, content []byte) error {
+	if content == nil {
+		content = []byte{}
+	}
+	_, err := s.q.Exec(`INSERT INTO blobs (hash, content, stored_at) VALUES (?, ?, ?)
+		ON CONFLICT(hash) DO UPDATE SET stored_at = excluded.stored_at`, hash, content, time.Now().UTC())
+	return err
+}
+
+func (s *sqliteStore) GetBlob(hash string) ([]byte, error) {
+	var content []byte
+	err := s.q.QueryRow(`SELECT content FROM blobs WHERE hash = ?`, hash).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("blob %s not found", hash)
+	}
+	return content, err
+}
+
+func (s *sqliteStore) ListBlobs() ([]BlobInfo, error) {
+	blobs, err := queryAll(s, func(row rowScanner) (*BlobInfo, error) {
+		var blob BlobInfo
+		var storedAt sql.NullTime
+		err := row.Scan(&blob.Hash, &blob.Size, &storedAt)
+		blob.StoredAt = storedAt.Time
+		return &blob, err
+	}, `SELECT hash, LENGTH(content), stored_at FROM blobs ORDER BY hash`)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]BlobInfo, len(blobs))
+	for i, blob := range blobs {
+		result[i] = *blob
+	}
+	return result, nil
+}
+
+func (s *sqliteStore) DeleteBlob(hash string, storedBefore time.Time) (bool, error) {
+	result, err := s.q.Exec(`DELETE FROM blobs WHERE hash = ? AND (stored_at IS NULL OR stored_at <= ?)`, hash, storedBefore.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqliteStore) DeleteRecords(table string, ids []int) error {
+	name, ok := sqliteTableNames[table]
+	if !ok {
+		return fmt.Errorf("unknown table %q", table)
+	}
+
+	// Stay well below SQLite's limit on query parameters
+	const batch = 500
+	for start := 0; start < len(ids); start += batch {
+		chunk := ids[start:min(start+batch, len(ids))]
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+		if _, err := s.q.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", name, placeholders), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact runs VACUUM, which rebuilds the database file without free pages
+func (s *sqliteStore) Compact() error {
+	if s.db == nil {
+		return fmt.Errorf("cannot compact inside a transaction")
+	}
+	_, err := s.db.Exec(`VACUUM`)
+	return err
+}
+
+// Snapshot copies the database with VACUUM INTO, which reads it in one
+// transaction, and hands the copy to fn in place of the live database file
+// and its journals
+func (s *sqliteStore) Snapshot(fn func(replacements map[string]string) error) error {
+	if s.db == nil {
+		return fmt.Errorf("cannot snapshot inside a transaction")
+	}
+	dir, err := os.MkdirTemp("", "eve-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, sqliteDatabaseName)
+	if _, err := s.db.Exec(`VACUUM INTO ?`, snapshot); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return fn(map[string]string{
+		sqliteDatabaseName:              snapshot,
+		sqliteDatabaseName + "-wal":     "",
+		sqliteDatabaseName + "-shm":     "",
+		sqliteDatabaseName + "-journal": "",
+	})
+}
+
+// Stats reports the stored size of each table as the length of its values;
+// the page overhead is part of DiskBytes only
+func (s *sqliteStore) Stats() (*StorageStats, error) {
+	stats := &StorageStats{}
+	tables := append([]string{}, storageTables...)
+	for _, table := range append(tables, "blobs") {
+		name := table
+		if mapped, ok := sqliteTableNames[table]; ok {
+			name = mapped
+		}
+		columns, err := s.tableColumns(name)
+		if err != nil {
+			return nil, err
+		}
+		lengths := make([]string, len(columns))
+		for i, column := range columns {
+			lengths[i] = fmt.Sprintf("IFNULL(LENGTH(%s), 0)", column)
+		}
+
+		usage := TableStats{Table: table}
+		query := fmt.Sprintf("SELECT COUNT(*), IFNULL(SUM(%s), 0) FROM %s", strings.Join(lengths, " + "), name)
+		if err := s.q.QueryRow(query).Scan(&usage.Records, &usage.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to measure %s: %w", name, err)
+		}
+		stats.Tables = append(stats.Tables, usage)
+	}
+
+	var pageSize, pages, free int64
+	for pragma, value := range map[string]*int64{"page_size": &pageSize, "page_count": &pages, "freelist_count": &free} {
+		if err := s.q.QueryRow("PRAGMA " + pragma).Scan(value); err != nil {
+			return nil, err
+		}
+	}
+	stats.DiskBytes = pages * pageSize
+	stats.FreeBytes = free * pageSize
+	return stats, nil
+}
+
+// tableColumns returns the column names of a table
+func (s *sqliteStore) tableColumns(table string) ([]string, error) {
+	columns, err := queryAll(s, func(row rowScanner) (*string, error) {
+		var name string
+		err := row.Scan(&name)
+		return &name, err
+	}, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, len(columns))
+	for i, column := range columns {
+		result[i] = *column
+	}
+	return result, nil
+}
+
+func (s *sqliteStore) GetState(key string, value interface{}) (bool, error) {
+	var data string
+	err := s.q.QueryRow(`SELECT value FROM state WHERE key = ?`, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(data), value)
+}
+
+func (s *sqliteStore) PutState(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.q.Exec(`INSERT OR REPLACE INTO state (key, value) VALUES (?, ?)`, key, string(data))
+	return err
+}
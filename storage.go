@@ -0,0 +1,340 @@
+// storage.go - Storage backends for the project database and migration between them
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Storage persists project records. ProjectDatabase implements versioning
+// and defaults on top of it; a Storage only reads and writes records.
+//
+// Put methods insert a record and assign its ID when the ID is zero, and
+// replace the record with that ID otherwise.
+type Storage interface {
+	Name() string
+
+	PutFile(file *ProjectFile) error
+	GetFile(path string) (*ProjectFile, error) // active file with that path
+	ListFiles() ([]*ProjectFile, error)        // active files
+	ListAllFiles() ([]*ProjectFile, error)     // every file record, including deleted files
+
+	PutFileVersion(version *FileVersion) error
+	ListFileVersions(path string) ([]*FileVersion, error) // oldest first, all paths when path is empty
+
+	PutEdit(edit *EditHistory) error
+	ListEdits(path string, limit int) ([]*EditHistory, error) // newest first, all paths when path is empty
+
+	PutCheckpoint(checkpoint *Checkpoint) error
+	GetCheckpoint(id int) (*Checkpoint, error)
+	ListCheckpoints() ([]*Checkpoint, error) // newest first
+
+	PutMCPIntegration(integration *MCPIntegration) error
+	ListMCPIntegrations() ([]*MCPIntegration, error) // all, including inactive
+
+	PutMultiplayerAction(action *MultiplayerAction) error
+	ListMultiplayerActions(limit int) ([]*MultiplayerAction, error) // newest first
+
+	// FindEdits, FindCheckpoints and FindMultiplayerActions list the
+	// records selected by filter, newest first
+	FindEdits(filter RecordFilter) ([]*EditHistory, error)
+	FindCheckpoints(filter RecordFilter) ([]*Checkpoint, error)
+	FindMultiplayerActions(filter RecordFilter) ([]*MultiplayerAction, error)
+
+	// PutBlob stores content under hash. If the blob exists, only its
+	// storage time is refreshed.
+	PutBlob(hash string, content []byte) error
+	GetBlob(hash string) ([]byte, error)
+	ListBlobs() ([]BlobInfo, error)
+	// DeleteBlob removes a blob unless it was stored after storedBefore,
+	// and reports whether it was removed
+	DeleteBlob(hash string, storedBefore time.Time) (bool, error)
+
+	// DeleteRecords removes records by ID from one of storageTables
+	DeleteRecords(table string, ids []int) error
+
+	// GetState loads a small JSON value stored under key into value and
+	// reports whether it was found
+	GetState(key string, value interface{}) (bool, error)
+	PutState(key string, value interface{}) error
+
+	// Transaction runs fn against a view of the storage whose writes are
+	// committed together, or not at all if fn returns an error
+	Transaction(fn func(Storage) error) error
+
+	// Snapshot runs fn while the stored records cannot change, so the
+	// backend's files can be copied consistently. replacements maps file
+	// names in the project directory to consistent copies to use instead,
+	// or to "" for files that must not be copied.
+	Snapshot(fn func(replacements map[string]string) error) error
+
+	// Compact rewrites the storage to release the space of removed records
+	Compact() error
+	Stats() (*StorageStats, error)
+
+	Close() error
+}
+
+// storageTables are the record tables, by their file store directory names
+var storageTables = []string{"files", "versions", "edits", "checkpoints", "mcp", "multiplayer"}
+
+// RecordFilter selects records by path and time. Zero fields do not
+// filter; the path fields only apply to edits.
+type RecordFilter struct {
+	Path       string    // exact path
+	PathPrefix string    // directory ending in "/"
+	Since      time.Time // inclusive
+	Until      time.Time // exclusive
+	Limit      int       // newest matches
+}
+
+// matches reports whether a record with path p at time t is selected
+func (f RecordFilter) matches(p string, t time.Time) bool {
+	return (f.Path == "" || p == f.Path) && strings.HasPrefix(p, f.PathPrefix) &&
+		(f.Since.IsZero() || !t.Before(f.Since)) && (f.Until.IsZero() || t.Before(f.Until))
+}
+
+// withoutPath returns the filter without its path fields, for records that
+// have no path
+func (f RecordFilter) withoutPath() RecordFilter {
+	f.Path, f.PathPrefix = "", ""
+	return f
+}
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Hash     string
+	Size     int64
+	StoredAt time.Time // when the blob was last stored; zero if unknown
+}
+
+// TableStats is the space used by one table
+type TableStats struct {
+	Table   string
+	Records int
+	Bytes   int64 // size of the records
+	Files   int   // files holding them on disk; 0 when they live in a database file
+}
+
+// StorageStats summarizes the space used by a storage backend
+type StorageStats struct {
+	Tables    []TableStats // storageTables followed by blobs
+	DiskBytes int64        // size of everything the backend keeps on disk
+	FreeBytes int64        // unused space that Compact would release
+}
+
+// Storage backends selectable with EVE_DB_BACKEND
+const (
+	StorageFile   = "file"
+	StorageSQLite = "sqlite"
+)
+
+// sqliteDatabaseName is the SQLite database file inside the project directory
+const sqliteDatabaseName = "eve.db"
+
+// storageBackend picks the backend for projectDir: EVE_DB_BACKEND if set,
+// otherwise SQLite once a database has been created there, otherwise files
+func storageBackend(projectDir string) string {
+	if backend := os.Getenv("EVE_DB_BACKEND"); backend != "" {
+		return backend
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, sqliteDatabaseName)); err == nil {
+		return StorageSQLite
+	}
+	return StorageFile
+}
+
+// openStorage opens the named backend in projectDir
+func openStorage(backend, projectDir string) (Storage, error) {
+	switch backend {
+	case StorageFile:
+		return newFileStore(projectDir), nil
+	case StorageSQLite:
+		return openSQLiteStore(filepath.Join(projectDir, sqliteDatabaseName))
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (use %s or %s)", backend, StorageFile, StorageSQLite)
+	}
+}
+
+// storageCounts summarizes how many records of each kind were copied
+type storageCounts struct {
+	Files, Versions, Edits, Checkpoints, MCP, Multiplayer, Blobs, State int
+}
+
+// storageStateKeys are the state values copied by a migration
+var storageStateKeys = []string{"redo_stack", "working_tree", "maintenance"}
+
+// copyStorage copies every record from src into dst inside one transaction,
+// keeping record IDs so edit history stays linked to its files
+func copyStorage(src, dst Storage) (storageCounts, error) {
+	var counts storageCounts
+
+	// Deleted files are copied too: their versions and edits refer to them
+	files, err := src.ListAllFiles()
+	if err != nil {
+		return counts, err
+	}
+	versions, err := src.ListFileVersions("")
+	if err != nil {
+		return counts, err
+	}
+	edits, err := src.ListEdits("", 0)
+	if err != nil {
+		return counts, err
+	}
+	checkpoints, err := src.ListCheckpoints()
+	if err != nil {
+		return counts, err
+	}
+	integrations, err := src.ListMCPIntegrations()
+	if err != nil {
+		return counts, err
+	}
+	actions, err := src.ListMultiplayerActions(0)
+	if err != nil {
+		return counts, err
+	}
+	blobs, err := src.ListBlobs()
+	if err != nil {
+		return counts, err
+	}
+
+	err = dst.Transaction(func(tx Storage) error {
+		for _, file := range files {
+			if err := tx.PutFile(file); err != nil {
+				return fmt.Errorf("file %d: %w", file.ID, err)
+			}
+		}
+		for _, version := range versions {
+			if err := tx.PutFileVersion(version); err != nil {
+				return fmt.Errorf("file version %d: %w", version.ID, err)
+			}
+		}
+		for _, edit := range edits {
+			if err := tx.PutEdit(edit); err != nil {
+				return fmt.Errorf("edit %d: %w", edit.ID, err)
+			}
+		}
+		for _, checkpoint := range checkpoints {
+			if err := tx.PutCheckpoint(checkpoint); err != nil {
+				return fmt.Errorf("checkpoint %d: %w", checkpoint.ID, err)
+			}
+		}
+		for _, integration := range integrations {
+			if err := tx.PutMCPIntegration(integration); err != nil {
+				return fmt.Errorf("MCP integration %d: %w", integration.ID, err)
+			}
+		}
+		for _, action := range actions {
+			if err := tx.PutMultiplayerAction(action); err != nil {
+				return fmt.Errorf("multiplayer action %d: %w", action.ID, err)
+			}
+		}
+		for _, blob := range blobs {
+			content, err := src.GetBlob(blob.Hash)
+			if err != nil {
+				return err
+			}
+			if err := tx.PutBlob(blob.Hash, content); err != nil {
+				return fmt.Errorf("blob %s: %w", blob.Hash, err)
+			}
+		}
+		for _, key := range storageStateKeys {
+			var value interface{}
+			found, err := src.GetState(key, &value)
+			if err != nil {
+				return fmt.Errorf("state %s: %w", key, err)
+			}
+			if found {
+				if err := tx.PutState(key, value); err != nil {
+					return fmt.Errorf("state %s: %w", key, err)
+				}
+				counts.State++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return storageCounts{}, err
+	}
+
+	counts.Files = len(files)
+	counts.Versions = len(versions)
+	counts.Edits = len(edits)
+	counts.Checkpoints = len(checkpoints)
+	counts.MCP = len(integrations)
+	counts.Multiplayer = len(actions)
+	counts.Blobs = len(blobs)
+	return counts, nil
+}
+
+// MigrateStorage copies the records of the project in projectDir from one
+// backend to another. The target must be empty; the source is left untouched.
+func MigrateStorage(projectDir, from, to string) (string, error) {
+	if from == to {
+		return "", fmt.Errorf("source and target backend are both %s", from)
+	}
+
+	src, err := openStorage(from, projectDir)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	sqlitePath := filepath.Join(projectDir, sqliteDatabaseName)
+	_, statErr := os.Stat(sqlitePath)
+	createdSQLite := to == StorageSQLite && os.IsNotExist(statErr)
+
+	dst, err := openStorage(to, projectDir)
+	if err != nil {
+		return "", err
+	}
+	success := false
+	defer func() {
+		dst.Close()
+		// An empty database left behind would be picked up as the active store
+		if !success && createdSQLite {
+			os.Remove(sqlitePath)
+		}
+	}()
+
+	existing, err := dst.ListEdits("", 1)
+	if err != nil {
+		return "", err
+	}
+	files, err := dst.ListFiles()
+	if err != nil {
+		return "", err
+	}
+	checkpoints, err := dst.ListCheckpoints()
+	if err != nil {
+		return "", err
+	}
+	if len(existing)+len(files)+len(checkpoints) > 0 {
+		return "", fmt.Errorf("the %s store in %s already contains records; refusing to merge", to, projectDir)
+	}
+
+	counts, err := copyStorage(src, dst)
+	if err != nil {
+		return "", fmt.Errorf("migration to %s failed: %w", to, err)
+	}
+	success = true
+
+	note := ""
+	if from == StorageSQLite {
+		// Stop the SQLite database from being picked up automatically
+		src.Close()
+		if err := os.Rename(sqlitePath, sqlitePath+".migrated"); err != nil {
+			return "", fmt.Errorf("records copied but %s could not be renamed: %w", sqlitePath, err)
+		}
+		note = fmt.Sprintf("\n%s was renamed to %s.migrated", sqlitePath, sqliteDatabaseName)
+	} else {
+		note = fmt.Sprintf("\nThe JSON records in %s were left in place and are no longer used", projectDir)
+	}
+
+	return fmt.Sprintf("Migrated %s store to %s in %s: %d files, %d file versions, %d edits, %d checkpoints, %d MCP integrations, %d multiplayer actions, %d blobs",
+		from, to, projectDir, counts.Files, counts.Versions, counts.Edits, counts.Checkpoints, counts.MCP, counts.Multiplayer, counts.Blobs) + note, nil
+}
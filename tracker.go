@@ -0,0 +1,244 @@
+// tracker.go - Keeps the project database in step with the working tree
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// trackerExternal is the source of changes made outside EVE's tools
+const trackerExternal = "external"
+
+// trackedFile is what the tracker remembers about a file between scans
+type trackedFile struct {
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// WorkingTreeTracker scans the working tree and records every file whose
+// content changed in the project database, whoever changed it. The last
+// scan is persisted, so edits made while EVE was not running are detected
+// at the next session start.
+type WorkingTreeTracker struct {
+	root     string
+	mu       sync.Mutex
+	files    map[string]trackedFile // state after the last scan
+	baseline bool                   // whether a previous scan exists
+}
+
+// NewWorkingTreeTracker returns a tracker for root, or nil when the project
+// database is unavailable or EVE_TRACK_WORKING_TREE is "0", "false" or "off"
+func NewWorkingTreeTracker(root string) *WorkingTreeTracker {
+	if globalDB == nil {
+		return nil
+	}
+	switch os.Getenv("EVE_TRACK_WORKING_TREE") {
+	case "0", "false", "off":
+		return nil
+	}
+
+	t := &WorkingTreeTracker{root: root, files: map[string]trackedFile{}}
+	found, err := globalDB.LoadWorkingTreeState(&t.files)
+	if err != nil {
+		// Without the previous scan every file is simply re-checked against the database
+		t.files = map[string]trackedFile{}
+		found = false
+	}
+	t.baseline = found
+	return t
+}
+
+// HasBaseline reports whether a scan from an earlier session was loaded
+func (t *WorkingTreeTracker) HasBaseline() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.baseline
+}
+
+// Count returns the number of files tracked by the last scan
+func (t *WorkingTreeTracker) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.files)
+}
+
+// Sync scans the working tree, honouring ignore files, and saves every new
+// or changed file as a new version in the project database; files that
+// disappeared are marked deleted. All changes are saved in one transaction.
+// source names who made the changes: a tool name or trackerExternal.
+// Unchanged files are recognized by size and modification time without
+// being read.
+func (t *WorkingTreeTracker) Sync(source string) ([]checkpointChange, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	note := "changed outside EVE"
+	switch {
+	case !t.baseline:
+		note = "first working tree scan"
+	case source != trackerExternal:
+		note = "changed by " + source
+	}
+
+	current := map[string]trackedFile{}
+	var changes []checkpointChange
+	var saves []pendingFileVersion
+	var deleted []string
+	dirty := false
+	err := walkIgnoring(t.root, false, func(relPath string, d fs.DirEntry) error {
+		if d.IsDir() || checkpointExcluded[relPath] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > checkpointMaxFileSize {
+			return nil
+		}
+
+		previous, known := t.files[relPath]
+		if known && previous.Size == info.Size() && previous.ModTime.Equal(info.ModTime()) {
+			current[relPath] = previous
+			return nil
+		}
+
+		content, err := os.ReadFile(filepath.Join(t.root, filepath.FromSlash(relPath)))
+		if err != nil {
+			// Removed while scanning; the next scan records the deletion
+			return nil
+		}
+		file := trackedFile{Hash: contentHash(string(content)), Size: info.Size(), ModTime: info.ModTime()}
+		current[relPath] = file
+		dirty = true
+		if known && previous.Hash == file.Hash {
+			return nil
+		}
+
+		saves = append(saves, pendingFileVersion{Path: relPath, Content: string(content), Note: note})
+		change := checkpointChange{Path: relPath, Operation: "create", New: CheckpointFile{Hash: file.Hash, Mode: info.Mode().Perm(), Size: file.Size}}
+		if known {
+			change.Operation = "modify"
+			change.Old = CheckpointFile{Hash: previous.Hash, Size: previous.Size}
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for path, previous := range t.files {
+		if _, ok := current[path]; ok {
+			continue
+		}
+		deleted = append(deleted, path)
+		changes = append(changes, checkpointChange{Path: path, Operation: "delete", Old: CheckpointFile{Hash: previous.Hash, Size: previous.Size}})
+		dirty = true
+	}
+	if err := globalDB.saveFileVersions(saves, deleted); err != nil {
+		return nil, fmt.Errorf("failed to record changes: %w", err)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	t.files = current
+	if dirty || !t.baseline {
+		if err := globalDB.SaveWorkingTreeState(current); err != nil {
+			return changes, fmt.Errorf("failed to save working tree state: %w", err)
+		}
+		t.baseline = true
+	}
+	return changes, nil
+}
+
+// trackerMaxReported caps the external changes listed for the model
+const trackerMaxReported = 50
+
+// startTracking runs the session-start scan. Changes found against the
+// previous session's scan were made outside EVE.
+func (a *GenericAgent) startTracking() {
+	if a.tracker == nil {
+		return
+	}
+
+	fresh := !a.tracker.HasBaseline()
+	changes, err := a.tracker.Sync(trackerExternal)
+	if err != nil {
+		fmt.Printf("⚠️  Working tree tracking failed: %s\n", err.Error())
+		return
+	}
+	if fresh {
+		fmt.Printf("📂 Tracking %d files in the project database\n", a.tracker.Count())
+		return
+	}
+	a.noteExternalChanges(changes)
+}
+
+// noteExternalChanges reports external edits and keeps them for the next message
+func (a *GenericAgent) noteExternalChanges(changes []checkpointChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("📝 %d files changed outside EVE:\n%s", len(changes), formatChangeList(changes))
+	a.externalChanges = append(a.externalChanges, changes...)
+}
+
+// syncAfterTool records the changes made by a tool that can modify files and
+// has the repository map rebuilt before the next request
+func (a *GenericAgent) syncAfterTool(name string) {
+	if !a.tools.Mutating(name) {
+		return
+	}
+	a.repoMapValid = false
+	if a.tracker != nil {
+		a.syncWorkingTree(name)
+	}
+}
+
+// syncWorkingTree records the changes made by source, a tool or slash command
+func (a *GenericAgent) syncWorkingTree(source string) {
+	if a.tracker == nil {
+		return
+	}
+
+	changes, err := a.tracker.Sync(source)
+	if err != nil {
+		fmt.Printf("⚠️  Working tree tracking failed: %s\n", err.Error())
+		return
+	}
+	if a.verbose && len(changes) > 0 {
+		log.Printf("Recorded %d files changed by %s", len(changes), source)
+	}
+}
+
+// withExternalChanges scans for edits made since the last turn and, if
+// there are any, tells the model about them ahead of the user's message
+func (a *GenericAgent) withExternalChanges(userInput string) string {
+	if a.tracker == nil {
+		return userInput
+	}
+
+	changes, err := a.tracker.Sync(trackerExternal)
+	if err != nil {
+		fmt.Printf("⚠️  Working tree tracking failed: %s\n", err.Error())
+	} else {
+		a.noteExternalChanges(changes)
+	}
+	if len(a.externalChanges) == 0 {
+		return userInput
+	}
+
+	reported := a.externalChanges
+	a.externalChanges = nil
+	note := "[Files changed outside EVE since the last message:\n"
+	if len(reported) > trackerMaxReported {
+		note += formatChangeList(reported[:trackerMaxReported]) + fmt.Sprintf("... and %d more\n", len(reported)-trackerMaxReported)
+	} else {
+		note += formatChangeList(reported)
+	}
+	return note + "]\n\n" + userInput
+}
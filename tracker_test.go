@@ -0,0 +1,151 @@
+// tracker_test.go - Working tree scans recorded in the project database
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTestDatabase makes pdb the global project database for the test
+func useTestDatabase(t *testing.T, pdb *ProjectDatabase) {
+	t.Helper()
+	previous := globalDB
+	globalDB = pdb
+	t.Cleanup(func() { globalDB = previous })
+}
+
+// checkChanges verifies the operation reported for each changed path
+func checkChanges(t *testing.T, changes []checkpointChange, want map[string]string) {
+	t.Helper()
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes %v, want %v", len(changes), changes, want)
+	}
+	for _, change := range changes {
+		if want[change.Path] != change.Operation {
+			t.Errorf("%s: got %q, want %q", change.Path, change.Operation, want[change.Path])
+		}
+	}
+}
+
+func TestWorkingTreeTrackerSync(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			root := t.TempDir()
+			pdb := openTestDatabase(t, backend, t.TempDir())
+			defer pdb.Close()
+			useTestDatabase(t, pdb)
+			if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, filepath.Join(root, "a.txt"), "one\n")
+			writeTestFile(t, filepath.Join(root, "dir", "b.txt"), "two\n")
+			writeTestFile(t, filepath.Join(root, "gone.txt"), "bye\n")
+
+			tracker := NewWorkingTreeTracker(root)
+			if tracker.HasBaseline() {
+				t.Fatal("new tracker has a baseline")
+			}
+			changes, err := tracker.Sync(trackerExternal)
+			if err != nil {
+				t.Fatalf("first Sync: %v", err)
+			}
+			checkChanges(t, changes, map[string]string{"a.txt": "create", "dir/b.txt": "create", "gone.txt": "create"})
+			versions, err := pdb.FileVersions("a.txt")
+			if err != nil || len(versions) != 1 || versions[0].Note != "first working tree scan" {
+				t.Fatalf("versions of a.txt after first scan = %v, %v", versions, err)
+			}
+
+			// Unchanged files are not recorded again
+			changes, err = tracker.Sync(trackerExternal)
+			if err != nil || len(changes) != 0 {
+				t.Fatalf("unchanged Sync = %v, %v", changes, err)
+			}
+
+			writeTestFile(t, filepath.Join(root, "a.txt"), "one, edited\n")
+			later := time.Now().Add(time.Minute)
+			if err := os.Chtimes(filepath.Join(root, "a.txt"), later, later); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, filepath.Join(root, "c.txt"), "three\n")
+			if err := os.Remove(filepath.Join(root, "gone.txt")); err != nil {
+				t.Fatal(err)
+			}
+			changes, err = tracker.Sync("write_file")
+			if err != nil {
+				t.Fatalf("second Sync: %v", err)
+			}
+			checkChanges(t, changes, map[string]string{"a.txt": "modify", "c.txt": "create", "gone.txt": "delete"})
+
+			versions, err = pdb.FileVersions("a.txt")
+			if err != nil || len(versions) != 2 || versions[1].Version != 2 || versions[1].Note != "changed by write_file" {
+				t.Fatalf("versions of a.txt after edit = %v, %v", versions, err)
+			}
+			if file, err := pdb.GetFile("a.txt"); err != nil || file.Content != "one, edited\n" {
+				t.Fatalf("GetFile(a.txt) = %v, %v", file, err)
+			}
+			if _, err := pdb.GetFile("gone.txt"); err == nil {
+				t.Fatal("deleted file is still active")
+			}
+
+			// A new tracker picks up the saved scan
+			if !NewWorkingTreeTracker(root).HasBaseline() {
+				t.Fatal("scan state was not saved")
+			}
+		})
+	}
+}
+
+func TestWorkingTreeTrackerRecreatedFile(t *testing.T) {
+	root := t.TempDir()
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	useTestDatabase(t, pdb)
+	writeTestFile(t, filepath.Join(root, "a.txt"), "one\n")
+
+	tracker := NewWorkingTreeTracker(root)
+	if _, err := tracker.Sync(trackerExternal); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracker.Sync(trackerExternal); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, "a.txt"), "two\n")
+	if _, err := tracker.Sync(trackerExternal); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recreated file continues the path's version numbering
+	versions, err := pdb.FileVersions("a.txt")
+	if err != nil || len(versions) != 2 || versions[1].Version != 2 {
+		t.Fatalf("versions of a.txt = %v, %v", versions, err)
+	}
+}
+
+func TestWorkingTreeTrackerFirstScanManyFiles(t *testing.T) {
+	root := t.TempDir()
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	useTestDatabase(t, pdb)
+	const count = 300
+	for i := 0; i < count; i++ {
+		writeTestFile(t, filepath.Join(root, fmt.Sprintf("f%03d.txt", i)), fmt.Sprintf("file %d\n", i))
+	}
+
+	changes, err := NewWorkingTreeTracker(root).Sync(trackerExternal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != count {
+		t.Fatalf("got %d changes, want %d", len(changes), count)
+	}
+	files, err := pdb.ListFiles()
+	if err != nil || len(files) != count {
+		t.Fatalf("ListFiles = %d files, %v", len(files), err)
+	}
+}
@@ -0,0 +1,247 @@
+// undo.go - Undo/redo of tool-driven file changes
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UndoEditsInput is the input for the undo_edits tool
+type UndoEditsInput struct {
+	Count int  `json:"count,omitempty" jsonschema_description:"Number of tool-driven changes to revert (default 1). Each edit_file or apply_patch call counts as one change."`
+	Redo  bool `json:"redo,omitempty" jsonschema_description:"Re-apply previously undone changes instead of undoing."`
+}
+
+var UndoEditsInputSchema = GenerateSchema[UndoEditsInput]()
+
+func UndoEdits(input json.RawMessage) (string, error) {
+	var undoInput UndoEditsInput
+	if err := json.Unmarshal(input, &undoInput); err != nil {
+		return "", fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	if undoInput.Redo {
+		return RedoChanges(undoInput.Count)
+	}
+	return UndoChanges(undoInput.Count)
+}
+
+var UndoEditsDefinition = ToolDefinition{
+	Name:        "undo_edits",
+	Description: "Undo (or redo) the most recent file changes made by tools, including edits, file creations and deletions. Refuses to touch files that were modified by something else since the change.",
+	InputSchema: UndoEditsInputSchema,
+	Function:    UndoEdits,
+}
+
+// UndoChanges reverts the last count change groups that are not already undone
+func UndoChanges(count int) (string, error) {
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	if count <= 0 {
+		count = 1
+	}
+
+	edits, err := globalDB.GetEditHistory("", 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to load edit history: %w", err)
+	}
+
+	var active []*EditHistory
+	for _, e := range edits {
+		if !e.Undone {
+			active = append(active, e)
+		}
+	}
+	groups := groupEdits(active)
+	if len(groups) == 0 {
+		return "Nothing to undo", nil
+	}
+
+	redoStack := globalDB.LoadRedoStack()
+	var report []string
+	var failure error
+	for _, group := range groups[:min(count, len(groups))] {
+		// Entries are newest first, which is the order they must be reverted in
+		if failure = checkEditState(group, true); failure != nil {
+			break
+		}
+		undone := 0
+		for _, e := range group {
+			if err := restoreEditSide(e.Path, e.OldHash, e.Mode); err != nil {
+				failure = fmt.Errorf("failed to undo change to %s: %w", e.Path, err)
+				break
+			}
+			e.Undone = true
+			if err := globalDB.UpdateEdit(e); err != nil {
+				log.Printf("Failed to mark edit %d as undone: %v", e.ID, err)
+			}
+			undone++
+			report = append(report, fmt.Sprintf("undid %s of %s (%s)", e.Operation, e.Path, e.Tool))
+		}
+		// A partly undone group can still be redone
+		if id := group[0].Group; undone > 0 && (len(redoStack) == 0 || redoStack[len(redoStack)-1] != id) {
+			redoStack = append(redoStack, id)
+		}
+		if failure != nil {
+			break
+		}
+	}
+
+	if err := globalDB.SaveRedoStack(redoStack); err != nil {
+		log.Printf("Failed to save redo stack: %v", err)
+	}
+
+	return undoReport(report, failure)
+}
+
+// RedoChanges re-applies the last count undone change groups
+func RedoChanges(count int) (string, error) {
+	if globalDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	if count <= 0 {
+		count = 1
+	}
+
+	redoStack := globalDB.LoadRedoStack()
+	if len(redoStack) == 0 {
+		return "Nothing to redo", nil
+	}
+
+	edits, err := globalDB.GetEditHistory("", 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to load edit history: %w", err)
+	}
+
+	var report []string
+	var failure error
+	for i := 0; i < count && len(redoStack) > 0; i++ {
+		groupID := redoStack[len(redoStack)-1]
+
+		// Collect the group oldest first so changes are replayed in their original order
+		var group []*EditHistory
+		for j := len(edits) - 1; j >= 0; j-- {
+			if edits[j].Group == groupID && edits[j].Undone {
+				group = append(group, edits[j])
+			}
+		}
+
+		if failure = checkEditState(group, false); failure != nil {
+			break
+		}
+		for _, e := range group {
+			if err := restoreEditSide(e.Path, e.NewHash, e.Mode); err != nil {
+				failure = fmt.Errorf("failed to redo change to %s: %w", e.Path, err)
+				break
+			}
+			e.Undone = false
+			if err := globalDB.UpdateEdit(e); err != nil {
+				log.Printf("Failed to mark edit %d as redone: %v", e.ID, err)
+			}
+			report = append(report, fmt.Sprintf("redid %s of %s (%s)", e.Operation, e.Path, e.Tool))
+		}
+		if failure != nil {
+			// The group stays on the stack so its remaining edits can be redone
+			break
+		}
+		redoStack = redoStack[:len(redoStack)-1]
+	}
+
+	if err := globalDB.SaveRedoStack(redoStack); err != nil {
+		log.Printf("Failed to save redo stack: %v", err)
+	}
+
+	return undoReport(report, failure)
+}
+
+// undoReport combines the changes made by undo or redo with the error that
+// stopped it. The error is only returned if nothing was changed.
+func undoReport(report []string, failure error) (string, error) {
+	if failure == nil {
+		return strings.Join(report, "\n"), nil
+	}
+	if len(report) == 0 {
+		return "", failure
+	}
+	report = append(report, fmt.Sprintf("stopped: %v", failure))
+	return strings.Join(report, "\n"), nil
+}
+
+// groupEdits splits newest-first edits into change groups, newest group first
+func groupEdits(edits []*EditHistory) [][]*EditHistory {
+	var groups [][]*EditHistory
+	index := make(map[string]int)
+	for _, e := range edits {
+		key := e.Group
+		if key == "" {
+			// Entries recorded before grouping existed are undone one at a time
+			key = fmt.Sprintf("edit-%d", e.ID)
+		}
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], e)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []*EditHistory{e})
+	}
+	return groups
+}
+
+// checkEditState verifies that the files in a group are still in the state the
+// change left them in (undo) or the state before it (redo), so that external
+// modifications are never overwritten.
+func checkEditState(group []*EditHistory, undo bool) error {
+	var conflicts []string
+	for _, e := range group {
+		want := e.OldHash
+		if undo {
+			want = e.NewHash
+		}
+
+		content, err := os.ReadFile(e.Path)
+		switch {
+		case want == "" && err == nil:
+			conflicts = append(conflicts, e.Path+" exists but should not")
+		case want != "" && err != nil:
+			conflicts = append(conflicts, e.Path+" is missing")
+		case want != "" && !hashMatches(want, content):
+			conflicts = append(conflicts, e.Path+" was modified externally")
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("refusing to overwrite changes made since the edit: %s", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// restoreEditSide puts path into the state identified by hash; an empty hash
+// means the file should not exist. A recreated file gets mode, or 0644 for
+// edits recorded without one.
+func restoreEditSide(path, hash string, mode os.FileMode) error {
+	if hash == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	content, err := globalDB.GetBlob(hash)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+	return writeFileAtomic(path, content, mode)
+}
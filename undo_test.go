@@ -0,0 +1,163 @@
+// undo_test.go - Undo and redo of change groups, and refusal to overwrite external edits
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// writeTestChange writes a file and records it as a tool change in group;
+// empty content deletes the file
+func writeTestChange(t *testing.T, group, path, content string) {
+	t.Helper()
+	old, err := os.ReadFile(path)
+	if err != nil {
+		old = nil
+	}
+	if content == "" {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		recordFileChange("test", group, path, 0644, old, nil)
+		return
+	}
+	writeTestFile(t, path, content)
+	recordFileChange("test", group, path, 0, old, []byte(content))
+}
+
+func TestUndoRedoChangeGroups(t *testing.T) {
+	for _, backend := range []string{StorageFile, StorageSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			dbDir := t.TempDir()
+			pdb := openTestDatabase(t, backend, dbDir)
+			useTestDatabase(t, pdb)
+
+			writeTestChange(t, "g1", "a.txt", "one\n")
+			if _, err := applyTestPatch(t, `--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-one
++two
+--- /dev/null
++++ b/b.txt
+@@ -0,0 +1 @@
++new
+`); err != nil {
+				t.Fatal(err)
+			}
+
+			// The patch is one change: both files are reverted together
+			report, err := UndoChanges(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Count(report, "undid") != 2 {
+				t.Fatalf("undo report:\n%s", report)
+			}
+			checkTestFile(t, "a.txt", "one\n")
+			checkTestFileMissing(t, "b.txt")
+
+			if _, err := UndoChanges(1); err != nil {
+				t.Fatal(err)
+			}
+			checkTestFileMissing(t, "a.txt")
+			if report, err := UndoChanges(1); err != nil || report != "Nothing to undo" {
+				t.Fatalf("undo with nothing left = %q, %v", report, err)
+			}
+
+			// The redo stack survives reopening the database
+			if err := pdb.Close(); err != nil {
+				t.Fatal(err)
+			}
+			pdb = openTestDatabase(t, backend, dbDir)
+			defer pdb.Close()
+			useTestDatabase(t, pdb)
+			if stack := pdb.LoadRedoStack(); len(stack) != 2 {
+				t.Fatalf("redo stack after reopening = %v", stack)
+			}
+
+			if _, err := RedoChanges(1); err != nil {
+				t.Fatal(err)
+			}
+			checkTestFile(t, "a.txt", "one\n")
+			checkTestFileMissing(t, "b.txt")
+			if _, err := RedoChanges(1); err != nil {
+				t.Fatal(err)
+			}
+			checkTestFile(t, "a.txt", "two\n")
+			checkTestFile(t, "b.txt", "new\n")
+			if report, err := RedoChanges(1); err != nil || report != "Nothing to redo" {
+				t.Fatalf("redo with nothing left = %q, %v", report, err)
+			}
+
+			// A new change discards what was waiting to be redone
+			if _, err := UndoChanges(1); err != nil {
+				t.Fatal(err)
+			}
+			writeTestChange(t, "g3", "c.txt", "other\n")
+			if report, err := RedoChanges(1); err != nil || report != "Nothing to redo" {
+				t.Fatalf("redo after a new change = %q, %v", report, err)
+			}
+		})
+	}
+}
+
+func TestUndoRefusesExternalEdits(t *testing.T) {
+	t.Chdir(t.TempDir())
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	useTestDatabase(t, pdb)
+
+	writeTestChange(t, "g1", "a.txt", "one\n")
+	writeTestChange(t, "g2", "a.txt", "two\n")
+	writeTestFile(t, "a.txt", "edited by hand\n")
+
+	if _, err := UndoChanges(1); err == nil || !strings.Contains(err.Error(), "a.txt was modified externally") {
+		t.Fatalf("undo over an external edit = %v", err)
+	}
+	checkTestFile(t, "a.txt", "edited by hand\n")
+
+	// Once the file is back in the state the change left it in, undo works
+	writeTestFile(t, "a.txt", "two\n")
+	if _, err := UndoChanges(1); err != nil {
+		t.Fatal(err)
+	}
+	checkTestFile(t, "a.txt", "one\n")
+
+	// Redo is refused the same way
+	writeTestFile(t, "a.txt", "edited again\n")
+	if _, err := RedoChanges(1); err == nil || !strings.Contains(err.Error(), "modified externally") {
+		t.Fatalf("redo over an external edit = %v", err)
+	}
+	checkTestFile(t, "a.txt", "edited again\n")
+	if stack := pdb.LoadRedoStack(); len(stack) != 1 {
+		t.Fatalf("refused redo changed the redo stack: %v", stack)
+	}
+}
+
+func TestUndoStopsAtConflictingGroup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	pdb := openTestDatabase(t, StorageFile, t.TempDir())
+	defer pdb.Close()
+	useTestDatabase(t, pdb)
+
+	writeTestChange(t, "g1", "a.txt", "one\n")
+	writeTestChange(t, "g2", "b.txt", "two\n")
+	writeTestChange(t, "g2", "a.txt", "")
+	writeTestFile(t, "a.txt", "recreated by hand\n")
+	writeTestChange(t, "g3", "c.txt", "three\n")
+
+	// The newest group is undone; the conflict stops undo before g2
+	report, err := UndoChanges(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report, "undid create of c.txt") || !strings.Contains(report, "stopped:") || !strings.Contains(report, "a.txt exists but should not") {
+		t.Fatalf("undo report:\n%s", report)
+	}
+	checkTestFileMissing(t, "c.txt")
+	checkTestFile(t, "b.txt", "two\n")
+	checkTestFile(t, "a.txt", "recreated by hand\n")
+}